@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wolzey/taskboard/internal/alerts"
+	"github.com/wolzey/taskboard/internal/config"
+)
+
+var alertsCmd = &cobra.Command{
+	Use:   "alerts",
+	Short: "Manage alerting",
+}
+
+var alertsTestCmd = &cobra.Command{
+	Use:   "test [notifier...]",
+	Short: "Sends a test notification to the configured notifiers, all of them by default",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		for _, name := range args {
+			if !slices.ContainsFunc(cfg.Alerts.Notifiers, func(n alerts.NotifierConfig) bool { return n.Name == name }) {
+				return fmt.Errorf("unknown notifier %q", name)
+			}
+		}
+
+		failed := 0
+
+		for _, notifierCfg := range cfg.Alerts.Notifiers {
+			if len(args) > 0 && !slices.Contains(args, notifierCfg.Name) {
+				continue
+			}
+
+			notifier, err := alerts.NewNotifier(notifierCfg)
+			if err != nil {
+				return err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+			err = notifier.Notify(ctx, alerts.TestNotification())
+			cancel()
+
+			if err != nil {
+				failed++
+				fmt.Fprintf(cmd.OutOrStdout(), "%s\tfailed: %v\n", notifierCfg.Name, err)
+				continue
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "%s\tsent\n", notifierCfg.Name)
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d notifiers failed", failed)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	alertsCmd.AddCommand(alertsTestCmd)
+	rootCmd.AddCommand(alertsCmd)
+}
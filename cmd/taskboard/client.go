@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wolzey/taskboard/internal/app"
+	"github.com/wolzey/taskboard/internal/config"
+	"github.com/wolzey/taskboard/internal/db"
+)
+
+// loadApp connects to Redis using the same configuration as serve, without starting the API.
+// It is used by commands that talk to Redis directly.
+func loadApp() (*app.App, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	return newApp(cfg)
+}
+
+func newApp(cfg *config.Config) (*app.App, error) {
+	redisOpts, err := cfg.Redis.ToRedisOptions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Redis options: %w", err)
+	}
+
+	client, err := db.NewClient(redisOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &app.App{Services: &app.Services{
+		Redis:       client,
+		QueuePrefix: cfg.Queue.Prefix,
+		ExportMask:  cfg.Export.Mask,
+	}}, nil
+}
+
+// backend runs the operations of the client commands, against Redis or the API of a taskboard server
+type backend interface {
+	ListQueues(ctx context.Context) ([]string, error)
+	GetQueueCounts(ctx context.Context, queue string) (map[string]int64, error)
+	GetOverview(ctx context.Context) (map[string]map[string]int64, error)
+	ListJobs(ctx context.Context, queue string, state string, opts app.ListJobsOptions) (*app.ListJobsResponse, error)
+	GetJob(ctx context.Context, queue string, id string) (*app.ParsedJobResponse, error)
+	PromoteJob(ctx context.Context, queue string, id string, fromState string) (*app.PromoteJobResponse, error)
+	DeleteJob(ctx context.Context, queue string, id string) (*app.DeleteJobResponse, error)
+	Close() error
+}
+
+// loadBackend calls the server given by --server or client.server when set, Redis otherwise
+func loadBackend() (backend, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	server := clientOpts.server
+	if server == "" {
+		server = cfg.Client.Server
+	}
+
+	if server != "" {
+		base, err := url.Parse(strings.TrimSuffix(server, "/"))
+		if err != nil || base.Scheme == "" || base.Host == "" {
+			return nil, fmt.Errorf("invalid server %q: must be a URL such as http://localhost:1337", server)
+		}
+
+		tlsConfig, err := cfg.Client.TLS.ToTLSConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to build TLS config: %w", err)
+		}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+
+		return &httpBackend{base: base, client: &http.Client{Timeout: 30 * time.Second, Transport: transport}}, nil
+	}
+
+	a, err := newApp(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &appBackend{a}, nil
+}
+
+// appBackend reads Redis directly
+type appBackend struct {
+	*app.App
+}
+
+func (b *appBackend) GetJob(ctx context.Context, queue string, id string) (*app.ParsedJobResponse, error) {
+	return b.GetJobDetails(ctx, queue, id)
+}
+
+func (b *appBackend) Close() error {
+	return b.Redis.Close()
+}
+
+// httpBackend calls the API of a taskboard server
+type httpBackend struct {
+	base   *url.URL
+	client *http.Client
+}
+
+func (b *httpBackend) ListQueues(ctx context.Context) ([]string, error) {
+	var res app.QueuesResponse
+	if err := b.call(ctx, http.MethodGet, nil, nil, &res, "queues"); err != nil {
+		return nil, err
+	}
+
+	return res.Queues, nil
+}
+
+func (b *httpBackend) GetQueueCounts(ctx context.Context, queue string) (map[string]int64, error) {
+	var res app.CountsResponse
+	if err := b.call(ctx, http.MethodGet, nil, nil, &res, "queues", queue); err != nil {
+		return nil, err
+	}
+
+	return res.Counts, nil
+}
+
+func (b *httpBackend) GetOverview(ctx context.Context) (map[string]map[string]int64, error) {
+	var res map[string]map[string]int64
+	if err := b.call(ctx, http.MethodGet, nil, nil, &res, "overview"); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (b *httpBackend) ListJobs(ctx context.Context, queue string, state string, opts app.ListJobsOptions) (*app.ListJobsResponse, error) {
+	query := url.Values{}
+
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+
+	for key, value := range map[string]string{"order": opts.Order, "cursor": opts.Cursor, "filter": opts.Filter} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	if opts.From != nil {
+		query.Set("from", strconv.FormatInt(*opts.From, 10))
+	}
+
+	if opts.To != nil {
+		query.Set("to", strconv.FormatInt(*opts.To, 10))
+	}
+
+	if opts.Count {
+		query.Set("count", "true")
+	}
+
+	var res app.ListJobsResponse
+	if err := b.call(ctx, http.MethodGet, query, nil, &res, "queues", queue, "jobs", state); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+func (b *httpBackend) GetJob(ctx context.Context, queue string, id string) (*app.ParsedJobResponse, error) {
+	var res app.ParsedJobResponse
+	if err := b.call(ctx, http.MethodGet, nil, nil, &res, "queues", queue, id); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+func (b *httpBackend) PromoteJob(ctx context.Context, queue string, id string, fromState string) (*app.PromoteJobResponse, error) {
+	var res app.PromoteJobResponse
+	if err := b.call(ctx, http.MethodPost, nil, app.PromoteJobRequest{FromState: fromState}, &res, "queues", queue, id, "promote"); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+func (b *httpBackend) DeleteJob(ctx context.Context, queue string, id string) (*app.DeleteJobResponse, error) {
+	var res app.DeleteJobResponse
+	if err := b.call(ctx, http.MethodDelete, nil, nil, &res, "queues", queue, id); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+func (b *httpBackend) Close() error {
+	b.client.CloseIdleConnections()
+	return nil
+}
+
+// call sends a request to the API path made of the escaped segments and decodes the response into out.
+// Error responses are returned as errors holding their message.
+func (b *httpBackend) call(ctx context.Context, method string, query url.Values, body any, out any, segments ...string) error {
+	escaped := make([]string, len(segments))
+	for i, segment := range segments {
+		escaped[i] = url.PathEscape(segment)
+	}
+
+	target := b.base.String() + "/api/" + strings.Join(escaped, "/")
+
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read the response of %s: %w", target, err)
+	}
+
+	if res.StatusCode >= 400 {
+		var failure struct {
+			Message   string `json:"message"`
+			RequestID string `json:"request_id"`
+		}
+
+		if json.Unmarshal(data, &failure) == nil && failure.Message != "" {
+			// The request id finds the logs of the request on the server
+			if failure.RequestID != "" {
+				return fmt.Errorf("%s: %s (request %s)", res.Status, failure.Message, failure.RequestID)
+			}
+
+			return fmt.Errorf("%s: %s", res.Status, failure.Message)
+		}
+
+		return fmt.Errorf("%s responded %s", target, res.Status)
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode the response of %s: %w", target, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/wolzey/taskboard/internal/config"
+	"go.yaml.in/yaml/v3"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the configuration",
+}
+
+var configValidateOpts struct {
+	redis bool
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Checks the configuration and reports every problem with where its value comes from",
+	Long: `Checks the configuration and reports every problem with where its value comes from:
+the config file, an environment variable or the default. Files the configuration points to
+must be readable. With --redis, the connection to Redis is tested too.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.OutOrStdout()
+
+		cfg, err := config.ReadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		if file := viper.ConfigFileUsed(); file != "" {
+			fmt.Fprintf(out, "config file: %s\n", file)
+		} else {
+			fmt.Fprintln(out, "config file: none, using the defaults and environment variables")
+		}
+
+		problems := cfg.Validate()
+
+		for _, p := range problems {
+			fmt.Fprintf(out, "  %s\n", p)
+		}
+
+		failed := len(problems)
+
+		if configValidateOpts.redis {
+			if err := pingRedis(cfg); err != nil {
+				fmt.Fprintf(out, "redis %s:%d: %v\n", cfg.Redis.Host, cfg.Redis.Port, err)
+				failed++
+			} else {
+				fmt.Fprintf(out, "redis %s:%d: connected\n", cfg.Redis.Host, cfg.Redis.Port)
+			}
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d problems found", failed)
+		}
+
+		fmt.Fprintln(out, "configuration is valid")
+		return nil
+	},
+}
+
+// pingRedis connects to Redis with the configuration, without loading the scripts
+func pingRedis(cfg *config.Config) error {
+	opts, err := cfg.Redis.ToRedisOptions()
+	if err != nil {
+		return err
+	}
+
+	client := redis.NewClient(opts)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return client.Ping(ctx).Err()
+}
+
+var configShowOpts struct {
+	redact bool
+	format string
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Prints the effective configuration, merged from the defaults, the config file and the environment",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := config.ReadConfig(); err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		settings := config.Settings(configShowOpts.redact)
+
+		switch configShowOpts.format {
+		case formatYAML:
+			encoder := yaml.NewEncoder(cmd.OutOrStdout())
+			encoder.SetIndent(2)
+			if err := encoder.Encode(settings); err != nil {
+				return err
+			}
+
+			return encoder.Close()
+		case formatJSON:
+			encoder := json.NewEncoder(cmd.OutOrStdout())
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(settings)
+		}
+
+		return fmt.Errorf("invalid format %q: must be yaml or json", configShowOpts.format)
+	},
+}
+
+func init() {
+	configValidateCmd.Flags().BoolVar(&configValidateOpts.redis, "redis", false, "also test the connection to Redis")
+	configShowCmd.Flags().BoolVar(&configShowOpts.redact, "redact", false, "mask passwords, header values and the paths of URLs")
+	configShowCmd.Flags().StringVar(&configShowOpts.format, "format", formatYAML, "output format: yaml or json")
+
+	configCmd.AddCommand(configValidateCmd, configShowCmd)
+	rootCmd.AddCommand(configCmd)
+}
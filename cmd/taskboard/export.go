@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/signal"
+
+	"github.com/spf13/cobra"
+	"github.com/wolzey/taskboard/internal/app"
+)
+
+var exportOpts struct {
+	format string
+	fields []string
+	query  string
+	output string
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export <queue> <state>",
+	Short: "Exports the jobs of a state as NDJSON or CSV",
+	Long: `Exports every job of a state, or those matching --query, as NDJSON or CSV.
+Without --fields, CSV columns are the common job fields followed by the data and
+opts fields of every job, which are read once before the rows are written.
+Fields listed under export.mask in the configuration are masked.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		a, err := loadApp()
+		if err != nil {
+			return err
+		}
+		defer a.Redis.Close()
+
+		export, err := a.NewJobExport(args[0], args[1], app.ExportOptions{
+			Format: exportOpts.format,
+			Fields: exportOpts.fields,
+			Query:  exportOpts.query,
+		})
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+
+		if exportOpts.output != "" && exportOpts.output != "-" {
+			file, err := os.Create(exportOpts.output)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			out = file
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		w := bufio.NewWriter(out)
+
+		if err := export.Write(ctx, w); err != nil {
+			return err
+		}
+
+		return w.Flush()
+	},
+}
+
+func init() {
+	exportCmd.Flags().StringVar(&exportOpts.format, "format", "ndjson", "output format: ndjson or csv")
+	exportCmd.Flags().StringSliceVar(&exportOpts.fields, "fields", nil, "fields or paths to export, e.g. id,name,data.user.id")
+	exportCmd.Flags().StringVarP(&exportOpts.query, "query", "q", "", "only export jobs matching a search query")
+	exportCmd.Flags().StringVarP(&exportOpts.output, "output", "o", "", "file to write to instead of stdout")
+
+	rootCmd.AddCommand(exportCmd)
+}
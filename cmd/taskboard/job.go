@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wolzey/taskboard/internal/app"
+)
+
+var jobCmd = &cobra.Command{
+	Use:   "job",
+	Short: "Inspect and manage a single job",
+}
+
+var jobLogsOpts struct {
+	follow   bool
+	interval time.Duration
+	search   string
+	limit    int64
+	index    bool
+}
+
+var jobLogsCmd = &cobra.Command{
+	Use:   "logs <queue> <id>",
+	Short: "Prints the logs written by a job",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		queue, id := args[0], args[1]
+
+		a, err := loadApp()
+		if err != nil {
+			return err
+		}
+		defer a.Redis.Close()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		opts := app.JobLogsOptions{
+			After:  -1,
+			Limit:  jobLogsOpts.limit,
+			Search: jobLogsOpts.search,
+		}
+
+		for {
+			// Drain everything available before sleeping, a page is capped by the server
+			for {
+				res, err := a.GetJobLogs(ctx, queue, id, opts)
+				if err != nil {
+					if errors.Is(err, context.Canceled) {
+						return nil
+					}
+					return fmt.Errorf("failed to read logs for job %s: %w", id, err)
+				}
+
+				for _, line := range res.Lines {
+					if jobLogsOpts.index {
+						fmt.Fprintf(cmd.OutOrStdout(), "%d\t%s\n", line.Index, line.Line)
+					} else {
+						fmt.Fprintln(cmd.OutOrStdout(), line.Line)
+					}
+				}
+
+				opts.After = res.LastIndex
+
+				if len(res.Lines) == 0 || int64(len(res.Lines)) >= res.Matched {
+					break
+				}
+			}
+
+			if !jobLogsOpts.follow {
+				return nil
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(jobLogsOpts.interval):
+			}
+		}
+	},
+}
+
+var jobGetCmd = &cobra.Command{
+	Use:   "get <queue> <id>",
+	Short: "Prints the details of a job",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := loadBackend()
+		if err != nil {
+			return err
+		}
+		defer b.Close()
+
+		job, err := b.GetJob(context.Background(), args[0], args[1])
+		if err != nil {
+			return err
+		}
+
+		return printResult(cmd.OutOrStdout(), job, func(w *tabwriter.Writer) {
+			data, _ := json.Marshal(job.Data)
+			options, _ := json.Marshal(job.Options)
+
+			processed := "-"
+			if job.ProcessedOn > 0 {
+				processed = formatMillis(&job.ProcessedOn)
+			}
+
+			fmt.Fprintf(w, "ID\t%s\n", args[1])
+			fmt.Fprintf(w, "NAME\t%s\n", job.Name)
+			fmt.Fprintf(w, "CREATED\t%s\n", formatTimestamp(job.Timestamp))
+			fmt.Fprintf(w, "PROCESSED\t%s\n", processed)
+			fmt.Fprintf(w, "ATTEMPTS\t%d\n", job.AttemptsMade)
+			fmt.Fprintf(w, "PRIORITY\t%d\n", job.Priority)
+			fmt.Fprintf(w, "DELAY\t%d\n", job.Delay)
+			fmt.Fprintf(w, "DATA\t%s\n", data)
+			fmt.Fprintf(w, "OPTIONS\t%s\n", options)
+			fmt.Fprintf(w, "FAILED REASON\t%s\n", valueOr(job.FailedReason, "-"))
+
+			// The stack of the last attempt is printed below the table, it spans many lines
+			if len(job.StackTrace) > 0 {
+				fmt.Fprintf(w, "\n%s\n", job.StackTrace[len(job.StackTrace)-1])
+			}
+		})
+	},
+}
+
+var jobPromoteFrom string
+
+var jobPromoteCmd = &cobra.Command{
+	Use:   "promote <queue> <id>",
+	Short: "Moves a delayed, failed, completed or waiting-children job to wait",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := loadBackend()
+		if err != nil {
+			return err
+		}
+		defer b.Close()
+
+		res, err := b.PromoteJob(context.Background(), args[0], args[1], jobPromoteFrom)
+		if err != nil {
+			return err
+		}
+
+		return printJobAction(cmd, res.Success, res.Message, res)
+	},
+}
+
+var jobDeleteCmd = &cobra.Command{
+	Use:   "delete <queue> <id>",
+	Short: "Deletes a job and its logs",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := loadBackend()
+		if err != nil {
+			return err
+		}
+		defer b.Close()
+
+		res, err := b.DeleteJob(context.Background(), args[0], args[1])
+		if err != nil {
+			return err
+		}
+
+		return printJobAction(cmd, res.Success, res.Message, res)
+	},
+}
+
+// printJobAction prints the response of an action on a job, unsuccessful actions fail the command
+func printJobAction(cmd *cobra.Command, success bool, message string, res any) error {
+	if !success {
+		return fmt.Errorf("%s", message)
+	}
+
+	return printResult(cmd.OutOrStdout(), res, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, message)
+	})
+}
+
+func init() {
+	jobPromoteCmd.Flags().StringVar(&jobPromoteFrom, "from", "delayed", "state the job is promoted from: delayed, failed, completed or waiting-children")
+
+	for _, cmd := range []*cobra.Command{jobGetCmd, jobPromoteCmd, jobDeleteCmd} {
+		addClientFlags(cmd)
+		jobCmd.AddCommand(cmd)
+	}
+
+	jobLogsCmd.Flags().BoolVarP(&jobLogsOpts.follow, "follow", "f", false, "keep polling for new log lines")
+	jobLogsCmd.Flags().DurationVar(&jobLogsOpts.interval, "interval", time.Second, "how often to poll for new lines when following")
+	jobLogsCmd.Flags().StringVarP(&jobLogsOpts.search, "search", "s", "", "only print lines containing this text (case-insensitive)")
+	jobLogsCmd.Flags().Int64Var(&jobLogsOpts.limit, "limit", 1000, "number of lines fetched per request")
+	jobLogsCmd.Flags().BoolVar(&jobLogsOpts.index, "index", false, "prefix each line with its index in the log list")
+
+	jobCmd.AddCommand(jobLogsCmd)
+	rootCmd.AddCommand(jobCmd)
+}
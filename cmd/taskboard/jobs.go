@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wolzey/taskboard/internal/app"
+	"github.com/wolzey/taskboard/internal/query"
+)
+
+var jobsCmd = &cobra.Command{
+	Use:   "jobs",
+	Short: "Inspect the jobs of a queue",
+}
+
+var jobsListOpts struct {
+	limit  int
+	order  string
+	from   string
+	to     string
+	cursor string
+	filter string
+	count  bool
+}
+
+var jobsListCmd = &cobra.Command{
+	Use:   "ls <queue> <state>",
+	Short: "Lists a page of the jobs of a state",
+	Long: `Lists a page of the jobs of a state, newest first unless --order is asc.
+The cursor of the next page is printed after the table, pass it to --cursor to continue.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := app.ListJobsOptions{
+			Limit:  jobsListOpts.limit,
+			Order:  jobsListOpts.order,
+			Cursor: jobsListOpts.cursor,
+			Filter: jobsListOpts.filter,
+			Count:  jobsListOpts.count,
+		}
+
+		var err error
+
+		if opts.From, err = parseTimeFlag("from", jobsListOpts.from); err != nil {
+			return err
+		}
+
+		if opts.To, err = parseTimeFlag("to", jobsListOpts.to); err != nil {
+			return err
+		}
+
+		b, err := loadBackend()
+		if err != nil {
+			return err
+		}
+		defer b.Close()
+
+		res, err := b.ListJobs(context.Background(), args[0], args[1], opts)
+		if err != nil {
+			return err
+		}
+
+		return printResult(cmd.OutOrStdout(), res, func(w *tabwriter.Writer) {
+			fmt.Fprintln(w, "ID\tNAME\tATTEMPTS\tCREATED\tPROCESSED\tFAILED REASON")
+
+			for _, job := range res.Results {
+				processed := "-"
+				if job.ProcessedOn > 0 {
+					processed = formatMillis(&job.ProcessedOn)
+				}
+
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", job.ID, job.Name, job.AttemptsMade, formatTimestamp(job.Timestamp), processed, valueOr(job.FailedReason, "-"))
+			}
+
+			about := ""
+			if res.Estimated {
+				about = "about "
+			}
+
+			fmt.Fprintf(w, "\n%d of %s%d jobs", len(res.Results), about, res.Count)
+			if res.Next != "" {
+				fmt.Fprintf(w, ", next page: --cursor %s", res.Next)
+			}
+			fmt.Fprintln(w)
+		})
+	},
+}
+
+// parseTimeFlag parses the time flags of the client commands into unix milliseconds, nil when empty
+func parseTimeFlag(name string, value string) (*int64, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	if millis, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return &millis, nil
+	}
+
+	millis, ok := query.ParseTime(value, time.Now())
+	if !ok {
+		return nil, fmt.Errorf("invalid --%s %q: must be unix milliseconds, a relative duration such as -6h, now, a date or an RFC 3339 time", name, value)
+	}
+
+	return &millis, nil
+}
+
+func init() {
+	jobsListCmd.Flags().IntVarP(&jobsListOpts.limit, "limit", "n", 25, "number of jobs per page")
+	jobsListCmd.Flags().StringVar(&jobsListOpts.order, "order", "desc", "order of the jobs: asc or desc")
+	jobsListCmd.Flags().StringVar(&jobsListOpts.from, "from", "", "only list jobs finished, or due when delayed, after this time")
+	jobsListCmd.Flags().StringVar(&jobsListOpts.to, "to", "", "only list jobs finished, or due when delayed, before this time")
+	jobsListCmd.Flags().StringVar(&jobsListOpts.cursor, "cursor", "", "cursor of the page to list, printed with the previous page")
+	jobsListCmd.Flags().StringVarP(&jobsListOpts.filter, "filter", "f", "", "only list jobs whose data contains this text")
+	jobsListCmd.Flags().BoolVar(&jobsListOpts.count, "count", false, "count every job matching --filter instead of estimating it")
+	addClientFlags(jobsListCmd)
+
+	jobsCmd.AddCommand(jobsListCmd)
+	rootCmd.AddCommand(jobsCmd)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/wolzey/taskboard/internal/app"
+)
+
+var openapiCmd = &cobra.Command{
+	Use:   "openapi",
+	Short: "Prints the OpenAPI specification of the API",
+	Long: `Prints the OpenAPI 3.1 specification of the API, built from its routes. serve also
+serves it at /api/openapi.json. Redis and the configuration are not needed.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		spec, err := app.OpenAPI()
+		if err != nil {
+			return err
+		}
+
+		_, err = cmd.OutOrStdout().Write(spec)
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(openapiCmd)
+}
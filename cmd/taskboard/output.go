@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.yaml.in/yaml/v3"
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatYAML  = "yaml"
+)
+
+// clientOpts are the flags shared by the commands that inspect queues
+var clientOpts struct {
+	server string
+	format string
+}
+
+func addClientFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&clientOpts.server, "server", "", "URL of a taskboard server to call instead of connecting to Redis, overrides client.server")
+	cmd.Flags().StringVar(&clientOpts.format, "format", formatTable, "output format: table, json or yaml")
+
+	// The format is checked before running, actions must not run when their result can't be printed
+	cmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+		if !slices.Contains([]string{formatTable, formatJSON, formatYAML}, clientOpts.format) {
+			return fmt.Errorf("invalid format %q: must be table, json or yaml", clientOpts.format)
+		}
+
+		return nil
+	}
+}
+
+// printResult writes v as JSON or YAML, with the field names of the API, or calls table to print it as a table
+func printResult(w io.Writer, v any, table func(w *tabwriter.Writer)) error {
+	switch clientOpts.format {
+	case formatTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		table(tw)
+		return tw.Flush()
+	case formatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	case formatYAML:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		// JSON is YAML, decoding it into a node keeps the order of the fields
+		var node yaml.Node
+		if err := yaml.Unmarshal(encoded, &node); err != nil {
+			return err
+		}
+
+		blockStyle(&node)
+
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(&node); err != nil {
+			return err
+		}
+
+		return encoder.Close()
+	}
+
+	return fmt.Errorf("invalid format %q: must be table, json or yaml", clientOpts.format)
+}
+
+// blockStyle clears the flow style and quotes of a node decoded from JSON
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// formatTimestamp formats the unix milliseconds BullMQ stores, which may be written as floats
+func formatTimestamp(value string) string {
+	millis, err := strconv.ParseFloat(value, 64)
+
+	if err != nil || millis <= 0 {
+		return "-"
+	}
+
+	return time.UnixMilli(int64(millis)).Format(time.RFC3339)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/wolzey/taskboard/internal/app"
+)
+
+// countColumns are the states counts are printed for, in the order jobs go through them
+var countColumns = []string{"wait", "delayed", "active", "completed", "failed"}
+
+var queuesCmd = &cobra.Command{
+	Use:     "queues",
+	Aliases: []string{"queue"},
+	Short:   "Inspect queues",
+}
+
+var queuesListCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "Lists the queues",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := loadBackend()
+		if err != nil {
+			return err
+		}
+		defer b.Close()
+
+		queues, err := b.ListQueues(context.Background())
+		if err != nil {
+			return err
+		}
+
+		return printResult(cmd.OutOrStdout(), app.QueuesResponse{Queues: queues, Count: len(queues)}, func(w *tabwriter.Writer) {
+			fmt.Fprintln(w, "NAME")
+
+			for _, queue := range queues {
+				fmt.Fprintln(w, queue)
+			}
+		})
+	},
+}
+
+var countsCmd = &cobra.Command{
+	Use:   "counts <queue>",
+	Short: "Prints the number of jobs of a queue in each state",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := loadBackend()
+		if err != nil {
+			return err
+		}
+		defer b.Close()
+
+		counts, err := b.GetQueueCounts(context.Background(), args[0])
+		if err != nil {
+			return err
+		}
+
+		return printResult(cmd.OutOrStdout(), app.CountsResponse{Counts: counts}, func(w *tabwriter.Writer) {
+			fmt.Fprintln(w, "STATE\tCOUNT")
+
+			for _, state := range countColumns {
+				fmt.Fprintf(w, "%s\t%d\n", state, counts[state])
+			}
+		})
+	},
+}
+
+var overviewCmd = &cobra.Command{
+	Use:   "overview",
+	Short: "Prints the number of jobs of every queue in each state",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := loadBackend()
+		if err != nil {
+			return err
+		}
+		defer b.Close()
+
+		overview, err := b.GetOverview(context.Background())
+		if err != nil {
+			return err
+		}
+
+		return printResult(cmd.OutOrStdout(), overview, func(w *tabwriter.Writer) {
+			fmt.Fprint(w, "QUEUE")
+			for _, state := range countColumns {
+				fmt.Fprintf(w, "\t%s", strings.ToUpper(state))
+			}
+			fmt.Fprintln(w)
+
+			for _, queue := range slices.Sorted(maps.Keys(overview)) {
+				fmt.Fprint(w, queue)
+				for _, state := range countColumns {
+					fmt.Fprintf(w, "\t%d", overview[queue][state])
+				}
+				fmt.Fprintln(w)
+			}
+		})
+	},
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{queuesListCmd, countsCmd, overviewCmd} {
+		addClientFlags(cmd)
+	}
+
+	queuesCmd.AddCommand(queuesListCmd)
+	rootCmd.AddCommand(queuesCmd)
+	rootCmd.AddCommand(countsCmd)
+	rootCmd.AddCommand(overviewCmd)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wolzey/taskboard/internal/app"
+)
+
+var schedulersCmd = &cobra.Command{
+	Use:     "schedulers",
+	Aliases: []string{"scheduler"},
+	Short:   "Manage job schedulers and repeatable jobs",
+}
+
+var schedulersListCmd = &cobra.Command{
+	Use:   "ls <queue>",
+	Short: "Lists the job schedulers of a queue",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		a, err := loadApp()
+		if err != nil {
+			return err
+		}
+		defer a.Redis.Close()
+
+		schedulers, err := a.ListJobSchedulers(context.Background(), args[0])
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tSCHEDULE\tTZ\tNEXT RUN\tLAST JOB\tSTATE")
+
+		for _, s := range schedulers {
+			lastJob := "-"
+			if s.LastJob != nil {
+				lastJob = fmt.Sprintf("%s (%s)", s.LastJob.ID, s.LastJob.State)
+			}
+
+			state := "active"
+			if s.Paused {
+				state = "paused"
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", s.ID, s.Name, formatSchedule(s), valueOr(s.TZ, "-"), formatMillis(s.NextRun), lastJob, state)
+		}
+
+		return w.Flush()
+	},
+}
+
+var schedulersNextCount int
+
+var schedulersNextCmd = &cobra.Command{
+	Use:   "next <queue> <scheduler>",
+	Short: "Prints the next run times of a job scheduler",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		a, err := loadApp()
+		if err != nil {
+			return err
+		}
+		defer a.Redis.Close()
+
+		scheduler, err := a.GetJobScheduler(context.Background(), args[0], args[1], schedulersNextCount)
+		if err != nil {
+			return err
+		}
+
+		if scheduler.Error != "" {
+			return fmt.Errorf("%s", scheduler.Error)
+		}
+
+		for _, run := range scheduler.NextRuns {
+			fmt.Fprintln(cmd.OutOrStdout(), formatMillis(&run))
+		}
+
+		return nil
+	},
+}
+
+// schedulerActionCmd builds the commands that run a single action against a scheduler
+func schedulerActionCmd(use string, short string, action func(*app.App, context.Context, string, string) (*app.SchedulerActionResponse, error)) *cobra.Command {
+	return &cobra.Command{
+		Use:   use + " <queue> <scheduler>",
+		Short: short,
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			a, err := loadApp()
+			if err != nil {
+				return err
+			}
+			defer a.Redis.Close()
+
+			res, err := action(a, context.Background(), args[0], args[1])
+			if err != nil {
+				return err
+			}
+
+			if !res.Success {
+				return fmt.Errorf("%s", res.Message)
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), res.Message)
+
+			return nil
+		},
+	}
+}
+
+func formatSchedule(s *app.JobScheduler) string {
+	if s.Pattern != "" {
+		return s.Pattern
+	}
+
+	if s.Every > 0 {
+		return "every " + (time.Duration(s.Every) * time.Millisecond).String()
+	}
+
+	return "-"
+}
+
+func formatMillis(millis *int64) string {
+	if millis == nil {
+		return "-"
+	}
+
+	return time.UnixMilli(*millis).Format(time.RFC3339)
+}
+
+func valueOr(s string, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+
+	return s
+}
+
+func init() {
+	schedulersNextCmd.Flags().IntVarP(&schedulersNextCount, "count", "n", 5, "number of run times to print")
+
+	schedulersCmd.AddCommand(schedulersListCmd)
+	schedulersCmd.AddCommand(schedulersNextCmd)
+	schedulersCmd.AddCommand(schedulerActionCmd("pause", "Pauses a job scheduler", (*app.App).PauseJobScheduler))
+	schedulersCmd.AddCommand(schedulerActionCmd("resume", "Resumes a paused job scheduler", (*app.App).ResumeJobScheduler))
+	schedulersCmd.AddCommand(schedulerActionCmd("trigger", "Adds a job from the scheduler's template that runs immediately", (*app.App).TriggerJobScheduler))
+	schedulersCmd.AddCommand(schedulerActionCmd("remove", "Removes a job scheduler and its upcoming job", (*app.App).RemoveJobScheduler))
+	rootCmd.AddCommand(schedulersCmd)
+}
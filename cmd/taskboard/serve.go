@@ -3,11 +3,23 @@ package main
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/wolzey/taskboard/internal/alerts"
 	"github.com/wolzey/taskboard/internal/api"
 	"github.com/wolzey/taskboard/internal/app"
 	"github.com/wolzey/taskboard/internal/config"
+	"github.com/wolzey/taskboard/internal/history"
+	"github.com/wolzey/taskboard/internal/index"
+	"github.com/wolzey/taskboard/internal/tracing"
 )
 
 var serveCmd = &cobra.Command{
@@ -20,28 +32,234 @@ var serveCmd = &cobra.Command{
 			return fmt.Errorf("failed to load config: %w", err)
 		}
 
-		// Convert Redis config to redis.Options
-		redisOpts, err := cfg.Redis.ToRedisOptions()
+		setLogger(cfg)
+
+		opts, err := appOptions(cfg)
 		if err != nil {
-			return fmt.Errorf("failed to create Redis options: %w", err)
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		if cfg.Tracing.Enabled {
+			shutdown, err := tracing.Setup(ctx, cfg.Tracing.ToTracingOptions())
+			if err != nil {
+				return fmt.Errorf("failed to set up tracing: %w", err)
+			}
+
+			// The spans not exported yet are sent before exiting
+			defer func() {
+				flushCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+				defer cancel()
+
+				if err := shutdown(flushCtx); err != nil {
+					slog.Error("unable to export the last spans", "error", err)
+				}
+			}()
 		}
 
-		a := app.NewApp(&app.AppOptions{
-			RedisOpts: redisOpts,
-			ApiOptions: &api.ApiOptions{
-				Port: cfg.API.Port,
-			},
-			QueuePrefix: cfg.Queue.Prefix,
+		a := app.NewApp(opts)
+		a.Start(ctx)
+
+		// mu serializes the reloads of the config file and of the credential files
+		var mu sync.Mutex
+		current := cfg
+		credentials := watchCredentials(ctx, a, cfg, &mu)
+
+		err = config.Watch(func(next *config.Config, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if applied := reload(a, current, next, err); applied != current {
+				current = applied
+				credentials()
+				credentials = watchCredentials(ctx, a, current, &mu)
+			}
 		})
+		if err != nil {
+			slog.Info("configuration changes need a restart", "reason", err)
+		}
+
+		go func() {
+			<-ctx.Done()
+			slog.Info("shutting down")
 
-		a.Api.Serve(context.Background())
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+
+			if err := a.Api.Shutdown(shutdownCtx); err != nil {
+				slog.Warn("requests in flight were interrupted", "error", err)
+			}
+		}()
+
+		a.Api.Serve(ctx)
 
 		return nil
 	},
 }
 
-func init() {
-	rootCmd.AddCommand(serveCmd)
+// shutdownTimeout bounds how long serve waits for the requests in flight and the export of spans when stopped
+const shutdownTimeout = 10 * time.Second
+
+// logLevel is the level of the logs of serve, it changes with the configuration
+var logLevel slog.LevelVar
+
+// setLogger logs with the level and format of the configuration, which has been validated
+func setLogger(cfg *config.Config) {
+	level, _ := cfg.Log.SlogLevel()
+	logLevel.Set(level)
+
+	handler, _ := cfg.Log.Handler(os.Stderr, &logLevel)
+	slog.SetDefault(slog.New(handler))
+}
+
+// appOptions maps the configuration to the options of the app
+func appOptions(cfg *config.Config) (*app.AppOptions, error) {
+	// Convert Redis config to redis.Options
+	redisOpts, err := cfg.Redis.ToRedisOptions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Redis options: %w", err)
+	}
+
+	tlsOpts, err := cfg.API.TLS.ToTLSOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &app.AppOptions{
+		RedisOpts: redisOpts,
+		ApiOptions: &api.ApiOptions{
+			Port:         cfg.API.Port,
+			BasePath:     cfg.API.BasePath,
+			UI:           cfg.API.UI,
+			ReadTimeout:  cfg.API.ReadTimeout,
+			WriteTimeout: cfg.API.WriteTimeout,
+			GinMode:      cfg.API.GinMode,
+			TLS:          tlsOpts,
+		},
+		QueuePrefix: cfg.Queue.Prefix,
+		ExportMask:  cfg.Export.Mask,
+	}
+
+	if cfg.Index.Enabled {
+		opts.Index = &index.Options{Fields: cfg.Index.Fields}
+	}
+
+	if cfg.History.Enabled {
+		opts.History = &history.Options{
+			Interval:       cfg.History.Interval,
+			Store:          cfg.History.Store,
+			Path:           cfg.History.Path,
+			Retention:      cfg.History.Retention,
+			RawRetention:   cfg.History.RawRetention,
+			DownsampleStep: cfg.History.DownsampleStep,
+		}
+	}
+
+	if cfg.Alerts.Enabled {
+		opts.Alerts = &alerts.Options{
+			Interval:  cfg.Alerts.Interval,
+			Rules:     cfg.Alerts.Rules,
+			Notifiers: cfg.Alerts.Notifiers,
+		}
+	}
+
+	return opts, nil
+}
+
+// restartKeys are the settings, or sections, only applied when serve starts. The files of the certificates
+// are read again when they change.
+var restartKeys = []string{
+	"api.port", "api.base_path", "api.ui",
+	"api.tls.cert_file", "api.tls.key_file", "api.tls.client_ca_file", "api.tls.client_auth",
+	"tracing",
+}
+
+// reload applies a new configuration and returns the one in effect, the current one stays when the new one
+// is invalid or can't be applied. Changes to the Redis settings connect a new client.
+func reload(a *app.App, current *config.Config, next *config.Config, err error) *config.Config {
+	if err != nil {
+		slog.Error("rejected the new configuration, keeping the current one", "error", err)
+		return current
+	}
+
+	changes := config.Diff(current, next)
+
+	// Saving a file often notifies several times
+	if len(changes) == 0 {
+		return current
+	}
+
+	reconnect := false
+
+	for _, change := range changes {
+		slog.Info("configuration changed", "key", change.Key, "old", change.Old, "new", change.New)
+
+		if slices.ContainsFunc(restartKeys, func(key string) bool {
+			return change.Key == key || strings.HasPrefix(change.Key, key+".")
+		}) {
+			slog.Warn("configuration change needs a restart", "key", change.Key)
+		}
+
+		reconnect = reconnect || strings.HasPrefix(change.Key, "redis.")
+	}
+
+	opts, err := appOptions(next)
+	if err == nil {
+		err = a.Reload(opts, reconnect)
+	}
+
+	if err != nil {
+		slog.Error("unable to apply the new configuration, keeping the current one", "error", err)
+		return current
+	}
+
+	setLogger(next)
+
+	slog.Info("configuration reloaded", "changes", len(changes), "reconnected", reconnect)
+
+	return next
 }
 
+// watchCredentials connects a new Redis client when the files holding the credentials of cfg change, so the
+// open connections stop using the previous ones. It returns a function to stop watching.
+func watchCredentials(ctx context.Context, a *app.App, cfg *config.Config, mu *sync.Mutex) context.CancelFunc {
+	ctx, cancel := context.WithCancel(ctx)
+	files := cfg.Redis.CredentialFiles()
 
+	if len(files) == 0 {
+		return cancel
+	}
+
+	err := config.WatchFiles(ctx, files, func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// The watch of replaced credentials may end after its last change was noticed
+		if ctx.Err() != nil {
+			return
+		}
+
+		opts, err := appOptions(cfg)
+		if err == nil {
+			err = a.Reload(opts, true)
+		}
+
+		if err != nil {
+			slog.Error("unable to reconnect with the new redis credentials", "error", err)
+			return
+		}
+
+		slog.Info("redis credentials changed, reconnected")
+	})
+	if err != nil {
+		slog.Warn("rotated redis credentials are only used by new connections", "reason", err)
+	}
+
+	return cancel
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/cobra"
+	"github.com/wolzey/taskboard/internal/db"
+	"github.com/wolzey/taskboard/internal/snapshot"
+)
+
+var snapshotOpts struct {
+	queue  string
+	states []string
+	output string
+}
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Writes the jobs, logs, meta and schedulers of a queue to a compressed snapshot",
+	Long: `Writes the jobs, logs, meta and job schedulers of a queue to a compressed snapshot
+which can be restored into another Redis with taskboard restore, e.g.
+
+  taskboard snapshot --queue emails --states failed,delayed > snap.tbz
+
+Flow dependencies and the events stream are not captured.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, state := range snapshotOpts.states {
+			if !slices.Contains(snapshot.States, state) {
+				return fmt.Errorf("invalid state %q: must be one of %s", state, strings.Join(snapshot.States, ", "))
+			}
+		}
+
+		var out io.Writer = cmd.OutOrStdout()
+
+		if snapshotOpts.output != "" && snapshotOpts.output != "-" {
+			file, err := os.Create(snapshotOpts.output)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			out = file
+		} else if isTerminal(os.Stdout) {
+			return fmt.Errorf("refusing to write a snapshot to a terminal, redirect the output or use --output")
+		}
+
+		a, err := loadApp()
+		if err != nil {
+			return err
+		}
+		defer a.Redis.Close()
+
+		summary, err := snapshot.Take(context.Background(), a.Redis.Client, a.QueuePrefix, snapshotOpts.queue, snapshotOpts.states, out)
+		if err != nil {
+			return err
+		}
+
+		for _, state := range snapshotOpts.states {
+			fmt.Fprintf(cmd.ErrOrStderr(), "%s: %d jobs\n", state, summary.Jobs[state])
+		}
+		fmt.Fprintf(cmd.ErrOrStderr(), "schedulers: %d\n", summary.Schedulers)
+
+		return nil
+	},
+}
+
+var restoreOpts struct {
+	into   string
+	prefix string
+	queue  string
+	remap  bool
+	dryRun bool
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <snapshot>",
+	Short: "Restores a snapshot taken with taskboard snapshot",
+	Long: `Restores a snapshot taken with taskboard snapshot, e.g.
+
+  taskboard restore --into localhost --prefix dev snap.tbz
+
+Restoring fails before writing anything when jobs of the snapshot already exist in the
+target queue, unless --remap is given to restore them under new ids.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		client, prefix, err := restoreTarget()
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+
+		if restoreOpts.prefix != "" {
+			prefix = restoreOpts.prefix
+		}
+
+		report, err := snapshot.Restore(context.Background(), client.Client, file, snapshot.RestoreOptions{
+			Prefix: prefix,
+			Queue:  restoreOpts.queue,
+			Remap:  restoreOpts.remap,
+			DryRun: restoreOpts.dryRun,
+		})
+
+		if report != nil {
+			printRestoreReport(cmd.OutOrStdout(), report)
+		}
+
+		return err
+	},
+}
+
+// restoreTarget connects to the Redis given with --into, or the configured one. Credentials
+// of the configuration are not sent to --into, they can be given in a redis:// URL instead.
+func restoreTarget() (*db.Redis, string, error) {
+	if restoreOpts.into == "" {
+		a, err := loadApp()
+		if err != nil {
+			return nil, "", err
+		}
+
+		return a.Redis, a.QueuePrefix, nil
+	}
+
+	var opts *redis.Options
+
+	if strings.Contains(restoreOpts.into, "://") {
+		parsed, err := redis.ParseURL(restoreOpts.into)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid --into: %w", err)
+		}
+
+		opts = parsed
+	} else {
+		addr := restoreOpts.into
+
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "6379")
+		}
+
+		opts = &redis.Options{Addr: addr}
+	}
+
+	client, err := db.NewClient(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return client, "", nil
+}
+
+func printRestoreReport(w io.Writer, report *snapshot.Report) {
+	verb := "restored"
+	if restoreOpts.dryRun {
+		verb = "would restore"
+	}
+
+	fmt.Fprintf(w, "snapshot of %s:%s taken %s, %s into %s\n", report.Header.Prefix, report.Header.Queue, report.Header.CreatedAt.Format("2006-01-02 15:04:05 MST"), verb, report.Target)
+
+	for _, change := range report.Meta {
+		fmt.Fprintf(w, "~ meta %s: %q -> %q\n", change.Field, change.Old, change.New)
+	}
+
+	for _, job := range report.Jobs {
+		switch {
+		case job.NewID != "":
+			fmt.Fprintf(w, "+ job %s (%s) as %s, id already taken\n", job.ID, job.State, job.NewID)
+		case job.Exists && restoreOpts.remap:
+			fmt.Fprintf(w, "+ job %s (%s) under a new id, id already taken\n", job.ID, job.State)
+		case job.Exists:
+			fmt.Fprintf(w, "! job %s (%s) already exists\n", job.ID, job.State)
+		default:
+			fmt.Fprintf(w, "+ job %s (%s)\n", job.ID, job.State)
+		}
+	}
+
+	for _, scheduler := range report.Schedulers {
+		sign := "+"
+		if scheduler.Exists {
+			sign = "~"
+		}
+
+		paused := ""
+		if scheduler.Paused {
+			paused = " (paused)"
+		}
+
+		fmt.Fprintf(w, "%s scheduler %s%s\n", sign, scheduler.ID, paused)
+	}
+
+	fmt.Fprintf(w, "%d jobs, %d already existing, %d schedulers\n", len(report.Jobs), report.Collisions(), len(report.Schedulers))
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func init() {
+	snapshotCmd.Flags().StringVar(&snapshotOpts.queue, "queue", "", "queue to snapshot")
+	snapshotCmd.Flags().StringSliceVar(&snapshotOpts.states, "states", snapshot.States, "states whose jobs are captured")
+	snapshotCmd.Flags().StringVarP(&snapshotOpts.output, "output", "o", "", "file to write to instead of stdout")
+	snapshotCmd.MarkFlagRequired("queue")
+
+	restoreCmd.Flags().StringVar(&restoreOpts.into, "into", "", "Redis to restore into, host[:port] or a redis:// URL (default the configured Redis)")
+	restoreCmd.Flags().StringVar(&restoreOpts.prefix, "prefix", "", "queue prefix to restore under (default the configured prefix, or the snapshot prefix with --into)")
+	restoreCmd.Flags().StringVar(&restoreOpts.queue, "queue", "", "queue to restore into (default the snapshot queue)")
+	restoreCmd.Flags().BoolVar(&restoreOpts.remap, "remap", false, "give jobs whose id is already taken a new id")
+	restoreCmd.Flags().BoolVar(&restoreOpts.dryRun, "dry-run", false, "only print what would be restored")
+
+	rootCmd.AddCommand(snapshotCmd)
+	rootCmd.AddCommand(restoreCmd)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+
+	"github.com/spf13/cobra"
+	"github.com/wolzey/taskboard/internal/tui"
+)
+
+var tuiCmd = &cobra.Command{
+	Use:   "tui",
+	Short: "Opens a terminal dashboard to browse queues and act on their jobs",
+	Long: `Opens a full screen terminal dashboard listing the queues with live counts.
+Queues drill down into the jobs of each state and jobs into their details, where they can be
+promoted, retried or deleted, and queues paused or resumed. The screen is refreshed from the
+events streams of the queues. It connects to Redis directly, like the other commands.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		a, err := loadApp()
+		if err != nil {
+			return err
+		}
+		defer a.Redis.Close()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		return tui.New(a).Run(ctx)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(tuiCmd)
+}
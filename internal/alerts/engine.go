@@ -0,0 +1,407 @@
+// Package alerts evaluates rules against the queues at a regular interval and notifies when they break.
+//
+// Each rule is evaluated separately for every queue it watches. An alert is pending while its condition
+// holds for less than the rule's For duration, then firing until the condition stops holding, when it
+// is resolved. Notifications are only sent when an alert fires, when it is resolved, and every repeat
+// interval while it fires, so a condition holding across evaluations is notified once.
+package alerts
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/wolzey/taskboard/internal/db"
+	"github.com/wolzey/taskboard/internal/scripts"
+)
+
+const (
+	StatePending = "pending"
+	StateFiring  = "firing"
+	// StatusResolved is the status of notifications sent when a firing alert stops
+	StatusResolved = "resolved"
+	// StatusTest is the status of notifications sent to check a notifier
+	StatusTest = "test"
+)
+
+type Options struct {
+	// Interval is how often rules are evaluated
+	Interval  time.Duration
+	Rules     []Rule
+	Notifiers []NotifierConfig
+}
+
+// Alert is a rule whose condition holds for a queue
+type Alert struct {
+	Rule  string  `json:"rule"`
+	Queue string  `json:"queue"`
+	State string  `json:"state"`
+	Value float64 `json:"value"`
+	// Since is when the condition started to hold
+	Since   time.Time  `json:"since"`
+	FiredAt *time.Time `json:"fired_at,omitempty"`
+
+	// notified is when the alert was last sent
+	notified time.Time
+}
+
+type alertKey struct {
+	rule  string
+	queue string
+}
+
+type Engine struct {
+	redis     *db.Redis
+	prefix    string
+	interval  time.Duration
+	rules     []Rule
+	notifiers map[string]Notifier
+	// history is how long counts are kept to compute increases
+	history time.Duration
+
+	mu     sync.Mutex
+	alerts map[alertKey]*Alert
+
+	// samples and clients are only used by the evaluation loop
+	samples    map[string][]countSample
+	clients    []db.ClientConn
+	clientsErr error
+}
+
+func New(client *db.Redis, queuePrefix string, opts Options) (*Engine, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = 30 * time.Second
+	}
+
+	e := &Engine{
+		redis:     client,
+		prefix:    queuePrefix,
+		interval:  opts.Interval,
+		notifiers: map[string]Notifier{},
+		alerts:    map[alertKey]*Alert{},
+		samples:   map[string][]countSample{},
+	}
+
+	for _, cfg := range opts.Notifiers {
+		if _, exists := e.notifiers[cfg.Name]; exists || cfg.Name == "" {
+			return nil, fmt.Errorf("notifier names must be unique and not empty, got %q", cfg.Name)
+		}
+
+		notifier, err := NewNotifier(cfg)
+
+		if err != nil {
+			return nil, err
+		}
+
+		e.notifiers[cfg.Name] = notifier
+	}
+
+	names := map[string]bool{}
+
+	for _, rule := range opts.Rules {
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+
+		if names[rule.Name] {
+			return nil, fmt.Errorf("rule %s: names must be unique", rule.Name)
+		}
+		names[rule.Name] = true
+
+		for _, name := range rule.Notify {
+			if _, ok := e.notifiers[name]; !ok {
+				return nil, fmt.Errorf("rule %s: unknown notifier %q", rule.Name, name)
+			}
+		}
+
+		if rule.Metric == MetricIncrease {
+			e.history = max(e.history, rule.Window+opts.Interval)
+		}
+
+		e.rules = append(e.rules, rule)
+	}
+
+	return e, nil
+}
+
+// Validate checks the rules and notifiers of opts as New does, without creating an engine
+func Validate(opts Options) error {
+	_, err := New(nil, "", opts)
+	return err
+}
+
+// Inherit takes over the alerts and the counts sampled by the engine this one replaces, so alerts aren't
+// sent again nor increases measured from scratch when the configuration changes. Alerts of rules that are
+// gone are dropped. previous must be stopped and watch the same queue prefix.
+func (e *Engine) Inherit(previous *Engine) {
+	previous.mu.Lock()
+	defer previous.mu.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for key, alert := range previous.alerts {
+		if slices.ContainsFunc(e.rules, func(r Rule) bool { return r.Name == key.rule }) {
+			inherited := *alert
+			e.alerts[key] = &inherited
+		}
+	}
+
+	if e.history > 0 {
+		for queue, samples := range previous.samples {
+			e.samples[queue] = slices.Clone(samples)
+		}
+	}
+}
+
+// Run evaluates the rules at each interval until ctx is done
+func (e *Engine) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := e.Evaluate(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "alerts: unable to evaluate rules", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Alerts returns the pending and firing alerts, by rule then queue
+func (e *Engine) Alerts() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	alerts := make([]Alert, 0, len(e.alerts))
+	for _, alert := range e.alerts {
+		alerts = append(alerts, *alert)
+	}
+
+	slices.SortFunc(alerts, func(a, b Alert) int {
+		return cmp.Or(cmp.Compare(a.Rule, b.Rule), cmp.Compare(a.Queue, b.Queue))
+	})
+
+	return alerts
+}
+
+// Evaluate measures every rule for the queues it watches and sends the notifications of the alerts
+// that fired or resolved. Rules whose metric can't be measured keep their alerts as they are.
+func (e *Engine) Evaluate(ctx context.Context, now time.Time) error {
+	queues, err := e.redis.Scripts.GetQueues(ctx, e.prefix+":")
+
+	if err != nil {
+		return err
+	}
+
+	watched := map[string][]*Rule{}
+
+	for i := range e.rules {
+		rule := &e.rules[i]
+
+		if rule.Queue != "" && rule.Queue != "*" {
+			watched[rule.Queue] = append(watched[rule.Queue], rule)
+			continue
+		}
+
+		for _, queue := range queues {
+			watched[queue] = append(watched[queue], rule)
+		}
+	}
+
+	if e.needs(MetricWorkers) {
+		e.clients, e.clientsErr = e.redis.Clients(ctx)
+	}
+
+	var notifications []pendingNotification
+	evaluated := map[alertKey]bool{}
+
+	for queue, rules := range watched {
+		for _, rule := range rules {
+			evaluated[alertKey{rule: rule.Name, queue: queue}] = true
+		}
+
+		counts, err := e.sampleCounts(ctx, queue, now)
+
+		if err != nil {
+			slog.ErrorContext(ctx, "alerts: unable to count the jobs", "queue", queue, "error", err)
+			continue
+		}
+
+		for _, rule := range rules {
+			value, known, err := e.measure(ctx, rule, queue, now, counts)
+
+			if err != nil {
+				slog.ErrorContext(ctx, "alerts: unable to evaluate rule", "rule", rule.Name, "queue", queue, "error", err)
+				continue
+			}
+
+			if !known {
+				continue
+			}
+
+			if n := e.transition(rule, queue, value, rule.holds(value), now); n != nil {
+				notifications = append(notifications, pendingNotification{rule: rule, notification: *n})
+			}
+		}
+	}
+
+	// Alerts of queues that disappeared are resolved
+	for _, alert := range e.Alerts() {
+		if evaluated[alertKey{rule: alert.Rule, queue: alert.Queue}] {
+			continue
+		}
+
+		i := slices.IndexFunc(e.rules, func(r Rule) bool { return r.Name == alert.Rule })
+
+		if n := e.transition(&e.rules[i], alert.Queue, alert.Value, false, now); n != nil {
+			notifications = append(notifications, pendingNotification{rule: &e.rules[i], notification: *n})
+		}
+	}
+
+	for _, pending := range notifications {
+		e.notify(ctx, pending.rule, pending.notification)
+	}
+
+	return nil
+}
+
+type pendingNotification struct {
+	rule         *Rule
+	notification Notification
+}
+
+func (e *Engine) needs(metric string) bool {
+	return slices.ContainsFunc(e.rules, func(r Rule) bool { return r.Metric == metric })
+}
+
+// sampleCounts counts the jobs of a queue, the counts are kept for the increase metric
+func (e *Engine) sampleCounts(ctx context.Context, queue string, now time.Time) (map[string]int64, error) {
+	if !e.needs(MetricCount) && !e.needs(MetricIncrease) {
+		return nil, nil
+	}
+
+	results, err := e.redis.Scripts.GetJobCounts(ctx, scripts.Queue{Prefix: e.prefix, Name: queue}, countStates)
+
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(countStates))
+	for i, state := range countStates {
+		counts[state] = results[i]
+	}
+
+	if e.history > 0 {
+		samples := append(e.samples[queue], countSample{time: now, counts: counts})
+
+		// Keep the newest sample older than the longest window, increases are measured from it
+		start := 0
+		for start+1 < len(samples) && !samples[start+1].time.After(now.Add(-e.history)) {
+			start++
+		}
+
+		e.samples[queue] = samples[start:]
+	}
+
+	return counts, nil
+}
+
+// transition moves the alert of a rule for a queue through its lifecycle, returning the notification
+// to send if any
+func (e *Engine) transition(rule *Rule, queue string, value float64, holds bool, now time.Time) *Notification {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	key := alertKey{rule: rule.Name, queue: queue}
+	alert, exists := e.alerts[key]
+
+	if !holds {
+		if !exists {
+			return nil
+		}
+
+		delete(e.alerts, key)
+
+		if alert.State != StateFiring {
+			return nil
+		}
+
+		n := e.notification(rule, alert, StatusResolved, value)
+		n.Resolved = &now
+
+		return &n
+	}
+
+	if !exists {
+		alert = &Alert{Rule: rule.Name, Queue: queue, State: StatePending, Since: now}
+		e.alerts[key] = alert
+	}
+
+	alert.Value = value
+
+	switch {
+	case alert.State == StatePending && now.Sub(alert.Since) >= rule.For:
+		alert.State = StateFiring
+		alert.FiredAt = &now
+	case alert.State == StateFiring && rule.RepeatInterval > 0 && now.Sub(alert.notified) >= rule.RepeatInterval:
+	default:
+		return nil
+	}
+
+	alert.notified = now
+	n := e.notification(rule, alert, StateFiring, value)
+
+	return &n
+}
+
+func (e *Engine) notification(rule *Rule, alert *Alert, status string, value float64) Notification {
+	return Notification{
+		Status:      status,
+		Rule:        rule.Name,
+		Description: rule.Description,
+		Queue:       alert.Queue,
+		Metric:      rule.Metric,
+		Measure:     rule.describe(),
+		Op:          rule.Op,
+		Threshold:   rule.Threshold,
+		Value:       value,
+		FiredAt:     *alert.FiredAt,
+	}
+}
+
+// notify sends a notification to the notifiers of its rule, failures are logged
+func (e *Engine) notify(ctx context.Context, rule *Rule, n Notification) {
+	for _, name := range rule.Notify {
+		notifyCtx, cancel := context.WithTimeout(ctx, notifyTimeout)
+
+		if err := e.notifiers[name].Notify(notifyCtx, n); err != nil {
+			slog.ErrorContext(ctx, "alerts: unable to notify", "notifier", name, "rule", rule.Name, "queue", n.Queue, "error", err)
+		}
+
+		cancel()
+	}
+}
+
+// TestNotification is sent to check notifiers are set up
+func TestNotification() Notification {
+	return Notification{
+		Status:      StatusTest,
+		Rule:        "test",
+		Description: "Test notification sent by taskboard",
+		Queue:       "-",
+		Metric:      MetricCount,
+		Measure:     "test value",
+		Op:          ">",
+		Value:       1,
+		FiredAt:     time.Now(),
+	}
+}
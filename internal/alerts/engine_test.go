@@ -0,0 +1,140 @@
+package alerts
+
+import (
+	"testing"
+	"time"
+)
+
+// step is an evaluation of a rule and the notification it should send
+type step struct {
+	after  time.Duration
+	value  float64
+	status string
+	state  string
+}
+
+func runSteps(t *testing.T, rule Rule, steps []step) {
+	t.Helper()
+
+	e := &Engine{alerts: map[alertKey]*Alert{}}
+	start := time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)
+
+	for _, s := range steps {
+		now := start.Add(s.after)
+		n := e.transition(&rule, "payments", s.value, rule.holds(s.value), now)
+
+		status := ""
+		if n != nil {
+			status = n.Status
+		}
+
+		if status != s.status {
+			t.Fatalf("at %s with %v: got notification %q, want %q", s.after, s.value, status, s.status)
+		}
+
+		state := ""
+		if alert, ok := e.alerts[alertKey{rule: rule.Name, queue: "payments"}]; ok {
+			state = alert.State
+		}
+
+		if state != s.state {
+			t.Fatalf("at %s with %v: got state %q, want %q", s.after, s.value, state, s.state)
+		}
+
+		if n != nil && n.Value != s.value {
+			t.Errorf("at %s: got value %v, want %v", s.after, n.Value, s.value)
+		}
+
+		if n != nil && n.Status == StatusResolved && (n.Resolved == nil || !n.Resolved.Equal(now)) {
+			t.Errorf("at %s: got resolved at %v, want %s", s.after, n.Resolved, now)
+		}
+	}
+}
+
+func TestTransition(t *testing.T) {
+	rule := Rule{Name: "failures", Metric: MetricCount, State: "failed", Op: ">", Threshold: 10, For: time.Minute, RepeatInterval: 10 * time.Minute}
+
+	runSteps(t, rule, []step{
+		{after: 0, value: 5},
+		{after: 30 * time.Second, value: 11, state: StatePending},
+		{after: time.Minute, value: 12, state: StatePending},
+		{after: 90 * time.Second, value: 13, status: StateFiring, state: StateFiring},
+		{after: 2 * time.Minute, value: 14, state: StateFiring},
+		{after: 11*time.Minute + 30*time.Second, value: 15, status: StateFiring, state: StateFiring},
+		{after: 12 * time.Minute, value: 16, state: StateFiring},
+		{after: 13 * time.Minute, value: 3, status: StatusResolved},
+		{after: 14 * time.Minute, value: 2},
+	})
+}
+
+func TestTransitionPendingResolvesSilently(t *testing.T) {
+	rule := Rule{Name: "failures", Metric: MetricCount, State: "failed", Op: ">", Threshold: 10, For: time.Minute}
+
+	runSteps(t, rule, []step{
+		{after: 0, value: 11, state: StatePending},
+		{after: 30 * time.Second, value: 3},
+		// The condition holds again, it must hold for a whole minute from now
+		{after: 40 * time.Second, value: 11, state: StatePending},
+		{after: 90 * time.Second, value: 11, state: StatePending},
+		{after: 100 * time.Second, value: 11, status: StateFiring, state: StateFiring},
+	})
+}
+
+func TestTransitionWithoutRepeat(t *testing.T) {
+	rule := Rule{Name: "failures", Metric: MetricCount, State: "failed", Op: ">=", Threshold: 10}
+
+	runSteps(t, rule, []step{
+		{after: 0, value: 10, status: StateFiring, state: StateFiring},
+		{after: time.Hour, value: 10, state: StateFiring},
+		{after: 24 * time.Hour, value: 20, state: StateFiring},
+		{after: 25 * time.Hour, value: 9, status: StatusResolved},
+	})
+}
+
+func TestInherit(t *testing.T) {
+	opts := Options{
+		Notifiers: []NotifierConfig{{Name: "hook", Type: NotifierWebhook, URL: "http://localhost"}},
+		Rules: []Rule{
+			{Name: "failures", Metric: MetricCount, State: "failed", Threshold: 10, Notify: []string{"hook"}},
+			{Name: "backlog", Metric: MetricCount, State: "wait", Threshold: 100, For: time.Hour, Notify: []string{"hook"}},
+		},
+	}
+
+	previous, err := New(nil, "bull", opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)
+
+	if n := previous.transition(&previous.rules[0], "payments", 20, true, start); n == nil || n.Status != StateFiring {
+		t.Fatalf("got notification %v, want the alert to fire", n)
+	}
+
+	previous.transition(&previous.rules[1], "payments", 200, true, start)
+
+	// The backlog rule is removed
+	opts.Rules = opts.Rules[:1]
+	e, err := New(nil, "bull", opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e.Inherit(previous)
+
+	alerts := e.Alerts()
+
+	if len(alerts) != 1 || alerts[0].Rule != "failures" || alerts[0].State != StateFiring || !alerts[0].Since.Equal(start) {
+		t.Fatalf("got alerts %+v, want the firing alert of the failures rule", alerts)
+	}
+
+	if n := e.transition(&e.rules[0], "payments", 20, true, start.Add(time.Minute)); n != nil {
+		t.Errorf("got notification %+v, want the inherited alert not to fire again", n)
+	}
+
+	if n := e.transition(&e.rules[0], "payments", 1, false, start.Add(2*time.Minute)); n == nil || n.Status != StatusResolved {
+		t.Errorf("got notification %v, want the inherited alert to resolve", n)
+	}
+}
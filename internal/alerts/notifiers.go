@@ -0,0 +1,263 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	NotifierWebhook = "webhook"
+	NotifierSlack   = "slack"
+	NotifierSMTP    = "smtp"
+
+	notifyTimeout = 10 * time.Second
+)
+
+// Notification is sent when an alert fires, fires again after the repeat interval, or resolves
+type Notification struct {
+	Status      string `json:"status"`
+	Rule        string `json:"rule"`
+	Description string `json:"description,omitempty"`
+	Queue       string `json:"queue"`
+	Metric      string `json:"metric"`
+	// Measure tells what the metric measures, e.g. failed jobs increase over 5m0s
+	Measure   string  `json:"measure"`
+	Op        string  `json:"op"`
+	Threshold float64 `json:"threshold"`
+	// Value is the last value of the metric, which no longer breaks the threshold once resolved
+	Value    float64    `json:"value"`
+	FiredAt  time.Time  `json:"fired_at"`
+	Resolved *time.Time `json:"resolved_at,omitempty"`
+}
+
+// Summary is a single line describing the notification, e.g.
+// [FIRING] payments-failures on payments: failed jobs increase over 5m0s is 73 (> 50)
+func (n Notification) Summary() string {
+	return fmt.Sprintf("[%s] %s on %s: %s is %s (%s %s)", strings.ToUpper(n.Status), n.Rule, n.Queue, n.Measure, formatValue(n.Value), n.Op, formatValue(n.Threshold))
+}
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// NotifierConfig configures a notifier, rules refer to it by name
+type NotifierConfig struct {
+	Name string `mapstructure:"name"`
+	// Type is webhook, slack or smtp
+	Type string `mapstructure:"type"`
+
+	// URL is where webhook and slack notifications are posted, with Headers
+	URL     string            `mapstructure:"url"`
+	Headers map[string]string `mapstructure:"headers"`
+
+	// Host and Port are those of the SMTP server, which is authenticated against when Username is set
+	Host     string   `mapstructure:"host"`
+	Port     int      `mapstructure:"port"`
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	From     string   `mapstructure:"from"`
+	To       []string `mapstructure:"to"`
+}
+
+// NewNotifier validates a notifier configuration
+func NewNotifier(cfg NotifierConfig) (Notifier, error) {
+	switch cfg.Type {
+	case NotifierWebhook, NotifierSlack:
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("notifier %s: url is required", cfg.Name)
+		}
+
+		return &webhookNotifier{url: cfg.URL, headers: cfg.Headers, slack: cfg.Type == NotifierSlack, client: &http.Client{Timeout: notifyTimeout}}, nil
+	case NotifierSMTP:
+		if cfg.Host == "" || cfg.From == "" || len(cfg.To) == 0 {
+			return nil, fmt.Errorf("notifier %s: host, from and to are required", cfg.Name)
+		}
+
+		if cfg.Port == 0 {
+			cfg.Port = 25
+		}
+
+		return &smtpNotifier{cfg: cfg}, nil
+	}
+
+	return nil, fmt.Errorf("notifier %s: invalid type %q: must be webhook, slack or smtp", cfg.Name, cfg.Type)
+}
+
+// webhookNotifier posts notifications as JSON, or as Slack incoming webhook messages
+type webhookNotifier struct {
+	url     string
+	headers map[string]string
+	slack   bool
+	client  *http.Client
+}
+
+func (w *webhookNotifier) Notify(ctx context.Context, n Notification) error {
+	var payload any = n
+
+	if w.slack {
+		payload = map[string]string{"text": n.Summary()}
+	}
+
+	body, err := json.Marshal(payload)
+
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	for key, value := range w.headers {
+		req.Header.Set(key, value)
+	}
+
+	res, err := w.client.Do(req)
+
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("%s responded %s: %s", w.url, res.Status, strings.TrimSpace(string(message)))
+	}
+
+	return nil
+}
+
+// smtpNotifier mails notifications, upgrading the connection with STARTTLS when the server offers it
+type smtpNotifier struct {
+	cfg NotifierConfig
+}
+
+func (s *smtpNotifier) Notify(ctx context.Context, n Notification) error {
+	var auth smtp.Auth
+
+	if s.cfg.Username != "" {
+		auth = smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.cfg.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", n.Summary())
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%s\r\n\r\n", n.Summary())
+
+	if n.Description != "" {
+		fmt.Fprintf(&msg, "%s\r\n\r\n", n.Description)
+	}
+
+	fmt.Fprintf(&msg, "Fired at: %s\r\n", n.FiredAt.Format(time.RFC3339))
+
+	if n.Resolved != nil {
+		fmt.Fprintf(&msg, "Resolved at: %s\r\n", n.Resolved.Format(time.RFC3339))
+	}
+
+	return s.send(ctx, auth, msg.Bytes())
+}
+
+// send does what smtp.SendMail does over a connection bound to the context, it is closed when the
+// context is done
+func (s *smtpNotifier) send(ctx context.Context, auth smtp.Auth, msg []byte) error {
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port)))
+
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, s.cfg.Host)
+
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.cfg.Host}); err != nil {
+			return contextError(ctx, err)
+		}
+	}
+
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return contextError(ctx, err)
+		}
+	}
+
+	if err := client.Mail(s.cfg.From); err != nil {
+		return contextError(ctx, err)
+	}
+
+	for _, to := range s.cfg.To {
+		if err := client.Rcpt(to); err != nil {
+			return contextError(ctx, err)
+		}
+	}
+
+	w, err := client.Data()
+
+	if err != nil {
+		return contextError(ctx, err)
+	}
+
+	if _, err := w.Write(msg); err != nil {
+		return contextError(ctx, err)
+	}
+
+	if err := w.Close(); err != nil {
+		return contextError(ctx, err)
+	}
+
+	return contextError(ctx, client.Quit())
+}
+
+// contextError reports the error of the context instead of the one caused by closing the connection
+// when the context is done
+func contextError(ctx context.Context, err error) error {
+	// The deadline of the connection is the one of the context, which may be noticed first
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		<-ctx.Done()
+	}
+
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
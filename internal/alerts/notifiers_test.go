@@ -0,0 +1,285 @@
+package alerts
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testNotification() Notification {
+	return Notification{
+		Status:    StateFiring,
+		Rule:      "payments-failures",
+		Queue:     "payments",
+		Metric:    MetricIncrease,
+		Measure:   "failed jobs increase over 5m0s",
+		Op:        ">",
+		Threshold: 50,
+		Value:     73,
+		FiredAt:   time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+}
+
+// receive starts a server recording the requests it gets, responding with status and message
+func receive(t *testing.T, status int, message string) (*httptest.Server, chan *http.Request, chan []byte) {
+	t.Helper()
+
+	requests := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- r
+		bodies <- body
+
+		w.WriteHeader(status)
+		io.WriteString(w, message)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, requests, bodies
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	server, requests, bodies := receive(t, http.StatusNoContent, "")
+
+	notifier, err := NewNotifier(NotifierConfig{Name: "hook", Type: NotifierWebhook, URL: server.URL, Headers: map[string]string{"Authorization": "Bearer token"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := notifier.Notify(t.Context(), testNotification()); err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-requests
+
+	if req.Method != http.MethodPost || req.Header.Get("Content-Type") != "application/json" || req.Header.Get("Authorization") != "Bearer token" {
+		t.Errorf("unexpected request %s with headers %v", req.Method, req.Header)
+	}
+
+	var got Notification
+
+	if err := json.Unmarshal(<-bodies, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := testNotification(); got != want {
+		t.Errorf("got notification %+v, want %+v", got, want)
+	}
+}
+
+func TestWebhookNotifierError(t *testing.T) {
+	server, _, _ := receive(t, http.StatusInternalServerError, "boom\n")
+
+	notifier, err := NewNotifier(NotifierConfig{Name: "hook", Type: NotifierWebhook, URL: server.URL})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = notifier.Notify(t.Context(), testNotification())
+
+	if err == nil || !strings.Contains(err.Error(), "500 Internal Server Error: boom") {
+		t.Errorf("got error %v, want the status and message of the response", err)
+	}
+}
+
+func TestSlackNotifier(t *testing.T) {
+	server, _, bodies := receive(t, http.StatusOK, "ok")
+
+	notifier, err := NewNotifier(NotifierConfig{Name: "slack", Type: NotifierSlack, URL: server.URL})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := notifier.Notify(t.Context(), testNotification()); err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]string
+
+	if err := json.Unmarshal(<-bodies, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "[FIRING] payments-failures on payments: failed jobs increase over 5m0s is 73 (> 50)"
+
+	if len(got) != 1 || got["text"] != want {
+		t.Errorf("got message %v, want text %q", got, want)
+	}
+}
+
+// mail is what the SMTP stand-in received
+type mail struct {
+	from string
+	to   []string
+	data string
+}
+
+// serveSMTP runs a stand-in SMTP server accepting a single mail, without STARTTLS nor authentication
+func serveSMTP(t *testing.T) (NotifierConfig, chan mail) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	mails := make(chan mail, 1)
+
+	go func() {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+		var received mail
+
+		reply("220 localhost ESMTP")
+
+		for {
+			line, err := r.ReadString('\n')
+
+			if err != nil {
+				return
+			}
+
+			command := strings.TrimRight(line, "\r\n")
+
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(command, "MAIL FROM:"):
+				received.from = strings.Trim(strings.TrimPrefix(command, "MAIL FROM:"), "<>")
+				reply("250 OK")
+			case strings.HasPrefix(command, "RCPT TO:"):
+				received.to = append(received.to, strings.Trim(strings.TrimPrefix(command, "RCPT TO:"), "<>"))
+				reply("250 OK")
+			case command == "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+
+				var data strings.Builder
+
+				for {
+					line, err := r.ReadString('\n')
+
+					if err != nil {
+						return
+					}
+
+					if line == ".\r\n" {
+						break
+					}
+
+					data.WriteString(line)
+				}
+
+				received.data = data.String()
+				reply("250 OK")
+			case command == "QUIT":
+				reply("221 Bye")
+				mails <- received
+				return
+			default:
+				reply("502 Command not implemented")
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+
+	return NotifierConfig{Name: "mail", Type: NotifierSMTP, Host: host, Port: portNumber, From: "taskboard@example.com", To: []string{"ops@example.com", "oncall@example.com"}}, mails
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	cfg, mails := serveSMTP(t)
+
+	notifier, err := NewNotifier(cfg)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := notifier.Notify(t.Context(), testNotification()); err != nil {
+		t.Fatal(err)
+	}
+
+	got := <-mails
+
+	if got.from != cfg.From || strings.Join(got.to, ",") != strings.Join(cfg.To, ",") {
+		t.Errorf("got mail from %s to %v, want from %s to %v", got.from, got.to, cfg.From, cfg.To)
+	}
+
+	for _, want := range []string{
+		"Subject: " + testNotification().Summary() + "\r\n",
+		"To: ops@example.com, oncall@example.com\r\n",
+		"Fired at: 2024-01-02T03:04:05Z\r\n",
+	} {
+		if !strings.Contains(got.data, want) {
+			t.Errorf("mail %q doesn't contain %q", got.data, want)
+		}
+	}
+}
+
+func TestSMTPNotifierTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// The server accepts connections but never greets
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+
+	notifier, err := NewNotifier(NotifierConfig{Name: "mail", Type: NotifierSMTP, Host: host, Port: portNumber, From: "taskboard@example.com", To: []string{"ops@example.com"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	err = notifier.Notify(ctx, testNotification())
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if took := time.Since(started); took > time.Second {
+		t.Errorf("notifying took %s, want it bounded by the context", took)
+	}
+}
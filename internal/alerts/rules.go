@@ -0,0 +1,242 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Metrics rules can watch
+const (
+	// MetricCount is the number of jobs in State
+	MetricCount = "count"
+	// MetricIncrease is how much the number of jobs in State grew over Window
+	MetricIncrease = "increase"
+	// MetricEvents is the number of Event events emitted over Window
+	MetricEvents = "events"
+	// MetricOldestAge is the age in seconds of the oldest job in State, one of the list states
+	MetricOldestAge = "oldest_age"
+	// MetricWorkers is the number of workers connected to the queue
+	MetricWorkers = "workers"
+)
+
+// eventsPage is how many events the events metric reads at once
+const eventsPage = 1000
+
+var (
+	metrics      = []string{MetricCount, MetricIncrease, MetricEvents, MetricOldestAge, MetricWorkers}
+	countStates  = []string{"active", "wait", "prioritized", "paused", "delayed", "waiting-children", "completed", "failed"}
+	oldestStates = []string{"wait", "paused", "active"}
+	operators    = []string{">", ">=", "<", "<=", "==", "!="}
+)
+
+// Rule compares a metric of a queue with a threshold at every evaluation
+type Rule struct {
+	Name        string `mapstructure:"name"`
+	Description string `mapstructure:"description"`
+	// Queue is the queue watched, every queue is watched separately when empty or *
+	Queue  string `mapstructure:"queue"`
+	Metric string `mapstructure:"metric"`
+	// State is the state counted by the count, increase and oldest_age metrics
+	State string `mapstructure:"state"`
+	// Event is the event counted by the events metric, e.g. failed or stalled
+	Event string `mapstructure:"event"`
+	// Window is the period the increase and events metrics are measured over
+	Window time.Duration `mapstructure:"window"`
+	// Op compares the metric with the threshold, > by default
+	Op        string  `mapstructure:"op"`
+	Threshold float64 `mapstructure:"threshold"`
+	// For is how long the condition must hold before the alert fires, it is pending meanwhile
+	For time.Duration `mapstructure:"for"`
+	// RepeatInterval is how often firing alerts are sent again, they are sent once when 0
+	RepeatInterval time.Duration `mapstructure:"repeat_interval"`
+	// Notify lists the names of the notifiers alerts are sent to
+	Notify []string `mapstructure:"notify"`
+}
+
+func (r *Rule) validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule without a name")
+	}
+
+	if r.Op == "" {
+		r.Op = ">"
+	}
+
+	if !slices.Contains(operators, r.Op) {
+		return fmt.Errorf("rule %s: invalid op %q: must be one of %s", r.Name, r.Op, strings.Join(operators, " "))
+	}
+
+	switch r.Metric {
+	case MetricCount, MetricIncrease:
+		if !slices.Contains(countStates, r.State) {
+			return fmt.Errorf("rule %s: invalid state %q: must be one of %s", r.Name, r.State, strings.Join(countStates, ", "))
+		}
+	case MetricOldestAge:
+		if r.State == "" {
+			r.State = "wait"
+		}
+
+		if !slices.Contains(oldestStates, r.State) {
+			return fmt.Errorf("rule %s: invalid state %q: must be one of %s", r.Name, r.State, strings.Join(oldestStates, ", "))
+		}
+	case MetricEvents:
+		if r.Event == "" {
+			return fmt.Errorf("rule %s: event is required", r.Name)
+		}
+	case MetricWorkers:
+	default:
+		return fmt.Errorf("rule %s: invalid metric %q: must be one of %s", r.Name, r.Metric, strings.Join(metrics, ", "))
+	}
+
+	if (r.Metric == MetricIncrease || r.Metric == MetricEvents) && r.Window <= 0 {
+		return fmt.Errorf("rule %s: window is required by the %s metric", r.Name, r.Metric)
+	}
+
+	if len(r.Notify) == 0 {
+		return fmt.Errorf("rule %s: no notifiers", r.Name)
+	}
+
+	return nil
+}
+
+func (r *Rule) matches(queue string) bool {
+	return r.Queue == "" || r.Queue == "*" || r.Queue == queue
+}
+
+// holds compares a value of the metric with the threshold
+func (r *Rule) holds(value float64) bool {
+	switch r.Op {
+	case ">":
+		return value > r.Threshold
+	case ">=":
+		return value >= r.Threshold
+	case "<":
+		return value < r.Threshold
+	case "<=":
+		return value <= r.Threshold
+	case "==":
+		return value == r.Threshold
+	case "!=":
+		return value != r.Threshold
+	}
+
+	return false
+}
+
+// describe tells what the metric of the rule measures, e.g. "failed jobs increase over 5m0s"
+func (r *Rule) describe() string {
+	switch r.Metric {
+	case MetricCount:
+		return r.State + " jobs"
+	case MetricIncrease:
+		return fmt.Sprintf("%s jobs increase over %s", r.State, r.Window)
+	case MetricEvents:
+		return fmt.Sprintf("%s events over %s", r.Event, r.Window)
+	case MetricOldestAge:
+		return fmt.Sprintf("age of the oldest %s job in seconds", r.State)
+	}
+
+	return "connected workers"
+}
+
+// countSample is the counts of a queue at a point in time, kept to compute increases
+type countSample struct {
+	time   time.Time
+	counts map[string]int64
+}
+
+// measure returns the value of the metric of a rule for a queue, false when it is not known yet,
+// e.g. before the queue was watched for a whole window
+func (e *Engine) measure(ctx context.Context, rule *Rule, queue string, now time.Time, counts map[string]int64) (float64, bool, error) {
+	queueKey := e.prefix + ":" + queue
+
+	switch rule.Metric {
+	case MetricCount:
+		return float64(counts[rule.State]), true, nil
+	case MetricIncrease:
+		var past *countSample
+
+		for i := range e.samples[queue] {
+			if sample := &e.samples[queue][i]; !sample.time.After(now.Add(-rule.Window)) {
+				past = sample
+			}
+		}
+
+		if past == nil {
+			return 0, false, nil
+		}
+
+		return float64(counts[rule.State] - past.counts[rule.State]), true, nil
+	case MetricEvents:
+		start := strconv.FormatInt(now.Add(-rule.Window).UnixMilli(), 10)
+		count := 0
+
+		// Streams hold up to 10k events by default, they are read a page at a time
+		for {
+			events, err := e.redis.XRangeN(ctx, queueKey+":events", start, "+", eventsPage).Result()
+
+			if err != nil {
+				return 0, false, err
+			}
+
+			for _, event := range events {
+				if event.Values["event"] == rule.Event {
+					count++
+				}
+			}
+
+			if len(events) < eventsPage {
+				return float64(count), true, nil
+			}
+
+			// The next page starts after the last event read
+			start = "(" + events[len(events)-1].ID
+		}
+	case MetricOldestAge:
+		// Jobs are pushed to the head of lists, the oldest is at the tail
+		id, err := e.redis.LIndex(ctx, queueKey+":"+rule.State, -1).Result()
+
+		if errors.Is(err, redis.Nil) {
+			return 0, true, nil
+		}
+
+		if err != nil {
+			return 0, false, err
+		}
+
+		timestamp, err := e.redis.HGet(ctx, queueKey+":"+id, "timestamp").Int64()
+
+		if errors.Is(err, redis.Nil) {
+			return 0, true, nil
+		}
+
+		if err != nil {
+			return 0, false, err
+		}
+
+		return max(now.Sub(time.UnixMilli(timestamp)).Seconds(), 0), true, nil
+	case MetricWorkers:
+		if e.clientsErr != nil {
+			return 0, false, fmt.Errorf("failed to list clients: %w", e.clientsErr)
+		}
+
+		count := 0
+
+		for _, client := range e.clients {
+			if _, ok := client.WorkerOf(e.prefix, queue); ok {
+				count++
+			}
+		}
+
+		return float64(count), true, nil
+	}
+
+	return 0, false, fmt.Errorf("unknown metric %q", rule.Metric)
+}
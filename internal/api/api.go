@@ -2,42 +2,217 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/wolzey/taskboard/internal/web"
 )
 
 type ApiOptions struct {
 	Port int
+	// BasePath serves the API and the UI under a sub-path, such as /taskboard behind a reverse proxy
+	BasePath string
+	// UI serves the web UI at the base path
+	UI bool
+	// ReadTimeout and WriteTimeout bound reading the body of a request and writing its response, none when zero
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// GinMode is debug, release or test, gin's default when empty
+	GinMode string
+	// TLS serves the API over TLS and HTTP/2 when set
+	TLS *TLSOptions
+	// StrictResponses fails the responses that don't match the specification, e.g. in tests
+	StrictResponses bool
 }
 
 type Api struct {
 	router *gin.Engine
 	server *http.Server
+	// basePath is empty or starts with a slash, without a trailing one
+	basePath string
+	// readTimeout and writeTimeout are applied to each request, they can change while serving
+	readTimeout  atomic.Int64
+	writeTimeout atomic.Int64
+	// certs is nil unless the API is served over TLS
+	certs      *certificates
+	principals atomic.Pointer[[]Principal]
+	// strictResponses fails the responses that don't match the specification instead of reporting them
+	strictResponses bool
+	// routes and the schemas of their bodies describe the API, they don't change once served
+	routes      []*route
+	schemas     *schemas
+	errorSchema *Schema
 }
 
 func NewApi(opts ApiOptions) *Api {
-	router := gin.Default()
+	if opts.GinMode != "" {
+		gin.SetMode(opts.GinMode)
+	}
+
+	// Routes and requests are logged with slog rather than gin's logger
+	gin.DebugPrintRouteFunc = func(method string, path string, handler string, handlers int) {
+		slog.Debug("api: route", "method", method, "path", path, "handler", handler)
+	}
+	gin.DebugPrintFunc = func(format string, values ...any) {
+		slog.Debug("api: gin: " + strings.TrimSpace(fmt.Sprintf(format, values...)))
+	}
+
+	router := gin.New()
+	// Handlers are called with gin's context, which falls back to the request's for the values logged
+	router.ContextWithFallback = true
+	// Path parameters are matched escaped, so ids holding a / such as those of legacy repeatable jobs are
+	// reached as a single %2F encoded segment
+	router.UseRawPath = true
 
+	// Read and write timeouts are set on each request instead, see SetTimeouts
 	s := &http.Server{
-		Addr:           fmt.Sprintf(":%d", opts.Port),
-		Handler:        router,
-		ReadTimeout:    10 * time.Second,
-		WriteTimeout:   10 * time.Second,
-		MaxHeaderBytes: 1 << 20,
+		Addr:              fmt.Sprintf(":%d", opts.Port),
+		Handler:           router,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       time.Minute,
+		MaxHeaderBytes:    1 << 20,
+	}
+
+	api := &Api{
+		router:          router,
+		server:          s,
+		basePath:        cleanBasePath(opts.BasePath),
+		schemas:         newSchemas(),
+		strictResponses: opts.StrictResponses,
+	}
+
+	api.errorSchema = api.schemas.of(reflect.TypeFor[ErrorResponse]())
+
+	api.SetTimeouts(opts.ReadTimeout, opts.WriteTimeout)
+	api.SetPrincipals(nil)
+	router.Use(logRequests, traceRequests, gin.CustomRecoveryWithWriter(io.Discard, recovered), api.deadlines)
+
+	if opts.TLS != nil {
+		api.certs = &certificates{opts: *opts.TLS}
+		s.TLSConfig = api.certs.config()
+		s.Protocols = new(http.Protocols)
+		s.Protocols.SetHTTP1(true)
+		s.Protocols.SetHTTP2(true)
+
+		api.SetPrincipals(opts.TLS.Principals)
+		router.Use(api.authorize)
 	}
 
-	return &Api{
-		router: router,
-		server: s,
+	router.GET(api.basePath+"/api/openapi.json", api.serveOpenAPI)
+
+	if opts.UI {
+		api.serveUI()
 	}
+
+	return api
+}
+
+// SetTimeouts changes the read and write timeouts of the requests received from now on
+func (api *Api) SetTimeouts(read time.Duration, write time.Duration) {
+	api.readTimeout.Store(int64(read))
+	api.writeTimeout.Store(int64(write))
+}
+
+// deadlines sets the read and write deadlines of a request, connections are reused so they are always set
+func (api *Api) deadlines(ctx *gin.Context) {
+	rc := http.NewResponseController(ctx.Writer)
+	now := time.Now()
+
+	var read, write time.Time
+
+	if d := time.Duration(api.readTimeout.Load()); d > 0 {
+		read = now.Add(d)
+	}
+
+	if d := time.Duration(api.writeTimeout.Load()); d > 0 {
+		write = now.Add(d)
+	}
+
+	if err := rc.SetReadDeadline(read); err != nil {
+		slog.WarnContext(ctx, "api: unable to set read deadline", "error", err)
+	}
+
+	if err := rc.SetWriteDeadline(write); err != nil {
+		slog.WarnContext(ctx, "api: unable to set write deadline", "error", err)
+	}
+
+	ctx.Next()
+}
+
+// ServeHTTP handles a request as the server does, e.g. to serve the API with httptest
+func (api *Api) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.router.ServeHTTP(w, r)
+}
+
+// Use adds middleware to the handlers added from now on
+func (api *Api) Use(middleware ...gin.HandlerFunc) {
+	api.router.Use(middleware...)
+}
+
+// cleanBasePath adds the leading slash of a base path and drops the trailing ones, / becomes empty
+func cleanBasePath(path string) string {
+	path = strings.Trim(path, "/")
+
+	if path == "" {
+		return ""
+	}
+
+	return "/" + path
+}
+
+// serveUI serves the files of the web UI under the base path, requests not matching any API route fall back to them
+func (api *Api) serveUI() {
+	files := http.StripPrefix(api.basePath, http.FileServerFS(web.Files))
+
+	api.router.NoRoute(func(ctx *gin.Context) {
+		path := ctx.Request.URL.Path
+		method := ctx.Request.Method
+
+		if method != "GET" && method != "HEAD" {
+			ctx.JSON(404, errorBody(ctx, 404, "not found"))
+			return
+		}
+
+		// The UI calls the API relative to the page, which must end with a slash
+		if path == api.basePath {
+			ctx.Redirect(http.StatusMovedPermanently, api.basePath+"/")
+			return
+		}
+
+		if !strings.HasPrefix(path, api.basePath+"/") || strings.HasPrefix(path, api.basePath+"/api/") {
+			ctx.JSON(404, errorBody(ctx, 404, "not found"))
+			return
+		}
+
+		files.ServeHTTP(ctx.Writer, ctx.Request)
+	})
 }
 
 func (api *Api) Serve(ctx context.Context) error {
-	if err := api.server.ListenAndServe(); err != nil {
-		fmt.Println("unable to serve http")
+	if api.certs != nil {
+		if err := api.certs.load(); err != nil {
+			slog.Error("api: unable to load the TLS certificates", "error", err)
+			panic(err)
+		}
+
+		if err := api.certs.watch(ctx); err != nil {
+			slog.Warn("api: renewed TLS certificates need a restart", "reason", err)
+		}
+
+		if err := api.server.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("api: unable to serve https", "error", err)
+			panic(err)
+		}
+	} else if err := api.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("api: unable to serve http", "error", err)
 		panic(err)
 	}
 
@@ -46,32 +221,107 @@ func (api *Api) Serve(ctx context.Context) error {
 	return nil
 }
 
+// Shutdown stops accepting requests and waits for those in flight until ctx is done, Serve then returns
+func (api *Api) Shutdown(ctx context.Context) error {
+	return api.server.Shutdown(ctx)
+}
+
 type Context struct {
 	*gin.Context
 }
 
+// RawResponse can be returned by a handler to respond with a body that is not JSON
+type RawResponse struct {
+	ContentType string
+	Body        []byte
+}
+
+// StreamResponse can be returned by a handler to write a body too large to hold in memory.
+// Write is called once the headers are sent, its errors can only end the response early.
+type StreamResponse struct {
+	ContentType string
+	// Filename makes clients save the body to a file when set
+	Filename string
+	Write    func(w io.Writer) error
+}
+
 type HandlerFunc func(*gin.Context) (status int, results any, err error)
 
-func (api *Api) AddAPIHandler(path string, method string, handler HandlerFunc) {
-	apiRouter := api.router.Group("/api")
+// AddAPIHandler adds a route under /api, described by op in the specification of the API
+func (api *Api) AddAPIHandler(path string, method string, handler HandlerFunc, op Operation) {
+	apiRouter := api.router.Group(api.basePath + "/api")
+	r := api.addRoute(method, path, op)
 	wrapped := func(ctx *gin.Context) {
+		if r.request != nil {
+			if err := api.checkRequest(ctx, r); err != nil {
+				status := 400
+				var tooLarge *http.MaxBytesError
+
+				if errors.As(err, &tooLarge) {
+					status = 413
+				}
+
+				ctx.Error(err)
+				ctx.JSON(status, errorBody(ctx, status, err.Error()))
+				return
+			}
+		}
+
 		status, result, err := handler(ctx)
 
 		if err != nil {
-			ctx.JSON(500, gin.H{"message": err.Error(), "status": 500})
+			if status < 400 {
+				status = 500
+			}
+
+			// The error is logged with the request
+			ctx.Error(err)
+			ctx.JSON(status, errorBody(ctx, status, err.Error()))
 			return
 		}
 
+		if raw, ok := result.(RawResponse); ok {
+			ctx.Data(status, raw.ContentType, raw.Body)
+			return
+		}
+
+		if stream, ok := result.(StreamResponse); ok {
+			ctx.Header("Content-Type", stream.ContentType)
+			if stream.Filename != "" {
+				ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", stream.Filename))
+			}
+			ctx.Status(status)
+
+			// Streams can outlast the server write timeout
+			if err := http.NewResponseController(ctx.Writer).SetWriteDeadline(time.Time{}); err != nil {
+				slog.WarnContext(ctx, "api: unable to clear write deadline", "error", err)
+			}
+
+			if err := stream.Write(ctx.Writer); err != nil {
+				ctx.Error(fmt.Errorf("streaming failed: %w", err))
+			}
+			return
+		}
+
+		// Responses drifting from the specification are reported while developing
+		if (api.strictResponses || gin.IsDebugging()) && !r.matchesResponse(result) {
+			if api.strictResponses {
+				err := fmt.Errorf("response of type %T doesn't match the specification of %s", result, op.ID)
+				ctx.Error(err)
+				ctx.JSON(500, errorBody(ctx, 500, err.Error()))
+				return
+			}
+
+			slog.WarnContext(ctx, "api: response doesn't match the specification", "operation", op.ID, "type", fmt.Sprintf("%T", result))
+		}
+
 		ctx.JSON(status, result)
 	}
 
 	switch method {
-	case "GET":
-		apiRouter.GET(path, wrapped)
-	case "POST":
-		apiRouter.POST(path, wrapped)
+	case "GET", "POST", "DELETE":
+		apiRouter.Handle(method, path, wrapped)
 	default:
-		fmt.Errorf("Unknown method %s", method)
-		return
+		panic(fmt.Sprintf("unknown method %s for %s", method, path))
 	}
 }
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type testRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type testResponse struct {
+	Name string `json:"name"`
+}
+
+type otherResponse struct {
+	Name string `json:"name"`
+}
+
+// serve sends a request to the API and decodes the error of the response, if any
+func serve(t *testing.T, api *Api, method string, path string, body string) (int, ErrorResponse) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+
+	var res ErrorResponse
+
+	if rec.Code >= 400 {
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatalf("unable to decode error response %q: %v", rec.Body.String(), err)
+		}
+	}
+
+	return rec.Code, res
+}
+
+func TestStrictResponses(t *testing.T) {
+	api := NewApi(ApiOptions{StrictResponses: true})
+
+	api.AddAPIHandler("/matching", "GET", func(ctx *gin.Context) (int, any, error) {
+		return 200, &testResponse{Name: "payments"}, nil
+	}, Operation{ID: "matching", Response: testResponse{}})
+
+	api.AddAPIHandler("/drifting", "GET", func(ctx *gin.Context) (int, any, error) {
+		return 200, otherResponse{Name: "payments"}, nil
+	}, Operation{ID: "drifting", Response: testResponse{}})
+
+	if status, res := serve(t, api, "GET", "/api/matching", ""); status != 200 {
+		t.Errorf("got status %d (%s), want 200", status, res.Message)
+	}
+
+	status, res := serve(t, api, "GET", "/api/drifting", "")
+
+	if status != 500 || !strings.Contains(res.Message, "api.otherResponse doesn't match the specification of drifting") {
+		t.Errorf("got status %d (%s), want the drift to fail the response", status, res.Message)
+	}
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+	api := NewApi(ApiOptions{})
+
+	api.AddAPIHandler("/names", "POST", func(ctx *gin.Context) (int, any, error) {
+		var req testRequest
+
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return 400, nil, err
+		}
+
+		return 200, testResponse(req), nil
+	}, Operation{ID: "names", Request: testRequest{}, Response: testResponse{}})
+
+	if status, res := serve(t, api, "POST", "/api/names", `{"name": "payments"}`); status != 200 {
+		t.Errorf("got status %d (%s), want 200", status, res.Message)
+	}
+
+	large := `{"name": "` + strings.Repeat("a", maxRequestBody) + `"}`
+
+	if status, res := serve(t, api, "POST", "/api/names", large); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("got status %d (%s), want %d", status, res.Message, http.StatusRequestEntityTooLarge)
+	}
+
+	if status, res := serve(t, api, "POST", "/api/names", `{}`); status != 400 || res.Message != "invalid request body: name is required" {
+		t.Errorf("got status %d (%s), want the missing name to be reported", status, res.Message)
+	}
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wolzey/taskboard/internal/logging"
+)
+
+// RequestIDHeader carries the id of a request in responses, clients may set it to correlate their logs with ours
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDKey is the key of the context holding the id of the request
+const RequestIDKey = "request_id"
+
+// maxRequestIDLength bounds the ids accepted from clients
+const maxRequestIDLength = 128
+
+// logRequests gives each request an id, carried with its route and queue by the context of the request so every
+// line logged while serving it tells which one it belongs to, then logs the request once served
+func logRequests(ctx *gin.Context) {
+	start := time.Now()
+
+	id := ctx.GetHeader(RequestIDHeader)
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+
+	ctx.Set(RequestIDKey, id)
+	ctx.Header(RequestIDHeader, id)
+
+	attrs := []slog.Attr{slog.String("request_id", id), slog.String("route", ctx.FullPath())}
+
+	if queue := ctx.Param("queue"); queue != "" {
+		attrs = append(attrs, slog.String("queue", queue))
+	}
+
+	reqCtx, _ := logging.WithRequest(ctx.Request.Context(), attrs...)
+	ctx.Request = ctx.Request.WithContext(reqCtx)
+
+	ctx.Next()
+
+	status := ctx.Writer.Status()
+	level := slog.LevelInfo
+
+	if status >= 500 {
+		level = slog.LevelError
+	} else if status >= 400 {
+		level = slog.LevelWarn
+	}
+
+	attrs = []slog.Attr{
+		slog.String("method", ctx.Request.Method),
+		slog.String("path", ctx.Request.URL.Path),
+		slog.Int("status", status),
+		slog.Duration("took", time.Since(start)),
+		slog.Int("size", max(ctx.Writer.Size(), 0)),
+		slog.String("client_ip", ctx.ClientIP()),
+	}
+
+	if principal := ctx.GetString(PrincipalKey); principal != "" {
+		attrs = append(attrs, slog.String("principal", principal))
+	}
+
+	if err := ctx.Errors.Last(); err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+
+	slog.LogAttrs(ctx.Request.Context(), level, "api: request", attrs...)
+}
+
+// validRequestID tells whether the id sent by a client can be logged as is
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// recovered logs the panics of handlers and responds with an error
+func recovered(ctx *gin.Context, err any) {
+	slog.ErrorContext(ctx, "api: panic serving request", "error", err, "stack", string(debug.Stack()))
+	ctx.Error(fmt.Errorf("panic: %v", err))
+	ctx.AbortWithStatusJSON(http.StatusInternalServerError, errorBody(ctx, http.StatusInternalServerError, "internal server error"))
+}
+
+// errorBody is the body of error responses
+func errorBody(ctx *gin.Context, status int, message string) ErrorResponse {
+	return ErrorResponse{Message: message, Status: status, RequestID: ctx.GetString(RequestIDKey)}
+}
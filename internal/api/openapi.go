@@ -0,0 +1,278 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Operation describes a route of the API in its OpenAPI specification
+type Operation struct {
+	// ID names the operation in generated clients, it must be unique
+	ID      string
+	Summary string
+	Query   []Param
+	// Request is a value of the type the JSON body of requests is bound to, nil when the route takes none.
+	// Bodies are checked against its schema before the handler is called.
+	Request any
+	// OptionalRequest accepts requests without a body
+	OptionalRequest bool
+	// Response is a value of the type of the JSON body of successful responses, nil when it isn't JSON
+	Response any
+	// Produces lists the content types of the responses that aren't JSON, e.g. text/csv
+	Produces []string
+}
+
+// Param is a query parameter of an operation
+type Param struct {
+	Name string
+	// Type is string, integer or boolean
+	Type        string
+	Description string
+	Required    bool
+	// Enum lists the accepted values, any value is accepted when empty
+	Enum []string
+}
+
+// ErrorResponse is the body of error responses, its request id correlates them with the logs
+type ErrorResponse struct {
+	Message   string `json:"message"`
+	Status    int    `json:"status"`
+	RequestID string `json:"request_id"`
+}
+
+// route is an operation added with AddAPIHandler and the schemas of its bodies
+type route struct {
+	method    string
+	path      string
+	operation Operation
+	request   *Schema
+	// response is nil when responses aren't JSON
+	response     *Schema
+	responseType reflect.Type
+}
+
+var pathParamPattern = regexp.MustCompile(`:([^/]+)`)
+
+// addRoute describes a route, it panics when the operation can't be described
+func (api *Api) addRoute(method string, path string, op Operation) *route {
+	if op.ID == "" {
+		panic(fmt.Sprintf("missing operation id for %s %s", method, path))
+	}
+
+	if slices.ContainsFunc(api.routes, func(r *route) bool { return r.operation.ID == op.ID }) {
+		panic(fmt.Sprintf("duplicate operation id %s for %s %s", op.ID, method, path))
+	}
+
+	r := &route{method: method, path: path, operation: op}
+
+	if op.Request != nil {
+		r.request = api.schemas.of(reflect.TypeOf(op.Request))
+	}
+
+	if op.Response != nil {
+		r.responseType = derefType(reflect.TypeOf(op.Response))
+		r.response = api.schemas.of(r.responseType)
+	}
+
+	api.routes = append(api.routes, r)
+
+	return r
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	return t
+}
+
+// maxRequestBody bounds the bodies checked against the schemas, they are read in memory
+const maxRequestBody = 1 << 20
+
+// checkRequest checks the JSON body of a request against the schema of the route, the handler reads it
+// again afterwards. Bodies larger than maxRequestBody fail with an *http.MaxBytesError.
+func (api *Api) checkRequest(ctx *gin.Context, r *route) error {
+	body, err := io.ReadAll(http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxRequestBody))
+
+	if err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+
+	ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		if r.operation.OptionalRequest {
+			return nil
+		}
+
+		return fmt.Errorf("invalid request body: missing body")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var value any
+
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+
+	if decoder.More() {
+		return fmt.Errorf("invalid request body: unexpected data after the JSON value")
+	}
+
+	if err := api.schemas.validate(r.request, value, ""); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+
+	return nil
+}
+
+// matchesResponse tells if result is of the type of the responses of the route in the specification
+func (r *route) matchesResponse(result any) bool {
+	return r.responseType != nil && result != nil && derefType(reflect.TypeOf(result)) == r.responseType
+}
+
+type document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       info                             `json:"info"`
+	Servers    []server                         `json:"servers,omitempty"`
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components components                       `json:"components"`
+}
+
+type info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type server struct {
+	URL string `json:"url"`
+}
+
+type operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary,omitempty"`
+	Parameters  []parameter          `json:"parameters,omitempty"`
+	RequestBody *requestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*response `json:"responses"`
+}
+
+type parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type requestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*mediaType `json:"content"`
+}
+
+type response struct {
+	Description string                `json:"description"`
+	Content     map[string]*mediaType `json:"content,omitempty"`
+}
+
+type mediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// OpenAPI is the OpenAPI 3.1 specification of the routes added with AddAPIHandler, as JSON
+func (api *Api) OpenAPI() ([]byte, error) {
+	doc := document{
+		OpenAPI:    "3.1.0",
+		Info:       info{Title: "taskboard", Version: "1"},
+		Paths:      map[string]map[string]*operation{},
+		Components: components{Schemas: api.schemas.components},
+	}
+
+	if api.basePath != "" {
+		doc.Servers = []server{{URL: api.basePath}}
+	}
+
+	for _, r := range api.routes {
+		op := &operation{
+			OperationID: r.operation.ID,
+			Summary:     r.operation.Summary,
+			Responses: map[string]*response{
+				"200":     {Description: "OK", Content: map[string]*mediaType{}},
+				"default": {Description: "Error", Content: map[string]*mediaType{"application/json": {Schema: api.errorSchema}}},
+			},
+		}
+
+		for _, match := range pathParamPattern.FindAllStringSubmatch(r.path, -1) {
+			op.Parameters = append(op.Parameters, parameter{Name: match[1], In: "path", Required: true, Schema: &Schema{Type: schemaType{"string"}}})
+		}
+
+		for _, param := range r.operation.Query {
+			op.Parameters = append(op.Parameters, parameter{
+				Name:        param.Name,
+				In:          "query",
+				Description: param.Description,
+				Required:    param.Required,
+				Schema:      &Schema{Type: schemaType{param.Type}, Enum: param.Enum},
+			})
+		}
+
+		if r.request != nil {
+			op.RequestBody = &requestBody{
+				Required: !r.operation.OptionalRequest,
+				Content:  map[string]*mediaType{"application/json": {Schema: r.request}},
+			}
+		}
+
+		if r.response != nil {
+			op.Responses["200"].Content["application/json"] = &mediaType{Schema: r.response}
+		}
+
+		for _, contentType := range r.operation.Produces {
+			op.Responses["200"].Content[contentType] = &mediaType{Schema: &Schema{Type: schemaType{"string"}}}
+		}
+
+		path := "/api" + pathParamPattern.ReplaceAllString(r.path, "{$1}")
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*operation{}
+		}
+
+		doc.Paths[path][strings.ToLower(r.method)] = op
+	}
+
+	spec, err := json.MarshalIndent(doc, "", "  ")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append(spec, '\n'), nil
+}
+
+// serveOpenAPI serves the specification of the API
+func (api *Api) serveOpenAPI(ctx *gin.Context) {
+	spec, err := api.OpenAPI()
+
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(500, errorBody(ctx, 500, err.Error()))
+		return
+	}
+
+	ctx.Data(200, "application/json", spec)
+}
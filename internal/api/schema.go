@@ -0,0 +1,386 @@
+package api
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const componentsPrefix = "#/components/schemas/"
+
+// Schema is the JSON Schema of a request or response body, as used by OpenAPI 3.1
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 schemaType         `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+}
+
+// schemaType lists the JSON types of a schema, it is written as a string when there is only one
+type schemaType []string
+
+func (t schemaType) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+
+	return json.Marshal([]string(t))
+}
+
+// nullable also accepts null, the schema is copied
+func nullable(schema *Schema) *Schema {
+	if schema.Ref != "" {
+		return &Schema{AnyOf: []*Schema{schema, {Type: schemaType{"null"}}}}
+	}
+
+	// Schemas without a type already accept anything
+	if len(schema.Type) == 0 || slices.Contains(schema.Type, "null") {
+		return schema
+	}
+
+	copied := *schema
+	copied.Type = append(slices.Clip(schema.Type), "null")
+
+	return &copied
+}
+
+var (
+	timeType          = reflect.TypeFor[time.Time]()
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+// schemas builds the schemas of Go types as encoding/json writes them, named structs become components
+// referenced by name so recursive types can be described
+type schemas struct {
+	components map[string]*Schema
+	names      map[reflect.Type]string
+}
+
+func newSchemas() *schemas {
+	return &schemas{components: map[string]*Schema{}, names: map[reflect.Type]string{}}
+}
+
+func (s *schemas) of(t reflect.Type) *Schema {
+	t = derefType(t)
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: schemaType{"string"}, Format: "date-time"}
+	case implements(t, jsonMarshalerType):
+		// The encoding is up to the type, e.g. json.RawMessage
+		return &Schema{}
+	case implements(t, textMarshalerType):
+		return &Schema{Type: schemaType{"string"}}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: schemaType{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Uint, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: schemaType{"integer"}}
+	case reflect.Int32, reflect.Uint32:
+		return &Schema{Type: schemaType{"integer"}, Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: schemaType{"integer"}, Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: schemaType{"number"}}
+	case reflect.String:
+		return &Schema{Type: schemaType{"string"}}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: schemaType{"string"}, Format: "byte"}
+		}
+
+		return &Schema{Type: schemaType{"array"}, Items: s.of(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: schemaType{"object"}, AdditionalProperties: s.of(t.Elem())}
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+
+		return s.ref(t)
+	}
+
+	panic(fmt.Sprintf("api: %s can't be described by a schema", t))
+}
+
+func implements(t reflect.Type, iface reflect.Type) bool {
+	return t.Kind() != reflect.Interface && (t.Implements(iface) || reflect.PointerTo(t).Implements(iface))
+}
+
+// ref adds the component of a named struct, types of other packages are prefixed with it when their
+// names are taken
+func (s *schemas) ref(t reflect.Type) *Schema {
+	name, ok := s.names[t]
+
+	if !ok {
+		name = t.Name()
+
+		if _, taken := s.components[name]; taken {
+			name = path.Base(t.PkgPath()) + "." + name
+		}
+
+		s.names[t] = name
+		// Recursive fields refer to the component before it is done
+		s.components[name] = &Schema{}
+		s.components[name] = s.object(t)
+	}
+
+	return &Schema{Ref: componentsPrefix + name}
+}
+
+func (s *schemas) object(t reflect.Type) *Schema {
+	schema := &Schema{Type: schemaType{"object"}, Properties: map[string]*Schema{}}
+
+	for _, field := range jsonFields(t) {
+		prop := s.of(field.typ)
+
+		switch {
+		case field.quoted && slices.ContainsFunc(prop.Type, func(t string) bool { return t != "string" }):
+			prop = &Schema{Type: schemaType{"string"}}
+		case !field.omitempty && slices.Contains([]reflect.Kind{reflect.Pointer, reflect.Slice, reflect.Map}, field.typ.Kind()):
+			// Nil values are written as null unless omitted
+			prop = nullable(prop)
+		}
+
+		schema.Properties[field.name] = prop
+
+		if field.required {
+			schema.Required = append(schema.Required, field.name)
+		}
+	}
+
+	return schema
+}
+
+type jsonField struct {
+	name      string
+	typ       reflect.Type
+	depth     int
+	tagged    bool
+	omitempty bool
+	// quoted fields have the string option, their numbers and booleans are written as strings
+	quoted bool
+	// required fields are bound with the required rule
+	required bool
+}
+
+// jsonFields lists the fields encoding/json reads and writes, the fields of embedded structs included.
+// Like encoding/json, the shallowest field of a name hides the others, tagged ones win ties and names
+// still tied are dropped.
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+
+	var walk func(t reflect.Type, depth int)
+	walk = func(t reflect.Type, depth int) {
+		for i := range t.NumField() {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+
+			if tag == "-" {
+				continue
+			}
+
+			name, opts, _ := strings.Cut(tag, ",")
+			options := strings.Split(opts, ",")
+
+			if f.Anonymous && name == "" {
+				embedded := f.Type
+				if embedded.Kind() == reflect.Pointer {
+					embedded = embedded.Elem()
+				}
+
+				if embedded.Kind() == reflect.Struct {
+					walk(embedded, depth+1)
+					continue
+				}
+			}
+
+			if !f.IsExported() {
+				continue
+			}
+
+			field := jsonField{
+				name:      name,
+				typ:       f.Type,
+				depth:     depth,
+				tagged:    name != "",
+				omitempty: slices.Contains(options, "omitempty") || slices.Contains(options, "omitzero"),
+				quoted:    slices.Contains(options, "string"),
+				required:  slices.Contains(strings.Split(f.Tag.Get("binding"), ","), "required"),
+			}
+
+			if field.name == "" {
+				field.name = f.Name
+			}
+
+			fields = append(fields, field)
+		}
+	}
+
+	walk(t, 0)
+
+	byName := map[string][]jsonField{}
+	var names []string
+
+	for _, field := range fields {
+		if _, ok := byName[field.name]; !ok {
+			names = append(names, field.name)
+		}
+
+		byName[field.name] = append(byName[field.name], field)
+	}
+
+	var dominant []jsonField
+
+	for _, name := range names {
+		candidates := byName[name]
+		shallowest := slices.MinFunc(candidates, func(a jsonField, b jsonField) int { return a.depth - b.depth }).depth
+
+		candidates = slices.DeleteFunc(slices.Clone(candidates), func(f jsonField) bool { return f.depth > shallowest })
+
+		if len(candidates) > 1 {
+			candidates = slices.DeleteFunc(candidates, func(f jsonField) bool { return !f.tagged })
+		}
+
+		if len(candidates) == 1 {
+			dominant = append(dominant, candidates[0])
+		}
+	}
+
+	return dominant
+}
+
+// validate checks a value decoded with json.Decoder.UseNumber against the schema, at is the path of the value
+// in the body, empty for the body itself
+func (s *schemas) validate(schema *Schema, value any, at string) error {
+	if schema.Ref != "" {
+		return s.validate(s.components[strings.TrimPrefix(schema.Ref, componentsPrefix)], value, at)
+	}
+
+	if len(schema.AnyOf) > 0 {
+		var first error
+
+		for _, alternative := range schema.AnyOf {
+			err := s.validate(alternative, value, at)
+
+			if err == nil {
+				return nil
+			}
+
+			if first == nil && (value != nil || !slices.Contains(alternative.Type, "null")) {
+				first = err
+			}
+		}
+
+		return first
+	}
+
+	if len(schema.Type) > 0 && !slices.ContainsFunc(schema.Type, func(t string) bool { return isJSONType(value, t) }) {
+		return fmt.Errorf("%sexpected %s, got %s", prefixOf(at), strings.Join(schema.Type, " or "), jsonTypeOf(value))
+	}
+
+	switch value := value.(type) {
+	case string:
+		if len(schema.Enum) > 0 && !slices.Contains(schema.Enum, value) {
+			return fmt.Errorf("%smust be one of %s", prefixOf(at), strings.Join(schema.Enum, ", "))
+		}
+	case []any:
+		if schema.Items == nil {
+			return nil
+		}
+
+		for i, item := range value {
+			if err := s.validate(schema.Items, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		for _, name := range schema.Required {
+			if _, ok := value[name]; !ok {
+				return fmt.Errorf("%s is required", joinPath(at, name))
+			}
+		}
+
+		for _, name := range slices.Sorted(maps.Keys(value)) {
+			prop, ok := schema.Properties[name]
+
+			if !ok {
+				prop = schema.AdditionalProperties
+			}
+
+			if prop == nil {
+				continue
+			}
+
+			if err := s.validate(prop, value[name], joinPath(at, name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func isJSONType(value any, t string) bool {
+	if t == "integer" {
+		number, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+
+		_, err := strconv.ParseInt(number.String(), 10, 64)
+		return err == nil
+	}
+
+	return jsonTypeOf(value) == t
+}
+
+func jsonTypeOf(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	}
+
+	return "object"
+}
+
+func joinPath(at string, name string) string {
+	if at == "" {
+		return name
+	}
+
+	return at + "." + name
+}
+
+func prefixOf(at string) string {
+	if at == "" {
+		return ""
+	}
+
+	return at + ": "
+}
@@ -0,0 +1,304 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gin-gonic/gin"
+)
+
+// PrincipalKey is the key of the context holding the name of the principal authenticated by a client certificate
+const PrincipalKey = "principal"
+
+// settle is how long files must stay unchanged before the certificates are read again,
+// secret stores often replace them in several steps
+const settle = 200 * time.Millisecond
+
+// clientAuthTypes are the client authentication modes by name
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"none":               tls.NoClientCert,
+	"request":            tls.RequestClientCert,
+	"require":            tls.RequireAnyClientCert,
+	"verify_if_given":    tls.VerifyClientCertIfGiven,
+	"require_and_verify": tls.RequireAndVerifyClientCert,
+}
+
+// ParseClientAuth parses a client authentication mode, an empty mode verifies the certificates of every client
+// when a client CA is set and asks for none otherwise
+func ParseClientAuth(mode string, clientCA bool) (tls.ClientAuthType, error) {
+	if mode == "" {
+		if clientCA {
+			return tls.RequireAndVerifyClientCert, nil
+		}
+
+		return tls.NoClientCert, nil
+	}
+
+	auth, ok := clientAuthTypes[mode]
+	if !ok {
+		return 0, fmt.Errorf("must be none, request, require, verify_if_given or require_and_verify, got %q", mode)
+	}
+
+	return auth, nil
+}
+
+// VerifiesClientCerts tells whether a client authentication mode verifies the certificates clients present,
+// principals are only matched against verified certificates
+func VerifiesClientCerts(auth tls.ClientAuthType) bool {
+	return auth == tls.VerifyClientCertIfGiven || auth == tls.RequireAndVerifyClientCert
+}
+
+// TLSOptions serves the API over TLS. The files are read again when they change, so renewed certificates
+// are used without a restart.
+type TLSOptions struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile holds the certificates of the authorities client certificates are verified against
+	ClientCAFile string
+	ClientAuth   tls.ClientAuthType
+	// Principals authorize the requests of clients by the subject of their verified certificate, every client
+	// is authorized when there are none
+	Principals []Principal
+}
+
+// Principal is a client identified by its certificate
+type Principal struct {
+	Name string `mapstructure:"name"`
+	// Subjects are matched against the common name and the DNS, URI and email names of certificates,
+	// * matches any part of a name between slashes, e.g. spiffe://example.org/ns/ops/*
+	Subjects []string `mapstructure:"subjects"`
+	// ReadOnly principals can only send GET and HEAD requests
+	ReadOnly bool `mapstructure:"read_only"`
+}
+
+// Validate checks the subject patterns of the principal
+func (p *Principal) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("a principal needs a name")
+	}
+
+	if len(p.Subjects) == 0 {
+		return fmt.Errorf("principal %s needs at least one subject", p.Name)
+	}
+
+	for _, subject := range p.Subjects {
+		if _, err := path.Match(subject, ""); err != nil {
+			return fmt.Errorf("principal %s: invalid subject %q: %w", p.Name, subject, err)
+		}
+	}
+
+	return nil
+}
+
+// matches tells whether a name of the certificate matches a subject of the principal
+func (p *Principal) matches(cert *x509.Certificate) bool {
+	names := []string{cert.Subject.CommonName}
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+
+	for _, subject := range p.Subjects {
+		for _, name := range names {
+			if ok, _ := path.Match(subject, name); ok && name != "" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// certificates holds the last certificates read from the files of the TLS options
+type certificates struct {
+	opts TLSOptions
+	// files are the contents last read, the certificates are only parsed again when they change
+	files     [][]byte
+	cert      atomic.Pointer[tls.Certificate]
+	clientCAs atomic.Pointer[x509.CertPool]
+}
+
+// load reads the files and replaces the certificates when they changed, the current ones stay on errors
+func (c *certificates) load() error {
+	paths := []string{c.opts.CertFile, c.opts.KeyFile}
+
+	if c.opts.ClientCAFile != "" {
+		paths = append(paths, c.opts.ClientCAFile)
+	}
+
+	files := make([][]byte, len(paths))
+
+	for i, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("unable to read %s: %w", p, err)
+		}
+
+		files[i] = data
+	}
+
+	if slices.EqualFunc(files, c.files, bytes.Equal) {
+		return nil
+	}
+
+	cert, err := tls.X509KeyPair(files[0], files[1])
+	if err != nil {
+		return fmt.Errorf("invalid certificate or key: %w", err)
+	}
+
+	if c.opts.ClientCAFile != "" {
+		pool := x509.NewCertPool()
+
+		if !pool.AppendCertsFromPEM(files[2]) {
+			return fmt.Errorf("%s holds no PEM certificate", c.opts.ClientCAFile)
+		}
+
+		c.clientCAs.Store(pool)
+	}
+
+	reloaded := c.files != nil
+	c.files = files
+	c.cert.Store(&cert)
+
+	if reloaded {
+		slog.Info("api: TLS certificates reloaded", "cert_file", c.opts.CertFile)
+	}
+
+	return nil
+}
+
+// watch reads the certificates again when the directories holding them change until ctx is done.
+// Directories are watched rather than files since Kubernetes replaces the symlinks of mounted secrets.
+func (c *certificates) watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	dirs := map[string]bool{}
+
+	for _, p := range []string{c.opts.CertFile, c.opts.KeyFile, c.opts.ClientCAFile} {
+		if p == "" || dirs[filepath.Dir(p)] {
+			continue
+		}
+
+		dirs[filepath.Dir(p)] = true
+
+		if err := watcher.Add(filepath.Dir(p)); err != nil {
+			watcher.Close()
+			return fmt.Errorf("unable to watch %s: %w", filepath.Dir(p), err)
+		}
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		var reload <-chan time.Time
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				reload = time.After(settle)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+
+				slog.Warn("api: watching the TLS certificates failed", "error", err)
+			case <-reload:
+				reload = nil
+
+				if err := c.load(); err != nil {
+					slog.Error("api: unable to reload the TLS certificates, keeping the current ones", "error", err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// config is the TLS configuration of the server, it always hands out the last certificates read
+func (c *certificates) config() *tls.Config {
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: c.opts.ClientAuth,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return c.cert.Load(), nil
+		},
+	}
+
+	return &tls.Config{
+		MinVersion: base.MinVersion,
+		NextProtos: base.NextProtos,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cfg := base.Clone()
+			cfg.ClientCAs = c.clientCAs.Load()
+			return cfg, nil
+		},
+	}
+}
+
+// SetPrincipals changes the principals authorizing the requests received from now on, it has no effect
+// unless the API is served over TLS
+func (api *Api) SetPrincipals(principals []Principal) {
+	api.principals.Store(&principals)
+}
+
+// authorize maps the verified client certificate of a request to a principal, requests are rejected
+// when principals are set and none matches
+func (api *Api) authorize(ctx *gin.Context) {
+	principals := *api.principals.Load()
+
+	if len(principals) == 0 {
+		ctx.Next()
+		return
+	}
+
+	state := ctx.Request.TLS
+
+	if state == nil || len(state.VerifiedChains) == 0 {
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, errorBody(ctx, http.StatusUnauthorized, "a verified client certificate is required"))
+		return
+	}
+
+	cert := state.VerifiedChains[0][0]
+
+	for _, p := range principals {
+		if !p.matches(cert) {
+			continue
+		}
+
+		if p.ReadOnly && ctx.Request.Method != http.MethodGet && ctx.Request.Method != http.MethodHead {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, errorBody(ctx, http.StatusForbidden, fmt.Sprintf("principal %s is read only", p.Name)))
+			return
+		}
+
+		ctx.Set(PrincipalKey, p.Name)
+		ctx.Next()
+		return
+	}
+
+	ctx.AbortWithStatusJSON(http.StatusForbidden, errorBody(ctx, http.StatusForbidden, fmt.Sprintf("no principal matches the certificate of %q", cert.Subject.CommonName)))
+}
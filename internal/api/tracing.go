@@ -0,0 +1,59 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/wolzey/taskboard/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceRequests starts the span of each request, continuing the trace of the caller when it sends a traceparent header
+func traceRequests(ctx *gin.Context) {
+	reqCtx := otel.GetTextMapPropagator().Extract(ctx.Request.Context(), propagation.HeaderCarrier(ctx.Request.Header))
+
+	route := ctx.FullPath()
+	name := ctx.Request.Method
+
+	if route != "" {
+		name += " " + route
+	}
+
+	attrs := []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String(ctx.Request.Method),
+		semconv.URLPath(ctx.Request.URL.Path),
+		semconv.HTTPRoute(route),
+		semconv.ClientAddress(ctx.ClientIP()),
+		attribute.String("taskboard.request_id", ctx.GetString(RequestIDKey)),
+	}
+
+	if queue := ctx.Param("queue"); queue != "" {
+		attrs = append(attrs, attribute.String("taskboard.queue", queue))
+	}
+
+	reqCtx, span := tracing.Tracer().Start(reqCtx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+	defer span.End()
+
+	ctx.Request = ctx.Request.WithContext(reqCtx)
+
+	ctx.Next()
+
+	status := ctx.Writer.Status()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+
+	if principal := ctx.GetString(PrincipalKey); principal != "" {
+		span.SetAttributes(attribute.String("taskboard.principal", principal))
+	}
+
+	if err := ctx.Errors.Last(); err != nil {
+		span.RecordError(err)
+	}
+
+	// Client errors are the caller's, only server errors fail the span
+	if status >= 500 {
+		span.SetStatus(codes.Error, "")
+	}
+}
@@ -0,0 +1,24 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wolzey/taskboard/internal/alerts"
+)
+
+type AlertsResponse struct {
+	Alerts []alerts.Alert `json:"alerts"`
+	Count  int            `json:"count"`
+}
+
+// HandleGetAlerts lists the pending and firing alerts
+func (a *App) HandleGetAlerts(ctx *gin.Context) (int, any, error) {
+	if a.Alerts == nil {
+		return 404, nil, fmt.Errorf("alerting is not enabled")
+	}
+
+	active := a.Alerts.Alerts()
+
+	return 200, AlertsResponse{Alerts: active, Count: len(active)}, nil
+}
@@ -2,13 +2,21 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"slices"
 	"sort"
+	"sync"
+	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
+	"github.com/wolzey/taskboard/internal/alerts"
 	"github.com/wolzey/taskboard/internal/api"
 	"github.com/wolzey/taskboard/internal/db"
+	"github.com/wolzey/taskboard/internal/history"
+	"github.com/wolzey/taskboard/internal/index"
 )
 
 /**
@@ -33,15 +41,51 @@ func (a *queueState) ParseResults(res []int64) map[string]int64 {
 }
 
 type App struct {
-	Api         *api.Api
+	Api *api.Api
+	// Services are the current ones, or those taken by the request being handled
+	*Services
+
+	// services holds the current services, requests take them from it once
+	services atomic.Pointer[Services]
+	opts     *AppOptions
+	// ctx is that of Start, stops stop the background work started with it by name
+	ctx   context.Context
+	stops map[string]func()
+}
+
+// Services are the parts of the app Reload replaces. They aren't changed once in use: Reload swaps in new
+// ones while each request keeps those it took when it started.
+type Services struct {
 	Redis       *db.Redis
 	QueuePrefix string
+	// Indexer is nil unless indexing is enabled, searches then always scan
+	Indexer *index.Indexer
+	// ExportMask lists the fields, e.g. data.user.email, whose values are masked in exports
+	ExportMask []string
+	// History is nil unless queue history is enabled
+	History *history.Sampler
+	// Alerts is nil unless alerting is enabled
+	Alerts *alerts.Engine
+
+	// inUse is held for reading by the requests using the services, the Redis client they replaced is
+	// closed once it can be held for writing
+	inUse sync.RWMutex
 }
 
+// servicesKey is where requests keep the services they took
+const servicesKey = "taskboard.services"
+
 type AppOptions struct {
 	RedisOpts   *redis.Options
 	ApiOptions  *api.ApiOptions
 	QueuePrefix string
+	// Index enables the secondary indexes used by searches when set
+	Index      *index.Options
+	ExportMask []string
+	// History enables sampling the job counts of every queue when set
+	History *history.Options
+	// Alerts enables evaluating alerting rules when set
+	Alerts *alerts.Options
 }
 
 type QueuesResponse struct {
@@ -61,84 +105,502 @@ func NewApp(opts *AppOptions) *App {
 	client, err := db.NewClient(opts.RedisOpts)
 
 	if err != nil {
-		fmt.Println("Unable to initialize redis client")
+		slog.Error("app: unable to initialize the redis client", "error", err)
 		panic(err)
 	}
 
 	routes := api.NewApi(*opts.ApiOptions)
 
-	queuePrefix := opts.QueuePrefix
-	if queuePrefix == "" {
-		queuePrefix = "bull"
-	}
+	queuePrefix := queuePrefixOf(opts)
 
 	app := &App{
-		Redis:       client,
-		Api:         routes,
-		QueuePrefix: queuePrefix,
+		Services: &Services{
+			Redis:       client,
+			QueuePrefix: queuePrefix,
+			ExportMask:  opts.ExportMask,
+		},
+		Api:   routes,
+		opts:  opts,
+		stops: map[string]func(){},
+	}
+
+	if opts.Index != nil {
+		app.Indexer, err = index.New(client, queuePrefix, *opts.Index)
+
+		if err != nil {
+			slog.Error("app: unable to initialize the indexer", "error", err)
+			panic(err)
+		}
+	}
+
+	if opts.History != nil {
+		app.History, err = history.New(client, queuePrefix, *opts.History)
+
+		if err != nil {
+			slog.Error("app: unable to initialize the history sampler", "error", err)
+			panic(err)
+		}
+	}
+
+	if opts.Alerts != nil {
+		app.Alerts, err = alerts.New(client, queuePrefix, *opts.Alerts)
+
+		if err != nil {
+			slog.Error("app: unable to initialize alerting", "error", err)
+			panic(err)
+		}
 	}
 
+	app.services.Store(app.Services)
+	routes.Use(app.useServices)
 	app.Init()
 
 	return app
 }
 
-func (a *App) Init() {
-	a.Api.AddAPIHandler("/overview", "GET", a.GetJobsOverview)
-	a.Api.AddAPIHandler("/queues", "GET", a.GetQueues)
-	a.Api.AddAPIHandler("/queues/:queue", "GET", a.GetQueueDetails)
-	a.Api.AddAPIHandler("/queues/:queue/:id", "GET", a.HandleGetJobDetails)
-	a.Api.AddAPIHandler("/queues/:queue/:id/promote", "POST", a.HandlePromoteJob)
-	a.Api.AddAPIHandler("/queues/:queue/:id", "DELETE", a.HandleDeleteJob)
-	a.Api.AddAPIHandler("/queues/:queue/jobs/:state", "GET", a.HandleListJobs)
+func queuePrefixOf(opts *AppOptions) string {
+	if opts.QueuePrefix == "" {
+		return "bull"
+	}
+
+	return opts.QueuePrefix
 }
 
-func (a *App) GetQueueDetails(ctx *gin.Context) (int, any, error) {
-	queueName := a.withPrefix(ctx.Param("queue"))
+// Start runs the background work of the app, such as indexing, until ctx is done
+func (a *App) Start(ctx context.Context) {
+	a.ctx = ctx
 
-	results, err := a.Redis.Scripts.GetJobCounts(context.Background(), queueName, allStates)
+	a.run("detached", reattachDetachedJobs(a.Redis, a.QueuePrefix))
 
-	if err != nil {
-		return 500, nil, err
+	if a.Indexer != nil {
+		a.run("index", a.Indexer.Run)
 	}
 
-	parsed := allStates.ParseResults(results)
+	if a.History != nil {
+		a.run("history", a.History.Run)
+	}
 
-	return 200, CountsResponse{Counts: parsed}, nil
+	if a.Alerts != nil {
+		a.run("alerts", a.Alerts.Run)
+	}
 }
 
-func (a *App) GetQueues(ctx *gin.Context) (int, any, error) {
-	results, err := a.Redis.Scripts.GetQueues(context.Background(), a.QueuePrefix+":")
+// run runs work in the background until the context of Start is done or it is stopped
+func (a *App) run(name string, work func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(a.ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		work(ctx)
+	}()
+
+	a.stops[name] = func() {
+		cancel()
+		<-done
+	}
+}
+
+// useServices has each request take the current services once, they stay in use until it is done
+func (a *App) useServices(ctx *gin.Context) {
+	services := a.acquire()
+	defer services.inUse.RUnlock()
+
+	ctx.Set(servicesKey, services)
+	ctx.Next()
+}
+
+// acquire takes the current services, they are in use until inUse is unlocked
+func (a *App) acquire() *Services {
+	for {
+		services := a.services.Load()
+		services.inUse.RLock()
+
+		if a.services.Load() == services {
+			return services
+		}
+
+		// Reload replaced them meanwhile
+		services.inUse.RUnlock()
+	}
+}
+
+// bind calls a handler of the app with the services taken by the request
+func (a *App) bind(handler func(*App, *gin.Context) (int, any, error)) api.HandlerFunc {
+	return func(ctx *gin.Context) (int, any, error) {
+		return handler(&App{Api: a.Api, Services: ctx.MustGet(servicesKey).(*Services)}, ctx)
+	}
+}
+
+// timeParams bound the range of history and metrics
+var timeParams = []api.Param{
+	{Name: "from", Type: "string", Description: "Start of the range: a relative duration such as -6h, now, a date or an RFC 3339 time"},
+	{Name: "to", Type: "string", Description: "End of the range, now by default"},
+}
+
+// failureScanParam bounds the failed jobs read to group failures
+var failureScanParam = api.Param{Name: "limit", Type: "integer", Description: fmt.Sprintf("Number of failed jobs scanned, %d by default and at most %d", defaultFailureScan, maxFailureScan)}
+
+func (a *App) Init() {
+	a.Api.AddAPIHandler("/overview", "GET", a.bind((*App).GetJobsOverview), api.Operation{
+		ID:       "getOverview",
+		Summary:  "Counts the jobs of every queue by state",
+		Response: map[string]map[string]int64{},
+	})
+	a.Api.AddAPIHandler("/alerts", "GET", a.bind((*App).HandleGetAlerts), api.Operation{
+		ID:       "listAlerts",
+		Summary:  "Lists the pending and firing alerts",
+		Response: AlertsResponse{},
+	})
+	a.Api.AddAPIHandler("/queues", "GET", a.bind((*App).GetQueues), api.Operation{
+		ID:       "listQueues",
+		Summary:  "Lists the queues",
+		Response: QueuesResponse{},
+	})
+	a.Api.AddAPIHandler("/queues/:queue", "GET", a.bind((*App).GetQueueDetails), api.Operation{
+		ID:       "getQueueCounts",
+		Summary:  "Counts the jobs of a queue by state",
+		Response: CountsResponse{},
+	})
+	a.Api.AddAPIHandler("/queues/:queue/:id", "GET", a.bind((*App).HandleGetJobDetails), api.Operation{
+		ID:       "getJob",
+		Summary:  "Reads a job",
+		Response: ParsedJobResponse{},
+	})
+	a.Api.AddAPIHandler("/queues/:queue/:id/promote", "POST", a.bind((*App).HandlePromoteJob), api.Operation{
+		ID:       "promoteJob",
+		Summary:  "Moves a job to wait",
+		Request:  PromoteJobRequest{},
+		Response: PromoteJobResponse{},
+	})
+	a.Api.AddAPIHandler("/queues/:queue/:id/logs", "GET", a.bind((*App).HandleGetJobLogs), api.Operation{
+		ID:      "getJobLogs",
+		Summary: "Reads the lines logged by a job",
+		Query: []api.Param{
+			{Name: "after", Type: "integer", Description: "Only returns lines with a greater index, -1 by default"},
+			{Name: "offset", Type: "integer", Description: "Skips this many lines, or matches when searching"},
+			{Name: "limit", Type: "integer", Description: fmt.Sprintf("%d by default and at most %d", defaultLogsLimit, maxLogsLimit)},
+			{Name: "q", Type: "string", Description: "Only returns lines containing it"},
+		},
+		Response: JobLogsResponse{},
+	})
+	a.Api.AddAPIHandler("/queues/:queue/:id/flow", "GET", a.bind((*App).HandleGetFlow), api.Operation{
+		ID:      "getJobFlow",
+		Summary: "Reads the flow of a job",
+		Query: []api.Param{
+			{Name: "root", Type: "boolean", Description: "Starts from the root of the flow rather than the job, true by default"},
+			{Name: "depth", Type: "integer", Description: "Levels of children read"},
+			{Name: "format", Type: "string", Enum: []string{"json", "dot"}},
+		},
+		Response: FlowResponse{},
+		Produces: []string{"text/vnd.graphviz"},
+	})
+	a.Api.AddAPIHandler("/queues/:queue/:id/move", "POST", a.bind((*App).HandleMoveJob), api.Operation{
+		ID:       "moveJob",
+		Summary:  "Moves or copies a job to another queue",
+		Request:  MoveJobRequest{},
+		Response: MoveJobResponse{},
+	})
+	a.Api.AddAPIHandler("/queues/:queue/:id", "DELETE", a.bind((*App).HandleDeleteJob), api.Operation{
+		ID:       "deleteJob",
+		Summary:  "Removes a job and its logs",
+		Response: DeleteJobResponse{},
+	})
+	a.Api.AddAPIHandler("/queues/:queue/jobs/:state", "GET", a.bind((*App).HandleListJobs), api.Operation{
+		ID:      "listJobs",
+		Summary: "Lists a page of the jobs of a state",
+		Query: []api.Param{
+			{Name: "limit", Type: "integer", Description: fmt.Sprintf("%d by default and at most %d", defaultPageLimit, maxPageLimit)},
+			{Name: "order", Type: "string", Enum: []string{"asc", "desc"}},
+			{Name: "cursor", Type: "string", Description: "next or prev of a previous page"},
+			{Name: "filter", Type: "string", Description: "Only lists jobs whose data contains it"},
+			{Name: "count", Type: "boolean", Description: "Counts every job matching the filter instead of estimating it"},
+			{Name: "from", Type: "string", Description: "Unix milliseconds or a time such as -6h, jobs finished or due from then"},
+			{Name: "to", Type: "string", Description: "Unix milliseconds or a time such as now, jobs finished or due until then"},
+		},
+		Response: ListJobsResponse{},
+	})
+	a.Api.AddAPIHandler("/queues/:queue/jobs/:state/export", "GET", a.bind((*App).HandleExportJobs), api.Operation{
+		ID:      "exportJobs",
+		Summary: "Exports the jobs of a state",
+		Query: []api.Param{
+			{Name: "format", Type: "string", Enum: []string{"ndjson", "csv"}},
+			{Name: "q", Type: "string", Description: "Only exports the jobs matching this search query"},
+			{Name: "fields", Type: "string", Description: "Comma separated fields exported, e.g. id,data.user.id"},
+		},
+		Produces: []string{"application/x-ndjson", "text/csv"},
+	})
+	a.Api.AddAPIHandler("/queues/:queue/failures/groups", "GET", a.bind((*App).HandleGetFailureGroups), api.Operation{
+		ID:       "listFailureGroups",
+		Summary:  "Groups failed jobs by the error they failed with",
+		Query:    []api.Param{failureScanParam},
+		Response: FailureGroupsResponse{},
+	})
+	a.Api.AddAPIHandler("/queues/:queue/failures/groups/:group/retry", "POST", a.bind((*App).HandleRetryFailureGroup), api.Operation{
+		ID:       "retryFailureGroup",
+		Summary:  "Retries the failed jobs of a group",
+		Query:    []api.Param{failureScanParam},
+		Response: FailureGroupActionResponse{},
+	})
+	a.Api.AddAPIHandler("/queues/:queue/failures/groups/:group", "DELETE", a.bind((*App).HandleDeleteFailureGroup), api.Operation{
+		ID:       "deleteFailureGroup",
+		Summary:  "Removes the failed jobs of a group",
+		Query:    []api.Param{failureScanParam},
+		Response: FailureGroupActionResponse{},
+	})
+	a.Api.AddAPIHandler("/queues/:queue/workers", "GET", a.bind((*App).HandleGetWorkers), api.Operation{
+		ID:       "listWorkers",
+		Summary:  "Lists the workers connected to a queue",
+		Response: WorkersResponse{},
+	})
+	a.Api.AddAPIHandler("/queues/:queue/locks", "GET", a.bind((*App).HandleListActiveJobs), api.Operation{
+		ID:      "listJobLocks",
+		Summary: "Lists active jobs with the locks of their workers",
+		Query: []api.Param{
+			{Name: "start", Type: "integer"},
+			{Name: "limit", Type: "integer", Description: fmt.Sprintf("%d by default", defaultActiveJobsLimit)},
+		},
+		Response: ActiveJobsResponse{},
+	})
+	a.Api.AddAPIHandler("/queues/:queue/history", "GET", a.bind((*App).HandleGetQueueHistory), api.Operation{
+		ID:       "getQueueHistory",
+		Summary:  "Reads the job counts sampled over time",
+		Query:    append(slices.Clone(timeParams), api.Param{Name: "step", Type: "string", Description: "Duration between points, e.g. 5m"}),
+		Response: HistoryResponse{},
+	})
+	a.Api.AddAPIHandler("/queues/:queue/metrics", "GET", a.bind((*App).HandleGetQueueMetrics), api.Operation{
+		ID:       "getQueueMetrics",
+		Summary:  "Reads the throughput and failure rate of a queue",
+		Query:    append(slices.Clone(timeParams), api.Param{Name: "bucket", Type: "string", Enum: []string{"minute", "hour", "day"}}),
+		Response: MetricsResponse{},
+	})
+	a.Api.AddAPIHandler("/queues/:queue/move", "POST", a.bind((*App).HandleMoveJobs), api.Operation{
+		ID:       "moveJobs",
+		Summary:  "Moves or copies jobs to another queue",
+		Request:  MoveJobsRequest{},
+		Response: MoveJobsResponse{},
+	})
+	a.Api.AddAPIHandler("/queues/:queue/pause", "POST", a.bind((*App).HandlePauseQueue), api.Operation{
+		ID:       "pauseQueue",
+		Summary:  "Pauses a queue",
+		Response: QueueActionResponse{},
+	})
+	a.Api.AddAPIHandler("/queues/:queue/resume", "POST", a.bind((*App).HandleResumeQueue), api.Operation{
+		ID:       "resumeQueue",
+		Summary:  "Resumes a paused queue",
+		Response: QueueActionResponse{},
+	})
+	a.Api.AddAPIHandler("/queues/:queue/search", "GET", a.bind((*App).HandleSearchJobs), api.Operation{
+		ID:      "searchJobs",
+		Summary: "Searches the jobs matching a query",
+		Query: []api.Param{
+			{Name: "q", Type: "string", Required: true, Description: "Search query"},
+			{Name: "states", Type: "string", Description: "Comma separated states searched, all by default"},
+			{Name: "cursor", Type: "string", Description: "next of a previous page"},
+			{Name: "limit", Type: "integer", Description: fmt.Sprintf("%d by default and at most %d", defaultSearchLimit, maxSearchLimit)},
+			{Name: "count", Type: "boolean", Description: "Also counts every match"},
+		},
+		Response: SearchResponse{},
+	})
+	a.Api.AddAPIHandler("/queues/:queue/stalled", "GET", a.bind((*App).HandleGetStalledJobs), api.Operation{
+		ID:       "listStalledJobs",
+		Summary:  "Lists active jobs whose lock has expired",
+		Response: StalledJobsResponse{},
+	})
+	a.Api.AddAPIHandler("/queues/:queue/stalled/recover", "POST", a.bind((*App).HandleRecoverStalledJobs), api.Operation{
+		ID:              "recoverStalledJobs",
+		Summary:         "Moves stalled jobs back to wait, or to failed once stalled too many times",
+		Request:         RecoverStalledJobsRequest{},
+		OptionalRequest: true,
+		Response:        RecoverStalledJobsResponse{},
+	})
+	a.Api.AddAPIHandler("/queues/:queue/schedulers", "GET", a.bind((*App).HandleListJobSchedulers), api.Operation{
+		ID:       "listJobSchedulers",
+		Summary:  "Lists the job schedulers of a queue",
+		Response: JobSchedulersResponse{},
+	})
+	a.Api.AddAPIHandler("/queues/:queue/schedulers/:scheduler", "GET", a.bind((*App).HandleGetJobScheduler), api.Operation{
+		ID:       "getJobScheduler",
+		Summary:  "Reads a job scheduler and its next runs",
+		Query:    []api.Param{{Name: "next", Type: "integer", Description: fmt.Sprintf("Number of next runs, %d by default and at most %d", defaultNextRunCount, maxNextRunCount)}},
+		Response: JobScheduler{},
+	})
+	a.Api.AddAPIHandler("/queues/:queue/schedulers/:scheduler", "DELETE", a.bind((*App).HandleRemoveJobScheduler), api.Operation{
+		ID:       "removeJobScheduler",
+		Summary:  "Removes a job scheduler and its upcoming job",
+		Response: SchedulerActionResponse{},
+	})
+	a.Api.AddAPIHandler("/queues/:queue/schedulers/:scheduler/pause", "POST", a.bind((*App).HandlePauseJobScheduler), api.Operation{
+		ID:       "pauseJobScheduler",
+		Summary:  "Pauses a job scheduler",
+		Response: SchedulerActionResponse{},
+	})
+	a.Api.AddAPIHandler("/queues/:queue/schedulers/:scheduler/resume", "POST", a.bind((*App).HandleResumeJobScheduler), api.Operation{
+		ID:       "resumeJobScheduler",
+		Summary:  "Resumes a paused job scheduler",
+		Response: SchedulerActionResponse{},
+	})
+	a.Api.AddAPIHandler("/queues/:queue/schedulers/:scheduler/trigger", "POST", a.bind((*App).HandleTriggerJobScheduler), api.Operation{
+		ID:       "triggerJobScheduler",
+		Summary:  "Adds a job from the scheduler's template that runs immediately",
+		Response: SchedulerActionResponse{},
+	})
+}
+
+// OpenAPI is the specification of the API, built without connecting to Redis
+func OpenAPI() ([]byte, error) {
+	a := &App{Api: api.NewApi(api.ApiOptions{})}
+	a.Init()
+
+	return a.Api.OpenAPI()
+}
+
+// ListQueues returns the names of the queues, sorted
+func (a *App) ListQueues(ctx context.Context) ([]string, error) {
+	results, err := a.Redis.Scripts.GetQueues(ctx, a.QueuePrefix+":")
 
 	if err != nil {
-		return 400, nil, err
+		return nil, err
 	}
 
 	sort.Slice(results, func(i int, j int) bool {
 		return results[i] < results[j]
 	})
 
-	return 200, QueuesResponse{Queues: results, Count: len(results)}, nil
+	return results, nil
 }
 
-func (a *App) GetJobsOverview(ctx *gin.Context) (int, any, error) {
+// GetQueueCounts counts the jobs of a queue by state
+func (a *App) GetQueueCounts(ctx context.Context, queue string) (map[string]int64, error) {
+	results, err := a.Redis.Scripts.GetJobCounts(ctx, a.scriptsQueue(queue), allStates)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return allStates.ParseResults(results), nil
+}
+
+// GetOverview counts the jobs of every queue by state, queues that can't be counted are left out
+func (a *App) GetOverview(ctx context.Context) (map[string]map[string]int64, error) {
 	final := make(map[string]map[string]int64)
 
-	results, err := a.Redis.Scripts.GetQueues(context.Background(), a.QueuePrefix+":")
+	results, err := a.Redis.Scripts.GetQueues(ctx, a.QueuePrefix+":")
 
 	if err != nil {
-		return 500, nil, err
+		return nil, err
 	}
 
 	for _, v := range results {
-		fullKey := a.withPrefix(v)
-		counts, err := a.Redis.Scripts.GetJobCounts(context.Background(), fullKey, allStates)
+		counts, err := a.GetQueueCounts(ctx, v)
 
 		if err != nil {
 			continue
 		}
 
-		final[v] = allStates.ParseResults(counts)
+		final[v] = counts
+	}
+
+	return final, nil
+}
+
+type QueueActionResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+// IsQueuePaused tells whether workers stopped picking the jobs of a queue
+func (a *App) IsQueuePaused(ctx context.Context, queue string) (bool, error) {
+	return a.Redis.HExists(ctx, a.withPrefix(queue, "meta"), "paused").Result()
+}
+
+// PauseQueue stops workers from picking the jobs of a queue, waiting jobs are kept until it is resumed
+func (a *App) PauseQueue(ctx context.Context, queue string) (*QueueActionResponse, error) {
+	return a.pauseQueue(ctx, queue, true)
+}
+
+// ResumeQueue lets workers pick the jobs of a paused queue again
+func (a *App) ResumeQueue(ctx context.Context, queue string) (*QueueActionResponse, error) {
+	return a.pauseQueue(ctx, queue, false)
+}
+
+func (a *App) pauseQueue(ctx context.Context, queue string, pause bool) (*QueueActionResponse, error) {
+	exists, err := a.Redis.Exists(ctx, a.withPrefix(queue, "meta")).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if exists == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrQueueNotFound, queue)
+	}
+
+	result, err := a.Redis.Scripts.PauseQueue(ctx, a.scriptsQueue(queue), pause)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to pause queue: %w", err)
+	}
+
+	action := "resumed"
+	if pause {
+		action = "paused"
+	}
+
+	switch result {
+	case 1:
+		return &QueueActionResponse{Success: true, Message: fmt.Sprintf("Queue %s %s", queue, action)}, nil
+	case 2:
+		return &QueueActionResponse{Success: true, Message: fmt.Sprintf("Queue %s is already %s", queue, action)}, nil
+	default:
+		return nil, fmt.Errorf("unexpected result from pause operation: %d", result)
+	}
+}
+
+func (a *App) HandlePauseQueue(ctx *gin.Context) (int, any, error) {
+	return queueAction(a.PauseQueue(ctx.Request.Context(), ctx.Param("queue")))
+}
+
+func (a *App) HandleResumeQueue(ctx *gin.Context) (int, any, error) {
+	return queueAction(a.ResumeQueue(ctx.Request.Context(), ctx.Param("queue")))
+}
+
+func queueAction(res *QueueActionResponse, err error) (int, any, error) {
+	if errors.Is(err, ErrQueueNotFound) {
+		return 404, nil, err
+	}
+
+	if err != nil {
+		return 500, nil, err
+	}
+
+	return 200, res, nil
+}
+
+func (a *App) GetQueueDetails(ctx *gin.Context) (int, any, error) {
+	parsed, err := a.GetQueueCounts(ctx.Request.Context(), ctx.Param("queue"))
+
+	if err != nil {
+		return 500, nil, err
+	}
+
+	return 200, CountsResponse{Counts: parsed}, nil
+}
+
+func (a *App) GetQueues(ctx *gin.Context) (int, any, error) {
+	results, err := a.ListQueues(ctx.Request.Context())
+
+	if err != nil {
+		return 400, nil, err
+	}
+
+	return 200, QueuesResponse{Queues: results, Count: len(results)}, nil
+}
+
+func (a *App) GetJobsOverview(ctx *gin.Context) (int, any, error) {
+	final, err := a.GetOverview(ctx.Request.Context())
+
+	if err != nil {
+		return 500, nil, err
 	}
 
 	return 200, final, nil
@@ -0,0 +1,253 @@
+package app
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/wolzey/taskboard/internal/alerts"
+	"github.com/wolzey/taskboard/internal/api"
+	"github.com/wolzey/taskboard/internal/history"
+)
+
+// seed adds jobs of every state to the payments queue, with a flow, a job scheduler, metrics and two
+// failure reasons
+func seed(t *testing.T, rc *redis.Client) {
+	t.Helper()
+
+	ctx := t.Context()
+	now := time.Now().UnixMilli()
+
+	addJob := func(id string, fields ...any) {
+		base := []any{"name", "charge", "data", `{"user":{"id":42}}`, "opts", `{"attempts":3}`, "timestamp", now}
+		rc.HSet(ctx, "bull:payments:"+id, append(base, fields...)...)
+	}
+
+	for _, queue := range []string{"payments", "archive"} {
+		rc.HSet(ctx, "bull:"+queue+":meta", "opts.maxLenEvents", 10000)
+	}
+
+	for _, id := range []string{"1", "10", "11", "12"} {
+		addJob(id)
+		rc.LPush(ctx, "bull:payments:wait", id)
+	}
+	rc.RPush(ctx, "bull:payments:1:logs", "charging", "charged")
+
+	addJob("2", "delay", 60000)
+	rc.ZAdd(ctx, "bull:payments:delayed", redis.Z{Score: float64((now + 60000) * 4096), Member: "2"})
+
+	addJob("3", "failedReason", "connection refused", "finishedOn", now, "attemptsMade", 3)
+	addJob("4", "failedReason", "card declined", "finishedOn", now, "attemptsMade", 3)
+	rc.ZAdd(ctx, "bull:payments:failed", redis.Z{Score: float64(now), Member: "3"}, redis.Z{Score: float64(now), Member: "4"})
+
+	addJob("5", "processedOn", now)
+	addJob("6", "processedOn", now)
+	rc.LPush(ctx, "bull:payments:active", "5", "6")
+	rc.Set(ctx, "bull:payments:5:lock", "token", time.Minute)
+
+	addJob("7", "processedOn", now, "finishedOn", now, "returnvalue", `{"ok":true}`)
+	rc.ZAdd(ctx, "bull:payments:completed", redis.Z{Score: float64(now), Member: "7"})
+	rc.HSet(ctx, "bull:payments:metrics:completed", "count", 1, "prevTS", now, "prevCount", 0)
+	rc.LPush(ctx, "bull:payments:metrics:completed:data", 0)
+
+	addJob("8")
+	addJob("9", "parentKey", "bull:payments:8", "parent", `{"id":"8","queueKey":"bull:payments"}`)
+	rc.ZAdd(ctx, "bull:payments:waiting-children", redis.Z{Score: float64(now), Member: "8"})
+	rc.SAdd(ctx, "bull:payments:8:dependencies", "bull:payments:9")
+	rc.LPush(ctx, "bull:payments:wait", "9")
+
+	rc.ZAdd(ctx, "bull:payments:repeat", redis.Z{Score: float64(now + time.Hour.Milliseconds()), Member: "daily"})
+	rc.HSet(ctx, "bull:payments:repeat:daily", "name", "report", "pattern", "0 3 * * *", "ic", 4, "data", `{}`, "opts", `{"attempts":2}`)
+}
+
+// newTestApp serves the queues of mr, responses drifting from the specification fail
+func newTestApp(t *testing.T, mr *miniredis.Miniredis) *App {
+	t.Helper()
+
+	a := NewApp(&AppOptions{
+		RedisOpts:   &redis.Options{Addr: mr.Addr()},
+		ApiOptions:  &api.ApiOptions{GinMode: gin.TestMode, StrictResponses: true},
+		QueuePrefix: "bull",
+	})
+	t.Cleanup(func() { a.Redis.Close() })
+
+	return a
+}
+
+// TestResponses calls every operation of the API and fails when a handler responds with another type than
+// the one of the specification
+func TestResponses(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rc := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rc.Close() })
+
+	seed(t, rc)
+
+	a := NewApp(&AppOptions{
+		RedisOpts:   &redis.Options{Addr: mr.Addr()},
+		ApiOptions:  &api.ApiOptions{GinMode: gin.TestMode, StrictResponses: true},
+		QueuePrefix: "bull",
+		History:     &history.Options{Interval: time.Minute, Store: "redis"},
+		Alerts: &alerts.Options{
+			Interval:  time.Minute,
+			Notifiers: []alerts.NotifierConfig{{Name: "hook", Type: alerts.NotifierWebhook, URL: "http://localhost"}},
+			Rules:     []alerts.Rule{{Name: "failures", Metric: alerts.MetricCount, State: "failed", Op: ">", Threshold: 10, Notify: []string{"hook"}}},
+		},
+	})
+	t.Cleanup(func() { a.Redis.Close() })
+
+	server := httptest.NewServer(a.Api)
+	t.Cleanup(server.Close)
+
+	refused, _, _ := failureFingerprint("connection refused", nil)
+	declined, _, _ := failureFingerprint("card declined", nil)
+
+	// Operations changing jobs come after those reading them
+	cases := []struct {
+		operation string
+		method    string
+		path      string
+		body      string
+	}{
+		{"getOverview", "GET", "/overview", ""},
+		{"listAlerts", "GET", "/alerts", ""},
+		{"listQueues", "GET", "/queues", ""},
+		{"getQueueCounts", "GET", "/queues/payments", ""},
+		{"getJob", "GET", "/queues/payments/1", ""},
+		{"getJobLogs", "GET", "/queues/payments/1/logs", ""},
+		{"getJobFlow", "GET", "/queues/payments/9/flow", ""},
+		{"listJobs", "GET", "/queues/payments/jobs/wait", ""},
+		{"listJobs", "GET", "/queues/payments/jobs/active?limit=1", ""},
+		{"exportJobs", "GET", "/queues/payments/jobs/completed/export", ""},
+		{"listFailureGroups", "GET", "/queues/payments/failures/groups", ""},
+		{"listJobLocks", "GET", "/queues/payments/locks", ""},
+		{"getQueueHistory", "GET", "/queues/payments/history", ""},
+		{"getQueueMetrics", "GET", "/queues/payments/metrics", ""},
+		{"searchJobs", "GET", "/queues/payments/search?q=name:charge", ""},
+		{"listStalledJobs", "GET", "/queues/payments/stalled", ""},
+		{"listJobSchedulers", "GET", "/queues/payments/schedulers", ""},
+		{"getJobScheduler", "GET", "/queues/payments/schedulers/daily", ""},
+		{"promoteJob", "POST", "/queues/payments/2/promote", `{"fromState": "delayed"}`},
+		{"moveJob", "POST", "/queues/payments/10/move", `{"target": "archive"}`},
+		{"moveJobs", "POST", "/queues/payments/move", `{"target": "archive", "jobIds": ["11"]}`},
+		{"deleteJob", "DELETE", "/queues/payments/12", ""},
+		{"retryFailureGroup", "POST", "/queues/payments/failures/groups/" + refused + "/retry", ""},
+		{"deleteFailureGroup", "DELETE", "/queues/payments/failures/groups/" + declined, ""},
+		{"recoverStalledJobs", "POST", "/queues/payments/stalled/recover", ""},
+		{"pauseQueue", "POST", "/queues/payments/pause", ""},
+		{"resumeQueue", "POST", "/queues/payments/resume", ""},
+		{"pauseJobScheduler", "POST", "/queues/payments/schedulers/daily/pause", ""},
+		{"resumeJobScheduler", "POST", "/queues/payments/schedulers/daily/resume", ""},
+		{"triggerJobScheduler", "POST", "/queues/payments/schedulers/daily/trigger", ""},
+		{"removeJobScheduler", "DELETE", "/queues/payments/schedulers/daily", ""},
+	}
+
+	// listWorkers reads CLIENT LIST, which miniredis doesn't support
+	called := map[string]bool{"listWorkers": true}
+
+	for _, c := range cases {
+		called[c.operation] = true
+
+		req, err := http.NewRequestWithContext(t.Context(), c.method, server.URL+"/api"+c.path, strings.NewReader(c.body))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		res, err := http.DefaultClient.Do(req)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+
+		if res.StatusCode != 200 {
+			t.Errorf("%s %s: got status %d: %s", c.method, c.path, res.StatusCode, body)
+		}
+	}
+
+	spec, err := a.Api.OpenAPI()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Paths map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+		} `json:"paths"`
+	}
+
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, operations := range doc.Paths {
+		for method, op := range operations {
+			if !called[op.OperationID] {
+				t.Errorf("%s %s: operation %s isn't called", strings.ToUpper(method), path, op.OperationID)
+			}
+		}
+	}
+}
+
+// TestLegacySchedulerKey reaches a legacy repeatable job, whose key holds colons and the slashes of its cron
+// pattern, through an escaped path segment
+func TestLegacySchedulerKey(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rc := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rc.Close() })
+
+	key := "report:::UTC:*/5 * * * *"
+	rc.ZAdd(t.Context(), "bull:payments:repeat", redis.Z{Score: float64(time.Now().Add(time.Minute).UnixMilli()), Member: key})
+
+	a := newTestApp(t, mr)
+	server := httptest.NewServer(a.Api)
+	t.Cleanup(server.Close)
+
+	path := server.URL + "/api/queues/payments/schedulers/" + url.PathEscape(key)
+	res, err := http.Get(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var scheduler JobScheduler
+	err = json.NewDecoder(res.Body).Decode(&scheduler)
+	res.Body.Close()
+
+	if err != nil || res.StatusCode != 200 {
+		t.Fatalf("got status %d: %v", res.StatusCode, err)
+	}
+
+	if scheduler.ID != key || !scheduler.Legacy || scheduler.Pattern != "*/5 * * * *" || scheduler.TZ != "UTC" {
+		t.Errorf("got %+v, want the legacy repeatable job %s", scheduler, key)
+	}
+
+	req, _ := http.NewRequestWithContext(t.Context(), "DELETE", path, nil)
+	res, err = http.DefaultClient.Do(req)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != 200 {
+		t.Fatalf("got status %d removing it", res.StatusCode)
+	}
+
+	if n, _ := rc.ZCard(t.Context(), "bull:payments:repeat").Result(); n != 0 {
+		t.Errorf("got %d repeatable jobs left, want 0", n)
+	}
+}
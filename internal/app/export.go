@@ -0,0 +1,495 @@
+package app
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/wolzey/taskboard/internal/api"
+	"github.com/wolzey/taskboard/internal/query"
+	"github.com/wolzey/taskboard/internal/scripts"
+)
+
+const (
+	exportPageSize = 500
+	// maskedValue replaces the values of masked fields
+	maskedValue = "***"
+)
+
+// ErrInvalidExport wraps errors caused by the export parameters given by the client
+var ErrInvalidExport = errors.New("invalid export")
+
+// defaultCSVColumns come first when no fields are selected, followed by the data and opts fields of the jobs
+var defaultCSVColumns = []string{"id", "state", "name", "timestamp", "processedOn", "finishedOn", "attemptsMade", "failedReason"}
+
+// Job hash fields holding numbers and JSON, they are exported as such
+var (
+	exportNumberFields = []string{"timestamp", "processedOn", "finishedOn", "delay", "priority"}
+	exportJSONFields   = []string{"data", "opts", "returnvalue", "stacktrace"}
+)
+
+type ExportOptions struct {
+	// Format is ndjson, the default, or csv
+	Format string
+	// Fields selects fields or paths into them, e.g. data.user.id. Every field is exported when empty.
+	Fields []string
+	// Query only exports the jobs matching a search query
+	Query string
+}
+
+// JobExport streams the jobs of a state, it is validated before anything is written
+type JobExport struct {
+	app   *App
+	queue string
+	state string
+	opts  ExportOptions
+}
+
+// NewJobExport validates the options of an export of the jobs of a state
+func (a *App) NewJobExport(queue string, state string, opts ExportOptions) (*JobExport, error) {
+	if !slices.Contains(searchableStates, state) {
+		return nil, fmt.Errorf("%w: invalid state %q: must be one of %s", ErrInvalidExport, state, strings.Join(searchableStates, ", "))
+	}
+
+	if opts.Format == "" {
+		opts.Format = "ndjson"
+	}
+
+	if opts.Format != "ndjson" && opts.Format != "csv" {
+		return nil, fmt.Errorf("%w: invalid format %q: must be ndjson or csv", ErrInvalidExport, opts.Format)
+	}
+
+	for _, field := range opts.Fields {
+		if field == "" || slices.Contains(strings.Split(field, "."), "") {
+			return nil, fmt.Errorf("%w: invalid field %q", ErrInvalidExport, field)
+		}
+	}
+
+	if opts.Query != "" {
+		if _, err := query.Parse(opts.Query, time.Now()); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidExport, err)
+		}
+	}
+
+	return &JobExport{app: a, queue: queue, state: state, opts: opts}, nil
+}
+
+func (e *JobExport) ContentType() string {
+	if e.opts.Format == "csv" {
+		return "text/csv"
+	}
+
+	return "application/x-ndjson"
+}
+
+func (e *JobExport) Filename() string {
+	return fmt.Sprintf("%s-%s.%s", e.queue, e.state, e.opts.Format)
+}
+
+// Write streams every job of the export to w, a page at a time
+func (e *JobExport) Write(ctx context.Context, w io.Writer) error {
+	var out recordWriter
+
+	if e.opts.Format == "csv" {
+		columns := e.opts.Fields
+
+		if len(columns) == 0 {
+			var err error
+
+			if columns, err = e.csvColumns(ctx); err != nil {
+				return err
+			}
+		}
+
+		out = &csvRecordWriter{w: csv.NewWriter(w), columns: columns}
+	} else {
+		out = &ndjsonRecordWriter{enc: json.NewEncoder(w), fields: e.opts.Fields}
+	}
+
+	err := e.each(ctx, func(records []map[string]any) error {
+		for _, record := range records {
+			maskRecord(record, e.app.ExportMask)
+		}
+
+		return out.Write(records)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return out.Close()
+}
+
+// csvColumns reads the jobs of the export once to find the columns of a CSV export without selected
+// fields: the default ones followed by the flattened data and opts fields of every job. Fields of
+// jobs added or updated once the export started may be left out.
+func (e *JobExport) csvColumns(ctx context.Context) ([]string, error) {
+	seen := map[string]bool{}
+
+	err := e.each(ctx, func(records []map[string]any) error {
+		for _, record := range records {
+			flat := map[string]any{}
+			flattenInto(flat, "data", record["data"])
+			flattenInto(flat, "opts", record["opts"])
+
+			for key := range flat {
+				if key != "data" && key != "opts" {
+					seen[key] = true
+				}
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var nested []string
+	for key := range seen {
+		nested = append(nested, key)
+	}
+	sort.Strings(nested)
+
+	return append(slices.Clone(defaultCSVColumns), nested...), nil
+}
+
+// each reads the jobs of the export a page at a time
+func (e *JobExport) each(ctx context.Context, fn func([]map[string]any) error) error {
+	if e.opts.Query != "" {
+		opts := SearchOptions{Query: e.opts.Query, States: []string{e.state}, Limit: maxSearchLimit, IDsOnly: true}
+
+		for {
+			res, err := e.app.SearchJobs(ctx, e.queue, opts)
+
+			if err != nil {
+				return err
+			}
+
+			ids := make([]string, len(res.Results))
+			for i, job := range res.Results {
+				ids[i] = job.ID
+			}
+
+			records, err := e.app.jobRecords(ctx, e.queue, e.state, ids)
+
+			if err != nil {
+				return err
+			}
+
+			if err := fn(records); err != nil {
+				return err
+			}
+
+			if res.Next == "" {
+				return nil
+			}
+
+			opts.Cursor = res.Next
+		}
+	}
+
+	pageOpts := scripts.PageOptions{Order: "desc", Min: "-inf", Max: "+inf", Limit: exportPageSize}
+
+	for {
+		page, err := e.app.Redis.Scripts.PaginateJobs(ctx, e.app.scriptsQueue(e.queue), e.state, pageOpts)
+
+		if err != nil {
+			return fmt.Errorf("failed to list jobs: %w", err)
+		}
+
+		ids := make([]string, len(page.Jobs))
+		for i, job := range page.Jobs {
+			ids[i] = job.ID
+		}
+
+		records, err := e.app.jobRecords(ctx, e.queue, e.state, ids)
+
+		if err != nil {
+			return err
+		}
+
+		if err := fn(records); err != nil {
+			return err
+		}
+
+		if !page.HasNext || len(page.Jobs) == 0 {
+			return nil
+		}
+
+		last := page.Jobs[len(page.Jobs)-1]
+		pageOpts.Position, pageOpts.Member = last.Position, last.ID
+	}
+}
+
+// jobRecords reads job hashes in a single round trip and converts them into records keyed by the
+// BullMQ field names, JSON fields are decoded. Jobs removed in the meantime are skipped.
+func (a *App) jobRecords(ctx context.Context, queue string, state string, ids []string) ([]map[string]any, error) {
+	pipe := a.Redis.Client.Pipeline()
+	hashes := make([]*redis.MapStringStringCmd, len(ids))
+
+	for i, id := range ids {
+		hashes[i] = pipe.HGetAll(ctx, a.withPrefix(queue, id))
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to read jobs: %w", err)
+	}
+
+	records := make([]map[string]any, 0, len(ids))
+
+	for i, id := range ids {
+		hash := hashes[i].Val()
+
+		if len(hash) == 0 {
+			continue
+		}
+
+		record := map[string]any{"id": id, "state": state}
+
+		for key, value := range hash {
+			switch {
+			case slices.Contains(exportNumberFields, key):
+				if num, err := strconv.ParseInt(value, 10, 64); err == nil {
+					record[key] = num
+				} else {
+					record[key] = value
+				}
+			case slices.Contains(exportJSONFields, key):
+				var decoded any
+				if err := json.Unmarshal([]byte(value), &decoded); err == nil {
+					record[key] = decoded
+				} else {
+					record[key] = value
+				}
+			case key == "atm" || key == "attemptsMade":
+				// BullMQ 5 stores attemptsMade as atm
+				num, _ := strconv.ParseInt(value, 10, 64)
+				record["attemptsMade"] = num
+			default:
+				record[key] = value
+			}
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// maskRecord replaces the values at the masked paths, e.g. data.user.email, when present
+func maskRecord(record map[string]any, masks []string) {
+	for _, mask := range masks {
+		path := strings.Split(mask, ".")
+		var value any = record
+
+		for i, segment := range path {
+			container, ok := value.(map[string]any)
+
+			if !ok {
+				break
+			}
+
+			if _, ok := container[segment]; !ok {
+				break
+			}
+
+			if i == len(path)-1 {
+				container[segment] = maskedValue
+				break
+			}
+
+			value = container[segment]
+		}
+	}
+}
+
+// lookupPath returns the value at a dotted path of a record, array elements are addressed with 0-based indexes
+func lookupPath(record map[string]any, path string) (any, bool) {
+	var value any = record
+
+	for _, segment := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]any:
+			next, ok := v[segment]
+			if !ok {
+				return nil, false
+			}
+			value = next
+		case []any:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// flattenInto adds the leaves of nested objects under dotted keys, arrays are kept whole
+func flattenInto(flat map[string]any, prefix string, value any) {
+	object, ok := value.(map[string]any)
+
+	if !ok {
+		flat[prefix] = value
+		return
+	}
+
+	for key, nested := range object {
+		flattenInto(flat, prefix+"."+key, nested)
+	}
+}
+
+func formatCSVValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+
+	encoded, err := json.Marshal(value)
+
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+
+	return string(encoded)
+}
+
+type recordWriter interface {
+	Write(records []map[string]any) error
+	Close() error
+}
+
+type ndjsonRecordWriter struct {
+	enc    *json.Encoder
+	fields []string
+}
+
+func (w *ndjsonRecordWriter) Write(records []map[string]any) error {
+	for _, record := range records {
+		var line any = record
+
+		if len(w.fields) > 0 {
+			selected := make(map[string]any, len(w.fields))
+
+			for _, field := range w.fields {
+				selected[field], _ = lookupPath(record, field)
+			}
+
+			line = selected
+		}
+
+		if err := w.enc.Encode(line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *ndjsonRecordWriter) Close() error {
+	return nil
+}
+
+// csvRecordWriter writes a header followed by a row per job
+type csvRecordWriter struct {
+	w       *csv.Writer
+	columns []string
+	started bool
+}
+
+func (w *csvRecordWriter) start() error {
+	w.started = true
+
+	return w.w.Write(w.columns)
+}
+
+func (w *csvRecordWriter) Write(records []map[string]any) error {
+	if !w.started {
+		if err := w.start(); err != nil {
+			return err
+		}
+	}
+
+	row := make([]string, len(w.columns))
+
+	for _, record := range records {
+		for i, column := range w.columns {
+			value, _ := lookupPath(record, column)
+			row[i] = formatCSVValue(value)
+		}
+
+		if err := w.w.Write(row); err != nil {
+			return err
+		}
+	}
+
+	w.w.Flush()
+
+	return w.w.Error()
+}
+
+func (w *csvRecordWriter) Close() error {
+	if !w.started {
+		if err := w.start(); err != nil {
+			return err
+		}
+	}
+
+	w.w.Flush()
+
+	return w.w.Error()
+}
+
+func (a *App) HandleExportJobs(ctx *gin.Context) (int, any, error) {
+	opts := ExportOptions{
+		Format: ctx.Query("format"),
+		Query:  ctx.Query("q"),
+	}
+
+	if fields := ctx.Query("fields"); fields != "" {
+		opts.Fields = strings.Split(fields, ",")
+	}
+
+	export, err := a.NewJobExport(ctx.Param("queue"), ctx.Param("state"), opts)
+
+	if errors.Is(err, ErrInvalidExport) {
+		return 400, nil, err
+	}
+
+	if err != nil {
+		return 500, nil, err
+	}
+
+	return 200, api.StreamResponse{
+		ContentType: export.ContentType(),
+		Filename:    export.Filename(),
+		Write: func(w io.Writer) error {
+			return export.Write(ctx.Request.Context(), w)
+		},
+	}, nil
+}
@@ -0,0 +1,315 @@
+package app
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/wolzey/taskboard/internal/scripts"
+)
+
+const (
+	defaultFailureScan = 10000
+	maxFailureScan     = 100000
+	failureScanPage    = 500
+	// failureFrames is the number of stack frames, from the top, that tell failures apart
+	failureFrames      = 3
+	failureSampleCount = 5
+)
+
+// ErrFailureGroupNotFound is returned when no failed job of the scanned ones is in the group
+var ErrFailureGroupNotFound = errors.New("failure group not found")
+
+var (
+	uuidPattern   = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	hexIDPattern  = regexp.MustCompile(`\b(0x)?[0-9a-fA-F]{8,}\b`)
+	numberPattern = regexp.MustCompile(`\d+`)
+	spacePattern  = regexp.MustCompile(`\s+`)
+)
+
+type FailureGroup struct {
+	// ID is a hash of the normalized reason and frames, it is stable across scans
+	ID     string   `json:"id"`
+	Reason string   `json:"reason"`
+	Frames []string `json:"frames"`
+	// Message is the failed reason of the last job of the group as it was recorded
+	Message string `json:"message"`
+	Count   int64  `json:"count"`
+	// FirstSeen and LastSeen are when the oldest and newest jobs of the group failed, in unix milliseconds
+	FirstSeen int64    `json:"first_seen"`
+	LastSeen  int64    `json:"last_seen"`
+	SampleIDs []string `json:"sample_ids"`
+	// Attempts counts the jobs of the group by the number of attempts they made
+	Attempts map[int64]int64 `json:"attempts"`
+
+	ids []string
+}
+
+type FailureGroupsResponse struct {
+	Queue string `json:"queue"`
+	// Scanned is the number of failed jobs grouped, the newest ones, out of Total
+	Scanned int64          `json:"scanned"`
+	Total   int64          `json:"total"`
+	Groups  []FailureGroup `json:"groups"`
+}
+
+type FailureGroupActionResponse struct {
+	Group string `json:"group"`
+	// Jobs are the jobs retried or deleted
+	Jobs []string `json:"jobs"`
+	// Skipped are jobs of the group that were not failed anymore
+	Skipped []string `json:"skipped"`
+}
+
+// normalizeFailure strips the parts of an error message or stack frame that differ between occurrences of
+// the same failure: UUIDs, hexadecimal ids and numbers, including line and column numbers
+func normalizeFailure(value string) string {
+	value = uuidPattern.ReplaceAllString(value, "<uuid>")
+	value = hexIDPattern.ReplaceAllStringFunc(value, func(match string) string {
+		// Long words made of hex letters only, e.g. "deadbeef", are not ids
+		if strings.ContainsAny(match, "0123456789") {
+			return "<id>"
+		}
+
+		return match
+	})
+	value = numberPattern.ReplaceAllString(value, "<n>")
+
+	return strings.TrimSpace(spacePattern.ReplaceAllString(value, " "))
+}
+
+// failureFingerprint returns the group of a failure, with the normalized reason and top frames of the
+// stack of the last attempt it hashes
+func failureFingerprint(reason string, stack []string) (string, string, []string) {
+	normalized := normalizeFailure(reason)
+	frames := []string{}
+
+	if len(stack) > 0 {
+		// The first line of a stack repeats the message, frames follow
+		for _, line := range strings.Split(stack[len(stack)-1], "\n")[1:] {
+			line = strings.TrimSpace(line)
+
+			if !strings.HasPrefix(line, "at ") {
+				continue
+			}
+
+			frames = append(frames, normalizeFailure(line))
+
+			if len(frames) == failureFrames {
+				break
+			}
+		}
+	}
+
+	sum := sha1.Sum([]byte(normalized + "\n" + strings.Join(frames, "\n")))
+
+	return hex.EncodeToString(sum[:8]), normalized, frames
+}
+
+// GetFailureGroups groups up to limit of the newest failed jobs of a queue by their normalized reason and
+// stack, groups are sorted by count then by when they were last seen
+func (a *App) GetFailureGroups(ctx context.Context, queue string, limit int64) (*FailureGroupsResponse, error) {
+	res := &FailureGroupsResponse{Queue: queue}
+	groups := map[string]*FailureGroup{}
+	pageOpts := scripts.PageOptions{Order: "desc", Min: "-inf", Max: "+inf", Limit: min(limit, failureScanPage)}
+
+	for res.Scanned < limit {
+		page, err := a.Redis.Scripts.PaginateJobs(ctx, a.scriptsQueue(queue), "failed", pageOpts)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to list failed jobs: %w", err)
+		}
+
+		res.Total = page.Total
+
+		pipe := a.Redis.Client.Pipeline()
+		fields := make([]*redis.SliceCmd, len(page.Jobs))
+
+		for i, job := range page.Jobs {
+			// BullMQ 5 stores attemptsMade as atm
+			fields[i] = pipe.HMGet(ctx, a.withPrefix(queue, job.ID), "failedReason", "stacktrace", "atm", "attemptsMade")
+		}
+
+		if len(page.Jobs) > 0 {
+			if _, err := pipe.Exec(ctx); err != nil {
+				return nil, fmt.Errorf("failed to read failed jobs: %w", err)
+			}
+		}
+
+		for i, job := range page.Jobs {
+			values := fields[i].Val()
+
+			// Removed in the meantime
+			if values[0] == nil && values[1] == nil {
+				continue
+			}
+
+			reason, _ := values[0].(string)
+			stacktrace, _ := values[1].(string)
+			attempts, _ := values[2].(string)
+			if attempts == "" {
+				attempts, _ = values[3].(string)
+			}
+
+			id, normalized, frames := failureFingerprint(reason, parseStackTrace(stacktrace))
+			finishedOn, _ := strconv.ParseInt(job.Position, 10, 64)
+			attemptsMade, _ := strconv.ParseInt(attempts, 10, 64)
+
+			group, ok := groups[id]
+
+			// Jobs are scanned newest first
+			if !ok {
+				group = &FailureGroup{ID: id, Reason: normalized, Frames: frames, Message: reason, LastSeen: finishedOn, Attempts: map[int64]int64{}}
+				groups[id] = group
+			}
+
+			group.Count++
+			group.FirstSeen = finishedOn
+			group.Attempts[attemptsMade]++
+			group.ids = append(group.ids, job.ID)
+
+			if len(group.SampleIDs) < failureSampleCount {
+				group.SampleIDs = append(group.SampleIDs, job.ID)
+			}
+		}
+
+		res.Scanned += int64(len(page.Jobs))
+
+		if !page.HasNext || len(page.Jobs) == 0 {
+			break
+		}
+
+		last := page.Jobs[len(page.Jobs)-1]
+		pageOpts.Position, pageOpts.Member = last.Position, last.ID
+		pageOpts.Limit = min(limit-res.Scanned, failureScanPage)
+	}
+
+	res.Groups = make([]FailureGroup, 0, len(groups))
+	for _, group := range groups {
+		res.Groups = append(res.Groups, *group)
+	}
+
+	slices.SortFunc(res.Groups, func(a, b FailureGroup) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(b.LastSeen, a.LastSeen), cmp.Compare(a.ID, b.ID))
+	})
+
+	return res, nil
+}
+
+// RetryFailureGroup moves the failed jobs of a group back to wait, or paused when the queue is paused, as
+// BullMQ retries jobs: their failure is cleared and their attempts start over
+func (a *App) RetryFailureGroup(ctx context.Context, queue string, group string, limit int64) (*FailureGroupActionResponse, error) {
+	return a.failureGroupAction(ctx, queue, group, limit, func(id string) (int64, error) {
+		return a.Redis.Scripts.RetryFailedJob(ctx, a.scriptsQueue(queue), id)
+	})
+}
+
+// DeleteFailureGroup deletes the failed jobs of a group
+func (a *App) DeleteFailureGroup(ctx context.Context, queue string, group string, limit int64) (*FailureGroupActionResponse, error) {
+	return a.failureGroupAction(ctx, queue, group, limit, func(id string) (int64, error) {
+		return a.Redis.Scripts.DeleteFailedJob(ctx, a.scriptsQueue(queue), id)
+	})
+}
+
+// failureGroupAction groups the failed jobs as GetFailureGroups does and runs action on each job of the
+// group, action returns 1 when the job was handled
+func (a *App) failureGroupAction(ctx context.Context, queue string, group string, limit int64, action func(id string) (int64, error)) (*FailureGroupActionResponse, error) {
+	groups, err := a.GetFailureGroups(ctx, queue, limit)
+
+	if err != nil {
+		return nil, err
+	}
+
+	i := slices.IndexFunc(groups.Groups, func(g FailureGroup) bool { return g.ID == group })
+
+	if i < 0 {
+		return nil, fmt.Errorf("%w: %s in the %d newest failed jobs of %s", ErrFailureGroupNotFound, group, groups.Scanned, queue)
+	}
+
+	res := &FailureGroupActionResponse{Group: group, Jobs: []string{}, Skipped: []string{}}
+
+	for _, id := range groups.Groups[i].ids {
+		result, err := action(id)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to process job %s: %w", id, err)
+		}
+
+		if result == 1 {
+			res.Jobs = append(res.Jobs, id)
+		} else {
+			res.Skipped = append(res.Skipped, id)
+		}
+	}
+
+	return res, nil
+}
+
+func parseFailureScan(ctx *gin.Context) (int64, error) {
+	value := ctx.Query("limit")
+
+	if value == "" {
+		return defaultFailureScan, nil
+	}
+
+	limit, err := strconv.ParseInt(value, 10, 64)
+
+	if err != nil || limit <= 0 || limit > maxFailureScan {
+		return 0, fmt.Errorf("invalid limit %q: must be between 1 and %d", value, maxFailureScan)
+	}
+
+	return limit, nil
+}
+
+func (a *App) HandleGetFailureGroups(ctx *gin.Context) (int, any, error) {
+	limit, err := parseFailureScan(ctx)
+
+	if err != nil {
+		return 400, nil, err
+	}
+
+	res, err := a.GetFailureGroups(ctx.Request.Context(), ctx.Param("queue"), limit)
+
+	if err != nil {
+		return 500, nil, err
+	}
+
+	return 200, res, nil
+}
+
+func (a *App) HandleRetryFailureGroup(ctx *gin.Context) (int, any, error) {
+	return a.handleFailureGroupAction(ctx, a.RetryFailureGroup)
+}
+
+func (a *App) HandleDeleteFailureGroup(ctx *gin.Context) (int, any, error) {
+	return a.handleFailureGroupAction(ctx, a.DeleteFailureGroup)
+}
+
+func (a *App) handleFailureGroupAction(ctx *gin.Context, action func(context.Context, string, string, int64) (*FailureGroupActionResponse, error)) (int, any, error) {
+	limit, err := parseFailureScan(ctx)
+
+	if err != nil {
+		return 400, nil, err
+	}
+
+	res, err := action(ctx.Request.Context(), ctx.Param("queue"), ctx.Param("group"), limit)
+
+	if errors.Is(err, ErrFailureGroupNotFound) {
+		return 404, nil, err
+	}
+
+	if err != nil {
+		return 500, nil, err
+	}
+
+	return 200, res, nil
+}
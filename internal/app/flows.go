@@ -0,0 +1,322 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wolzey/taskboard/internal/api"
+	"github.com/wolzey/taskboard/internal/scripts"
+)
+
+const (
+	defaultFlowDepth = 10
+	maxFlowDepth     = 50
+	maxFlowNodes     = 1000
+)
+
+type FlowOptions struct {
+	// FromRoot climbs parent links first so the whole flow is returned instead of the job's subtree
+	FromRoot bool
+	MaxDepth int
+}
+
+type FlowChildCounts struct {
+	Pending      int `json:"pending"`
+	Processed    int `json:"processed"`
+	Failed       int `json:"failed"`
+	Unsuccessful int `json:"unsuccessful"`
+}
+
+type FlowNode struct {
+	Key      string          `json:"key"`
+	Queue    string          `json:"queue"`
+	ID       string          `json:"id"`
+	Name     string          `json:"name"`
+	State    string          `json:"state"`
+	Counts   FlowChildCounts `json:"counts"`
+	Children []*FlowNode     `json:"children"`
+	// Cycle is set when the node was already part of the tree and was not expanded again
+	Cycle bool `json:"cycle,omitempty"`
+	// Truncated is set when the node has children that were not expanded because of depth or size limits
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+type FlowResponse struct {
+	Root      *FlowNode `json:"root"`
+	Nodes     int       `json:"nodes"`
+	Truncated bool      `json:"truncated"`
+}
+
+type flowBuilder struct {
+	ctx      context.Context
+	app      *App
+	maxDepth int
+	seen     map[string]bool
+	nodes    int
+	trimmed  bool
+}
+
+// GetFlow returns the dependency tree a job belongs to, following parent and child keys across queues
+func (a *App) GetFlow(ctx context.Context, queue string, id string, opts FlowOptions) (*FlowResponse, error) {
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = defaultFlowDepth
+	}
+
+	if opts.MaxDepth > maxFlowDepth {
+		opts.MaxDepth = maxFlowDepth
+	}
+
+	rootKey := a.withPrefix(queue, id)
+
+	if _, err := a.getFlowNode(ctx, rootKey); err != nil {
+		return nil, err
+	}
+
+	if opts.FromRoot {
+		var err error
+		rootKey, err = a.findFlowRoot(ctx, rootKey)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	b := &flowBuilder{
+		ctx:      ctx,
+		app:      a,
+		maxDepth: opts.MaxDepth,
+		seen:     make(map[string]bool),
+	}
+
+	root, err := b.build(rootKey, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &FlowResponse{Root: root, Nodes: b.nodes, Truncated: b.trimmed}, nil
+}
+
+// findFlowRoot follows parentKey links up to the top-most job that still exists
+func (a *App) findFlowRoot(ctx context.Context, key string) (string, error) {
+	visited := map[string]bool{key: true}
+
+	for range maxFlowDepth {
+		node, err := a.getFlowNode(ctx, key)
+
+		if err != nil {
+			return "", err
+		}
+
+		if node.ParentKey == "" || visited[node.ParentKey] {
+			return key, nil
+		}
+
+		if _, err := a.getFlowNode(ctx, node.ParentKey); errors.Is(err, scripts.ErrJobNotFound) {
+			return key, nil
+		} else if err != nil {
+			return "", err
+		}
+
+		visited[node.ParentKey] = true
+		key = node.ParentKey
+	}
+
+	return key, nil
+}
+
+func (a *App) getFlowNode(ctx context.Context, key string) (*scripts.FlowNode, error) {
+	queueKey, id := splitJobKey(key)
+	queue := scripts.Queue{Name: queueKey}
+
+	// Parents may be under other prefixes, those are known by their key only
+	if name, ok := strings.CutPrefix(queueKey, a.QueuePrefix+":"); ok {
+		queue = a.scriptsQueue(name)
+	}
+
+	return a.Redis.Scripts.GetFlowNode(ctx, queue, id)
+}
+
+func (b *flowBuilder) build(key string, depth int) (*FlowNode, error) {
+	queueKey, id := splitJobKey(key)
+
+	node := &FlowNode{
+		Key:      key,
+		Queue:    strings.TrimPrefix(queueKey, b.app.QueuePrefix+":"),
+		ID:       id,
+		Children: []*FlowNode{},
+	}
+
+	if b.seen[key] {
+		node.Cycle = true
+		return node, nil
+	}
+
+	b.seen[key] = true
+	b.nodes++
+
+	details, err := b.app.getFlowNode(b.ctx, key)
+
+	if errors.Is(err, scripts.ErrJobNotFound) {
+		// Children removed by removeOnComplete / removeOnFail are still referenced by their parent
+		node.State = "missing"
+		return node, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	node.Name = details.Name
+	node.State = details.State
+	node.Counts = FlowChildCounts{
+		Pending:      len(details.Pending),
+		Processed:    len(details.Processed),
+		Failed:       len(details.Failed),
+		Unsuccessful: len(details.Unsuccessful),
+	}
+
+	children := slices.Concat(details.Pending, details.Processed, details.Failed, details.Unsuccessful)
+	slices.Sort(children)
+	children = slices.Compact(children)
+
+	if len(children) == 0 {
+		return node, nil
+	}
+
+	if depth >= b.maxDepth || b.nodes >= maxFlowNodes {
+		node.Truncated = true
+		b.trimmed = true
+		return node, nil
+	}
+
+	for _, childKey := range children {
+		if b.nodes >= maxFlowNodes {
+			node.Truncated = true
+			b.trimmed = true
+			break
+		}
+
+		child, err := b.build(childKey, depth+1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		node.Children = append(node.Children, child)
+	}
+
+	return node, nil
+}
+
+// splitJobKey splits a full job key such as bull:queue:1 into its queue key and job id.
+// BullMQ does not allow colons in job ids so the last segment is always the id.
+func splitJobKey(key string) (string, string) {
+	idx := strings.LastIndex(key, ":")
+
+	if idx == -1 {
+		return "", key
+	}
+
+	return key[:idx], key[idx+1:]
+}
+
+var flowStateColors = map[string]string{
+	"completed":        "palegreen",
+	"failed":           "salmon",
+	"active":           "lightblue",
+	"waiting-children": "khaki",
+	"delayed":          "lightgrey",
+	"prioritized":      "lightyellow",
+	"wait":             "white",
+	"paused":           "white",
+	"missing":          "grey",
+}
+
+// renderFlowDot renders a flow tree as a Graphviz digraph
+func renderFlowDot(flow *FlowResponse) []byte {
+	var sb strings.Builder
+
+	sb.WriteString("digraph flow {\n")
+	sb.WriteString("  node [shape=box, style=\"rounded,filled\", fontname=\"Helvetica\"];\n")
+
+	var walk func(node *FlowNode)
+	walk = func(node *FlowNode) {
+		if !node.Cycle {
+			color, ok := flowStateColors[node.State]
+			if !ok {
+				color = "white"
+			}
+
+			label := fmt.Sprintf("%s:%s\\n%s\\n(%s)", node.Queue, node.ID, node.Name, node.State)
+			if node.Truncated {
+				label += "\\n..."
+			}
+
+			fmt.Fprintf(&sb, "  %s [label=%s, fillcolor=%s];\n", strconv.Quote(node.Key), dotQuote(label), color)
+		}
+
+		for _, child := range node.Children {
+			fmt.Fprintf(&sb, "  %s -> %s;\n", strconv.Quote(node.Key), strconv.Quote(child.Key))
+			walk(child)
+		}
+	}
+
+	walk(flow.Root)
+	sb.WriteString("}\n")
+
+	return []byte(sb.String())
+}
+
+// dotQuote quotes a label while keeping the \n line breaks understood by Graphviz
+func dotQuote(s string) string {
+	return "\"" + strings.ReplaceAll(s, "\"", "\\\"") + "\""
+}
+
+func (a *App) HandleGetFlow(ctx *gin.Context) (int, any, error) {
+	queue := ctx.Param("queue")
+	id := SerializedId(ctx.Param("id"))
+
+	if !id.IsValid() {
+		return 400, nil, fmt.Errorf("invalid job id")
+	}
+
+	opts := FlowOptions{FromRoot: ctx.DefaultQuery("root", "true") != "false"}
+
+	if depth := ctx.Query("depth"); depth != "" {
+		parsed, err := strconv.Atoi(depth)
+
+		if err != nil {
+			return 400, nil, fmt.Errorf("invalid depth: %w", err)
+		}
+
+		opts.MaxDepth = parsed
+	}
+
+	format := ctx.DefaultQuery("format", "json")
+
+	if format != "json" && format != "dot" {
+		return 400, nil, fmt.Errorf("invalid format: must be one of json, dot")
+	}
+
+	flow, err := a.GetFlow(ctx.Request.Context(), queue, id.String(), opts)
+
+	if errors.Is(err, scripts.ErrJobNotFound) {
+		return 404, nil, fmt.Errorf("job %s not found", id)
+	}
+
+	if err != nil {
+		return 500, nil, err
+	}
+
+	if format == "dot" {
+		return 200, api.RawResponse{ContentType: "text/vnd.graphviz; charset=utf-8", Body: renderFlowDot(flow)}, nil
+	}
+
+	return 200, flow, nil
+}
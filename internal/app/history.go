@@ -0,0 +1,97 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wolzey/taskboard/internal/history"
+	"github.com/wolzey/taskboard/internal/query"
+)
+
+const (
+	defaultHistoryRange = 24 * time.Hour
+	// maxHistoryPoints bounds the buckets a step may split the range into
+	maxHistoryPoints = 10000
+)
+
+// ErrHistoryDisabled is returned when queue history isn't enabled in the configuration
+var ErrHistoryDisabled = errors.New("queue history is not enabled")
+
+type HistoryResponse struct {
+	Queue string `json:"queue"`
+	// From, To and Step are in milliseconds, Step is 0 when samples are returned as stored
+	From    int64            `json:"from"`
+	To      int64            `json:"to"`
+	Step    int64            `json:"step"`
+	Samples []history.Sample `json:"samples"`
+}
+
+// GetQueueHistory returns the samples of a queue taken between from and to, downsampled to step unless it is 0
+func (a *App) GetQueueHistory(ctx context.Context, queue string, from int64, to int64, step time.Duration) (*HistoryResponse, error) {
+	if a.History == nil {
+		return nil, ErrHistoryDisabled
+	}
+
+	samples, err := a.History.History(ctx, queue, from, to, step)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	if samples == nil {
+		samples = []history.Sample{}
+	}
+
+	return &HistoryResponse{Queue: queue, From: from, To: to, Step: step.Milliseconds(), Samples: samples}, nil
+}
+
+func (a *App) HandleGetQueueHistory(ctx *gin.Context) (int, any, error) {
+	now := time.Now()
+	from, to := now.Add(-defaultHistoryRange).UnixMilli(), now.UnixMilli()
+
+	if value := ctx.Query("from"); value != "" {
+		var ok bool
+		if from, ok = query.ParseTime(value, now); !ok {
+			return 400, nil, fmt.Errorf("invalid from %q: must be a relative duration such as -6h, now, a date or an RFC 3339 time", value)
+		}
+	}
+
+	if value := ctx.Query("to"); value != "" {
+		var ok bool
+		if to, ok = query.ParseTime(value, now); !ok {
+			return 400, nil, fmt.Errorf("invalid to %q: must be a relative duration such as -6h, now, a date or an RFC 3339 time", value)
+		}
+	}
+
+	if from > to {
+		return 400, nil, fmt.Errorf("from must not be after to")
+	}
+
+	var step time.Duration
+
+	if value := ctx.Query("step"); value != "" {
+		var err error
+		if step, err = time.ParseDuration(value); err != nil || step < time.Second {
+			return 400, nil, fmt.Errorf("invalid step %q: must be a duration of at least 1s, e.g. 5m", value)
+		}
+
+		if (to-from)/step.Milliseconds() > maxHistoryPoints {
+			return 400, nil, fmt.Errorf("step %s is too small for the range, at most %d points are returned", step, maxHistoryPoints)
+		}
+	}
+
+	res, err := a.GetQueueHistory(ctx.Request.Context(), ctx.Param("queue"), from, to, step)
+
+	if errors.Is(err, ErrHistoryDisabled) {
+		return 404, nil, err
+	}
+
+	if err != nil {
+		return 500, nil, err
+	}
+
+	return 200, res, nil
+}
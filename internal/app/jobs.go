@@ -2,14 +2,21 @@ package app
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math"
 	"regexp"
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/wolzey/taskboard/internal/query"
+	"github.com/wolzey/taskboard/internal/scripts"
 )
 
 type Job struct {
@@ -26,11 +33,6 @@ type Job struct {
 	Opts         string `redis:"opts" json:"options"`
 }
 
-type PaginatedJobResponse struct {
-	Jobs       []*Job `json:"jobs"`
-	TotalCount int64  `json:"totalCount"`
-}
-
 type ParsedJobResponse struct {
 	Job
 	StackTrace []string       `json:"stacktrace"`
@@ -38,9 +40,9 @@ type ParsedJobResponse struct {
 	Options    map[string]any `json:"options"`
 }
 
-func (a *App) GetJobDetails(queue string, id string) (*ParsedJobResponse, error) {
+func (a *App) GetJobDetails(ctx context.Context, queue string, id string) (*ParsedJobResponse, error) {
 	var res Job
-	cmd := a.Redis.Client.HGetAll(context.Background(), a.withPrefix(queue, id))
+	cmd := a.Redis.Client.HGetAll(ctx, a.withPrefix(queue, id))
 
 	err := cmd.Scan(&res)
 
@@ -48,152 +50,341 @@ func (a *App) GetJobDetails(queue string, id string) (*ParsedJobResponse, error)
 		return nil, err
 	}
 
+	if len(cmd.Val()) == 0 {
+		return nil, fmt.Errorf("%w: %s", scripts.ErrJobNotFound, id)
+	}
+
 	var jsonData map[string]any
 	if err := json.Unmarshal([]byte(res.JobData), &jsonData); err != nil {
-		fmt.Printf("Error parsing job data into struct: %v\n", err)
+		slog.WarnContext(ctx, "app: unable to parse job data", "job_id", id, "error", err)
 		return nil, err
 	}
 
-	var jsonStack []string
-	if err := json.Unmarshal([]byte(res.StackTrace), &jsonStack); err != nil {
-		jsonStack = nil
-	}
-
 	var jsonOptions map[string]any
 	if err := json.Unmarshal([]byte(res.Opts), &jsonOptions); err != nil {
-		fmt.Printf("Error parsing job options into struct: %v\n", err)
+		slog.WarnContext(ctx, "app: unable to parse job options", "job_id", id, "error", err)
 		return nil, err
 	}
 
 	return &ParsedJobResponse{
 		Job:        res,
 		Data:       jsonData,
-		StackTrace: jsonStack,
+		StackTrace: parseStackTrace(res.StackTrace),
 		Options:    jsonOptions,
 	}, nil
 }
 
+// parseStackTrace decodes the stacktrace field of a job, a JSON array holding the stack of each failed attempt
+func parseStackTrace(raw string) []string {
+	var stack []string
+	if err := json.Unmarshal([]byte(raw), &stack); err != nil {
+		return nil
+	}
+
+	return stack
+}
+
 func (a *App) withPrefix(args ...string) string {
 	final := slices.Concat([]string{a.QueuePrefix}, args)
 
 	return strings.Join(final, ":")
 }
 
-func (a *App) totalCount(queue string, state string) (int64, error) {
-	result := a.Redis.Client.ZCard(context.Background(), a.withPrefix(queue, state))
+// scriptsQueue is a queue of the prefix of the app, as scripts take it
+func (a *App) scriptsQueue(queue string) scripts.Queue {
+	return scripts.Queue{Prefix: a.QueuePrefix, Name: queue}
+}
 
-	count, err := result.Result()
+const (
+	defaultPageLimit = 25
+	maxPageLimit     = 500
+)
 
-	if err != nil {
-		return 0, err
-	}
+// ErrInvalidPage wraps errors caused by the pagination parameters given by the client
+var ErrInvalidPage = errors.New("invalid page")
+
+// ErrInvalidPromote wraps errors caused by the state jobs are promoted from
+var ErrInvalidPromote = errors.New("invalid promote")
+
+// timeScoredStates maps the sorted sets scored by time to the factor their scores are scaled by,
+// delayed jobs are scored by timestamp * 0x1000 plus a counter
+var timeScoredStates = map[string]int64{"completed": 1, "failed": 1, "delayed": 0x1000}
+
+type ListJobsOptions struct {
+	Limit int
+	// Order is asc or desc, newest first by default
+	Order string
+	// From and To bound, in unix milliseconds, when completed and failed jobs finished and when delayed jobs are due
+	From *int64
+	To   *int64
+	// Cursor is the next or prev value of a previous response, empty starts from the first job
+	Cursor string
+	// Filter only lists jobs whose data contains it
+	Filter string
+	// Count scans the whole state to count the jobs matching the filter, they are estimated otherwise
+	Count bool
+}
 
-	return count, nil
+type ListedJob struct {
+	ID string `json:"id"`
+	*ParsedJobResponse
 }
 
-type ListFilter struct {
-	Val string `redis:"value"`
+type ListJobsResponse struct {
+	// Count is the number of jobs of the state within the time bounds, or matching the filter
+	Count int64 `json:"count"`
+	// Estimated is set when Count extrapolates the matches of the jobs scanned for the page to the whole state
+	Estimated bool         `json:"estimated"`
+	Results   []*ListedJob `json:"results"`
+	// Next and Prev are the cursors of the adjacent pages, empty when there is none
+	Next string `json:"next"`
+	Prev string `json:"prev"`
 }
 
-func Filter[T any](s []T, predicate func(T) bool) []T {
-	filtered := make([]T, 0, len(s))
+// pageCursor points at the job a page starts after (or ends before when prev is set)
+type pageCursor struct {
+	prev     bool
+	position string
+	member   string
+}
+
+// ListJobs returns a page of the jobs of a state. Pages follow the job the cursor points at
+// rather than an offset, so they don't shift when jobs change state between calls.
+func (a *App) ListJobs(ctx context.Context, queue string, state string, opts ListJobsOptions) (*ListJobsResponse, error) {
+	if !slices.Contains(searchableStates, state) {
+		return nil, fmt.Errorf("%w: invalid state %q: must be one of %s", ErrInvalidPage, state, strings.Join(searchableStates, ", "))
+	}
+
+	if opts.Order == "" {
+		opts.Order = "desc"
+	}
 
-	for _, v := range s {
-		if predicate(v) {
-			filtered = append(filtered, v)
+	if opts.Order != "asc" && opts.Order != "desc" {
+		return nil, fmt.Errorf("%w: invalid order %q: must be asc or desc", ErrInvalidPage, opts.Order)
+	}
+
+	if opts.Limit <= 0 {
+		opts.Limit = defaultPageLimit
+	}
+
+	if opts.Limit > maxPageLimit {
+		opts.Limit = maxPageLimit
+	}
+
+	if opts.Filter != "" {
+		if opts.Order != "desc" || opts.From != nil || opts.To != nil {
+			return nil, fmt.Errorf("%w: filter can't be combined with order or time bounds", ErrInvalidPage)
 		}
+
+		return a.filterJobs(ctx, queue, state, opts)
 	}
 
-	return filtered
-}
+	pageOpts := scripts.PageOptions{Order: opts.Order, Min: "-inf", Max: "+inf", Limit: int64(opts.Limit)}
 
-func (a *App) listJobs(queue string, state string, start int64, stop int64, filter *ListFilter) ([]string, error) {
-	fmt.Println(a.withPrefix(queue, state))
-	result := a.Redis.Client.ZRevRange(context.Background(), a.withPrefix(queue, state), start, stop)
+	if opts.From != nil || opts.To != nil {
+		scale, ok := timeScoredStates[state]
+
+		if !ok {
+			return nil, fmt.Errorf("%w: time bounds are not supported for %s jobs", ErrInvalidPage, state)
+		}
+
+		if opts.From != nil {
+			pageOpts.Min = strconv.FormatInt(*opts.From*scale, 10)
+		}
+
+		if opts.To != nil {
+			pageOpts.Max = strconv.FormatInt(*opts.To*scale+scale-1, 10)
+		}
+	}
+
+	if opts.Cursor != "" {
+		cursor, err := decodePageCursor(opts.Cursor)
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPage, err)
+		}
 
-	if result.Err() != nil {
-		return nil, result.Err()
+		pageOpts.Prev = cursor.prev
+		pageOpts.Position = cursor.position
+		pageOpts.Member = cursor.member
 	}
 
-	results, err := result.Result()
+	page, err := a.Redis.Scripts.PaginateJobs(ctx, a.scriptsQueue(queue), state, pageOpts)
 
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
 	}
 
-	if filter != nil {
-		results = Filter(results, func(s string) bool {
-			details, err := a.GetJobDetails(queue, s)
+	res := &ListJobsResponse{Count: page.Total, Results: []*ListedJob{}}
+
+	for _, job := range page.Jobs {
+		details, err := a.GetJobDetails(ctx, queue, job.ID)
+
+		if err != nil {
+			slog.WarnContext(ctx, "app: unable to get job details", "job_id", job.ID, "error", err)
+			continue
+		}
+
+		res.Results = append(res.Results, &ListedJob{ID: job.ID, ParsedJobResponse: details})
+	}
 
-			if err != nil {
-				return false
-			}
+	// An empty page, e.g. after its jobs were removed, pages back and forth from the cursor itself
+	first := pageCursor{position: pageOpts.Position, member: pageOpts.Member}
+	last := first
 
-			ds, err := json.Marshal(details.Data)
+	if len(page.Jobs) > 0 {
+		first = pageCursor{position: page.Jobs[0].Position, member: page.Jobs[0].ID}
+		last = pageCursor{position: page.Jobs[len(page.Jobs)-1].Position, member: page.Jobs[len(page.Jobs)-1].ID}
+	}
 
-			if err != nil {
-				return false
-			}
+	if page.HasPrev {
+		first.prev = true
+		res.Prev = encodePageCursor(first)
+	}
 
-			return strings.Contains(string(ds), filter.Val)
-		})
+	if page.HasNext {
+		res.Next = encodePageCursor(last)
 	}
 
-	return results, nil
+	return res, nil
 }
 
-func (a *App) HandleListJobs(ctx *gin.Context) (int, any, error) {
-	var filter *ListFilter
+// filterJobs lists the jobs whose data contains the filter. It searches the state so pages only go forward.
+// Unless counting is requested, the matches are only counted when the first page scans the whole state.
+func (a *App) filterJobs(ctx context.Context, queue string, state string, opts ListJobsOptions) (*ListJobsResponse, error) {
+	found, err := a.SearchJobs(ctx, queue, SearchOptions{
+		Query:  "data~" + strconv.Quote(opts.Filter),
+		States: []string{state},
+		Cursor: opts.Cursor,
+		Limit:  opts.Limit,
+		Count:  opts.Count,
+	})
+
+	if errors.Is(err, ErrInvalidSearch) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPage, err)
+	}
 
-	state := ctx.Param("state")
-	queue := ctx.Param("queue")
-	start, _ := strconv.Atoi(ctx.Query("start"))
-	stop, _ := strconv.Atoi(ctx.Query("stop"))
-	dataFilter := ctx.Query("filter")
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ListJobsResponse{Results: []*ListedJob{}, Next: found.Next}
 
-	if stop == 0 {
-		stop = 25
+	for _, job := range found.Results {
+		res.Results = append(res.Results, &ListedJob{ID: job.ID, ParsedJobResponse: job.ParsedJobResponse})
 	}
 
-	if dataFilter != "" {
-		filter = &ListFilter{
-			Val: dataFilter,
+	switch {
+	case found.Total != nil:
+		res.Count = *found.Total
+	case opts.Cursor == "" && found.Next == "":
+		res.Count = int64(found.Matched)
+	case found.Scanned > 0:
+		counts, err := a.GetQueueCounts(ctx, queue)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to count jobs: %w", err)
 		}
+
+		res.Count = int64(math.Round(float64(found.Matched) / float64(found.Scanned) * float64(counts[state])))
+		res.Estimated = true
+	default:
+		res.Estimated = true
 	}
 
-	results, err := a.listJobs(queue, state, int64(start), int64(stop), filter)
+	return res, nil
+}
 
-	if err != nil {
-		fmt.Println("error in listing jobs from redis")
-		return 500, nil, err
+// Page cursors are opaque to clients, they encode the direction, position and id of a job
+func encodePageCursor(cursor pageCursor) string {
+	direction := "n"
+	if cursor.prev {
+		direction = "p"
 	}
 
-	count, err := a.totalCount(queue, state)
+	return base64.RawURLEncoding.EncodeToString([]byte(direction + ":" + cursor.position + ":" + cursor.member))
+}
+
+func decodePageCursor(cursor string) (pageCursor, error) {
+	invalid := fmt.Errorf("invalid cursor")
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
 
 	if err != nil {
-		fmt.Println("error in getting total count")
-		return 500, nil, err
+		return pageCursor{}, invalid
 	}
 
-	type Results struct {
-		Count   int64 `json:"count"`
-		Results any   `json:"results"`
+	// Job ids may contain colons, positions don't
+	parts := strings.SplitN(string(raw), ":", 3)
+
+	if len(parts) != 3 || (parts[0] != "n" && parts[0] != "p") || parts[2] == "" {
+		return pageCursor{}, invalid
 	}
 
-	jobs := []*ParsedJobResponse{}
+	if _, err := strconv.ParseFloat(parts[1], 64); err != nil {
+		return pageCursor{}, invalid
+	}
 
-	for _, jobId := range results {
-		details, err := a.GetJobDetails(queue, jobId)
+	return pageCursor{prev: parts[0] == "p", position: parts[1], member: parts[2]}, nil
+}
+
+// parsePageTime parses the from and to bounds, given in unix milliseconds or as accepted by queries, e.g. -1h
+func parsePageTime(value string) (*int64, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	if millis, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return &millis, nil
+	}
+
+	millis, ok := query.ParseTime(value, time.Now())
+
+	if !ok {
+		return nil, fmt.Errorf("invalid time %q", value)
+	}
+
+	return &millis, nil
+}
+
+func (a *App) HandleListJobs(ctx *gin.Context) (int, any, error) {
+	opts := ListJobsOptions{
+		Order:  ctx.Query("order"),
+		Cursor: ctx.Query("cursor"),
+		Filter: ctx.Query("filter"),
+		Count:  ctx.Query("count") == "true",
+	}
+
+	if limit := ctx.Query("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
 
 		if err != nil {
-			fmt.Println("unable to get job details for job id:", jobId)
-			continue
+			return 400, nil, fmt.Errorf("invalid limit: %w", err)
 		}
 
-		jobs = append(jobs, details)
+		opts.Limit = parsed
+	}
+
+	var err error
+
+	if opts.From, err = parsePageTime(ctx.Query("from")); err != nil {
+		return 400, nil, fmt.Errorf("invalid from: %w", err)
+	}
+
+	if opts.To, err = parsePageTime(ctx.Query("to")); err != nil {
+		return 400, nil, fmt.Errorf("invalid to: %w", err)
 	}
 
-	return 200, Results{Count: count, Results: jobs}, nil
+	results, err := a.ListJobs(ctx.Request.Context(), ctx.Param("queue"), ctx.Param("state"), opts)
+
+	if errors.Is(err, ErrInvalidPage) {
+		return 400, nil, err
+	}
+
+	if err != nil {
+		return 500, nil, err
+	}
+
+	return 200, results, nil
 }
 
 type SerializedId string
@@ -202,7 +393,7 @@ func (s SerializedId) IsValid() bool {
 	r, err := regexp.Compile("[0-9]+")
 
 	if err != nil {
-		fmt.Println("FAILED TO COMPILE REGEXP")
+		slog.Error("app: unable to compile the job id pattern", "error", err)
 		panic(err)
 	}
 
@@ -221,7 +412,11 @@ func (a *App) HandleGetJobDetails(ctx *gin.Context) (int, any, error) {
 		return 500, nil, fmt.Errorf("invalid job id")
 	}
 
-	results, err := a.GetJobDetails(queue, id.String())
+	results, err := a.GetJobDetails(ctx.Request.Context(), queue, id.String())
+
+	if errors.Is(err, scripts.ErrJobNotFound) {
+		return 404, nil, err
+	}
 
 	if err != nil {
 		return 500, nil, err
@@ -239,6 +434,39 @@ type PromoteJobResponse struct {
 	Message string `json:"message"`
 }
 
+// promotableStates are the states jobs can be moved to wait from
+var promotableStates = []string{"delayed", "failed", "completed", "waiting-children"}
+
+// PromoteJob moves a job of fromState to wait, the response is unsuccessful when the job is not in fromState
+func (a *App) PromoteJob(ctx context.Context, queue string, id string, fromState string) (*PromoteJobResponse, error) {
+	if !slices.Contains(promotableStates, fromState) {
+		return nil, fmt.Errorf("%w: fromState must be one of %s", ErrInvalidPromote, strings.Join(promotableStates, ", "))
+	}
+
+	result, err := a.Redis.Scripts.PromoteJob(ctx, a.scriptsQueue(queue), id, fromState)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to promote job: %w", err)
+	}
+
+	switch result {
+	case 1:
+		return &PromoteJobResponse{
+			Success: true,
+			Message: fmt.Sprintf("Job %s promoted from %s to waiting", id, fromState),
+		}, nil
+	case 0:
+		return &PromoteJobResponse{
+			Success: false,
+			Message: fmt.Sprintf("Job %s not found in %s state", id, fromState),
+		}, nil
+	case -1:
+		return nil, fmt.Errorf("%w: the script rejected state %s", ErrInvalidPromote, fromState)
+	default:
+		return nil, fmt.Errorf("unexpected result from promote operation: %d", result)
+	}
+}
+
 func (a *App) HandlePromoteJob(ctx *gin.Context) (int, any, error) {
 	queue := ctx.Param("queue")
 	id := SerializedId(ctx.Param("id"))
@@ -252,54 +480,52 @@ func (a *App) HandlePromoteJob(ctx *gin.Context) (int, any, error) {
 		return 400, nil, fmt.Errorf("invalid request body: %w", err)
 	}
 
-	// Validate fromState
-	validStates := map[string]bool{
-		"delayed":           true,
-		"failed":            true,
-		"completed":         true,
-		"waiting-children":  true,
+	res, err := a.PromoteJob(ctx.Request.Context(), queue, id.String(), req.FromState)
+
+	if errors.Is(err, ErrInvalidPromote) {
+		return 400, nil, err
+	}
+
+	if err != nil {
+		return 500, nil, err
 	}
 
-	if !validStates[req.FromState] {
-		return 400, nil, fmt.Errorf("invalid fromState: must be one of delayed, failed, completed, waiting-children")
+	if !res.Success {
+		return 404, res, nil
 	}
 
-	queueKey := a.withPrefix(queue)
-	result, err := a.Redis.Scripts.PromoteJob(context.Background(), queueKey, id.String(), req.FromState)
+	return 200, res, nil
+}
+
+type DeleteJobResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+// DeleteJob removes a job and its logs, the response is unsuccessful when the job does not exist
+func (a *App) DeleteJob(ctx context.Context, queue string, id string) (*DeleteJobResponse, error) {
+	result, err := a.Redis.Scripts.DeleteJob(ctx, a.scriptsQueue(queue), id)
 
 	if err != nil {
-		return 500, nil, fmt.Errorf("failed to promote job: %w", err)
+		return nil, fmt.Errorf("failed to delete job: %w", err)
 	}
 
 	switch result {
 	case 1:
-		return 200, PromoteJobResponse{
+		return &DeleteJobResponse{
 			Success: true,
-			Message: fmt.Sprintf("Job %s promoted from %s to waiting", id, req.FromState),
+			Message: fmt.Sprintf("Job %s deleted successfully", id),
 		}, nil
 	case 0:
-		return 404, PromoteJobResponse{
+		return &DeleteJobResponse{
 			Success: false,
-			Message: fmt.Sprintf("Job %s not found in %s state", id, req.FromState),
-		}, nil
-	case -1:
-		return 400, PromoteJobResponse{
-			Success: false,
-			Message: "Invalid state provided",
+			Message: fmt.Sprintf("Job %s not found", id),
 		}, nil
 	default:
-		return 500, PromoteJobResponse{
-			Success: false,
-			Message: "Unexpected result from promote operation",
-		}, nil
+		return nil, fmt.Errorf("unexpected result from delete operation: %d", result)
 	}
 }
 
-type DeleteJobResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
-}
-
 func (a *App) HandleDeleteJob(ctx *gin.Context) (int, any, error) {
 	queue := ctx.Param("queue")
 	id := SerializedId(ctx.Param("id"))
@@ -308,28 +534,15 @@ func (a *App) HandleDeleteJob(ctx *gin.Context) (int, any, error) {
 		return 400, nil, fmt.Errorf("invalid job id")
 	}
 
-	queueKey := a.withPrefix(queue)
-	result, err := a.Redis.Scripts.DeleteJob(context.Background(), queueKey, id.String())
+	res, err := a.DeleteJob(ctx.Request.Context(), queue, id.String())
 
 	if err != nil {
-		return 500, nil, fmt.Errorf("failed to delete job: %w", err)
+		return 500, nil, err
 	}
 
-	switch result {
-	case 1:
-		return 200, DeleteJobResponse{
-			Success: true,
-			Message: fmt.Sprintf("Job %s deleted successfully", id),
-		}, nil
-	case 0:
-		return 404, DeleteJobResponse{
-			Success: false,
-			Message: fmt.Sprintf("Job %s not found", id),
-		}, nil
-	default:
-		return 500, DeleteJobResponse{
-			Success: false,
-			Message: "Unexpected result from delete operation",
-		}, nil
+	if !res.Success {
+		return 404, res, nil
 	}
+
+	return 200, res, nil
 }
@@ -0,0 +1,319 @@
+package app
+
+import (
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/wolzey/taskboard/internal/scripts"
+)
+
+func TestPageCursor(t *testing.T) {
+	for _, cursor := range []pageCursor{
+		{position: "1700000000000", member: "42"},
+		{prev: true, position: "3", member: "repeat:daily:1700000000000"},
+		{position: "-1.5", member: "a:b:c"},
+	} {
+		got, err := decodePageCursor(encodePageCursor(cursor))
+
+		if err != nil || got != cursor {
+			t.Errorf("%+v: got %+v, %v after a round trip", cursor, got, err)
+		}
+	}
+
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+
+	for _, tampered := range []string{
+		"not base64!",
+		encode("n:1700000000000"),
+		encode("x:1:42"),
+		encode("n:one:42"),
+		encode("p:1:"),
+		encode(""),
+		base64.StdEncoding.EncodeToString([]byte("n:1:42>")),
+	} {
+		if got, err := decodePageCursor(tampered); err == nil {
+			t.Errorf("%q: got %+v, want an error", tampered, got)
+		}
+	}
+}
+
+func TestSearchCursor(t *testing.T) {
+	for _, cursor := range []searchCursor{
+		{pos: scripts.SearchPosition{StateIndex: 1, Offset: 0}},
+		{pos: scripts.SearchPosition{StateIndex: 3, Offset: 250}, offset: 250},
+		{indexed: true, offset: 75, pos: scripts.SearchPosition{Offset: 75}},
+	} {
+		got, err := decodeSearchCursor(encodeSearchCursor(cursor))
+
+		if err != nil {
+			t.Errorf("%+v: %v", cursor, err)
+			continue
+		}
+
+		if got.indexed != cursor.indexed || got.pos.Offset != cursor.pos.Offset || (!cursor.indexed && got.pos.StateIndex != cursor.pos.StateIndex) {
+			t.Errorf("%+v: got %+v after a round trip", cursor, got)
+		}
+	}
+
+	// An empty cursor starts from the first state
+	if got, err := decodeSearchCursor(""); err != nil || got.pos.StateIndex != 1 || got.pos.Offset != 0 {
+		t.Errorf("got %+v, %v for an empty cursor", got, err)
+	}
+
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+
+	for _, tampered := range []string{
+		"not base64!",
+		encode("1"),
+		encode("0:10"),
+		encode("-1:10"),
+		encode("1:-10"),
+		encode("i:ten"),
+		encode("x:10"),
+	} {
+		if got, err := decodeSearchCursor(tampered); err == nil {
+			t.Errorf("%q: got %+v, want an error", tampered, got)
+		}
+	}
+}
+
+// collect pages through a state with ListJobs, following the next cursors
+func collect(t *testing.T, a *App, state string, opts ListJobsOptions) []string {
+	t.Helper()
+
+	var ids []string
+
+	for range 20 {
+		page, err := a.ListJobs(t.Context(), "payments", state, opts)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids = append(ids, jobIDs(page.Results)...)
+
+		if page.Next == "" {
+			return ids
+		}
+
+		opts.Cursor = page.Next
+	}
+
+	t.Fatal("got more pages than jobs")
+	return nil
+}
+
+func TestListJobsPages(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rc := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rc.Close() })
+
+	ctx := t.Context()
+
+	// Jobs 1 to 7 completed a second apart, 3 and 4 at the same time, and pushed to wait in that order
+	for i := 1; i <= 7; i++ {
+		id := strconv.Itoa(i)
+		score := int64(1700000000000 + i*1000)
+
+		if i == 4 {
+			score -= 1000
+		}
+
+		rc.HSet(ctx, "bull:payments:"+id, "name", "charge", "data", "{}", "opts", "{}", "timestamp", score)
+		rc.ZAdd(ctx, "bull:payments:completed", redis.Z{Score: float64(score), Member: id})
+		rc.LPush(ctx, "bull:payments:wait", id)
+	}
+
+	a := newTestApp(t, mr)
+	newestFirst := []string{"7", "6", "5", "4", "3", "2", "1"}
+
+	for _, state := range []string{"completed", "wait"} {
+		ids := collect(t, a, state, ListJobsOptions{Limit: 3})
+
+		if !slices.Equal(ids, newestFirst) {
+			t.Errorf("%s: got %v paging forward, want %v", state, ids, newestFirst)
+		}
+
+		oldestFirst := slices.Clone(newestFirst)
+		slices.Reverse(oldestFirst)
+
+		if ids := collect(t, a, state, ListJobsOptions{Limit: 3, Order: "asc"}); !slices.Equal(ids, oldestFirst) {
+			t.Errorf("%s: got %v paging in ascending order, want %v", state, ids, oldestFirst)
+		}
+
+		// Paging back from the last page lists the earlier pages, each in the order of the list
+		last, err := a.ListJobs(ctx, "payments", state, ListJobsOptions{Limit: 3, Cursor: encodePageCursor(pageCursor{position: position(t, rc, state, "3"), member: "3"})})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := jobIDs(last.Results); !slices.Equal(got, []string{"2", "1"}) || last.Prev == "" || last.Next != "" {
+			t.Errorf("%s: got %v, prev %q and next %q for the last page", state, got, last.Prev, last.Next)
+		}
+
+		back, err := a.ListJobs(ctx, "payments", state, ListJobsOptions{Limit: 3, Cursor: last.Prev})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := jobIDs(back.Results); !slices.Equal(got, []string{"5", "4", "3"}) || back.Next == "" || back.Prev == "" {
+			t.Errorf("%s: got %v, prev %q and next %q paging back", state, got, back.Prev, back.Next)
+		}
+	}
+
+	// Removing the job a cursor points at and the one following it neither skips nor repeats jobs
+	for _, state := range []string{"completed", "wait"} {
+		first, err := a.ListJobs(ctx, "payments", state, ListJobsOptions{Limit: 3})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, id := range []string{"5", "4"} {
+			removeFrom(t, rc, state, id)
+		}
+
+		second, err := a.ListJobs(ctx, "payments", state, ListJobsOptions{Limit: 3, Cursor: first.Next})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := jobIDs(second.Results); !slices.Equal(got, []string{"3", "2", "1"}) {
+			t.Errorf("%s: got %v after removing the cursor job, want [3 2 1]", state, got)
+		}
+
+		if second.Count != 5 {
+			t.Errorf("%s: got count %d, want 5", state, second.Count)
+		}
+
+		// A page whose jobs were all removed is empty but keeps its cursors
+		for _, id := range []string{"3", "2", "1"} {
+			removeFrom(t, rc, state, id)
+		}
+
+		empty, err := a.ListJobs(ctx, "payments", state, ListJobsOptions{Limit: 3, Cursor: first.Next})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(empty.Results) != 0 || empty.Prev == "" || empty.Next != "" {
+			t.Errorf("%s: got %d jobs, prev %q and next %q once the following jobs were removed", state, len(empty.Results), empty.Prev, empty.Next)
+		}
+
+		previous, err := a.ListJobs(ctx, "payments", state, ListJobsOptions{Limit: 3, Cursor: empty.Prev})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := jobIDs(previous.Results); !slices.Equal(got, []string{"7", "6"}) {
+			t.Errorf("%s: got %v paging back from an empty page, want [7 6]", state, got)
+		}
+	}
+}
+
+// TestListJobsFilterCount only counts every job matching a filter on request, otherwise matches are exact
+// when a page scans the whole state and estimated when it doesn't
+func TestListJobsFilterCount(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rc := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rc.Close() })
+
+	ctx := t.Context()
+
+	for i := 1; i <= 40; i++ {
+		id := strconv.Itoa(i)
+		plan := "free"
+
+		if i%4 == 0 {
+			plan = "pro"
+		}
+
+		rc.HSet(ctx, "bull:payments:"+id, "name", "charge", "data", fmt.Sprintf(`{"plan":%q}`, plan), "opts", "{}", "timestamp", i)
+		rc.ZAdd(ctx, "bull:payments:completed", redis.Z{Score: float64(i), Member: id})
+	}
+
+	a := newTestApp(t, mr)
+
+	exact, err := a.ListJobs(ctx, "payments", "completed", ListJobsOptions{Filter: "pro", Limit: 2, Count: true})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exact.Count != 10 || exact.Estimated || len(exact.Results) != 2 || exact.Next == "" {
+		t.Errorf("got count %d, estimated %v and %d jobs when counting", exact.Count, exact.Estimated, len(exact.Results))
+	}
+
+	estimated, err := a.ListJobs(ctx, "payments", "completed", ListJobsOptions{Filter: "pro", Limit: 2})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !estimated.Estimated || estimated.Count <= 2 || estimated.Count > 40 {
+		t.Errorf("got count %d, estimated %v without counting", estimated.Count, estimated.Estimated)
+	}
+
+	whole, err := a.ListJobs(ctx, "payments", "completed", ListJobsOptions{Filter: "pro", Limit: 50})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if whole.Count != 10 || whole.Estimated {
+		t.Errorf("got count %d, estimated %v for a page scanning every job", whole.Count, whole.Estimated)
+	}
+}
+
+func jobIDs(jobs []*ListedJob) []string {
+	ids := make([]string, len(jobs))
+
+	for i, job := range jobs {
+		ids[i] = job.ID
+	}
+
+	return ids
+}
+
+// position is the score or list index cursors point at a job with
+func position(t *testing.T, rc *redis.Client, state string, id string) string {
+	t.Helper()
+
+	if state == "wait" {
+		index, err := rc.LPos(t.Context(), "bull:payments:wait", id, redis.LPosArgs{}).Result()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return strconv.FormatInt(index, 10)
+	}
+
+	score, err := rc.ZScore(t.Context(), "bull:payments:"+state, id).Result()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
+
+func removeFrom(t *testing.T, rc *redis.Client, state string, id string) {
+	t.Helper()
+
+	if state == "wait" {
+		rc.LRem(t.Context(), "bull:payments:wait", 0, id)
+	} else {
+		rc.ZRem(t.Context(), "bull:payments:"+state, id)
+	}
+}
@@ -0,0 +1,115 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wolzey/taskboard/internal/scripts"
+)
+
+const (
+	defaultLogsLimit = 100
+	maxLogsLimit     = 1000
+)
+
+type JobLogsOptions struct {
+	// After only returns lines with an index greater than this, -1 returns from the beginning
+	After int64
+	// Offset skips this many lines (or matches when searching)
+	Offset int64
+	Limit  int64
+	Search string
+}
+
+type JobLogLine struct {
+	Index int64  `json:"index"`
+	Line  string `json:"line"`
+}
+
+type JobLogsResponse struct {
+	Lines   []JobLogLine `json:"lines"`
+	Total   int64        `json:"total"`
+	Matched int64        `json:"matched"`
+	// LastIndex is the index of the last returned line, pass it as `after` to tail new lines
+	LastIndex int64 `json:"last_index"`
+}
+
+// GetJobLogs reads the lines written by job.log() for a job
+func (a *App) GetJobLogs(ctx context.Context, queue string, id string, opts JobLogsOptions) (*JobLogsResponse, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = defaultLogsLimit
+	}
+
+	if opts.Limit > maxLogsLimit {
+		opts.Limit = maxLogsLimit
+	}
+
+	logs, err := a.Redis.Scripts.GetJobLogs(ctx, a.scriptsQueue(queue), id, opts.After, opts.Offset, opts.Limit, opts.Search)
+
+	if err != nil {
+		return nil, err
+	}
+
+	res := &JobLogsResponse{
+		Lines:     make([]JobLogLine, len(logs.Lines)),
+		Total:     logs.Total,
+		Matched:   logs.Matched,
+		LastIndex: opts.After,
+	}
+
+	for i, line := range logs.Lines {
+		res.Lines[i] = JobLogLine{Index: line.Index, Line: line.Line}
+		res.LastIndex = line.Index
+	}
+
+	return res, nil
+}
+
+func (a *App) HandleGetJobLogs(ctx *gin.Context) (int, any, error) {
+	queue := ctx.Param("queue")
+	id := SerializedId(ctx.Param("id"))
+
+	if !id.IsValid() {
+		return 400, nil, fmt.Errorf("invalid job id")
+	}
+
+	opts := JobLogsOptions{
+		After:  -1,
+		Search: ctx.Query("q"),
+	}
+
+	for param, dst := range map[string]*int64{"after": &opts.After, "offset": &opts.Offset, "limit": &opts.Limit} {
+		val := ctx.Query(param)
+
+		if val == "" {
+			continue
+		}
+
+		parsed, err := strconv.ParseInt(val, 10, 64)
+
+		if err != nil {
+			return 400, nil, fmt.Errorf("invalid %s: %w", param, err)
+		}
+
+		*dst = parsed
+	}
+
+	if opts.After < -1 || opts.Offset < 0 {
+		return 400, nil, fmt.Errorf("after must be -1 or greater and offset must not be negative")
+	}
+
+	results, err := a.GetJobLogs(ctx.Request.Context(), queue, id.String(), opts)
+
+	if errors.Is(err, scripts.ErrJobNotFound) {
+		return 404, nil, fmt.Errorf("job %s not found", id)
+	}
+
+	if err != nil {
+		return 500, nil, err
+	}
+
+	return 200, results, nil
+}
@@ -0,0 +1,212 @@
+package app
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wolzey/taskboard/internal/query"
+)
+
+// ErrMetricsNotEnabled is returned for queues whose workers don't record metrics
+var ErrMetricsNotEnabled = errors.New("metrics are not enabled")
+
+// metricsBuckets are the sizes metrics can be aggregated to, buckets are aligned on UTC
+var metricsBuckets = map[string]time.Duration{
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+}
+
+type MetricsPoint struct {
+	// Time is the start of the bucket in unix milliseconds
+	Time      int64 `json:"time"`
+	Completed int64 `json:"completed"`
+	Failed    int64 `json:"failed"`
+	// Throughput is the number of finished jobs per minute over the minutes of the bucket metrics cover
+	Throughput float64 `json:"throughput"`
+	// FailureRate is the share of finished jobs that failed, from 0 to 1
+	FailureRate float64 `json:"failure_rate"`
+}
+
+type MetricsResponse struct {
+	Queue  string `json:"queue"`
+	Bucket string `json:"bucket"`
+	// Totals are the counts of the whole range, Points those of each bucket, oldest first
+	Totals MetricsPoint   `json:"totals"`
+	Points []MetricsPoint `json:"points"`
+}
+
+// metricsSeries is a list of per minute counts decoded from the metrics keys of a state
+type metricsSeries struct {
+	// counts is keyed by the start of each minute in unix milliseconds
+	counts map[int64]int64
+}
+
+// readMetricsSeries decodes the metrics BullMQ workers write when their metrics option is set:
+//
+//	<queue>:metrics:<state>        hash of count, the total, prevTS, when data was last pushed, and prevCount, the total then
+//	<queue>:metrics:<state>:data   list of per minute counts, newest first
+//
+// The head of the data list counts the minute before the one of prevTS, the jobs of that minute are
+// the difference between count and prevCount until the next push. Returns nil when the keys are absent.
+func readMetricsSeries(meta map[string]string, data []string) *metricsSeries {
+	prevTS, err := strconv.ParseInt(meta["prevTS"], 10, 64)
+
+	if err != nil {
+		return nil
+	}
+
+	count, _ := strconv.ParseInt(meta["count"], 10, 64)
+	prevCount, _ := strconv.ParseInt(meta["prevCount"], 10, 64)
+
+	minute := time.Minute.Milliseconds()
+	current := prevTS - prevTS%minute
+	series := &metricsSeries{counts: make(map[int64]int64, len(data)+1)}
+	series.counts[current] = max(count-prevCount, 0)
+
+	for i, value := range data {
+		n, _ := strconv.ParseInt(value, 10, 64)
+		series.counts[current-int64(i+1)*minute] = n
+	}
+
+	return series
+}
+
+// GetQueueMetrics aggregates the metrics of a queue into buckets between from and to, in unix milliseconds
+func (a *App) GetQueueMetrics(ctx context.Context, queue string, bucket string, from int64, to int64) (*MetricsResponse, error) {
+	size, ok := metricsBuckets[bucket]
+
+	if !ok {
+		return nil, fmt.Errorf("invalid bucket %q: must be minute, hour or day", bucket)
+	}
+
+	pipe := a.Redis.Pipeline()
+	completedMeta := pipe.HGetAll(ctx, a.withPrefix(queue, "metrics", "completed"))
+	completedData := pipe.LRange(ctx, a.withPrefix(queue, "metrics", "completed", "data"), 0, -1)
+	failedMeta := pipe.HGetAll(ctx, a.withPrefix(queue, "metrics", "failed"))
+	failedData := pipe.LRange(ctx, a.withPrefix(queue, "metrics", "failed", "data"), 0, -1)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to read metrics: %w", err)
+	}
+
+	completed := readMetricsSeries(completedMeta.Val(), completedData.Val())
+	failed := readMetricsSeries(failedMeta.Val(), failedData.Val())
+
+	if completed == nil && failed == nil {
+		return nil, fmt.Errorf("%w for queue %s: workers record them when started with the metrics option", ErrMetricsNotEnabled, queue)
+	}
+
+	bucketSize := size.Milliseconds()
+	points := map[int64]*MetricsPoint{}
+	// minutes are counted per bucket, a minute recorded by both series is counted once
+	minutes := map[int64]map[int64]bool{}
+	res := &MetricsResponse{Queue: queue, Bucket: bucket, Points: []MetricsPoint{}}
+	var covered int
+
+	add := func(series *metricsSeries, failed bool) {
+		if series == nil {
+			return
+		}
+
+		for minute, count := range series.counts {
+			if minute < from || minute > to {
+				continue
+			}
+
+			start := minute - minute%bucketSize
+			point, ok := points[start]
+
+			if !ok {
+				point = &MetricsPoint{Time: start}
+				points[start] = point
+				minutes[start] = map[int64]bool{}
+			}
+
+			if failed {
+				point.Failed += count
+				res.Totals.Failed += count
+			} else {
+				point.Completed += count
+				res.Totals.Completed += count
+			}
+
+			if !minutes[start][minute] {
+				minutes[start][minute] = true
+				covered++
+			}
+		}
+	}
+
+	add(completed, false)
+	add(failed, true)
+
+	for start, point := range points {
+		point.Throughput, point.FailureRate = finishedRates(point.Completed, point.Failed, len(minutes[start]))
+		res.Points = append(res.Points, *point)
+	}
+
+	slices.SortFunc(res.Points, func(a, b MetricsPoint) int {
+		return cmp.Compare(a.Time, b.Time)
+	})
+
+	if len(res.Points) > 0 {
+		res.Totals.Time = res.Points[0].Time
+	}
+
+	res.Totals.Throughput, res.Totals.FailureRate = finishedRates(res.Totals.Completed, res.Totals.Failed, covered)
+
+	return res, nil
+}
+
+func finishedRates(completed int64, failed int64, minutes int) (float64, float64) {
+	finished := completed + failed
+
+	if finished == 0 || minutes == 0 {
+		return 0, 0
+	}
+
+	return float64(finished) / float64(minutes), float64(failed) / float64(finished)
+}
+
+func (a *App) HandleGetQueueMetrics(ctx *gin.Context) (int, any, error) {
+	now := time.Now()
+	bucket := ctx.DefaultQuery("bucket", "hour")
+	from, to := int64(0), now.UnixMilli()
+
+	if value := ctx.Query("from"); value != "" {
+		var ok bool
+		if from, ok = query.ParseTime(value, now); !ok {
+			return 400, nil, fmt.Errorf("invalid from %q: must be a relative duration such as -6h, now, a date or an RFC 3339 time", value)
+		}
+	}
+
+	if value := ctx.Query("to"); value != "" {
+		var ok bool
+		if to, ok = query.ParseTime(value, now); !ok {
+			return 400, nil, fmt.Errorf("invalid to %q: must be a relative duration such as -6h, now, a date or an RFC 3339 time", value)
+		}
+	}
+
+	if _, ok := metricsBuckets[bucket]; !ok {
+		return 400, nil, fmt.Errorf("invalid bucket %q: must be minute, hour or day", bucket)
+	}
+
+	res, err := a.GetQueueMetrics(ctx.Request.Context(), ctx.Param("queue"), bucket, from, to)
+
+	if errors.Is(err, ErrMetricsNotEnabled) {
+		return 404, nil, err
+	}
+
+	if err != nil {
+		return 500, nil, err
+	}
+
+	return 200, res, nil
+}
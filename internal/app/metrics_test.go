@@ -0,0 +1,120 @@
+package app
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// metricsTime is when the fixture metrics were last pushed, 30 seconds into 01:00 UTC
+var metricsTime = time.Date(2024, 1, 2, 1, 0, 30, 0, time.UTC)
+
+func at(hour int, minute int) int64 {
+	return time.Date(2024, 1, 2, hour, minute, 0, 0, time.UTC).UnixMilli()
+}
+
+func TestReadMetricsSeries(t *testing.T) {
+	meta := map[string]string{"count": "100", "prevCount": "97", "prevTS": "1704157230000"}
+	series := readMetricsSeries(meta, []string{"5", "4", "0", "2"})
+
+	// The minute of prevTS counts the jobs since the last push, the data list the minutes before it
+	want := map[int64]int64{at(1, 0): 3, at(0, 59): 5, at(0, 58): 4, at(0, 57): 0, at(0, 56): 2}
+
+	if series == nil || !maps.Equal(series.counts, want) {
+		t.Errorf("got %v, want %v", series, want)
+	}
+
+	// A count reset below prevCount doesn't make the current minute negative
+	if series := readMetricsSeries(map[string]string{"count": "3", "prevCount": "10", "prevTS": "1704157230000"}, nil); series == nil || series.counts[at(1, 0)] != 0 {
+		t.Errorf("got %v after the count was reset", series)
+	}
+
+	for _, meta := range []map[string]string{{}, {"count": "3"}, {"prevTS": "soon"}} {
+		if series := readMetricsSeries(meta, []string{"1"}); series != nil {
+			t.Errorf("%v: got %v, want no series", meta, series.counts)
+		}
+	}
+}
+
+func TestGetQueueMetrics(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rc := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rc.Close() })
+
+	ctx := t.Context()
+
+	// The keys BullMQ workers write with the metrics option, the failed series is shorter
+	rc.HSet(ctx, "bull:payments:metrics:completed", "count", 100, "prevCount", 97, "prevTS", metricsTime.UnixMilli())
+	rc.RPush(ctx, "bull:payments:metrics:completed:data", "5", "4", "0", "2")
+	rc.HSet(ctx, "bull:payments:metrics:failed", "count", 10, "prevCount", 9, "prevTS", metricsTime.UnixMilli())
+	rc.RPush(ctx, "bull:payments:metrics:failed:data", "1")
+
+	a := newTestApp(t, mr)
+	to := metricsTime.UnixMilli()
+
+	cases := []struct {
+		bucket string
+		from   int64
+		want   []MetricsPoint
+	}{
+		{"minute", 0, []MetricsPoint{
+			{Time: at(0, 56), Completed: 2, Throughput: 2},
+			{Time: at(0, 57)},
+			{Time: at(0, 58), Completed: 4, Throughput: 4},
+			{Time: at(0, 59), Completed: 5, Failed: 1, Throughput: 6, FailureRate: 1.0 / 6},
+			{Time: at(1, 0), Completed: 3, Failed: 1, Throughput: 4, FailureRate: 0.25},
+		}},
+		{"minute", at(0, 58), []MetricsPoint{
+			{Time: at(0, 58), Completed: 4, Throughput: 4},
+			{Time: at(0, 59), Completed: 5, Failed: 1, Throughput: 6, FailureRate: 1.0 / 6},
+			{Time: at(1, 0), Completed: 3, Failed: 1, Throughput: 4, FailureRate: 0.25},
+		}},
+		// Rates are per minute metrics cover, not per minute of the bucket
+		{"hour", 0, []MetricsPoint{
+			{Time: at(0, 0), Completed: 11, Failed: 1, Throughput: 3, FailureRate: 1.0 / 12},
+			{Time: at(1, 0), Completed: 3, Failed: 1, Throughput: 4, FailureRate: 0.25},
+		}},
+		{"day", 0, []MetricsPoint{
+			{Time: at(0, 0), Completed: 14, Failed: 2, Throughput: 3.2, FailureRate: 0.125},
+		}},
+	}
+
+	for _, c := range cases {
+		res, err := a.GetQueueMetrics(ctx, "payments", c.bucket, c.from, to)
+
+		if err != nil {
+			t.Errorf("%s from %d: %v", c.bucket, c.from, err)
+			continue
+		}
+
+		if !slices.Equal(res.Points, c.want) {
+			t.Errorf("%s from %d: got %+v, want %+v", c.bucket, c.from, res.Points, c.want)
+		}
+	}
+
+	res, err := a.GetQueueMetrics(ctx, "payments", "hour", 0, to)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (MetricsPoint{Time: at(0, 0), Completed: 14, Failed: 2, Throughput: 3.2, FailureRate: 0.125}); res.Totals != want {
+		t.Errorf("got totals %+v, want %+v", res.Totals, want)
+	}
+
+	if _, err := a.GetQueueMetrics(ctx, "payments", "week", 0, to); err == nil {
+		t.Error("got no error for an invalid bucket")
+	}
+
+	// Workers of the orders queue don't record metrics
+	rc.HSet(ctx, "bull:orders:meta", "opts.maxLenEvents", 10000)
+
+	if _, err := a.GetQueueMetrics(ctx, "orders", "hour", 0, to); !errors.Is(err, ErrMetricsNotEnabled) {
+		t.Errorf("got %v, want ErrMetricsNotEnabled", err)
+	}
+}
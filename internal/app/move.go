@@ -0,0 +1,353 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/wolzey/taskboard/internal/db"
+	"github.com/wolzey/taskboard/internal/scripts"
+)
+
+const (
+	defaultMoveLimit = 100
+	maxMoveLimit     = 1000
+	// detachedTimeout is how long a job can stay detached before it is put back
+	detachedTimeout       = 5 * time.Minute
+	detachedSweepInterval = time.Minute
+)
+
+var (
+	// ErrInvalidMove wraps errors caused by the move parameters given by the client
+	ErrInvalidMove = errors.New("invalid move")
+	// ErrJobNotMovable is returned for active jobs, jobs of flows and jobs whose id is taken in the target queue
+	ErrJobNotMovable = errors.New("job can't be moved")
+	// ErrQueueNotFound is returned when the target queue has no meta, i.e. it was never created
+	ErrQueueNotFound = errors.New("queue not found")
+)
+
+// movableStates are the states jobs can be moved from in bulk
+var movableStates = []string{"wait", "paused", "prioritized", "delayed", "failed", "completed"}
+
+type MoveOptions struct {
+	Target string
+	// Copy leaves the job in the source queue
+	Copy bool
+	// PreserveID keeps the id of the job in the target queue, it takes the next id of the target queue otherwise
+	PreserveID bool
+}
+
+type MoveJobRequest struct {
+	Target     string `json:"target"`
+	Copy       bool   `json:"copy"`
+	PreserveID bool   `json:"preserveId"`
+}
+
+type MoveJobsRequest struct {
+	MoveJobRequest
+	// JobIDs are the jobs to move, when empty up to Limit jobs of FromState are moved, oldest first
+	JobIDs    []string `json:"jobIds"`
+	FromState string   `json:"fromState"`
+	Limit     int      `json:"limit"`
+}
+
+type MoveJobResponse struct {
+	ID     string `json:"id"`
+	NewID  string `json:"new_id"`
+	Target string `json:"target"`
+	Copied bool   `json:"copied"`
+	// Atomic is false when the queues are in different hash slots and the job was moved in two steps
+	Atomic bool `json:"atomic"`
+}
+
+type MoveJobFailure struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+type MoveJobsResponse struct {
+	Moved  []MoveJobResponse `json:"moved"`
+	Failed []MoveJobFailure  `json:"failed"`
+}
+
+// MoveJob adds a job to another queue as a fresh waiting job with the same name, data, options and logs,
+// then removes it from its queue unless it is copied. When both queues share a hash slot this happens
+// in a single script. Otherwise the job is first taken out of its state, copied, then deleted, and put
+// back in its state when copying fails or, once started, the app finds it left out by an interrupted move.
+func (a *App) MoveJob(ctx context.Context, queue string, id string, opts MoveOptions) (*MoveJobResponse, error) {
+	if err := a.validateMove(ctx, queue, opts); err != nil {
+		return nil, err
+	}
+
+	return a.moveJob(ctx, queue, id, opts)
+}
+
+func (a *App) validateMove(ctx context.Context, queue string, opts MoveOptions) error {
+	if opts.Target == "" {
+		return fmt.Errorf("%w: target is required", ErrInvalidMove)
+	}
+
+	if opts.Target == queue {
+		return fmt.Errorf("%w: target is the queue of the job", ErrInvalidMove)
+	}
+
+	exists, err := a.Redis.Exists(ctx, a.withPrefix(opts.Target, "meta")).Result()
+
+	if err != nil {
+		return err
+	}
+
+	if exists == 0 {
+		return fmt.Errorf("%w: %s", ErrQueueNotFound, opts.Target)
+	}
+
+	return nil
+}
+
+func (a *App) moveJob(ctx context.Context, queue string, id string, opts MoveOptions) (*MoveJobResponse, error) {
+	source, target := a.scriptsQueue(queue), a.scriptsQueue(opts.Target)
+	res := &MoveJobResponse{ID: id, Target: opts.Target, Copied: opts.Copy}
+
+	newID := ""
+	if opts.PreserveID {
+		newID = id
+	}
+
+	if db.HashSlot(source.Key("wait")) == db.HashSlot(target.Key("wait")) {
+		result, movedID, err := a.Redis.Scripts.MoveJob(ctx, source, target, id, newID, opts.Copy, time.Now().UnixMilli())
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to move job: %w", err)
+		}
+
+		if err := moveResultError(result, id, opts.Target); err != nil {
+			return nil, err
+		}
+
+		res.NewID, res.Atomic = movedID, true
+
+		return res, nil
+	}
+
+	result, job, err := a.Redis.Scripts.DetachJob(ctx, source, id, opts.Copy, time.Now().UnixMilli())
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to detach job: %w", err)
+	}
+
+	if err := moveResultError(result, id, opts.Target); err != nil {
+		return nil, err
+	}
+
+	result, res.NewID, err = a.Redis.Scripts.CopyJob(ctx, target, newID, job, time.Now().UnixMilli())
+
+	if err == nil {
+		err = moveResultError(result, id, opts.Target)
+	}
+
+	if err != nil {
+		if !opts.Copy {
+			if _, reattachErr := a.Redis.Scripts.ReattachJob(ctx, source, id); reattachErr != nil {
+				return nil, fmt.Errorf("failed to copy job: %w, then failed to put it back: %v", err, reattachErr)
+			}
+		}
+
+		return nil, err
+	}
+
+	if !opts.Copy {
+		removed, err := a.Redis.Scripts.RemoveDetachedJob(ctx, source, id)
+
+		if err != nil {
+			return nil, fmt.Errorf("job was copied to %s as %s but failed to be removed: %w", opts.Target, res.NewID, err)
+		}
+
+		if removed == 0 {
+			return nil, fmt.Errorf("job was copied to %s as %s but was put back in %s meanwhile", opts.Target, res.NewID, queue)
+		}
+	}
+
+	return res, nil
+}
+
+// reattachDetachedJobs periodically puts back the jobs left out of their state by moves to queues in other
+// hash slots that were interrupted, e.g. when taskboard stopped between their steps. Jobs that were copied
+// before the move was interrupted end up in both queues.
+func reattachDetachedJobs(client *db.Redis, prefix string) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		for {
+			if err := sweepDetachedJobs(ctx, client, prefix); err != nil && ctx.Err() == nil {
+				slog.ErrorContext(ctx, "app: unable to put back detached jobs", "error", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(detachedSweepInterval):
+			}
+		}
+	}
+}
+
+func sweepDetachedJobs(ctx context.Context, client *db.Redis, prefix string) error {
+	queues, err := client.Scripts.GetQueues(ctx, prefix+":")
+
+	if err != nil {
+		return err
+	}
+
+	// Moves take far less than the timeout, jobs detached for longer were left behind
+	before := strconv.FormatInt(time.Now().Add(-detachedTimeout).UnixMilli(), 10)
+
+	for _, queue := range queues {
+		source := scripts.Queue{Prefix: prefix, Name: queue}
+		ids, err := client.ZRangeByScore(ctx, source.Key("taskboard", "detached"), &redis.ZRangeBy{Min: "-inf", Max: before}).Result()
+
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			result, err := client.Scripts.ReattachJob(ctx, source, id)
+
+			if err != nil {
+				return err
+			}
+
+			if result == 1 {
+				slog.WarnContext(ctx, "app: put back a job left detached by an interrupted move", "queue", queue, "job_id", id)
+			}
+		}
+	}
+
+	return nil
+}
+
+func moveResultError(result int64, id string, target string) error {
+	switch result {
+	case 1:
+		return nil
+	case 0:
+		return fmt.Errorf("%w: %s", scripts.ErrJobNotFound, id)
+	case -1:
+		return fmt.Errorf("%w: job %s is active", ErrJobNotMovable, id)
+	case -2:
+		return fmt.Errorf("%w: job %s belongs to a flow", ErrJobNotMovable, id)
+	case -3:
+		return fmt.Errorf("%w: %s already has a job %s", ErrJobNotMovable, target, id)
+	case -4:
+		return fmt.Errorf("%w: job %s is already being moved", ErrJobNotMovable, id)
+	}
+
+	return fmt.Errorf("unexpected move result %d", result)
+}
+
+// MoveJobs moves the given jobs, or up to limit jobs of a state, failures are reported per job
+func (a *App) MoveJobs(ctx context.Context, queue string, jobIds []string, fromState string, limit int, opts MoveOptions) (*MoveJobsResponse, error) {
+	if err := a.validateMove(ctx, queue, opts); err != nil {
+		return nil, err
+	}
+
+	if len(jobIds) == 0 {
+		page, err := a.Redis.Scripts.PaginateJobs(ctx, a.scriptsQueue(queue), fromState, scripts.PageOptions{Order: "asc", Min: "-inf", Max: "+inf", Limit: int64(limit)})
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to list jobs: %w", err)
+		}
+
+		for _, job := range page.Jobs {
+			jobIds = append(jobIds, job.ID)
+		}
+	}
+
+	res := &MoveJobsResponse{Moved: []MoveJobResponse{}, Failed: []MoveJobFailure{}}
+
+	for _, id := range jobIds {
+		moved, err := a.moveJob(ctx, queue, id, opts)
+
+		if err != nil {
+			res.Failed = append(res.Failed, MoveJobFailure{ID: id, Error: err.Error()})
+			continue
+		}
+
+		res.Moved = append(res.Moved, *moved)
+	}
+
+	return res, nil
+}
+
+func moveErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidMove):
+		return 400
+	case errors.Is(err, scripts.ErrJobNotFound), errors.Is(err, ErrQueueNotFound):
+		return 404
+	case errors.Is(err, ErrJobNotMovable):
+		return 409
+	}
+
+	return 500
+}
+
+func (a *App) HandleMoveJob(ctx *gin.Context) (int, any, error) {
+	id := SerializedId(ctx.Param("id"))
+
+	if !id.IsValid() {
+		return 400, nil, fmt.Errorf("invalid job id")
+	}
+
+	var req MoveJobRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		return 400, nil, fmt.Errorf("invalid request body: %w", err)
+	}
+
+	opts := MoveOptions{Target: req.Target, Copy: req.Copy, PreserveID: req.PreserveID}
+	res, err := a.MoveJob(ctx.Request.Context(), ctx.Param("queue"), id.String(), opts)
+
+	if err != nil {
+		return moveErrorStatus(err), nil, err
+	}
+
+	return 200, res, nil
+}
+
+func (a *App) HandleMoveJobs(ctx *gin.Context) (int, any, error) {
+	var req MoveJobsRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		return 400, nil, fmt.Errorf("invalid request body: %w", err)
+	}
+
+	for _, id := range req.JobIDs {
+		if !SerializedId(id).IsValid() {
+			return 400, nil, fmt.Errorf("invalid job id %q", id)
+		}
+	}
+
+	if len(req.JobIDs) == 0 && !slices.Contains(movableStates, req.FromState) {
+		return 400, nil, fmt.Errorf("jobIds or fromState is required, fromState must be one of %s", strings.Join(movableStates, ", "))
+	}
+
+	if req.Limit == 0 {
+		req.Limit = defaultMoveLimit
+	}
+
+	if req.Limit < 0 || req.Limit > maxMoveLimit || len(req.JobIDs) > maxMoveLimit {
+		return 400, nil, fmt.Errorf("at most %d jobs can be moved at once", maxMoveLimit)
+	}
+
+	opts := MoveOptions{Target: req.Target, Copy: req.Copy, PreserveID: req.PreserveID}
+	res, err := a.MoveJobs(ctx.Request.Context(), ctx.Param("queue"), req.JobIDs, req.FromState, req.Limit, opts)
+
+	if err != nil {
+		return moveErrorStatus(err), nil, err
+	}
+
+	return 200, res, nil
+}
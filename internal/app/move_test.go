@@ -0,0 +1,218 @@
+package app
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/wolzey/taskboard/internal/db"
+)
+
+// moveFixture holds queues sharing a hash slot through their {shop} tag, and payments and archive which don't
+func moveFixture(t *testing.T) (*App, *redis.Client) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	rc := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rc.Close() })
+
+	for _, queue := range []string{"{shop}orders", "{shop}archive", "payments", "archive"} {
+		rc.HSet(t.Context(), "bull:"+queue+":meta", "opts.maxLenEvents", 10000)
+	}
+
+	if db.HashSlot("bull:{shop}orders:wait") != db.HashSlot("bull:{shop}archive:wait") || db.HashSlot("bull:payments:wait") == db.HashSlot("bull:archive:wait") {
+		t.Fatal("the hash slots of the queues don't fit the tests")
+	}
+
+	return newTestApp(t, mr), rc
+}
+
+func addMovableJob(t *testing.T, rc *redis.Client, queue string, id string, state string) {
+	t.Helper()
+
+	ctx := t.Context()
+	rc.HSet(ctx, "bull:"+queue+":"+id, "name", "charge", "data", `{"user":42}`, "opts", `{"attempts":3}`, "timestamp", 1700000000000)
+	rc.RPush(ctx, "bull:"+queue+":"+id+":logs", "charging")
+
+	switch state {
+	case "wait", "active", "paused":
+		rc.LPush(ctx, "bull:"+queue+":"+state, id)
+	default:
+		rc.ZAdd(ctx, "bull:"+queue+":"+state, redis.Z{Score: 1700000000000, Member: id})
+	}
+}
+
+// inState tells whether a job is in the list or sorted set of a state
+func inState(t *testing.T, rc *redis.Client, queue string, state string, id string) bool {
+	t.Helper()
+
+	key := "bull:" + queue + ":" + state
+
+	if keyType, _ := rc.Type(t.Context(), key).Result(); keyType == "list" {
+		_, err := rc.LPos(t.Context(), key, id, redis.LPosArgs{}).Result()
+		return err == nil
+	}
+
+	_, err := rc.ZScore(t.Context(), key, id).Result()
+	return err == nil
+}
+
+func TestMoveJob(t *testing.T) {
+	a, rc := moveFixture(t)
+	ctx := t.Context()
+
+	cases := []struct {
+		source string
+		target string
+		state  string
+		opts   MoveOptions
+		atomic bool
+	}{
+		{"{shop}orders", "{shop}archive", "wait", MoveOptions{}, true},
+		{"{shop}orders", "{shop}archive", "failed", MoveOptions{Copy: true}, true},
+		{"{shop}orders", "{shop}archive", "delayed", MoveOptions{PreserveID: true}, true},
+		{"payments", "archive", "failed", MoveOptions{}, false},
+		{"payments", "archive", "completed", MoveOptions{Copy: true}, false},
+		{"payments", "archive", "wait", MoveOptions{PreserveID: true}, false},
+	}
+
+	for i, c := range cases {
+		id := strconv.Itoa(100 + i)
+		addMovableJob(t, rc, c.source, id, c.state)
+
+		c.opts.Target = c.target
+		res, err := a.MoveJob(ctx, c.source, id, c.opts)
+
+		if err != nil {
+			t.Errorf("%s to %s %+v: %v", c.source, c.target, c.opts, err)
+			continue
+		}
+
+		if res.Atomic != c.atomic || res.Copied != c.opts.Copy {
+			t.Errorf("%s to %s %+v: got %+v", c.source, c.target, c.opts, res)
+		}
+
+		if c.opts.PreserveID && res.NewID != id {
+			t.Errorf("%s to %s: got id %s, want %s preserved", c.source, c.target, res.NewID, id)
+		}
+
+		// The job is a fresh waiting job of the target queue with the same name, data and logs
+		job, _ := rc.HGetAll(ctx, "bull:"+c.target+":"+res.NewID).Result()
+		logs, _ := rc.LRange(ctx, "bull:"+c.target+":"+res.NewID+":logs", 0, -1).Result()
+
+		if job["name"] != "charge" || job["data"] != `{"user":42}` || !slices.Equal(logs, []string{"charging"}) || !inState(t, rc, c.target, "wait", res.NewID) {
+			t.Errorf("%s to %s: got job %v with logs %v in the target queue", c.source, c.target, job, logs)
+		}
+
+		kept, _ := rc.Exists(ctx, "bull:"+c.source+":"+id).Result()
+
+		if (kept == 1) != c.opts.Copy || inState(t, rc, c.source, c.state, id) != c.opts.Copy {
+			t.Errorf("%s to %s %+v: got the source job kept %v", c.source, c.target, c.opts, kept == 1)
+		}
+
+		if n, _ := rc.ZCard(ctx, "bull:"+c.source+":taskboard:detached").Result(); n != 0 {
+			t.Errorf("%s to %s: %d jobs left detached", c.source, c.target, n)
+		}
+	}
+}
+
+func TestMoveJobNotMovable(t *testing.T) {
+	a, rc := moveFixture(t)
+	ctx := t.Context()
+
+	for _, pair := range [][2]string{{"{shop}orders", "{shop}archive"}, {"payments", "archive"}} {
+		source, target := pair[0], pair[1]
+
+		// The id is taken in the target queue, the job stays where it was
+		addMovableJob(t, rc, source, "5", "failed")
+		addMovableJob(t, rc, target, "5", "completed")
+
+		_, err := a.MoveJob(ctx, source, "5", MoveOptions{Target: target, PreserveID: true})
+
+		if !errors.Is(err, ErrJobNotMovable) {
+			t.Errorf("%s to %s: got %v for a taken id, want ErrJobNotMovable", source, target, err)
+		}
+
+		if !inState(t, rc, source, "failed", "5") {
+			t.Errorf("%s to %s: the job wasn't put back after the collision", source, target)
+		}
+
+		if detached, _ := rc.HExists(ctx, "bull:"+source+":5", "taskboardDetached").Result(); detached {
+			t.Errorf("%s to %s: the job is still marked detached", source, target)
+		}
+
+		if name, _ := rc.HGet(ctx, "bull:"+target+":5", "name").Result(); name != "charge" || !inState(t, rc, target, "completed", "5") {
+			t.Errorf("%s to %s: the job of the target queue changed", source, target)
+		}
+
+		addMovableJob(t, rc, source, "6", "active")
+
+		if _, err := a.MoveJob(ctx, source, "6", MoveOptions{Target: target}); !errors.Is(err, ErrJobNotMovable) {
+			t.Errorf("%s to %s: got %v for an active job, want ErrJobNotMovable", source, target, err)
+		}
+
+		addMovableJob(t, rc, source, "7", "wait")
+		rc.HSet(ctx, "bull:"+source+":7", "parentKey", "bull:"+source+":1")
+
+		if _, err := a.MoveJob(ctx, source, "7", MoveOptions{Target: target}); !errors.Is(err, ErrJobNotMovable) {
+			t.Errorf("%s to %s: got %v for a job of a flow, want ErrJobNotMovable", source, target, err)
+		}
+	}
+
+	if _, err := a.MoveJob(ctx, "payments", "404", MoveOptions{Target: "archive"}); err == nil {
+		t.Error("moved a job that doesn't exist")
+	}
+
+	if _, err := a.MoveJob(ctx, "payments", "5", MoveOptions{Target: "missing"}); !errors.Is(err, ErrQueueNotFound) {
+		t.Errorf("got %v for a target queue that doesn't exist, want ErrQueueNotFound", err)
+	}
+}
+
+// TestSweepDetachedJobs puts back the jobs left detached by moves interrupted for longer than the timeout
+func TestSweepDetachedJobs(t *testing.T) {
+	a, rc := moveFixture(t)
+	ctx := t.Context()
+
+	addMovableJob(t, rc, "payments", "1", "failed")
+	addMovableJob(t, rc, "payments", "2", "wait")
+	addMovableJob(t, rc, "payments", "3", "delayed")
+
+	source := a.scriptsQueue("payments")
+	old := time.Now().Add(-2 * detachedTimeout).UnixMilli()
+
+	for id, detachedOn := range map[string]int64{"1": old, "2": old, "3": time.Now().UnixMilli()} {
+		if result, _, err := a.Redis.Scripts.DetachJob(ctx, source, id, false, detachedOn); err != nil || result != 1 {
+			t.Fatalf("got %d, %v detaching job %s", result, err, id)
+		}
+	}
+
+	// A detached job can't be moved again meanwhile
+	if _, err := a.MoveJob(ctx, "payments", "1", MoveOptions{Target: "archive"}); !errors.Is(err, ErrJobNotMovable) {
+		t.Errorf("got %v moving a detached job, want ErrJobNotMovable", err)
+	}
+
+	if err := sweepDetachedJobs(ctx, a.Redis, "bull"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !inState(t, rc, "payments", "failed", "1") || !inState(t, rc, "payments", "wait", "2") {
+		t.Error("the jobs detached before the timeout weren't put back in their state")
+	}
+
+	if score, _ := rc.ZScore(ctx, "bull:payments:failed", "1").Result(); score != 1700000000000 {
+		t.Errorf("got score %v, want the job put back with its score", score)
+	}
+
+	// The move of job 3 may still be running
+	if inState(t, rc, "payments", "delayed", "3") {
+		t.Error("a recently detached job was put back")
+	}
+
+	if ids, _ := rc.ZRange(ctx, "bull:payments:taskboard:detached", 0, -1).Result(); !slices.Equal(ids, []string{"3"}) {
+		t.Errorf("got %v detached, want [3]", ids)
+	}
+}
@@ -0,0 +1,154 @@
+package app
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wolzey/taskboard/internal/alerts"
+	"github.com/wolzey/taskboard/internal/db"
+	"github.com/wolzey/taskboard/internal/history"
+	"github.com/wolzey/taskboard/internal/index"
+)
+
+// Reload applies new options while the app serves, except for the port, base path, UI and TLS certificates
+// of the API. Its principals are replaced.
+//
+// When reconnect is set, a new Redis client replaces the current one, which is closed once the requests
+// using it are done. The indexer, history sampler and alerting engine are replaced when their options,
+// the client or the queue prefix change, the others keep running. So is the sweep of detached jobs
+// when the client or the queue prefix change. A new alerting engine takes over the pending and firing
+// alerts of the previous one unless the queue prefix changed. Nothing is applied when the new client
+// or any of them fails to start.
+func (a *App) Reload(opts *AppOptions, reconnect bool) error {
+	client := a.Redis
+
+	if reconnect {
+		var err error
+
+		if client, err = db.NewClient(opts.RedisOpts); err != nil {
+			return err
+		}
+	}
+
+	prefix := queuePrefixOf(opts)
+	rebuild := reconnect || prefix != a.QueuePrefix
+
+	indexer, sampler, engine := a.Indexer, a.History, a.Alerts
+	// replaced are the names of the background work to stop, and start again when still enabled
+	var replaced []string
+	var err error
+
+	if rebuild {
+		replaced = append(replaced, "detached")
+	}
+
+	if rebuild || !reflect.DeepEqual(opts.Index, a.opts.Index) {
+		replaced = append(replaced, "index")
+		indexer = nil
+
+		if opts.Index != nil {
+			if indexer, err = index.New(client, prefix, *opts.Index); err != nil {
+				return a.abortReload(client, fmt.Errorf("unable to initialize the indexer: %w", err))
+			}
+		}
+	}
+
+	if rebuild || !reflect.DeepEqual(opts.History, a.opts.History) {
+		replaced = append(replaced, "history")
+		sampler = nil
+
+		if opts.History != nil {
+			if sampler, err = history.New(client, prefix, *opts.History); err != nil {
+				return a.abortReload(client, fmt.Errorf("unable to initialize the history sampler: %w", err))
+			}
+		}
+	}
+
+	if rebuild || !reflect.DeepEqual(opts.Alerts, a.opts.Alerts) {
+		replaced = append(replaced, "alerts")
+		engine = nil
+
+		if opts.Alerts != nil {
+			if engine, err = alerts.New(client, prefix, *opts.Alerts); err != nil {
+				return a.abortReload(client, fmt.Errorf("unable to initialize alerting: %w", err))
+			}
+		}
+	}
+
+	// The replaced work is stopped first, so the alerts taken over no longer change
+	for _, name := range replaced {
+		if stop, ok := a.stops[name]; ok {
+			stop()
+			delete(a.stops, name)
+		}
+	}
+
+	if engine != nil && a.Alerts != nil && engine != a.Alerts && prefix == a.QueuePrefix {
+		engine.Inherit(a.Alerts)
+	}
+
+	// Requests started from now on use the new services, those in flight keep the previous ones
+	previous := a.Services
+	a.Services = &Services{
+		Redis:       client,
+		QueuePrefix: prefix,
+		Indexer:     indexer,
+		ExportMask:  opts.ExportMask,
+		History:     sampler,
+		Alerts:      engine,
+	}
+	a.services.Store(a.Services)
+	a.opts = opts
+
+	a.Api.SetTimeouts(opts.ApiOptions.ReadTimeout, opts.ApiOptions.WriteTimeout)
+
+	if opts.ApiOptions.TLS != nil {
+		a.Api.SetPrincipals(opts.ApiOptions.TLS.Principals)
+	}
+
+	if opts.ApiOptions.GinMode != "" {
+		gin.SetMode(opts.ApiOptions.GinMode)
+	}
+
+	// Background work only runs once the app is started
+	if a.ctx != nil {
+		for _, name := range replaced {
+			switch {
+			case name == "detached":
+				a.run(name, reattachDetachedJobs(client, prefix))
+			case name == "index" && indexer != nil:
+				a.run(name, indexer.Run)
+			case name == "history" && sampler != nil:
+				a.run(name, sampler.Run)
+			case name == "alerts" && engine != nil:
+				a.run(name, engine.Run)
+			}
+		}
+	}
+
+	if reconnect {
+		go func() {
+			// Requests which loaded the previous services before they were replaced take and release them
+			// again before retrying, they would block on a lock left held
+			previous.inUse.Lock()
+			defer previous.inUse.Unlock()
+
+			if err := previous.Redis.Close(); err != nil {
+				slog.Warn("app: unable to close the previous redis client", "error", err)
+			}
+		}()
+	}
+
+	return nil
+}
+
+// abortReload closes the client created for a reload that failed
+func (a *App) abortReload(client *db.Redis, err error) error {
+	if client != a.Redis {
+		client.Close()
+	}
+
+	return err
+}
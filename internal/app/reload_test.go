@@ -0,0 +1,118 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/wolzey/taskboard/internal/api"
+)
+
+// TestReloadInFlight reconnects while requests are served, those in flight keep the previous client until
+// they are done and none of them blocks on the services it replaced
+func TestReloadInFlight(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rc := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rc.Close() })
+
+	seed(t, rc)
+
+	opts := &AppOptions{
+		RedisOpts:   &redis.Options{Addr: mr.Addr()},
+		ApiOptions:  &api.ApiOptions{GinMode: gin.TestMode},
+		QueuePrefix: "bull",
+	}
+	a := NewApp(opts)
+	t.Cleanup(func() { a.Redis.Close() })
+
+	server := httptest.NewServer(a.Api)
+	t.Cleanup(server.Close)
+
+	// A request holding the services while they are replaced
+	held := a.acquire()
+
+	if err := a.Reload(opts, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if held.Redis == a.Redis {
+		t.Fatal("got the same client after reconnecting")
+	}
+
+	if err := held.Redis.Ping(t.Context()).Err(); err != nil {
+		t.Fatalf("the previous client was closed while in use: %v", err)
+	}
+
+	held.inUse.RUnlock()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for held.Redis.Ping(t.Context()).Err() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("the previous client wasn't closed once released")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A request which loaded the previous services before the swap takes them again before retrying
+	taken := make(chan struct{})
+
+	go func() {
+		held.inUse.RLock()
+		held.inUse.RUnlock()
+		close(taken)
+	}()
+
+	select {
+	case <-taken:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the previous services are still locked")
+	}
+
+	// Requests keep being answered while the client is replaced again and again
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	for range 4 {
+		wg.Go(func() {
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				res, err := http.Get(server.URL + "/api/queues/payments/jobs/wait")
+
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				res.Body.Close()
+
+				if res.StatusCode != 200 {
+					t.Errorf("got status %d while reloading", res.StatusCode)
+					return
+				}
+			}
+		})
+	}
+
+	for range 20 {
+		if err := a.Reload(opts, true); err != nil {
+			t.Fatal(err)
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,538 @@
+package app
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robfig/cron/v3"
+	"github.com/wolzey/taskboard/internal/scripts"
+)
+
+const (
+	// recentJobsWindow is how many of the latest jobs per state are inspected to find the last job of a scheduler
+	recentJobsWindow    = 1000
+	defaultNextRunCount = 5
+	maxNextRunCount     = 100
+)
+
+// BullMQ uses cron-parser which accepts an optional leading seconds field
+var cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+var ErrSchedulerNotFound = errors.New("job scheduler not found")
+
+type SchedulerJob struct {
+	ID        string `json:"id"`
+	State     string `json:"state"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+type JobScheduler struct {
+	ID         string          `json:"id"`
+	Name       string          `json:"name"`
+	Pattern    string          `json:"pattern,omitempty"`
+	Every      int64           `json:"every,omitempty"`
+	TZ         string          `json:"tz,omitempty"`
+	StartDate  int64           `json:"start_date,omitempty"`
+	EndDate    int64           `json:"end_date,omitempty"`
+	Limit      int64           `json:"limit,omitempty"`
+	Iterations int64           `json:"iterations"`
+	Paused     bool            `json:"paused"`
+	NextRun    *int64          `json:"next_run"`
+	NextRuns   []int64         `json:"next_runs,omitempty"`
+	LastJob    *SchedulerJob   `json:"last_job"`
+	Data       json.RawMessage `json:"data,omitempty"`
+	Opts       json.RawMessage `json:"options,omitempty"`
+	// Legacy is set for repeatable jobs created before job schedulers, they can't be paused
+	Legacy bool `json:"legacy"`
+	// Error is set when the next run times can't be computed, e.g. an unsupported cron expression
+	Error string `json:"error,omitempty"`
+
+	// jobIdKey is the part of the produced job ids identifying this scheduler
+	jobIdKey string
+}
+
+type JobSchedulersResponse struct {
+	Schedulers []*JobScheduler `json:"schedulers"`
+	Count      int             `json:"count"`
+}
+
+type SchedulerActionResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	JobID   string `json:"job_id,omitempty"`
+}
+
+// ListJobSchedulers returns the job schedulers and legacy repeatable jobs of a queue
+func (a *App) ListJobSchedulers(ctx context.Context, queue string) ([]*JobScheduler, error) {
+	return a.getJobSchedulers(ctx, queue, "", 0)
+}
+
+// GetJobScheduler returns a single scheduler with its next count run times
+func (a *App) GetJobScheduler(ctx context.Context, queue string, id string, count int) (*JobScheduler, error) {
+	schedulers, err := a.getJobSchedulers(ctx, queue, id, count)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(schedulers) == 0 {
+		return nil, ErrSchedulerNotFound
+	}
+
+	return schedulers[0], nil
+}
+
+func (a *App) getJobSchedulers(ctx context.Context, queue string, id string, nextRuns int) ([]*JobScheduler, error) {
+	res, err := a.Redis.Scripts.GetJobSchedulers(ctx, a.scriptsQueue(queue), id, recentJobsWindow)
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	schedulers := make([]*JobScheduler, 0, len(res.Schedulers))
+
+	for _, raw := range res.Schedulers {
+		scheduler := parseJobScheduler(raw)
+		scheduler.LastJob = findLastSchedulerJob(scheduler.jobIdKey, res.RecentJobs)
+
+		if nextRuns > 0 {
+			runs, err := scheduler.nextRunsFrom(now, nextRuns)
+
+			if err != nil {
+				scheduler.Error = err.Error()
+			}
+
+			scheduler.NextRuns = runs
+		}
+
+		schedulers = append(schedulers, scheduler)
+	}
+
+	sort.Slice(schedulers, func(i, j int) bool {
+		return schedulers[i].ID < schedulers[j].ID
+	})
+
+	return schedulers, nil
+}
+
+func parseJobScheduler(raw scripts.JobScheduler) *JobScheduler {
+	scheduler := &JobScheduler{
+		ID:       raw.ID,
+		jobIdKey: raw.ID,
+	}
+
+	if next, err := strconv.ParseInt(raw.NextMillis, 10, 64); err == nil {
+		scheduler.NextRun = &next
+	}
+
+	if _, ok := raw.Fields["name"]; !ok {
+		// Legacy repeatable jobs only exist as name:jobId:endDate:tz:pattern members and their
+		// jobs are identified by the md5 of that member
+		parts := strings.SplitN(raw.ID, ":", 5)
+		hash := md5.Sum([]byte(raw.ID))
+
+		scheduler.Legacy = true
+		scheduler.jobIdKey = hex.EncodeToString(hash[:])
+		scheduler.Name = parts[0]
+
+		if len(parts) == 5 {
+			scheduler.EndDate, _ = strconv.ParseInt(parts[2], 10, 64)
+			scheduler.TZ = parts[3]
+
+			if every, err := strconv.ParseInt(parts[4], 10, 64); err == nil {
+				scheduler.Every = every
+			} else {
+				scheduler.Pattern = parts[4]
+			}
+		}
+
+		return scheduler
+	}
+
+	fields := raw.Fields
+	scheduler.Paused = raw.Paused
+
+	scheduler.Name = fields["name"]
+	scheduler.Pattern = fields["pattern"]
+	scheduler.TZ = fields["tz"]
+	scheduler.Every, _ = strconv.ParseInt(fields["every"], 10, 64)
+	scheduler.StartDate, _ = strconv.ParseInt(fields["startDate"], 10, 64)
+	scheduler.EndDate, _ = strconv.ParseInt(fields["endDate"], 10, 64)
+	scheduler.Limit, _ = strconv.ParseInt(fields["limit"], 10, 64)
+	scheduler.Iterations, _ = strconv.ParseInt(fields["ic"], 10, 64)
+
+	if data := fields["data"]; json.Valid([]byte(data)) {
+		scheduler.Data = json.RawMessage(data)
+	}
+
+	if opts := fields["opts"]; json.Valid([]byte(opts)) {
+		scheduler.Opts = json.RawMessage(opts)
+	}
+
+	return scheduler
+}
+
+// findLastSchedulerJob picks the most recent job with an id of the form repeat:<jobIdKey>:<millis>
+func findLastSchedulerJob(jobIdKey string, recent map[string]string) *SchedulerJob {
+	var last *SchedulerJob
+	prefix := "repeat:" + jobIdKey + ":"
+
+	for id, state := range recent {
+		if !strings.HasPrefix(id, prefix) {
+			continue
+		}
+
+		millis, err := strconv.ParseInt(strings.TrimPrefix(id, prefix), 10, 64)
+
+		if err != nil {
+			continue
+		}
+
+		if last == nil || millis > last.Timestamp {
+			last = &SchedulerJob{ID: id, State: state, Timestamp: millis}
+		}
+	}
+
+	return last
+}
+
+// nextRunsFrom computes up to count upcoming run times (unix millis) of the scheduler
+func (s *JobScheduler) nextRunsFrom(now time.Time, count int) ([]int64, error) {
+	if s.Limit > 0 && s.Iterations >= s.Limit {
+		return []int64{}, nil
+	}
+
+	if s.Limit > 0 && int64(count) > s.Limit-s.Iterations {
+		count = int(s.Limit - s.Iterations)
+	}
+
+	runs := make([]int64, 0, count)
+
+	start := now
+	if s.StartDate > 0 && time.UnixMilli(s.StartDate).After(start) {
+		start = time.UnixMilli(s.StartDate)
+	}
+
+	// The stored next run of an active scheduler is the job that is already scheduled
+	if s.NextRun != nil && !s.Paused {
+		runs = append(runs, *s.NextRun)
+		start = time.UnixMilli(*s.NextRun)
+	}
+
+	switch {
+	case s.Every > 0:
+		next := start.UnixMilli()
+		if len(runs) == 0 {
+			// Align on multiples of the interval like BullMQ's repeat option does
+			next = (next/s.Every + 1) * s.Every
+		} else {
+			next += s.Every
+		}
+
+		for len(runs) < count {
+			runs = append(runs, next)
+			next += s.Every
+		}
+	case s.Pattern != "":
+		schedule, err := cronParser.Parse(s.Pattern)
+
+		if err != nil {
+			return runs, fmt.Errorf("unsupported pattern %q: %w", s.Pattern, err)
+		}
+
+		loc := time.Local
+		if s.TZ != "" {
+			loc, err = time.LoadLocation(s.TZ)
+
+			if err != nil {
+				return runs, fmt.Errorf("unknown timezone %q: %w", s.TZ, err)
+			}
+		}
+
+		next := start.In(loc)
+		for len(runs) < count {
+			next = schedule.Next(next)
+
+			if next.IsZero() {
+				break
+			}
+
+			runs = append(runs, next.UnixMilli())
+		}
+	}
+
+	if len(runs) > count {
+		runs = runs[:count]
+	}
+
+	if s.EndDate > 0 {
+		for i, run := range runs {
+			if run > s.EndDate {
+				return runs[:i], nil
+			}
+		}
+	}
+
+	return runs, nil
+}
+
+// PauseJobScheduler stops a scheduler from producing jobs, the upcoming job is removed
+func (a *App) PauseJobScheduler(ctx context.Context, queue string, id string) (*SchedulerActionResponse, error) {
+	scheduler, err := a.GetJobScheduler(ctx, queue, id, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if scheduler.Legacy {
+		return nil, fmt.Errorf("legacy repeatable jobs can't be paused, remove them instead")
+	}
+
+	result, err := a.Redis.Scripts.PauseJobScheduler(ctx, a.scriptsQueue(queue), id, scheduler.jobIdKey)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to pause job scheduler: %w", err)
+	}
+
+	switch result {
+	case 1:
+		return &SchedulerActionResponse{Success: true, Message: fmt.Sprintf("Job scheduler %s paused", id)}, nil
+	case 2:
+		return &SchedulerActionResponse{Success: true, Message: fmt.Sprintf("Job scheduler %s is already paused", id)}, nil
+	case 0:
+		return nil, ErrSchedulerNotFound
+	default:
+		return nil, fmt.Errorf("unexpected result from pause operation: %d", result)
+	}
+}
+
+// ResumeJobScheduler resumes a paused scheduler, its next job is scheduled from the current time
+func (a *App) ResumeJobScheduler(ctx context.Context, queue string, id string) (*SchedulerActionResponse, error) {
+	scheduler, err := a.GetJobScheduler(ctx, queue, id, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !scheduler.Paused {
+		return &SchedulerActionResponse{Success: true, Message: fmt.Sprintf("Job scheduler %s is not paused", id)}, nil
+	}
+
+	now := time.Now()
+	runs, err := scheduler.nextRunsFrom(now, 1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(runs) == 0 {
+		return nil, fmt.Errorf("job scheduler %s has no upcoming runs", id)
+	}
+
+	opts := scheduler.templateOpts()
+	opts["delay"] = max(runs[0]-now.UnixMilli(), 0)
+	opts["repeat"] = scheduler.repeatOpts()
+
+	encoded, err := json.Marshal(opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := a.Redis.Scripts.ResumeJobScheduler(ctx, a.scriptsQueue(queue), id, scheduler.jobIdKey, runs[0], string(encoded), now.UnixMilli())
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to resume job scheduler: %w", err)
+	}
+
+	switch result {
+	case 1:
+		return &SchedulerActionResponse{
+			Success: true,
+			Message: fmt.Sprintf("Job scheduler %s resumed, next run at %s", id, time.UnixMilli(runs[0]).UTC().Format(time.RFC3339)),
+		}, nil
+	case 2:
+		return &SchedulerActionResponse{Success: true, Message: fmt.Sprintf("Job scheduler %s is not paused", id)}, nil
+	case 0:
+		return nil, ErrSchedulerNotFound
+	default:
+		return nil, fmt.Errorf("unexpected result from resume operation: %d", result)
+	}
+}
+
+// TriggerJobScheduler adds a job built from the scheduler's template that runs immediately
+func (a *App) TriggerJobScheduler(ctx context.Context, queue string, id string) (*SchedulerActionResponse, error) {
+	scheduler, err := a.GetJobScheduler(ctx, queue, id, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if scheduler.Legacy && scheduler.Data == nil {
+		return nil, fmt.Errorf("legacy repeatable jobs don't store a job template and can't be triggered")
+	}
+
+	now := time.Now().UnixMilli()
+	jobId := fmt.Sprintf("repeat:%s:%d", scheduler.jobIdKey, now)
+
+	opts := scheduler.templateOpts()
+	priority, _ := opts["priority"].(float64)
+
+	encoded, err := json.Marshal(opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := a.Redis.Scripts.TriggerJobScheduler(ctx, a.scriptsQueue(queue), id, jobId, string(encoded), now, int64(priority))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to trigger job scheduler: %w", err)
+	}
+
+	switch result {
+	case 1:
+		return &SchedulerActionResponse{Success: true, Message: fmt.Sprintf("Job scheduler %s triggered", id), JobID: jobId}, nil
+	case 0:
+		return nil, ErrSchedulerNotFound
+	case -1:
+		return &SchedulerActionResponse{Success: false, Message: fmt.Sprintf("Job %s already exists", jobId), JobID: jobId}, nil
+	default:
+		return nil, fmt.Errorf("unexpected result from trigger operation: %d", result)
+	}
+}
+
+// RemoveJobScheduler removes a scheduler and the job it has scheduled next
+func (a *App) RemoveJobScheduler(ctx context.Context, queue string, id string) (*SchedulerActionResponse, error) {
+	scheduler, err := a.GetJobScheduler(ctx, queue, id, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := a.Redis.Scripts.RemoveJobScheduler(ctx, a.scriptsQueue(queue), id, scheduler.jobIdKey)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove job scheduler: %w", err)
+	}
+
+	if result == 0 {
+		return nil, ErrSchedulerNotFound
+	}
+
+	return &SchedulerActionResponse{Success: true, Message: fmt.Sprintf("Job scheduler %s removed", id)}, nil
+}
+
+// templateOpts returns the options jobs produced by the scheduler are created with
+func (s *JobScheduler) templateOpts() map[string]any {
+	opts := map[string]any{}
+
+	if s.Opts != nil {
+		_ = json.Unmarshal(s.Opts, &opts)
+	}
+
+	return opts
+}
+
+func (s *JobScheduler) repeatOpts() map[string]any {
+	repeat := map[string]any{"count": s.Iterations + 1}
+
+	if s.Pattern != "" {
+		repeat["pattern"] = s.Pattern
+	}
+	if s.Every > 0 {
+		repeat["every"] = s.Every
+	}
+	if s.TZ != "" {
+		repeat["tz"] = s.TZ
+	}
+	if s.Limit > 0 {
+		repeat["limit"] = s.Limit
+	}
+	if s.StartDate > 0 {
+		repeat["startDate"] = s.StartDate
+	}
+	if s.EndDate > 0 {
+		repeat["endDate"] = s.EndDate
+	}
+
+	return repeat
+}
+
+func schedulerErrorStatus(err error) int {
+	if errors.Is(err, ErrSchedulerNotFound) {
+		return 404
+	}
+
+	return 500
+}
+
+func (a *App) HandleListJobSchedulers(ctx *gin.Context) (int, any, error) {
+	schedulers, err := a.ListJobSchedulers(ctx.Request.Context(), ctx.Param("queue"))
+
+	if err != nil {
+		return 500, nil, err
+	}
+
+	return 200, JobSchedulersResponse{Schedulers: schedulers, Count: len(schedulers)}, nil
+}
+
+func (a *App) HandleGetJobScheduler(ctx *gin.Context) (int, any, error) {
+	count := defaultNextRunCount
+
+	if next := ctx.Query("next"); next != "" {
+		parsed, err := strconv.Atoi(next)
+
+		if err != nil || parsed < 0 || parsed > maxNextRunCount {
+			return 400, nil, fmt.Errorf("invalid next: must be between 0 and %d", maxNextRunCount)
+		}
+
+		count = parsed
+	}
+
+	scheduler, err := a.GetJobScheduler(ctx.Request.Context(), ctx.Param("queue"), ctx.Param("scheduler"), count)
+
+	if err != nil {
+		return schedulerErrorStatus(err), nil, err
+	}
+
+	return 200, scheduler, nil
+}
+
+func (a *App) HandlePauseJobScheduler(ctx *gin.Context) (int, any, error) {
+	return schedulerAction(a.PauseJobScheduler(ctx.Request.Context(), ctx.Param("queue"), ctx.Param("scheduler")))
+}
+
+func (a *App) HandleResumeJobScheduler(ctx *gin.Context) (int, any, error) {
+	return schedulerAction(a.ResumeJobScheduler(ctx.Request.Context(), ctx.Param("queue"), ctx.Param("scheduler")))
+}
+
+func (a *App) HandleTriggerJobScheduler(ctx *gin.Context) (int, any, error) {
+	return schedulerAction(a.TriggerJobScheduler(ctx.Request.Context(), ctx.Param("queue"), ctx.Param("scheduler")))
+}
+
+func (a *App) HandleRemoveJobScheduler(ctx *gin.Context) (int, any, error) {
+	return schedulerAction(a.RemoveJobScheduler(ctx.Request.Context(), ctx.Param("queue"), ctx.Param("scheduler")))
+}
+
+func schedulerAction(res *SchedulerActionResponse, err error) (int, any, error) {
+	if err != nil {
+		return schedulerErrorStatus(err), nil, err
+	}
+
+	if !res.Success {
+		return 409, res, nil
+	}
+
+	return 200, res, nil
+}
@@ -0,0 +1,393 @@
+package app
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wolzey/taskboard/internal/index"
+	"github.com/wolzey/taskboard/internal/query"
+	"github.com/wolzey/taskboard/internal/scripts"
+)
+
+const (
+	defaultSearchLimit = 25
+	maxSearchLimit     = 500
+	// searchScanPerCall bounds how long a single script call can block Redis
+	searchScanPerCall = 1000
+	// searchScanBudget bounds the work done by a single request, the next cursor continues from there
+	searchScanBudget = 50000
+)
+
+// ErrInvalidSearch wraps errors caused by the query, states or cursor given by the client
+var ErrInvalidSearch = errors.New("invalid search")
+
+// searchableStates are scanned, in this order, when a search doesn't name any states
+var searchableStates = []string{"active", "wait", "prioritized", "paused", "waiting-children", "delayed", "failed", "completed"}
+
+type SearchOptions struct {
+	Query  string
+	States []string
+	// Cursor is the next value of a previous response, empty starts from the beginning
+	Cursor string
+	Limit  int
+	// Count also scans every job to return the total number of matches
+	Count bool
+	// IDsOnly returns results without reading their details
+	IDsOnly bool
+}
+
+type SearchJob struct {
+	ID    string `json:"id"`
+	State string `json:"state"`
+	*ParsedJobResponse
+}
+
+type SearchResponse struct {
+	Results []*SearchJob `json:"results"`
+	// Matched is the number of results on this page
+	Matched int `json:"matched"`
+	// Total is the number of matches across all pages, only set when requested
+	Total   *int64 `json:"total,omitempty"`
+	Scanned int64  `json:"scanned"`
+	// Next is the cursor of the next page, empty once everything has been scanned
+	Next string `json:"next"`
+	// Indexed is set when candidates were read from the secondary indexes instead of scanning every job
+	Indexed bool `json:"indexed"`
+}
+
+// searchCursor is where a previous page stopped, either in a scan or in the candidates read from the indexes
+type searchCursor struct {
+	pos     scripts.SearchPosition
+	indexed bool
+	offset  int64
+}
+
+// SearchJobs returns the jobs matching a query across one or more states
+func (a *App) SearchJobs(ctx context.Context, queue string, opts SearchOptions) (*SearchResponse, error) {
+	expr, err := query.Parse(opts.Query, time.Now())
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSearch, err)
+	}
+
+	encoded, err := expr.JSON()
+
+	if err != nil {
+		return nil, err
+	}
+
+	states, err := parseSearchStates(opts.States)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSearch, err)
+	}
+
+	cursor, err := decodeSearchCursor(opts.Cursor)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSearch, err)
+	}
+
+	if opts.Limit <= 0 {
+		opts.Limit = defaultSearchLimit
+	}
+
+	if opts.Limit > maxSearchLimit {
+		opts.Limit = maxSearchLimit
+	}
+
+	queueKey := a.withPrefix(queue)
+
+	// Scans continue as they started, only new searches switch to the indexes
+	if a.Indexer != nil && (opts.Cursor == "" || cursor.indexed) {
+		if terms := a.indexTerms(expr); len(terms) > 0 {
+			ids, ok, err := a.Indexer.Lookup(ctx, queueKey, terms)
+
+			if err != nil {
+				slog.WarnContext(ctx, "app: unable to read search indexes, scanning instead", "error", err)
+			}
+
+			if ok {
+				return a.searchCandidates(ctx, queue, encoded, states, ids, cursor.offset, opts)
+			}
+		}
+	}
+
+	if cursor.indexed {
+		return nil, fmt.Errorf("%w: cursor expired, the search indexes are being rebuilt", ErrInvalidSearch)
+	}
+
+	pos := cursor.pos
+	res := &SearchResponse{Results: []*SearchJob{}}
+
+	for pos.StateIndex != 0 && len(res.Results) < opts.Limit && res.Scanned < searchScanBudget {
+		page, err := a.Redis.Scripts.SearchJobs(ctx, a.scriptsQueue(queue), encoded, states, pos, int64(opts.Limit-len(res.Results)), searchScanPerCall)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to search jobs: %w", err)
+		}
+
+		res.Scanned += page.Scanned
+		pos = page.Next
+
+		for _, match := range page.Jobs {
+			if opts.IDsOnly {
+				res.Results = append(res.Results, &SearchJob{ID: match.ID, State: match.State})
+				continue
+			}
+
+			details, err := a.GetJobDetails(ctx, queue, match.ID)
+
+			if err != nil {
+				slog.WarnContext(ctx, "app: unable to get job details", "job_id", match.ID, "error", err)
+				continue
+			}
+
+			res.Results = append(res.Results, &SearchJob{ID: match.ID, State: match.State, ParsedJobResponse: details})
+		}
+	}
+
+	res.Matched = len(res.Results)
+
+	if pos.StateIndex != 0 {
+		res.Next = encodeSearchCursor(searchCursor{pos: pos})
+	}
+
+	if opts.Count {
+		total, err := a.countMatches(ctx, queue, encoded, states)
+
+		if err != nil {
+			return nil, err
+		}
+
+		res.Total = &total
+	}
+
+	return res, nil
+}
+
+// indexTerms returns the equality terms on indexed fields every match must satisfy, i.e. those at the top level
+// of the query. Searches without any can't be answered from the indexes.
+func (a *App) indexTerms(expr *query.Expr) []index.Term {
+	conditions := []*query.Expr{expr}
+
+	if expr.Op == query.OpAnd {
+		conditions = expr.Args
+	}
+
+	var terms []index.Term
+
+	for _, cond := range conditions {
+		if cond.Op != query.OpCmp || cond.Cmp != query.CmpEq || cond.Value == "" {
+			continue
+		}
+
+		field := cond.Field
+		if len(cond.Path) > 0 {
+			field += "." + strings.Join(cond.Path, ".")
+		}
+
+		if !a.Indexer.Covers(field) {
+			continue
+		}
+
+		value := cond.Value
+		if cond.Num != nil {
+			value = strconv.FormatFloat(*cond.Num, 'f', -1, 64)
+		}
+
+		terms = append(terms, index.Term{Field: field, Value: value})
+	}
+
+	return terms
+}
+
+// searchCandidates evaluates the query against the jobs found in the indexes, starting at offset
+func (a *App) searchCandidates(ctx context.Context, queue string, encoded string, states []string, ids []string, offset int64, opts SearchOptions) (*SearchResponse, error) {
+	res := &SearchResponse{Results: []*SearchJob{}, Indexed: true}
+	q := a.scriptsQueue(queue)
+
+	for offset < int64(len(ids)) && len(res.Results) < opts.Limit && res.Scanned < searchScanBudget {
+		batch := ids[offset:min(offset+searchScanPerCall, int64(len(ids)))]
+		page, err := a.Redis.Scripts.SearchJobIds(ctx, q, encoded, states, batch, int64(opts.Limit-len(res.Results)))
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to search jobs: %w", err)
+		}
+
+		res.Scanned += page.Consumed
+		offset += page.Consumed
+		a.pruneIndexes(ctx, q.Key(), page.Missing)
+
+		for _, match := range page.Jobs {
+			if opts.IDsOnly {
+				res.Results = append(res.Results, &SearchJob{ID: match.ID, State: match.State})
+				continue
+			}
+
+			details, err := a.GetJobDetails(ctx, queue, match.ID)
+
+			if err != nil {
+				slog.WarnContext(ctx, "app: unable to get job details", "job_id", match.ID, "error", err)
+				continue
+			}
+
+			res.Results = append(res.Results, &SearchJob{ID: match.ID, State: match.State, ParsedJobResponse: details})
+		}
+	}
+
+	res.Matched = len(res.Results)
+
+	if offset < int64(len(ids)) {
+		res.Next = encodeSearchCursor(searchCursor{indexed: true, offset: offset})
+	}
+
+	if opts.Count {
+		var total int64
+
+		for start := 0; start < len(ids); start += searchScanPerCall {
+			page, err := a.Redis.Scripts.SearchJobIds(ctx, q, encoded, states, ids[start:min(start+searchScanPerCall, len(ids))], 0)
+
+			if err != nil {
+				return nil, fmt.Errorf("failed to count matching jobs: %w", err)
+			}
+
+			total += page.Matched
+		}
+
+		res.Total = &total
+	}
+
+	return res, nil
+}
+
+// pruneIndexes drops jobs BullMQ removed without an event, e.g. when trimming finished jobs
+func (a *App) pruneIndexes(ctx context.Context, queueKey string, ids []string) {
+	if err := a.Indexer.Remove(ctx, queueKey, ids); err != nil {
+		slog.WarnContext(ctx, "app: unable to prune search indexes", "error", err)
+	}
+}
+
+// countMatches scans every job of the states and counts those matching the encoded query
+func (a *App) countMatches(ctx context.Context, queue string, encoded string, states []string) (int64, error) {
+	var total int64
+	pos := scripts.SearchPosition{StateIndex: 1}
+
+	for pos.StateIndex != 0 {
+		page, err := a.Redis.Scripts.SearchJobs(ctx, a.scriptsQueue(queue), encoded, states, pos, 0, searchScanPerCall)
+
+		if err != nil {
+			return 0, fmt.Errorf("failed to count matching jobs: %w", err)
+		}
+
+		total += page.Matched
+		pos = page.Next
+	}
+
+	return total, nil
+}
+
+func parseSearchStates(states []string) ([]string, error) {
+	if len(states) == 0 {
+		return searchableStates, nil
+	}
+
+	for _, state := range states {
+		if !slices.Contains(searchableStates, state) {
+			return nil, fmt.Errorf("invalid state %q: must be one of %s", state, strings.Join(searchableStates, ", "))
+		}
+	}
+
+	return states, nil
+}
+
+// Cursors are opaque to clients, they encode the state and offset the scan stopped at,
+// or the offset within the candidates read from the indexes prefixed with i
+func encodeSearchCursor(cursor searchCursor) string {
+	if cursor.indexed {
+		return base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "i:%d", cursor.offset))
+	}
+
+	return base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%d:%d", cursor.pos.StateIndex, cursor.pos.Offset))
+}
+
+func decodeSearchCursor(cursor string) (searchCursor, error) {
+	if cursor == "" {
+		return searchCursor{pos: scripts.SearchPosition{StateIndex: 1}}, nil
+	}
+
+	invalid := fmt.Errorf("invalid cursor")
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+
+	if err != nil {
+		return searchCursor{}, invalid
+	}
+
+	stateIndex, offset, ok := strings.Cut(string(raw), ":")
+
+	if !ok {
+		return searchCursor{}, invalid
+	}
+
+	var res searchCursor
+
+	if stateIndex == "i" {
+		res.indexed = true
+	} else if res.pos.StateIndex, err = strconv.ParseInt(stateIndex, 10, 64); err != nil || res.pos.StateIndex < 1 {
+		return searchCursor{}, invalid
+	}
+
+	if res.offset, err = strconv.ParseInt(offset, 10, 64); err != nil || res.offset < 0 {
+		return searchCursor{}, invalid
+	}
+
+	res.pos.Offset = res.offset
+
+	return res, nil
+}
+
+func (a *App) HandleSearchJobs(ctx *gin.Context) (int, any, error) {
+	opts := SearchOptions{
+		Query:  ctx.Query("q"),
+		Cursor: ctx.Query("cursor"),
+		Count:  ctx.Query("count") == "true",
+	}
+
+	if opts.Query == "" {
+		return 400, nil, fmt.Errorf("missing query parameter q")
+	}
+
+	if states := ctx.Query("states"); states != "" {
+		opts.States = strings.Split(states, ",")
+	}
+
+	if limit := ctx.Query("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+
+		if err != nil {
+			return 400, nil, fmt.Errorf("invalid limit: %w", err)
+		}
+
+		opts.Limit = parsed
+	}
+
+	results, err := a.SearchJobs(ctx.Request.Context(), ctx.Param("queue"), opts)
+
+	if errors.Is(err, ErrInvalidSearch) {
+		return 400, nil, err
+	}
+
+	if err != nil {
+		return 500, nil, err
+	}
+
+	return 200, results, nil
+}
@@ -0,0 +1,161 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultMaxStalledCount matches the default of BullMQ workers
+	defaultMaxStalledCount = 1
+	stalledBatchSize       = 100
+)
+
+type StalledJob struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	StalledCounter int64  `json:"stalled_counter"`
+	AttemptsMade   int    `json:"attempts_made"`
+	ProcessedOn    int64  `json:"processed_on"`
+}
+
+type StalledJobsResponse struct {
+	Jobs  []StalledJob `json:"jobs"`
+	Count int          `json:"count"`
+}
+
+type RecoverStalledJobsRequest struct {
+	// JobIDs limits the recovery to these jobs, all stalled jobs are recovered when empty
+	JobIDs          []string `json:"jobIds"`
+	MaxStalledCount *int64   `json:"maxStalledCount"`
+}
+
+type RecoverStalledJobsResponse struct {
+	MovedToWait   []string `json:"moved_to_wait"`
+	MovedToFailed []string `json:"moved_to_failed"`
+	// Skipped are requested jobs that were not stalled (anymore)
+	Skipped []string `json:"skipped"`
+}
+
+// GetStalledJobs lists the active jobs of a queue that lost their lock
+func (a *App) GetStalledJobs(ctx context.Context, queue string) ([]StalledJob, error) {
+	stalled, err := a.Redis.Scripts.GetStalledJobs(ctx, a.scriptsQueue(queue))
+
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]StalledJob, 0, len(stalled))
+
+	for _, s := range stalled {
+		job := StalledJob{ID: s.ID, StalledCounter: s.StalledCounter}
+
+		if details, err := a.GetJobDetails(ctx, queue, s.ID); err == nil {
+			job.Name = details.Name
+			job.AttemptsMade = details.AttemptsMade
+			job.ProcessedOn = details.ProcessedOn
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+// RecoverStalledJobs moves stalled jobs back to wait, or to failed once they stalled more than
+// maxStalledCount times. Each batch is handled by a single script so a job is never moved twice.
+func (a *App) RecoverStalledJobs(ctx context.Context, queue string, jobIds []string, maxStalledCount int64) (*RecoverStalledJobsResponse, error) {
+	if len(jobIds) == 0 {
+		stalled, err := a.Redis.Scripts.GetStalledJobs(ctx, a.scriptsQueue(queue))
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, s := range stalled {
+			jobIds = append(jobIds, s.ID)
+		}
+	}
+
+	res := &RecoverStalledJobsResponse{
+		MovedToWait:   []string{},
+		MovedToFailed: []string{},
+		Skipped:       []string{},
+	}
+
+	for start := 0; start < len(jobIds); start += stalledBatchSize {
+		batch := jobIds[start:min(start+stalledBatchSize, len(jobIds))]
+
+		toWait, toFailed, err := a.Redis.Scripts.MoveStalledJobs(ctx, a.scriptsQueue(queue), maxStalledCount, time.Now().UnixMilli(), batch)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to recover stalled jobs: %w", err)
+		}
+
+		moved := make(map[string]bool, len(toWait)+len(toFailed))
+		for _, id := range toWait {
+			moved[id] = true
+		}
+		for _, id := range toFailed {
+			moved[id] = true
+		}
+
+		for _, id := range batch {
+			if !moved[id] {
+				res.Skipped = append(res.Skipped, id)
+			}
+		}
+
+		res.MovedToWait = append(res.MovedToWait, toWait...)
+		res.MovedToFailed = append(res.MovedToFailed, toFailed...)
+	}
+
+	return res, nil
+}
+
+func (a *App) HandleGetStalledJobs(ctx *gin.Context) (int, any, error) {
+	jobs, err := a.GetStalledJobs(ctx.Request.Context(), ctx.Param("queue"))
+
+	if err != nil {
+		return 500, nil, err
+	}
+
+	return 200, StalledJobsResponse{Jobs: jobs, Count: len(jobs)}, nil
+}
+
+func (a *App) HandleRecoverStalledJobs(ctx *gin.Context) (int, any, error) {
+	var req RecoverStalledJobsRequest
+
+	// An empty body recovers every stalled job with the default limit
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			return 400, nil, fmt.Errorf("invalid request body: %w", err)
+		}
+	}
+
+	maxStalledCount := int64(defaultMaxStalledCount)
+	if req.MaxStalledCount != nil {
+		if *req.MaxStalledCount < 0 {
+			return 400, nil, fmt.Errorf("maxStalledCount must not be negative")
+		}
+
+		maxStalledCount = *req.MaxStalledCount
+	}
+
+	for _, id := range req.JobIDs {
+		if !SerializedId(id).IsValid() {
+			return 400, nil, fmt.Errorf("invalid job id %q", id)
+		}
+	}
+
+	results, err := a.RecoverStalledJobs(ctx.Request.Context(), ctx.Param("queue"), req.JobIDs, maxStalledCount)
+
+	if err != nil {
+		return 500, nil, err
+	}
+
+	return 200, results, nil
+}
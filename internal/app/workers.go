@@ -0,0 +1,199 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const defaultActiveJobsLimit = 25
+
+type Worker struct {
+	ID   int64  `json:"id"`
+	Addr string `json:"addr"`
+	Name string `json:"name"`
+	// WorkerName is the name given to the worker in its options, if any
+	WorkerName string `json:"worker_name,omitempty"`
+	// Age and Idle are in seconds
+	Age  int64 `json:"age"`
+	Idle int64 `json:"idle"`
+}
+
+type WorkersResponse struct {
+	Workers []Worker `json:"workers"`
+	Count   int      `json:"count"`
+}
+
+type JobLock struct {
+	// Token identifies the worker holding the lock
+	Token string `json:"token"`
+	// TTL is the remaining time of the lock in milliseconds
+	TTL int64 `json:"ttl"`
+}
+
+type ActiveJob struct {
+	ID string `json:"id"`
+	*ParsedJobResponse
+	// Lock is nil when the lock has expired, the job will be considered stalled
+	Lock *JobLock `json:"lock"`
+}
+
+type ActiveJobsResponse struct {
+	Count int64        `json:"count"`
+	Jobs  []*ActiveJob `json:"results"`
+	// ExpiredLocks is the number of returned jobs without a lock
+	ExpiredLocks int `json:"expired_locks"`
+}
+
+// GetWorkers lists the connections of the workers processing a queue
+func (a *App) GetWorkers(ctx context.Context, queue string) ([]Worker, error) {
+	clients, err := a.Redis.Clients(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	workers := []Worker{}
+
+	for _, client := range clients {
+		workerName, ok := client.WorkerOf(a.QueuePrefix, queue)
+
+		if !ok {
+			continue
+		}
+
+		workers = append(workers, Worker{
+			ID:         client.ID,
+			Addr:       client.Addr,
+			Name:       client.Name,
+			WorkerName: workerName,
+			Age:        client.Age,
+			Idle:       client.Idle,
+		})
+	}
+
+	return workers, nil
+}
+
+// GetActiveJobs lists active jobs along with the lock held by the worker processing them
+func (a *App) GetActiveJobs(ctx context.Context, queue string, start int64, limit int64) (*ActiveJobsResponse, error) {
+	activeKey := a.withPrefix(queue, "active")
+
+	ids, err := a.Redis.Client.LRange(ctx, activeKey, start, start+limit-1).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := a.Redis.Client.LLen(ctx, activeKey).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	locks, err := a.getJobLocks(ctx, queue, ids)
+
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ActiveJobsResponse{Count: count, Jobs: []*ActiveJob{}}
+
+	for i, id := range ids {
+		details, err := a.GetJobDetails(ctx, queue, id)
+
+		if err != nil {
+			slog.WarnContext(ctx, "app: unable to get job details", "job_id", id, "error", err)
+			continue
+		}
+
+		if locks[i] == nil {
+			res.ExpiredLocks++
+		}
+
+		res.Jobs = append(res.Jobs, &ActiveJob{ID: id, ParsedJobResponse: details, Lock: locks[i]})
+	}
+
+	return res, nil
+}
+
+// getJobLocks reads the lock of each job in a single round trip, missing locks are nil
+func (a *App) getJobLocks(ctx context.Context, queue string, ids []string) ([]*JobLock, error) {
+	pipe := a.Redis.Client.Pipeline()
+
+	tokens := make([]*redis.StringCmd, len(ids))
+	ttls := make([]*redis.DurationCmd, len(ids))
+
+	for i, id := range ids {
+		lockKey := a.withPrefix(queue, id, "lock")
+		tokens[i] = pipe.Get(ctx, lockKey)
+		ttls[i] = pipe.PTTL(ctx, lockKey)
+	}
+
+	// Exec only reports the first failed command, expired locks fail with redis.Nil so each command is checked
+	_, _ = pipe.Exec(ctx)
+
+	locks := make([]*JobLock, len(ids))
+
+	for i := range ids {
+		token, err := tokens[i].Result()
+
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err := ttls[i].Err(); err != nil {
+			return nil, err
+		}
+
+		locks[i] = &JobLock{Token: token, TTL: ttls[i].Val().Milliseconds()}
+
+		// A lock without expiry reports a negative TTL
+		if ttls[i].Val() < 0 {
+			locks[i].TTL = -1
+		}
+	}
+
+	return locks, nil
+}
+
+func (a *App) HandleGetWorkers(ctx *gin.Context) (int, any, error) {
+	workers, err := a.GetWorkers(ctx.Request.Context(), ctx.Param("queue"))
+
+	if err != nil {
+		return 500, nil, err
+	}
+
+	return 200, WorkersResponse{Workers: workers, Count: len(workers)}, nil
+}
+
+func (a *App) HandleListActiveJobs(ctx *gin.Context) (int, any, error) {
+	start, err := strconv.ParseInt(ctx.DefaultQuery("start", "0"), 10, 64)
+
+	if err != nil || start < 0 {
+		return 400, nil, fmt.Errorf("invalid start")
+	}
+
+	limit, err := strconv.ParseInt(ctx.DefaultQuery("limit", strconv.Itoa(defaultActiveJobsLimit)), 10, 64)
+
+	if err != nil || limit <= 0 {
+		return 400, nil, fmt.Errorf("invalid limit")
+	}
+
+	results, err := a.GetActiveJobs(ctx.Request.Context(), ctx.Param("queue"), start, limit)
+
+	if err != nil {
+		return 500, nil, err
+	}
+
+	return 200, results, nil
+}
@@ -4,17 +4,31 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/spf13/viper"
+	"github.com/wolzey/taskboard/internal/alerts"
+	"github.com/wolzey/taskboard/internal/api"
+	"github.com/wolzey/taskboard/internal/logging"
+	"github.com/wolzey/taskboard/internal/tracing"
 )
 
 type Config struct {
-	Redis RedisConfig `mapstructure:"redis"`
-	API   APIConfig   `mapstructure:"api"`
-	Queue QueueConfig `mapstructure:"queue"`
+	Redis   RedisConfig   `mapstructure:"redis"`
+	API     APIConfig     `mapstructure:"api"`
+	Queue   QueueConfig   `mapstructure:"queue"`
+	Index   IndexConfig   `mapstructure:"index"`
+	Export  ExportConfig  `mapstructure:"export"`
+	History HistoryConfig `mapstructure:"history"`
+	Alerts  AlertsConfig  `mapstructure:"alerts"`
+	Client  ClientConfig  `mapstructure:"client"`
+	Log     LogConfig     `mapstructure:"log"`
+	Tracing TracingConfig `mapstructure:"tracing"`
 }
 
 type RedisConfig struct {
@@ -25,6 +39,9 @@ type RedisConfig struct {
 	Username string    `mapstructure:"username"`
 	UseTLS   bool      `mapstructure:"use_tls"`
 	TLS      TLSConfig `mapstructure:"tls"`
+	// PasswordFile and UsernameFile hold the credentials instead, they are read again for each new connection
+	PasswordFile string `mapstructure:"password_file"`
+	UsernameFile string `mapstructure:"username_file"`
 }
 
 type TLSConfig struct {
@@ -35,16 +52,162 @@ type TLSConfig struct {
 }
 
 type APIConfig struct {
-	Port int `mapstructure:"port"`
+	Port     int    `mapstructure:"port"`
+	BasePath string `mapstructure:"base_path"`
+	UI       bool   `mapstructure:"ui"`
+	// ReadTimeout and WriteTimeout bound reading the body of a request and writing its response
+	ReadTimeout  time.Duration `mapstructure:"read_timeout"`
+	WriteTimeout time.Duration `mapstructure:"write_timeout"`
+	// GinMode is debug, release or test, the GIN_MODE environment variable is used when empty
+	GinMode string       `mapstructure:"gin_mode"`
+	TLS     APITLSConfig `mapstructure:"tls"`
+}
+
+// APITLSConfig serves the API over TLS when CertFile is set, clients present certificates signed by the
+// authorities of ClientCAFile when it is set
+type APITLSConfig struct {
+	CertFile     string `mapstructure:"cert_file"`
+	KeyFile      string `mapstructure:"key_file"`
+	ClientCAFile string `mapstructure:"client_ca_file"`
+	// ClientAuth is none, request, require, verify_if_given or require_and_verify
+	ClientAuth string          `mapstructure:"client_auth"`
+	Principals []api.Principal `mapstructure:"principals"`
+}
+
+// Enabled tells whether the API is served over TLS
+func (t *APITLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+// ToTLSOptions converts APITLSConfig to the TLS options of the API, nil when TLS is disabled
+func (t *APITLSConfig) ToTLSOptions() (*api.TLSOptions, error) {
+	if !t.Enabled() {
+		return nil, nil
+	}
+
+	auth, err := api.ParseClientAuth(t.ClientAuth, t.ClientCAFile != "")
+	if err != nil {
+		return nil, fmt.Errorf("api.tls.client_auth %w", err)
+	}
+
+	// Every request would be refused, certificates which aren't verified match no principal
+	if len(t.Principals) > 0 && !api.VerifiesClientCerts(auth) {
+		return nil, fmt.Errorf("api.tls.principals need verified client certificates, api.tls.client_auth must be verify_if_given or require_and_verify")
+	}
+
+	return &api.TLSOptions{
+		CertFile:     t.CertFile,
+		KeyFile:      t.KeyFile,
+		ClientCAFile: t.ClientCAFile,
+		ClientAuth:   auth,
+		Principals:   t.Principals,
+	}, nil
 }
 
 type QueueConfig struct {
 	Prefix string `mapstructure:"prefix"`
 }
 
+type ExportConfig struct {
+	Mask []string `mapstructure:"mask"`
+}
+
+type IndexConfig struct {
+	Enabled bool     `mapstructure:"enabled"`
+	Fields  []string `mapstructure:"fields"`
+}
+
+type HistoryConfig struct {
+	Enabled        bool          `mapstructure:"enabled"`
+	Interval       time.Duration `mapstructure:"interval"`
+	Store          string        `mapstructure:"store"`
+	Path           string        `mapstructure:"path"`
+	Retention      time.Duration `mapstructure:"retention"`
+	RawRetention   time.Duration `mapstructure:"raw_retention"`
+	DownsampleStep time.Duration `mapstructure:"downsample_step"`
+}
+
+type AlertsConfig struct {
+	Enabled   bool                    `mapstructure:"enabled"`
+	Interval  time.Duration           `mapstructure:"interval"`
+	Rules     []alerts.Rule           `mapstructure:"rules"`
+	Notifiers []alerts.NotifierConfig `mapstructure:"notifiers"`
+}
+
+// ClientConfig configures the commands that inspect queues from the terminal
+type ClientConfig struct {
+	// Server is the URL of a taskboard server the commands call instead of connecting to Redis
+	Server string `mapstructure:"server"`
+	// TLS configures the connections to an https server, e.g. the certificate of mTLS clients
+	TLS TLSConfig `mapstructure:"tls"`
+}
+
+// TracingConfig configures the OpenTelemetry traces of serve
+type TracingConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Exporter is otlp, or stdout for local testing
+	Exporter string `mapstructure:"exporter"`
+	// Endpoint is the host:port or URL of the OTLP collector, the OTEL_EXPORTER_OTLP_* variables apply when empty
+	Endpoint string `mapstructure:"endpoint"`
+	// Protocol is http or grpc
+	Protocol    string            `mapstructure:"protocol"`
+	Insecure    bool              `mapstructure:"insecure"`
+	Headers     map[string]string `mapstructure:"headers"`
+	ServiceName string            `mapstructure:"service_name"`
+	SampleRatio float64           `mapstructure:"sample_ratio"`
+}
+
+// ToTracingOptions converts TracingConfig to the options of the tracing package
+func (t *TracingConfig) ToTracingOptions() tracing.Options {
+	return tracing.Options{
+		Exporter:    t.Exporter,
+		Endpoint:    t.Endpoint,
+		Protocol:    t.Protocol,
+		Insecure:    t.Insecure,
+		Headers:     t.Headers,
+		ServiceName: t.ServiceName,
+		SampleRatio: t.SampleRatio,
+	}
+}
+
+// LogConfig configures the logs of serve
+type LogConfig struct {
+	// Level is debug, info, warn or error
+	Level string `mapstructure:"level"`
+	// Format is text or json
+	Format string `mapstructure:"format"`
+}
+
+// SlogLevel parses the level
+func (l *LogConfig) SlogLevel() (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(l.Level))
+	return level, err
+}
+
+// Handler creates the handler of the logs written to w, at the level of leveler
+func (l *LogConfig) Handler(w io.Writer, leveler slog.Leveler) (slog.Handler, error) {
+	return logging.NewHandler(w, l.Format, leveler)
+}
+
 // LoadConfig loads configuration from config file and environment variables
-// Environment variables take precedence over config file values
+// Environment variables take precedence over config file values.
+// It fails with a ValidationError listing every problem when the configuration is invalid.
 func LoadConfig() (*Config, error) {
+	cfg, err := ReadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if problems := cfg.Validate(); len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+
+	return cfg, nil
+}
+
+// ReadConfig loads the configuration like LoadConfig, without validating it
+func ReadConfig() (*Config, error) {
 	// Set defaults
 	setDefaults()
 
@@ -68,8 +231,13 @@ func LoadConfig() (*Config, error) {
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.AutomaticEnv()
 
+	return unmarshal()
+}
+
+// unmarshal decodes the configuration viper holds
+func unmarshal() (*Config, error) {
 	var cfg Config
-	if err := viper.Unmarshal(&cfg); err != nil {
+	if err := viper.Unmarshal(&cfg, decodeHook); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
@@ -83,6 +251,8 @@ func setDefaults() {
 	viper.SetDefault("redis.password", "")
 	viper.SetDefault("redis.db", 0)
 	viper.SetDefault("redis.username", "")
+	viper.SetDefault("redis.password_file", "")
+	viper.SetDefault("redis.username_file", "")
 	viper.SetDefault("redis.use_tls", false)
 	viper.SetDefault("redis.tls.cert_file", "")
 	viper.SetDefault("redis.tls.key_file", "")
@@ -91,9 +261,58 @@ func setDefaults() {
 
 	// API defaults
 	viper.SetDefault("api.port", 1337)
+	viper.SetDefault("api.base_path", "")
+	viper.SetDefault("api.ui", true)
+	viper.SetDefault("api.read_timeout", "10s")
+	viper.SetDefault("api.write_timeout", "10s")
+	viper.SetDefault("api.gin_mode", "")
+	viper.SetDefault("api.tls.cert_file", "")
+	viper.SetDefault("api.tls.key_file", "")
+	viper.SetDefault("api.tls.client_ca_file", "")
+	viper.SetDefault("api.tls.client_auth", "")
 
 	// Queue defaults
 	viper.SetDefault("queue.prefix", "bull")
+
+	// Index defaults
+	viper.SetDefault("index.enabled", false)
+	viper.SetDefault("index.fields", []string{"name", "errorClass"})
+
+	// Export defaults
+	viper.SetDefault("export.mask", []string{})
+
+	// History defaults
+	viper.SetDefault("history.enabled", false)
+	viper.SetDefault("history.interval", "1m")
+	viper.SetDefault("history.store", "file")
+	viper.SetDefault("history.path", "./taskboard-history")
+	viper.SetDefault("history.retention", "720h")
+	viper.SetDefault("history.raw_retention", "24h")
+	viper.SetDefault("history.downsample_step", "15m")
+
+	// Alerts defaults
+	viper.SetDefault("alerts.enabled", false)
+	viper.SetDefault("alerts.interval", "30s")
+
+	// Client defaults
+	viper.SetDefault("client.server", "")
+	viper.SetDefault("client.tls.cert_file", "")
+	viper.SetDefault("client.tls.key_file", "")
+	viper.SetDefault("client.tls.ca_file", "")
+	viper.SetDefault("client.tls.insecure_skip_verify", false)
+
+	// Log defaults
+	viper.SetDefault("log.level", "info")
+	viper.SetDefault("log.format", logging.FormatText)
+
+	// Tracing defaults
+	viper.SetDefault("tracing.enabled", false)
+	viper.SetDefault("tracing.exporter", tracing.ExporterOTLP)
+	viper.SetDefault("tracing.endpoint", "")
+	viper.SetDefault("tracing.protocol", tracing.ProtocolHTTP)
+	viper.SetDefault("tracing.insecure", false)
+	viper.SetDefault("tracing.service_name", "taskboard")
+	viper.SetDefault("tracing.sample_ratio", 1.0)
 }
 
 // ToRedisOptions converts RedisConfig to redis.Options
@@ -105,8 +324,19 @@ func (r *RedisConfig) ToRedisOptions() (*redis.Options, error) {
 		Username: r.Username,
 	}
 
+	if r.PasswordFile != "" || r.UsernameFile != "" {
+		creds := &credentials{
+			username:     r.Username,
+			password:     r.Password,
+			usernameFile: r.UsernameFile,
+			passwordFile: r.PasswordFile,
+			read:         map[string]string{},
+		}
+		opts.CredentialsProviderContext = creds.provide
+	}
+
 	if r.UseTLS {
-		tlsConfig, err := r.buildTLSConfig()
+		tlsConfig, err := r.TLS.ToTLSConfig()
 		if err != nil {
 			return nil, fmt.Errorf("failed to build TLS config: %w", err)
 		}
@@ -116,15 +346,15 @@ func (r *RedisConfig) ToRedisOptions() (*redis.Options, error) {
 	return opts, nil
 }
 
-// buildTLSConfig creates a tls.Config from TLSConfig
-func (r *RedisConfig) buildTLSConfig() (*tls.Config, error) {
+// ToTLSConfig creates a tls.Config from TLSConfig
+func (t *TLSConfig) ToTLSConfig() (*tls.Config, error) {
 	tlsConfig := &tls.Config{
-		InsecureSkipVerify: r.TLS.InsecureSkipVerify,
+		InsecureSkipVerify: t.InsecureSkipVerify,
 	}
 
 	// Load client cert and key if provided
-	if r.TLS.CertFile != "" && r.TLS.KeyFile != "" {
-		cert, err := tls.LoadX509KeyPair(r.TLS.CertFile, r.TLS.KeyFile)
+	if t.CertFile != "" && t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load client certificate: %w", err)
 		}
@@ -132,8 +362,8 @@ func (r *RedisConfig) buildTLSConfig() (*tls.Config, error) {
 	}
 
 	// Load CA cert if provided
-	if r.TLS.CAFile != "" {
-		caCert, err := os.ReadFile(r.TLS.CAFile)
+	if t.CAFile != "" {
+		caCert, err := os.ReadFile(t.CAFile)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
 		}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"net/url"
+
+	"github.com/spf13/viper"
+)
+
+// redacted replaces the value of secrets
+const redacted = "********"
+
+// secretKeys are the settings holding secrets at any depth, the values of headers are secrets too
+var secretKeys = map[string]bool{"password": true, "token": true, "secret": true}
+
+// Settings is the effective configuration, merged from the defaults, the config file and the environment.
+// Secrets are masked when redact is set: passwords, header values and the paths, queries and passwords of URLs.
+func Settings(redact bool) map[string]any {
+	settings := viper.AllSettings()
+
+	if redact {
+		return redactMap(settings)
+	}
+
+	return settings
+}
+
+// redactMap copies m with its secrets masked, viper may share nested values with its own settings
+func redactMap(m map[string]any) map[string]any {
+	copied := make(map[string]any, len(m))
+
+	for key, value := range m {
+		switch {
+		case secretKeys[key]:
+			if value != nil && value != "" {
+				value = redacted
+			}
+		case key == "headers":
+			if headers, ok := value.(map[string]any); ok {
+				masked := make(map[string]any, len(headers))
+				for name := range headers {
+					masked[name] = redacted
+				}
+				value = masked
+			}
+		case key == "url" || key == "server":
+			if s, ok := value.(string); ok {
+				value = redactURL(s)
+			}
+		default:
+			value = redactValue(value)
+		}
+
+		copied[key] = value
+	}
+
+	return copied
+}
+
+func redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		return redactMap(v)
+	case []any:
+		copied := make([]any, len(v))
+		for i, item := range v {
+			copied[i] = redactValue(item)
+		}
+		return copied
+	}
+
+	return value
+}
+
+// redactURL keeps the scheme and host of a URL, webhook URLs such as Slack's carry their token in the path
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+
+	if err != nil || u.Host == "" {
+		if raw == "" {
+			return raw
+		}
+
+		return redacted
+	}
+
+	s := u.Scheme + "://"
+
+	if u.User != nil {
+		s += u.User.Username()
+
+		if _, ok := u.User.Password(); ok {
+			s += ":" + redacted
+		}
+
+		s += "@"
+	}
+
+	s += u.Host
+
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+		s += "/" + redacted
+	}
+
+	return s
+}
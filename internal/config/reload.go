@@ -0,0 +1,197 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// settle is how long to wait for writes to the config file to end before reading it,
+// editors and tools often truncate it first then write it in several events
+const settle = 200 * time.Millisecond
+
+// Change is a setting whose value changed, secrets are redacted
+type Change struct {
+	Key string
+	Old string
+	New string
+}
+
+// Watch calls onChange each time the config file is written, with the new configuration or why it is invalid.
+// Calls are made one at a time. It fails when no config file was loaded.
+func Watch(onChange func(cfg *Config, err error)) error {
+	if viper.ConfigFileUsed() == "" {
+		return fmt.Errorf("no config file to watch")
+	}
+
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		time.Sleep(settle)
+
+		// viper read the file as soon as it changed, it may have been half written
+		if err := viper.ReadInConfig(); err != nil {
+			onChange(nil, fmt.Errorf("failed to read config file: %w", err))
+			return
+		}
+
+		if info, err := os.Stat(viper.ConfigFileUsed()); err == nil && info.Size() == 0 {
+			onChange(nil, fmt.Errorf("config file %s is empty", viper.ConfigFileUsed()))
+			return
+		}
+
+		cfg, err := unmarshal()
+
+		if err == nil {
+			if problems := cfg.Validate(); len(problems) > 0 {
+				err = &ValidationError{Problems: problems}
+			}
+		}
+
+		onChange(cfg, err)
+	})
+	viper.WatchConfig()
+
+	return nil
+}
+
+// WatchFiles calls onChange each time the contents of any of the files change, until ctx is done. Calls are
+// made one at a time. Directories are watched rather than files since Kubernetes replaces the symlinks of
+// mounted secrets.
+func WatchFiles(ctx context.Context, paths []string, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	// read are the last contents of each file, writes that leave them unchanged are ignored
+	read := map[string]string{}
+	dirs := map[string]bool{}
+
+	for _, p := range paths {
+		read[p], _ = readSecret(p)
+
+		if dirs[filepath.Dir(p)] {
+			continue
+		}
+
+		dirs[filepath.Dir(p)] = true
+
+		if err := watcher.Add(filepath.Dir(p)); err != nil {
+			watcher.Close()
+			return fmt.Errorf("unable to watch %s: %w", filepath.Dir(p), err)
+		}
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		var check <-chan time.Time
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				check = time.After(settle)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+
+				slog.Warn("config: watching files failed", "error", err)
+			case <-check:
+				check = nil
+				changed := false
+
+				for _, p := range paths {
+					// A file missing during a rotation is checked again on the next write
+					if value, err := readSecret(p); err == nil && value != read[p] {
+						read[p] = value
+						changed = true
+					}
+				}
+
+				if changed && ctx.Err() == nil {
+					onChange()
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Diff lists the settings that differ between two configurations, sorted by key
+func Diff(old *Config, new *Config) []Change {
+	before := map[string]string{}
+	after := map[string]string{}
+	flatten(before, "", reflect.ValueOf(*old))
+	flatten(after, "", reflect.ValueOf(*new))
+
+	var changes []Change
+
+	for _, key := range slices.Sorted(maps.Keys(after)) {
+		if before[key] == after[key] {
+			continue
+		}
+
+		change := Change{Key: key, Old: before[key], New: after[key]}
+
+		if secretSetting(key) {
+			change.Old, change.New = redacted, redacted
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes
+}
+
+// secretSetting tells whether a setting holds secrets, notifiers hold passwords and webhook URLs and
+// headers API keys
+func secretSetting(key string) bool {
+	last := key[strings.LastIndex(key, ".")+1:]
+	return secretKeys[last] || last == "headers" || key == "alerts.notifiers"
+}
+
+// flatten formats the settings of a configuration by key, lists and maps are formatted as JSON
+func flatten(settings map[string]string, prefix string, v reflect.Value) {
+	if v.Kind() == reflect.Struct {
+		for i := 0; i < v.NumField(); i++ {
+			flatten(settings, prefix+v.Type().Field(i).Tag.Get("mapstructure")+".", v.Field(i))
+		}
+		return
+	}
+
+	key := strings.TrimSuffix(prefix, ".")
+
+	// Empty lists are formatted alike whether they are nil or not
+	if v.Kind() == reflect.Slice && v.Len() == 0 {
+		settings[key] = "[]"
+		return
+	}
+
+	switch value := v.Interface().(type) {
+	case time.Duration:
+		settings[key] = value.String()
+	case string, bool, int:
+		settings[key] = fmt.Sprint(value)
+	default:
+		encoded, _ := json.Marshal(value)
+		settings[key] = string(encoded)
+	}
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/spf13/viper"
+)
+
+// envRef matches the ${NAME} references to environment variables in config strings, and the $${ escapes
+// written for a literal ${
+var envRef = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Expand resolves the indirections of a config string: file:///path is replaced by the contents of the
+// file, without trailing newlines, and each ${NAME} by the value of the environment variable. $${ is
+// written for a literal ${ and $$file:// for a value starting with a literal file://. Referencing a file
+// that can't be read or a variable that is not set is an error.
+func Expand(value string) (string, error) {
+	if rest, ok := strings.CutPrefix(value, "$$file://"); ok {
+		expanded, err := expandEnv(rest)
+		return "file://" + expanded, err
+	}
+
+	if path, ok := strings.CutPrefix(value, "file://"); ok {
+		return readSecret(path)
+	}
+
+	return expandEnv(value)
+}
+
+// expandEnv replaces the ${NAME} references of a config string by the values of the environment variables
+func expandEnv(value string) (string, error) {
+	var missing []string
+
+	expanded := envRef.ReplaceAllStringFunc(value, func(ref string) string {
+		if ref == "$${" {
+			return "${"
+		}
+
+		name := envRef.FindStringSubmatch(ref)[1]
+		v, ok := os.LookupEnv(name)
+
+		if !ok {
+			missing = append(missing, name)
+		}
+
+		return v
+	})
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+
+	return expanded, nil
+}
+
+// readSecret reads a secret mounted as a file, such as a Kubernetes secret
+func readSecret(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read %s: %w", path, err)
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// expandHook expands every string of the configuration as it is decoded
+func expandHook(from reflect.Type, to reflect.Type, data any) (any, error) {
+	if from.Kind() != reflect.String {
+		return data, nil
+	}
+
+	return Expand(data.(string))
+}
+
+// decodeHook is viper's, strings are expanded before being converted
+var decodeHook = viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+	expandHook,
+	mapstructure.StringToTimeDurationHookFunc(),
+	mapstructure.StringToSliceHookFunc(","),
+))
+
+// credentials provides the Redis credentials, the files holding them are read each time a connection is opened
+// so rotated credentials are used without a restart. Open connections keep the session they authenticated
+// until serve, which watches the files, reconnects.
+type credentials struct {
+	username     string
+	password     string
+	usernameFile string
+	passwordFile string
+
+	mu sync.Mutex
+	// read are the last values read from each file, used when a file can't be read during a rotation
+	read map[string]string
+}
+
+// CredentialFiles lists the files holding the Redis credentials
+func (r *RedisConfig) CredentialFiles() []string {
+	var files []string
+
+	for _, path := range []string{r.UsernameFile, r.PasswordFile} {
+		if path != "" {
+			files = append(files, path)
+		}
+	}
+
+	return files
+}
+
+func (c *credentials) provide(ctx context.Context) (string, string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	username, err := c.value(c.username, c.usernameFile)
+	if err != nil {
+		return "", "", err
+	}
+
+	password, err := c.value(c.password, c.passwordFile)
+	if err != nil {
+		return "", "", err
+	}
+
+	return username, password, nil
+}
+
+// value reads a credential from its file when it has one
+func (c *credentials) value(static string, path string) (string, error) {
+	if path == "" {
+		return static, nil
+	}
+
+	value, err := readSecret(path)
+	last, known := c.read[path]
+
+	if err != nil {
+		if !known {
+			return "", err
+		}
+
+		slog.Warn("redis: using the last credentials read", "error", err)
+		return last, nil
+	}
+
+	if known && value != last {
+		slog.Info("redis: credentials changed, new connections authenticate with them", "file", path)
+	}
+
+	c.read[path] = value
+	return value, nil
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExpand(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret")
+
+	if err := os.WriteFile(secret, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("TASKBOARD_TEST_NAME", "ops")
+
+	cases := []struct {
+		value string
+		want  string
+		err   bool
+	}{
+		{"plain", "plain", false},
+		{"${TASKBOARD_TEST_NAME}-alerts", "ops-alerts", false},
+		{"pa$${TASKBOARD_TEST_NAME}", "pa${TASKBOARD_TEST_NAME}", false},
+		{"file://" + secret, "s3cret", false},
+		{"$$file:///srv/hooks", "file:///srv/hooks", false},
+		{"$$file:///srv/${TASKBOARD_TEST_NAME}", "file:///srv/ops", false},
+		{"${TASKBOARD_TEST_UNSET}", "", true},
+		{"file://" + filepath.Join(dir, "missing"), "", true},
+	}
+
+	for _, c := range cases {
+		got, err := Expand(c.value)
+
+		if (err != nil) != c.err {
+			t.Errorf("%s: got error %v, want one: %v", c.value, err, c.err)
+			continue
+		}
+
+		if got != c.want {
+			t.Errorf("%s: got %q, want %q", c.value, got, c.want)
+		}
+	}
+}
+
+func TestWatchFiles(t *testing.T) {
+	dir := t.TempDir()
+	password := filepath.Join(dir, "password")
+
+	if err := os.WriteFile(password, []byte("first"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := make(chan struct{}, 10)
+
+	if err := WatchFiles(t.Context(), []string{password}, func() { changed <- struct{}{} }); err != nil {
+		t.Fatal(err)
+	}
+
+	// Writing the same contents again isn't a change
+	if err := os.WriteFile(password, []byte("first"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-changed:
+		t.Fatal("got a change for the same contents")
+	case <-time.After(3 * settle):
+	}
+
+	// Kubernetes writes the new secret aside then renames it
+	rotated := filepath.Join(dir, ".password.tmp")
+
+	if err := os.WriteFile(rotated, []byte("second"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Rename(rotated, password); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the rotated file wasn't noticed")
+	}
+}
@@ -0,0 +1,361 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"github.com/wolzey/taskboard/internal/alerts"
+	"github.com/wolzey/taskboard/internal/api"
+	"github.com/wolzey/taskboard/internal/tracing"
+)
+
+// Problem is an invalid setting, Source tells where its value comes from
+type Problem struct {
+	Key     string `json:"key"`
+	Source  string `json:"source"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s (%s): %s", p.Key, p.Source, p.Message)
+}
+
+// ValidationError is returned by LoadConfig with every problem of the configuration
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid configuration:")
+
+	for _, p := range e.Problems {
+		b.WriteString("\n  " + p.String())
+	}
+
+	return b.String()
+}
+
+// EnvVar is the environment variable overriding a key, e.g. TASKBOARD_REDIS_HOST for redis.host
+func EnvVar(key string) string {
+	return "TASKBOARD_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// Source tells where the value of a key comes from: its environment variable, the config file or the default
+func Source(key string) string {
+	// Empty environment variables are ignored
+	if env := EnvVar(key); os.Getenv(env) != "" {
+		return "env " + env
+	}
+
+	if viper.InConfig(key) {
+		return "file " + viper.ConfigFileUsed()
+	}
+
+	return "default"
+}
+
+// problems collects the problems found while validating
+type problems []Problem
+
+func (p *problems) add(key string, format string, args ...any) {
+	*p = append(*p, Problem{Key: key, Source: Source(key), Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate checks the configuration and the files it points to, it returns every problem found
+func (c *Config) Validate() []Problem {
+	var p problems
+
+	unknownKeys(&p)
+	c.Redis.validate(&p)
+
+	if c.API.Port < 1 || c.API.Port > 65535 {
+		p.add("api.port", "must be between 1 and 65535, got %d", c.API.Port)
+	}
+
+	if strings.ContainsAny(c.API.BasePath, "?# ") {
+		p.add("api.base_path", "must be a path without spaces, a query or a fragment, got %q", c.API.BasePath)
+	}
+
+	if c.API.ReadTimeout < 0 {
+		p.add("api.read_timeout", "must not be negative, got %s", c.API.ReadTimeout)
+	}
+
+	if c.API.WriteTimeout < 0 {
+		p.add("api.write_timeout", "must not be negative, got %s", c.API.WriteTimeout)
+	}
+
+	if !slices.Contains([]string{"", gin.DebugMode, gin.ReleaseMode, gin.TestMode}, c.API.GinMode) {
+		p.add("api.gin_mode", "must be debug, release or test, got %q", c.API.GinMode)
+	}
+
+	c.API.TLS.validate(&p)
+
+	if _, err := c.Log.SlogLevel(); err != nil {
+		p.add("log.level", "must be debug, info, warn or error, got %q", c.Log.Level)
+	}
+
+	if _, err := c.Log.Handler(io.Discard, nil); err != nil {
+		p.add("log.format", "must be text or json, got %q", c.Log.Format)
+	}
+
+	if c.Queue.Prefix == "" {
+		p.add("queue.prefix", "must not be empty")
+	}
+
+	if c.Index.Enabled && len(c.Index.Fields) == 0 {
+		p.add("index.fields", "at least one field is required when the index is enabled")
+	}
+
+	if c.History.Enabled {
+		c.History.validate(&p)
+	}
+
+	if c.Alerts.Enabled {
+		if c.Alerts.Interval < 0 {
+			p.add("alerts.interval", "must not be negative, got %s", c.Alerts.Interval)
+		}
+
+		if err := alerts.Validate(alerts.Options{Rules: c.Alerts.Rules, Notifiers: c.Alerts.Notifiers}); err != nil {
+			p.add("alerts", "%v", err)
+		}
+	}
+
+	if c.Tracing.Enabled {
+		if err := tracing.Validate(c.Tracing.ToTracingOptions()); err != nil {
+			p.add("tracing", "%v", err)
+		}
+	}
+
+	if c.Client.Server != "" {
+		if u, err := url.Parse(c.Client.Server); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			p.add("client.server", "must be an http or https URL, got %q", c.Client.Server)
+		}
+	}
+
+	checkCertificates(&p, "client.tls", c.Client.TLS.CertFile, c.Client.TLS.KeyFile, "ca_file", c.Client.TLS.CAFile)
+
+	return p
+}
+
+func (r *RedisConfig) validate(p *problems) {
+	if r.Host == "" {
+		p.add("redis.host", "must not be empty")
+	}
+
+	if r.Port < 1 || r.Port > 65535 {
+		p.add("redis.port", "must be between 1 and 65535, got %d", r.Port)
+	}
+
+	if r.DB < 0 {
+		p.add("redis.db", "must not be negative, got %d", r.DB)
+	}
+
+	if r.Password != "" && r.PasswordFile != "" {
+		p.add("redis.password_file", "can't be set with redis.password")
+	}
+
+	if r.Username != "" && r.UsernameFile != "" {
+		p.add("redis.username_file", "can't be set with redis.username")
+	}
+
+	secrets := map[string]string{"redis.password_file": r.PasswordFile, "redis.username_file": r.UsernameFile}
+
+	for _, key := range slices.Sorted(maps.Keys(secrets)) {
+		if secrets[key] == "" {
+			continue
+		}
+
+		if _, err := readSecret(secrets[key]); err != nil {
+			p.add(key, "%v", err)
+		}
+	}
+
+	if !r.UseTLS {
+		files := map[string]string{
+			"redis.tls.cert_file": r.TLS.CertFile,
+			"redis.tls.key_file":  r.TLS.KeyFile,
+			"redis.tls.ca_file":   r.TLS.CAFile,
+		}
+
+		for _, key := range slices.Sorted(maps.Keys(files)) {
+			if files[key] != "" {
+				p.add(key, "is ignored unless redis.use_tls is true")
+			}
+		}
+
+		return
+	}
+
+	checkCertificates(p, "redis.tls", r.TLS.CertFile, r.TLS.KeyFile, "ca_file", r.TLS.CAFile)
+}
+
+// checkCertificates checks that the certificate and key are set together, that the files can be read and
+// that they hold a key pair and PEM certificates
+func checkCertificates(p *problems, prefix string, certFile string, keyFile string, caKey string, caFile string) {
+	certKey, keyKey, caKey := prefix+".cert_file", prefix+".key_file", prefix+"."+caKey
+
+	if certFile != "" && keyFile == "" {
+		p.add(keyKey, "is required with %s", certKey)
+	}
+
+	if keyFile != "" && certFile == "" {
+		p.add(certKey, "is required with %s", keyKey)
+	}
+
+	files := map[string]string{certKey: certFile, keyKey: keyFile, caKey: caFile}
+
+	// contents are the files that could be read, their contents are checked next
+	contents := map[string][]byte{}
+
+	for _, key := range slices.Sorted(maps.Keys(files)) {
+		if files[key] == "" {
+			continue
+		}
+
+		data, err := os.ReadFile(files[key])
+		if err != nil {
+			p.add(key, "unable to read %s: %v", files[key], err)
+			continue
+		}
+
+		contents[key] = data
+	}
+
+	cert, certOk := contents[certKey]
+	key, keyOk := contents[keyKey]
+
+	if certOk && keyOk {
+		if _, err := tls.X509KeyPair(cert, key); err != nil {
+			p.add(certKey, "invalid certificate or key: %v", err)
+		}
+	}
+
+	if ca, ok := contents[caKey]; ok && !x509.NewCertPool().AppendCertsFromPEM(ca) {
+		p.add(caKey, "%s holds no PEM certificate", caFile)
+	}
+}
+
+func (t *APITLSConfig) validate(p *problems) {
+	auth, err := api.ParseClientAuth(t.ClientAuth, t.ClientCAFile != "")
+	if err != nil {
+		p.add("api.tls.client_auth", "%v", err)
+	}
+
+	if !t.Enabled() {
+		set := map[string]bool{
+			"api.tls.client_ca_file": t.ClientCAFile != "",
+			"api.tls.client_auth":    t.ClientAuth != "",
+			"api.tls.principals":     len(t.Principals) > 0,
+		}
+
+		for _, key := range slices.Sorted(maps.Keys(set)) {
+			if set[key] {
+				p.add(key, "is ignored unless api.tls.cert_file is set")
+			}
+		}
+
+		return
+	}
+
+	checkCertificates(p, "api.tls", t.CertFile, t.KeyFile, "client_ca_file", t.ClientCAFile)
+
+	if t.ClientCAFile == "" && api.VerifiesClientCerts(auth) {
+		p.add("api.tls.client_ca_file", "is required to verify client certificates")
+	}
+
+	if len(t.Principals) == 0 {
+		return
+	}
+
+	if err == nil && !api.VerifiesClientCerts(auth) {
+		p.add("api.tls.principals", "need verified client certificates, api.tls.client_auth must be verify_if_given or require_and_verify")
+	}
+
+	names := map[string]bool{}
+
+	for _, principal := range t.Principals {
+		if err := principal.Validate(); err != nil {
+			p.add("api.tls.principals", "%v", err)
+		}
+
+		if names[principal.Name] {
+			p.add("api.tls.principals", "principal %s is defined twice", principal.Name)
+		}
+
+		names[principal.Name] = true
+	}
+}
+
+func (h *HistoryConfig) validate(p *problems) {
+	durations := map[string]time.Duration{
+		"history.interval":        h.Interval,
+		"history.retention":       h.Retention,
+		"history.raw_retention":   h.RawRetention,
+		"history.downsample_step": h.DownsampleStep,
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(durations)) {
+		if durations[key] < 0 {
+			p.add(key, "must not be negative")
+		}
+	}
+
+	if h.RawRetention > 0 && h.Retention > 0 && h.RawRetention > h.Retention {
+		p.add("history.raw_retention", "%s is longer than history.retention %s", h.RawRetention, h.Retention)
+	}
+
+	switch h.Store {
+	case "", "file":
+		if h.Path == "" {
+			p.add("history.path", "is required by the file store")
+		} else if info, err := os.Stat(h.Path); err == nil && !info.IsDir() {
+			p.add("history.path", "%s is not a directory", h.Path)
+		}
+	case "redis":
+	default:
+		p.add("history.store", "must be file or redis, got %q", h.Store)
+	}
+}
+
+// unknownKeys reports the keys set in the config file that no setting reads, which are usually typos
+func unknownKeys(p *problems) {
+	keys := viper.AllKeys()
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		if viper.InConfig(key) && !knownKey(reflect.TypeOf(Config{}), strings.Split(key, ".")) {
+			p.add(key, "unknown setting")
+		}
+	}
+}
+
+// knownKey tells whether path leads to a field of t, maps and lists hold any key
+func knownKey(t reflect.Type, path []string) bool {
+	if t.Kind() != reflect.Struct {
+		return t.Kind() == reflect.Map || t.Kind() == reflect.Slice
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		if field.Tag.Get("mapstructure") != path[0] {
+			continue
+		}
+
+		return len(path) == 1 || knownKey(field.Type, path[1:])
+	}
+
+	return false
+}
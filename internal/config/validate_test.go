@@ -0,0 +1,52 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/wolzey/taskboard/internal/api"
+)
+
+// TestPrincipalsNeedVerifiedCertificates rejects principals with client authentication modes that don't
+// verify certificates, every request would be refused
+func TestPrincipalsNeedVerifiedCertificates(t *testing.T) {
+	cases := []struct {
+		clientAuth string
+		caFile     string
+		valid      bool
+	}{
+		{"", "ca.pem", true},
+		{"verify_if_given", "ca.pem", true},
+		{"require_and_verify", "ca.pem", true},
+		{"", "", false},
+		{"none", "ca.pem", false},
+		{"request", "ca.pem", false},
+		{"require", "ca.pem", false},
+	}
+
+	for _, c := range cases {
+		cfg := APITLSConfig{
+			CertFile:     "cert.pem",
+			KeyFile:      "key.pem",
+			ClientCAFile: c.caFile,
+			ClientAuth:   c.clientAuth,
+			Principals:   []api.Principal{{Name: "ops", Subjects: []string{"ops.example.org"}}},
+		}
+
+		var p problems
+		cfg.validate(&p)
+
+		rejected := false
+
+		for _, problem := range p {
+			rejected = rejected || problem.Key == "api.tls.principals"
+		}
+
+		if rejected == c.valid {
+			t.Errorf("client_auth %q with client CA %q: got principals rejected %v, want %v", c.clientAuth, c.caFile, rejected, !c.valid)
+		}
+
+		if _, err := cfg.ToTLSOptions(); (err != nil) == c.valid {
+			t.Errorf("client_auth %q with client CA %q: got TLS options error %v", c.clientAuth, c.caFile, err)
+		}
+	}
+}
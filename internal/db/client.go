@@ -15,6 +15,7 @@ type Redis struct {
 
 func NewClient(opts *redis.Options) (*Redis, error) {
 	client := redis.NewClient(opts)
+	client.AddHook(latency{})
 
 	ctx := context.Background()
 	
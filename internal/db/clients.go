@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+	"strings"
+)
+
+// ClientConn is a connection as reported by CLIENT LIST
+type ClientConn struct {
+	ID   int64
+	Addr string
+	Name string
+	// Age and Idle are in seconds
+	Age  int64
+	Idle int64
+}
+
+// Clients returns the connections currently open on the Redis server
+func (r *Redis) Clients(ctx context.Context) ([]ClientConn, error) {
+	list, err := r.Client.ClientList(ctx).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return parseClientList(list), nil
+}
+
+// WorkerOf reports whether a connection is one of the BullMQ workers of a queue, along with the name
+// given to the worker if any. Workers name their connections <prefix>:<base64 queue name>, followed
+// by :w:<worker name> when started with a name.
+func (c ClientConn) WorkerOf(prefix string, queue string) (string, bool) {
+	name := prefix + ":" + base64.StdEncoding.EncodeToString([]byte(queue))
+
+	if c.Name == name {
+		return "", true
+	}
+
+	return strings.CutPrefix(c.Name, name+":w:")
+}
+
+// parseClientList parses the `key=value key=value` lines returned by CLIENT LIST
+func parseClientList(list string) []ClientConn {
+	var clients []ClientConn
+
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+
+		if line == "" {
+			continue
+		}
+
+		var conn ClientConn
+
+		for _, field := range strings.Fields(line) {
+			key, value, ok := strings.Cut(field, "=")
+
+			if !ok {
+				continue
+			}
+
+			switch key {
+			case "id":
+				conn.ID, _ = strconv.ParseInt(value, 10, 64)
+			case "addr":
+				conn.Addr = value
+			case "name":
+				conn.Name = value
+			case "age":
+				conn.Age, _ = strconv.ParseInt(value, 10, 64)
+			case "idle":
+				conn.Idle, _ = strconv.ParseInt(value, 10, 64)
+			}
+		}
+
+		clients = append(clients, conn)
+	}
+
+	return clients
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/wolzey/taskboard/internal/logging"
+	"github.com/wolzey/taskboard/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// latency adds the time spent on each command to the request of its context and logs commands at debug level,
+// pipelines are traced
+type latency struct{}
+
+func (latency) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (latency) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		took := time.Since(start)
+
+		if r := logging.RequestOf(ctx); r != nil {
+			r.AddRedis(took)
+		}
+
+		logCommand(ctx, "redis: command", err, "command", cmd.Name(), "took", took)
+
+		return err
+	}
+}
+
+func (latency) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		ctx, span := tracing.StartChild(ctx, "redis pipeline", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+			semconv.DBSystemNameRedis,
+			semconv.DBOperationBatchSize(len(cmds)),
+			attribute.StringSlice("taskboard.commands", commandNames(cmds)),
+		))
+		defer span.End()
+
+		start := time.Now()
+		err := next(ctx, cmds)
+		took := time.Since(start)
+
+		if err != nil && err != redis.Nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+
+		if r := logging.RequestOf(ctx); r != nil {
+			r.AddRedis(took)
+		}
+
+		logCommand(ctx, "redis: pipeline", err, "commands", len(cmds), "took", took)
+
+		return err
+	}
+}
+
+// commandNames are the distinct commands of a pipeline, in order
+func commandNames(cmds []redis.Cmder) []string {
+	var names []string
+
+	for _, cmd := range cmds {
+		if !slices.Contains(names, cmd.Name()) {
+			names = append(names, cmd.Name())
+		}
+	}
+
+	return names
+}
+
+// logCommand logs a command at debug level with its error, missing keys are not errors
+func logCommand(ctx context.Context, msg string, err error, args ...any) {
+	if !slog.Default().Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
+	if err != nil && err != redis.Nil {
+		args = append(args, "error", err)
+	}
+
+	slog.DebugContext(ctx, msg, args...)
+}
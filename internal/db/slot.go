@@ -0,0 +1,37 @@
+package db
+
+import "strings"
+
+// SlotCount is the number of hash slots of a Redis Cluster
+const SlotCount = 16384
+
+// HashSlot returns the cluster hash slot of a key. Like Redis, only the part between the first {
+// and the following } is hashed when it isn't empty, so queues with a hash tag share a slot.
+func HashSlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+
+	return int(crc16(key) % SlotCount)
+}
+
+// crc16 is the CRC16-CCITT (XMODEM) checksum used by Redis Cluster
+func crc16(s string) uint16 {
+	var crc uint16
+
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
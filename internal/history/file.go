@@ -0,0 +1,159 @@
+package history
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileStore keeps the samples of each queue in an NDJSON file of a directory, appended to as
+// samples are taken and rewritten when compacted
+type FileStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("no directory for the history files")
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create the history directory: %w", err)
+	}
+
+	return &FileStore{dir: dir}, nil
+}
+
+// path escapes the queue name, which may hold any character
+func (f *FileStore) path(queue string) string {
+	return filepath.Join(f.dir, url.PathEscape(queue)+".ndjson")
+}
+
+func (f *FileStore) Add(ctx context.Context, queue string, sample Sample) error {
+	line, err := json.Marshal(sample)
+
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.path(queue), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func (f *FileStore) Range(ctx context.Context, queue string, from int64, to int64) ([]Sample, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	samples, err := f.read(queue)
+
+	if err != nil {
+		return nil, err
+	}
+
+	inRange := []Sample{}
+
+	for _, sample := range samples {
+		if sample.Time >= from && sample.Time <= to {
+			inRange = append(inRange, sample)
+		}
+	}
+
+	return inRange, nil
+}
+
+func (f *FileStore) Compact(ctx context.Context, queue string, policy Policy) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	samples, err := f.read(queue)
+
+	if err != nil {
+		return err
+	}
+
+	return f.write(queue, policy.compact(samples))
+}
+
+func (f *FileStore) Close() error {
+	return nil
+}
+
+// read returns the samples of a queue in the order they were added, lines cut short by a crash are skipped
+func (f *FileStore) read(queue string) ([]Sample, error) {
+	file, err := os.Open(f.path(queue))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var samples []Sample
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		var sample Sample
+
+		if json.Unmarshal(scanner.Bytes(), &sample) == nil {
+			samples = append(samples, sample)
+		}
+	}
+
+	return samples, scanner.Err()
+}
+
+// write replaces the samples of a queue, through a temporary file so a crash doesn't lose them
+func (f *FileStore) write(queue string, samples []Sample) error {
+	tmp, err := os.CreateTemp(f.dir, ".compact-*")
+
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	buf := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(buf)
+
+	for _, sample := range samples {
+		if err := enc.Encode(sample); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+
+	if err := buf.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), f.path(queue))
+}
@@ -0,0 +1,302 @@
+// Package history records the job counts and throughput of every queue at a regular interval, so
+// past queue depths can be charted. Samples are kept in a Store, raw for a while then downsampled
+// into coarser buckets, and dropped once older than the retention.
+//
+// Samples are taken by every taskboard serving with history enabled, a single instance should
+// sample into a shared store.
+package history
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/wolzey/taskboard/internal/db"
+	"github.com/wolzey/taskboard/internal/scripts"
+)
+
+// compactInterval is how often samples are downsampled and expired
+const compactInterval = time.Hour
+
+// States are the job states whose counts are sampled
+var States = []string{"active", "wait", "prioritized", "paused", "delayed", "waiting-children", "completed", "failed"}
+
+// Sample holds the job counts of a queue at a point in time, and the number of jobs that completed
+// and failed since the previous sample. Downsampled samples hold the highest counts of their bucket,
+// so peaks stay visible, and the total throughput; Time is then the start of the bucket.
+type Sample struct {
+	// Time is in unix milliseconds
+	Time      int64            `json:"time"`
+	Counts    map[string]int64 `json:"counts"`
+	Completed int64            `json:"completed"`
+	Failed    int64            `json:"failed"`
+}
+
+// Store persists samples per queue
+type Store interface {
+	Add(ctx context.Context, queue string, sample Sample) error
+	// Range returns the samples with from <= time <= to, oldest first
+	Range(ctx context.Context, queue string, from int64, to int64) ([]Sample, error)
+	// Compact drops the samples older than the retention and downsamples those older than the raw retention
+	Compact(ctx context.Context, queue string, policy Policy) error
+	Close() error
+}
+
+// Policy tells how long samples are kept
+type Policy struct {
+	// Now is the time retentions are counted from
+	Now time.Time
+	// Retention is how long samples are kept at all
+	Retention time.Duration
+	// RawRetention is how long samples are kept as taken, they are downsampled to DownsampleStep after
+	RawRetention   time.Duration
+	DownsampleStep time.Duration
+}
+
+// cutoffs returns the times before which samples are dropped and downsampled. The latter is
+// aligned on a step so buckets are only downsampled once complete.
+func (p Policy) cutoffs() (int64, int64) {
+	step := p.DownsampleStep.Milliseconds()
+	raw := p.Now.Add(-p.RawRetention).UnixMilli()
+
+	return p.Now.Add(-p.Retention).UnixMilli(), raw - raw%step
+}
+
+// compact applies the policy to samples sorted by time
+func (p Policy) compact(samples []Sample) []Sample {
+	expired, raw := p.cutoffs()
+
+	start := 0
+	for start < len(samples) && samples[start].Time < expired {
+		start++
+	}
+
+	end := start
+	for end < len(samples) && samples[end].Time < raw {
+		end++
+	}
+
+	return slices.Concat(Downsample(samples[start:end], p.DownsampleStep), samples[end:])
+}
+
+// Downsample aggregates samples sorted by time into buckets of step: counts are the highest of the
+// bucket and throughput the total. Downsampling already downsampled samples gives the same buckets.
+func Downsample(samples []Sample, step time.Duration) []Sample {
+	size := step.Milliseconds()
+
+	if size <= 0 {
+		return samples
+	}
+
+	var buckets []Sample
+
+	for _, sample := range samples {
+		start := sample.Time - sample.Time%size
+
+		if len(buckets) == 0 || buckets[len(buckets)-1].Time != start {
+			buckets = append(buckets, Sample{Time: start, Counts: map[string]int64{}})
+		}
+
+		bucket := &buckets[len(buckets)-1]
+		bucket.Completed += sample.Completed
+		bucket.Failed += sample.Failed
+
+		for state, count := range sample.Counts {
+			bucket.Counts[state] = max(bucket.Counts[state], count)
+		}
+	}
+
+	return buckets
+}
+
+type Options struct {
+	// Interval is how often samples are taken
+	Interval time.Duration
+	// Store is file or redis, Path is the directory of the file store
+	Store string
+	Path  string
+	// Retention, RawRetention and DownsampleStep are those of the Policy
+	Retention      time.Duration
+	RawRetention   time.Duration
+	DownsampleStep time.Duration
+}
+
+// Sampler takes samples of every queue and reads them back
+type Sampler struct {
+	redis  *db.Redis
+	prefix string
+	store  Store
+	opts   Options
+
+	mu sync.Mutex
+	// sampled is when each queue was last sampled, throughput is counted since
+	sampled map[string]int64
+}
+
+func New(client *db.Redis, queuePrefix string, opts Options) (*Sampler, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Minute
+	}
+
+	if opts.Retention <= 0 {
+		opts.Retention = 30 * 24 * time.Hour
+	}
+
+	if opts.RawRetention <= 0 {
+		opts.RawRetention = 24 * time.Hour
+	}
+
+	if opts.DownsampleStep <= 0 {
+		opts.DownsampleStep = 15 * time.Minute
+	}
+
+	if opts.RawRetention > opts.Retention {
+		return nil, fmt.Errorf("raw retention %s is longer than the retention %s", opts.RawRetention, opts.Retention)
+	}
+
+	var store Store
+	var err error
+
+	switch opts.Store {
+	case "", "file":
+		store, err = NewFileStore(opts.Path)
+	case "redis":
+		store = NewRedisStore(client.Client, queuePrefix)
+	default:
+		return nil, fmt.Errorf("unknown history store %q: must be file or redis", opts.Store)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Sampler{redis: client, prefix: queuePrefix, store: store, opts: opts, sampled: map[string]int64{}}, nil
+}
+
+// Run samples every queue at each interval and compacts the store until ctx is done
+func (s *Sampler) Run(ctx context.Context) {
+	defer s.store.Close()
+
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+
+	var compacted time.Time
+
+	for {
+		if err := s.sample(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "history: unable to sample queues", "error", err)
+		}
+
+		if time.Since(compacted) >= compactInterval {
+			if err := s.compact(ctx); err != nil && ctx.Err() == nil {
+				slog.ErrorContext(ctx, "history: unable to compact samples", "error", err)
+			}
+			compacted = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sample takes a sample of every queue
+func (s *Sampler) sample(ctx context.Context) error {
+	queues, err := s.redis.Scripts.GetQueues(ctx, s.prefix+":")
+
+	if err != nil {
+		return err
+	}
+
+	for _, queue := range queues {
+		if err := s.sampleQueue(ctx, queue, time.Now().UnixMilli()); err != nil {
+			slog.ErrorContext(ctx, "history: unable to sample queue", "queue", queue, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// sampleQueue records the counts of a queue and the jobs finished since it was last sampled, which
+// are counted from the completed and failed sets scored by finish time. Jobs removed on completion
+// aren't counted.
+func (s *Sampler) sampleQueue(ctx context.Context, queue string, now int64) error {
+	q := scripts.Queue{Prefix: s.prefix, Name: queue}
+	counts, err := s.redis.Scripts.GetJobCounts(ctx, q, States)
+
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	since, ok := s.sampled[queue]
+	s.sampled[queue] = now
+	s.mu.Unlock()
+
+	if !ok {
+		since = now - s.opts.Interval.Milliseconds()
+	}
+
+	min, max := fmt.Sprintf("(%d", since), fmt.Sprint(now)
+	pipe := s.redis.Pipeline()
+	completed := pipe.ZCount(ctx, q.Key("completed"), min, max)
+	failed := pipe.ZCount(ctx, q.Key("failed"), min, max)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	sample := Sample{Time: now, Counts: make(map[string]int64, len(States)), Completed: completed.Val(), Failed: failed.Val()}
+
+	for i, state := range States {
+		sample.Counts[state] = counts[i]
+	}
+
+	return s.store.Add(ctx, queue, sample)
+}
+
+// compact applies the retention policy to the samples of every queue sampled since the start
+func (s *Sampler) compact(ctx context.Context) error {
+	s.mu.Lock()
+	queues := make([]string, 0, len(s.sampled))
+	for queue := range s.sampled {
+		queues = append(queues, queue)
+	}
+	s.mu.Unlock()
+
+	policy := Policy{
+		Now:            time.Now(),
+		Retention:      s.opts.Retention,
+		RawRetention:   s.opts.RawRetention,
+		DownsampleStep: s.opts.DownsampleStep,
+	}
+
+	for _, queue := range queues {
+		if err := s.store.Compact(ctx, queue, policy); err != nil {
+			return fmt.Errorf("%s: %w", queue, err)
+		}
+	}
+
+	return nil
+}
+
+// History returns the samples of a queue between from and to, in unix milliseconds, downsampled
+// to step unless it is 0
+func (s *Sampler) History(ctx context.Context, queue string, from int64, to int64, step time.Duration) ([]Sample, error) {
+	samples, err := s.store.Range(ctx, queue, from, to)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if step > 0 {
+		samples = Downsample(samples, step)
+	}
+
+	return samples, nil
+}
@@ -0,0 +1,72 @@
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/wolzey/taskboard/internal/db"
+)
+
+func TestSampleQueue(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client, err := db.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	ctx := t.Context()
+	now := time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC).UnixMilli()
+
+	// Older BullMQ versions keep a 0: marker at the end of the wait and paused lists
+	client.LPush(ctx, "bull:payments:wait", "0:1700000000000", "1", "2")
+	client.LPush(ctx, "bull:payments:paused", "0:1700000000000")
+	client.LPush(ctx, "bull:payments:active", "3")
+	client.ZAdd(ctx, "bull:payments:delayed", redis.Z{Score: 1, Member: "4"})
+	client.ZAdd(ctx, "bull:payments:completed", redis.Z{Score: float64(now - 1000), Member: "5"}, redis.Z{Score: float64(now - time.Hour.Milliseconds()), Member: "6"})
+	client.ZAdd(ctx, "bull:payments:failed", redis.Z{Score: float64(now - 1000), Member: "7"})
+
+	s, err := New(client, "bull", Options{Store: "file", Path: t.TempDir()})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.store.Close()
+
+	if err := s.sampleQueue(ctx, "payments", now); err != nil {
+		t.Fatal(err)
+	}
+
+	samples, err := s.store.Range(ctx, "payments", now, now)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(samples) != 1 {
+		t.Fatalf("got %d samples, want 1", len(samples))
+	}
+
+	want := map[string]int64{"active": 1, "wait": 2, "prioritized": 0, "paused": 0, "delayed": 1, "waiting-children": 0, "completed": 2, "failed": 1}
+
+	for state, count := range want {
+		if got := samples[0].Counts[state]; got != count {
+			t.Errorf("got %d %s jobs, want %d", got, state, count)
+		}
+	}
+
+	// Only the jobs finished within the interval before the first sample are counted
+	if samples[0].Completed != 1 || samples[0].Failed != 1 {
+		t.Errorf("got %d completed and %d failed, want 1 and 1", samples[0].Completed, samples[0].Failed)
+	}
+
+	// Counting leaves the markers to BullMQ
+	for _, key := range []string{"bull:payments:wait", "bull:payments:paused"} {
+		if last, _ := client.LIndex(ctx, key, -1).Result(); last != "0:1700000000000" {
+			t.Errorf("got %q at the end of %s, want the marker", last, key)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const redisKeyPrefix = "taskboard:history:"
+
+// RedisStore keeps the samples of each queue in a sorted set scored by time, the way Redis TimeSeries
+// stores points:
+//
+//	taskboard:history:<queue key>   JSON encoded samples
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisStore(client *redis.Client, queuePrefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: queuePrefix}
+}
+
+func (r *RedisStore) key(queue string) string {
+	return redisKeyPrefix + r.prefix + ":" + queue
+}
+
+// Samples hold their time, members are unique as long as a queue is sampled once per millisecond
+func (r *RedisStore) Add(ctx context.Context, queue string, sample Sample) error {
+	member, err := json.Marshal(sample)
+
+	if err != nil {
+		return err
+	}
+
+	return r.client.ZAdd(ctx, r.key(queue), redis.Z{Score: float64(sample.Time), Member: member}).Err()
+}
+
+func (r *RedisStore) Range(ctx context.Context, queue string, from int64, to int64) ([]Sample, error) {
+	return r.rangeByScore(ctx, queue, fmt.Sprint(from), fmt.Sprint(to))
+}
+
+func (r *RedisStore) rangeByScore(ctx context.Context, queue string, min string, max string) ([]Sample, error) {
+	members, err := r.client.ZRangeByScore(ctx, r.key(queue), &redis.ZRangeBy{Min: min, Max: max}).Result()
+
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]Sample, 0, len(members))
+
+	for _, member := range members {
+		var sample Sample
+
+		if json.Unmarshal([]byte(member), &sample) == nil {
+			samples = append(samples, sample)
+		}
+	}
+
+	return samples, nil
+}
+
+// Compact replaces the samples older than the raw retention in a transaction, samples taken
+// meanwhile are newer so they aren't affected
+func (r *RedisStore) Compact(ctx context.Context, queue string, policy Policy) error {
+	_, raw := policy.cutoffs()
+	old, err := r.rangeByScore(ctx, queue, "-inf", fmt.Sprintf("(%d", raw))
+
+	if err != nil {
+		return err
+	}
+
+	compacted := policy.compact(old)
+	pipe := r.client.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, r.key(queue), "-inf", fmt.Sprintf("(%d", raw))
+
+	for _, sample := range compacted {
+		member, err := json.Marshal(sample)
+
+		if err != nil {
+			return err
+		}
+
+		pipe.ZAdd(ctx, r.key(queue), redis.Z{Score: float64(sample.Time), Member: member})
+	}
+
+	_, err = pipe.Exec(ctx)
+
+	return err
+}
+
+func (r *RedisStore) Close() error {
+	return nil
+}
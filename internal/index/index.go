@@ -0,0 +1,720 @@
+// Package index maintains secondary indexes of BullMQ jobs so searches on indexed fields don't scan every job.
+//
+// The indexer tails the events stream of each queue and keeps, per queue and indexed value, a set of job ids:
+//
+//	taskboard:index:<queue key>:f:<field>:<value>   ids of the jobs having value for field
+//	taskboard:index:<queue key>:j:<job id>          index keys the job was added to, used to update or remove it
+//	taskboard:index:<queue key>:cursor              id of the last event processed
+//	taskboard:index:<queue key>:ready               set once existing jobs were indexed, holds the indexed fields
+//
+// Jobs trimmed by BullMQ without a removed event stay in the index until a search finds them missing. When
+// BullMQ trims events before they are processed, the queue is indexed again and searched by scanning meanwhile.
+package index
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/wolzey/taskboard/internal/db"
+)
+
+const (
+	keyPrefix = "taskboard:index:"
+	// maxValueLength bounds indexed values, longer ones are only found by scanning
+	maxValueLength = 256
+	backfillBatch  = 500
+	eventsBatch    = 500
+)
+
+// backfillStates are the structures holding job ids, existing jobs are indexed from them
+var backfillStates = []string{"active", "wait", "prioritized", "paused", "waiting-children", "delayed", "failed", "completed"}
+
+// jsonFields hold JSON and are indexed by path, e.g. data.user.id
+var jsonFields = []string{"data", "opts", "returnvalue"}
+
+// errorClassPattern must stay in sync with getErrorClass in the evaluateQuery script include
+var errorClassPattern = regexp.MustCompile(`^([A-Za-z_$][A-Za-z0-9_$.]*):`)
+
+type Options struct {
+	// Fields are query field names: name, errorClass or a path into data, opts or returnvalue
+	Fields []string
+	// DiscoverInterval is how often new queues are looked for
+	DiscoverInterval time.Duration
+	// Block is how long reading the events streams waits for new events
+	Block time.Duration
+}
+
+type field struct {
+	name string
+	// key is the job hash field the value is read from, path is set for JSON fields
+	key  string
+	path []string
+}
+
+// Term is an equality condition on an indexed field
+type Term struct {
+	Field string
+	Value string
+}
+
+type Indexer struct {
+	redis  *db.Redis
+	prefix string
+	fields []field
+	opts   Options
+	// signature identifies the indexed fields, indexes built for other fields are rebuilt
+	signature string
+
+	mu sync.Mutex
+	// cursors holds the last event id processed for each queue key being tailed
+	cursors map[string]string
+	// generations counts the backfills started for each queue key, only the latest one marks it ready
+	generations map[string]int
+}
+
+func New(client *db.Redis, queuePrefix string, opts Options) (*Indexer, error) {
+	if len(opts.Fields) == 0 {
+		return nil, fmt.Errorf("no fields to index")
+	}
+
+	if opts.DiscoverInterval <= 0 {
+		opts.DiscoverInterval = 30 * time.Second
+	}
+
+	if opts.Block <= 0 {
+		opts.Block = 5 * time.Second
+	}
+
+	ix := &Indexer{redis: client, prefix: queuePrefix, opts: opts, cursors: map[string]string{}, generations: map[string]int{}}
+
+	for _, name := range opts.Fields {
+		f, err := parseField(name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ix.fields = append(ix.fields, f)
+	}
+
+	names := slices.Clone(opts.Fields)
+	slices.Sort(names)
+	ix.signature = strings.Join(slices.Compact(names), ",")
+
+	return ix, nil
+}
+
+func parseField(name string) (field, error) {
+	switch name {
+	case "name":
+		return field{name: name, key: "name"}, nil
+	case "errorClass":
+		return field{name: name}, nil
+	}
+
+	key, path, _ := strings.Cut(name, ".")
+
+	if !slices.Contains(jsonFields, key) || path == "" {
+		return field{}, fmt.Errorf("can't index field %q: must be name, errorClass or a path into %s", name, strings.Join(jsonFields, ", "))
+	}
+
+	f := field{name: name, key: key, path: strings.Split(path, ".")}
+
+	if slices.Contains(f.path, "") {
+		return field{}, fmt.Errorf("can't index field %q: invalid path", name)
+	}
+
+	return f, nil
+}
+
+// Covers reports whether a query field, including its path, is indexed
+func (ix *Indexer) Covers(name string) bool {
+	return slices.ContainsFunc(ix.fields, func(f field) bool { return f.name == name })
+}
+
+// NormalizeValue returns the form values are indexed under, numbers are formatted the same way regardless of how they were written
+func NormalizeValue(value string) string {
+	if num, err := strconv.ParseFloat(value, 64); err == nil {
+		return strconv.FormatFloat(num, 'f', -1, 64)
+	}
+
+	return value
+}
+
+// ErrorClass derives the error class of a failed job, e.g. TypeError, from its latest stacktrace or failed reason
+func ErrorClass(failedReason string, stacktrace string) string {
+	line := failedReason
+
+	var stack []any
+	if json.Unmarshal([]byte(stacktrace), &stack) == nil && len(stack) > 0 {
+		if last, ok := stack[len(stack)-1].(string); ok {
+			line = last
+		}
+	}
+
+	if line == "" {
+		return ""
+	}
+
+	if match := errorClassPattern.FindStringSubmatch(line); match != nil {
+		return match[1]
+	}
+
+	return "Error"
+}
+
+func indexKey(queueKey string, field string, value string) string {
+	return keyPrefix + queueKey + ":f:" + field + ":" + value
+}
+
+func jobKey(queueKey string, jobId string) string {
+	return keyPrefix + queueKey + ":j:" + jobId
+}
+
+func cursorKey(queueKey string) string {
+	return keyPrefix + queueKey + ":cursor"
+}
+
+func readyKey(queueKey string) string {
+	return keyPrefix + queueKey + ":ready"
+}
+
+// hashFields lists the job hash fields the indexed fields are read from
+func (ix *Indexer) hashFields() []string {
+	var keys []string
+
+	for _, f := range ix.fields {
+		switch {
+		case f.name == "errorClass":
+			keys = append(keys, "failedReason", "stacktrace")
+		default:
+			keys = append(keys, f.key)
+		}
+	}
+
+	slices.Sort(keys)
+
+	return slices.Compact(keys)
+}
+
+// indexKeys returns the index keys a job belongs to given its hash fields
+func (ix *Indexer) indexKeys(queueKey string, hash map[string]string) []string {
+	var keys []string
+	decoded := map[string]any{}
+
+	for _, f := range ix.fields {
+		var value string
+
+		switch {
+		case f.name == "errorClass":
+			value = ErrorClass(hash["failedReason"], hash["stacktrace"])
+		case f.path == nil:
+			value = hash[f.key]
+		default:
+			doc, ok := decoded[f.key]
+
+			if !ok {
+				if json.Unmarshal([]byte(hash[f.key]), &doc) != nil {
+					doc = nil
+				}
+				decoded[f.key] = doc
+			}
+
+			value = scalarAt(doc, f.path)
+		}
+
+		if value == "" || len(value) > maxValueLength {
+			continue
+		}
+
+		keys = append(keys, indexKey(queueKey, f.name, NormalizeValue(value)))
+	}
+
+	return keys
+}
+
+// scalarAt returns the string form of the scalar at path, objects, arrays and null aren't indexed
+func scalarAt(doc any, path []string) string {
+	value := doc
+
+	for _, segment := range path {
+		switch v := value.(type) {
+		case map[string]any:
+			value = v[segment]
+		case []any:
+			// Array elements are addressed with 0-based indexes like in queries
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(v) {
+				return ""
+			}
+			value = v[i]
+		default:
+			return ""
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+
+	return ""
+}
+
+// IndexJobs reads the jobs and updates the indexes they belong to, jobs that no longer exist are removed
+func (ix *Indexer) IndexJobs(ctx context.Context, queueKey string, jobIds []string) error {
+	if len(jobIds) == 0 {
+		return nil
+	}
+
+	hashFields := ix.hashFields()
+	pipe := ix.redis.Client.Pipeline()
+
+	exists := make([]*redis.IntCmd, len(jobIds))
+	values := make([]*redis.SliceCmd, len(jobIds))
+	current := make([]*redis.StringSliceCmd, len(jobIds))
+
+	for i, id := range jobIds {
+		exists[i] = pipe.Exists(ctx, queueKey+":"+id)
+		values[i] = pipe.HMGet(ctx, queueKey+":"+id, hashFields...)
+		current[i] = pipe.SMembers(ctx, jobKey(queueKey, id))
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to read jobs: %w", err)
+	}
+
+	pipe = ix.redis.Client.Pipeline()
+
+	for i, id := range jobIds {
+		var keys []string
+
+		if exists[i].Val() == 1 {
+			hash := map[string]string{}
+
+			for j, value := range values[i].Val() {
+				if s, ok := value.(string); ok {
+					hash[hashFields[j]] = s
+				}
+			}
+
+			keys = ix.indexKeys(queueKey, hash)
+		}
+
+		ix.diff(ctx, pipe, queueKey, id, current[i].Val(), keys)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to update indexes: %w", err)
+	}
+
+	return nil
+}
+
+// Remove drops jobs from every index they belong to
+func (ix *Indexer) Remove(ctx context.Context, queueKey string, jobIds []string) error {
+	if len(jobIds) == 0 {
+		return nil
+	}
+
+	pipe := ix.redis.Client.Pipeline()
+	current := make([]*redis.StringSliceCmd, len(jobIds))
+
+	for i, id := range jobIds {
+		current[i] = pipe.SMembers(ctx, jobKey(queueKey, id))
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to read indexed jobs: %w", err)
+	}
+
+	pipe = ix.redis.Client.Pipeline()
+
+	for i, id := range jobIds {
+		ix.diff(ctx, pipe, queueKey, id, current[i].Val(), nil)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to update indexes: %w", err)
+	}
+
+	return nil
+}
+
+// diff queues the commands moving a job from the index keys it is in to the wanted ones
+func (ix *Indexer) diff(ctx context.Context, pipe redis.Pipeliner, queueKey string, jobId string, current []string, wanted []string) {
+	for _, key := range current {
+		if !slices.Contains(wanted, key) {
+			pipe.SRem(ctx, key, jobId)
+		}
+	}
+
+	for _, key := range wanted {
+		if !slices.Contains(current, key) {
+			pipe.SAdd(ctx, key, jobId)
+		}
+	}
+
+	pipe.Del(ctx, jobKey(queueKey, jobId))
+
+	if len(wanted) > 0 {
+		pipe.SAdd(ctx, jobKey(queueKey, jobId), wanted)
+	}
+}
+
+// Lookup returns the ids of the jobs matching every term, sorted newest first. ok is false when
+// the indexes of the queue can't be used yet, e.g. while existing jobs are still being indexed.
+func (ix *Indexer) Lookup(ctx context.Context, queueKey string, terms []Term) (ids []string, ok bool, err error) {
+	ready, err := ix.redis.Client.Get(ctx, readyKey(queueKey)).Result()
+
+	if errors.Is(err, redis.Nil) || (err == nil && ready != ix.signature) {
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	keys := make([]string, len(terms))
+
+	for i, term := range terms {
+		value := NormalizeValue(term.Value)
+
+		if !ix.Covers(term.Field) || value == "" || len(value) > maxValueLength {
+			return nil, false, nil
+		}
+
+		keys[i] = indexKey(queueKey, term.Field, value)
+	}
+
+	ids, err = ix.redis.Client.SInter(ctx, keys...).Result()
+
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read indexes: %w", err)
+	}
+
+	sortJobIds(ids)
+
+	return ids, true, nil
+}
+
+// sortJobIds orders ids newest first: numeric ids descending, followed by custom ids in reverse lexical order
+func sortJobIds(ids []string) {
+	slices.SortFunc(ids, func(a string, b string) int {
+		na, errA := strconv.ParseInt(a, 10, 64)
+		nb, errB := strconv.ParseInt(b, 10, 64)
+
+		switch {
+		case errA == nil && errB == nil:
+			return cmp.Compare(nb, na)
+		case errA == nil:
+			return -1
+		case errB == nil:
+			return 1
+		}
+
+		return strings.Compare(b, a)
+	})
+}
+
+// Run indexes the jobs of every queue and keeps the indexes up to date until ctx is done
+func (ix *Indexer) Run(ctx context.Context) {
+	var discovered time.Time
+
+	for ctx.Err() == nil {
+		if time.Since(discovered) >= ix.opts.DiscoverInterval {
+			if err := ix.discover(ctx); err != nil {
+				slog.ErrorContext(ctx, "index: unable to discover queues", "error", err)
+			}
+			discovered = time.Now()
+		}
+
+		if err := ix.tail(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "index: unable to read events", "error", err)
+			sleep(ctx, time.Second)
+		}
+	}
+}
+
+// discover starts tailing queues that aren't yet, indexing their existing jobs when needed
+func (ix *Indexer) discover(ctx context.Context) error {
+	queues, err := ix.redis.Scripts.GetQueues(ctx, ix.prefix+":")
+
+	if err != nil {
+		return err
+	}
+
+	for _, queue := range queues {
+		queueKey := ix.prefix + ":" + queue
+
+		ix.mu.Lock()
+		_, tailing := ix.cursors[queueKey]
+		ix.mu.Unlock()
+
+		if tailing {
+			continue
+		}
+
+		cursor, err := ix.redis.Client.Get(ctx, cursorKey(queueKey)).Result()
+
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+
+		ready, err := ix.redis.Client.Get(ctx, readyKey(queueKey)).Result()
+
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+
+		if cursor == "" || ready != ix.signature {
+			if err := ix.reindex(ctx, queueKey); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		ix.mu.Lock()
+		ix.cursors[queueKey] = cursor
+		ix.mu.Unlock()
+	}
+
+	return nil
+}
+
+// reindex indexes the existing jobs of a queue again, searches scan the queue until it is done
+func (ix *Indexer) reindex(ctx context.Context, queueKey string) error {
+	if err := ix.redis.Client.Del(ctx, readyKey(queueKey)).Err(); err != nil {
+		return err
+	}
+
+	// Tailing starts from the latest event before existing jobs are indexed,
+	// jobs moving while they are read generate events that are processed afterwards
+	cursor, err := ix.latestEvent(ctx, queueKey)
+
+	if err != nil {
+		return err
+	}
+
+	if err := ix.redis.Client.Set(ctx, cursorKey(queueKey), cursor, 0).Err(); err != nil {
+		return err
+	}
+
+	ix.mu.Lock()
+	ix.cursors[queueKey] = cursor
+	ix.generations[queueKey]++
+	generation := ix.generations[queueKey]
+	ix.mu.Unlock()
+
+	go ix.backfill(ctx, queueKey, generation)
+
+	return nil
+}
+
+func (ix *Indexer) latestEvent(ctx context.Context, queueKey string) (string, error) {
+	events, err := ix.redis.Client.XRevRangeN(ctx, queueKey+":events", "+", "-", 1).Result()
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(events) == 0 {
+		return "0-0", nil
+	}
+
+	return events[0].ID, nil
+}
+
+// backfill indexes the jobs currently in the queue then marks its indexes ready, it stops when a newer
+// backfill of the queue was started
+func (ix *Indexer) backfill(ctx context.Context, queueKey string, generation int) {
+	for _, state := range backfillStates {
+		if !ix.isLatest(queueKey, generation) {
+			return
+		}
+
+		stateKey := queueKey + ":" + state
+
+		keyType, err := ix.redis.Client.Type(ctx, stateKey).Result()
+
+		if err != nil {
+			slog.ErrorContext(ctx, "index: unable to index", "key", stateKey, "error", err)
+			return
+		}
+
+		for start := int64(0); ; start += backfillBatch {
+			var ids []string
+
+			switch keyType {
+			case "zset":
+				ids, err = ix.redis.Client.ZRange(ctx, stateKey, start, start+backfillBatch-1).Result()
+			case "list":
+				ids, err = ix.redis.Client.LRange(ctx, stateKey, start, start+backfillBatch-1).Result()
+			}
+
+			if err == nil {
+				err = ix.IndexJobs(ctx, queueKey, ids)
+			}
+
+			if err != nil {
+				slog.ErrorContext(ctx, "index: unable to index", "key", stateKey, "error", err)
+				return
+			}
+
+			if len(ids) < backfillBatch {
+				break
+			}
+		}
+	}
+
+	if !ix.isLatest(queueKey, generation) {
+		return
+	}
+
+	if err := ix.redis.Client.Set(ctx, readyKey(queueKey), ix.signature, 0).Err(); err != nil {
+		slog.ErrorContext(ctx, "index: unable to mark queue ready", "key", queueKey, "error", err)
+	}
+}
+
+func (ix *Indexer) isLatest(queueKey string, generation int) bool {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	return ix.generations[queueKey] == generation
+}
+
+// tail reads the next events of every queue and updates the jobs they concern
+func (ix *Indexer) tail(ctx context.Context) error {
+	ix.mu.Lock()
+	queueKeys := make([]string, 0, len(ix.cursors))
+	for queueKey := range ix.cursors {
+		queueKeys = append(queueKeys, queueKey)
+	}
+	slices.Sort(queueKeys)
+
+	streams := make([]string, 0, 2*len(queueKeys))
+	cursors := make(map[string]string, len(queueKeys))
+	for _, queueKey := range queueKeys {
+		streams = append(streams, queueKey+":events")
+	}
+	for _, queueKey := range queueKeys {
+		streams = append(streams, ix.cursors[queueKey])
+		cursors[queueKey] = ix.cursors[queueKey]
+	}
+	ix.mu.Unlock()
+
+	if len(queueKeys) == 0 {
+		sleep(ctx, ix.opts.DiscoverInterval)
+		return nil
+	}
+
+	res, err := ix.redis.Client.XRead(ctx, &redis.XReadArgs{Streams: streams, Count: eventsBatch, Block: ix.opts.Block}).Result()
+
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, stream := range res {
+		if len(stream.Messages) == 0 {
+			continue
+		}
+
+		queueKey := strings.TrimSuffix(stream.Stream, ":events")
+
+		trimmed, err := ix.trimmedSince(ctx, queueKey, cursors[queueKey])
+
+		if err != nil {
+			return err
+		}
+
+		if trimmed {
+			slog.WarnContext(ctx, "index: events were trimmed before being processed, indexing the queue again", "key", queueKey)
+
+			if err := ix.reindex(ctx, queueKey); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := ix.handleEvents(ctx, queueKey, stream.Messages); err != nil {
+			return err
+		}
+
+		cursor := stream.Messages[len(stream.Messages)-1].ID
+
+		if err := ix.redis.Client.Set(ctx, cursorKey(queueKey), cursor, 0).Err(); err != nil {
+			return err
+		}
+
+		ix.mu.Lock()
+		ix.cursors[queueKey] = cursor
+		ix.mu.Unlock()
+	}
+
+	return nil
+}
+
+// trimmedSince tells if events following cursor may have been trimmed before being read, which is the case
+// when no event up to the cursor is left in the stream
+func (ix *Indexer) trimmedSince(ctx context.Context, queueKey string, cursor string) (bool, error) {
+	// The stream was empty when tailing started, there is no event to compare with
+	if cursor == "0-0" {
+		return false, nil
+	}
+
+	events, err := ix.redis.Client.XRangeN(ctx, queueKey+":events", "-", cursor, 1).Result()
+
+	if err != nil {
+		return false, err
+	}
+
+	return len(events) == 0, nil
+}
+
+func (ix *Indexer) handleEvents(ctx context.Context, queueKey string, events []redis.XMessage) error {
+	var jobIds []string
+
+	for _, event := range events {
+		jobId, _ := event.Values["jobId"].(string)
+
+		// progress and active are frequent and don't change indexed fields, removed jobs are
+		// dropped by IndexJobs since their hash is gone
+		if jobId == "" || event.Values["event"] == "progress" || event.Values["event"] == "active" {
+			continue
+		}
+
+		if !slices.Contains(jobIds, jobId) {
+			jobIds = append(jobIds, jobId)
+		}
+	}
+
+	return ix.IndexJobs(ctx, queueKey, jobIds)
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
@@ -0,0 +1,195 @@
+package index
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/wolzey/taskboard/internal/db"
+)
+
+func newIndexer(t *testing.T, fields ...string) (*Indexer, *redis.Client) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	client, err := db.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	ix, err := New(client, "bull", Options{Fields: fields, Block: 10 * time.Millisecond})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ix, client.Client
+}
+
+func TestNormalizeValue(t *testing.T) {
+	cases := map[string]string{
+		"42":      "42",
+		"42.0":    "42",
+		"4.2e1":   "42",
+		"0042":    "42",
+		"-1.50":   "-1.5",
+		"0.1":     "0.1",
+		"abc":     "abc",
+		"42abc":   "42abc",
+		"1e400":   "1e400",
+		" 42":     " 42",
+		"":        "",
+		"user@42": "user@42",
+	}
+
+	for value, want := range cases {
+		if got := NormalizeValue(value); got != want {
+			t.Errorf("%q: got %q, want %q", value, got, want)
+		}
+	}
+}
+
+// TestIndexNormalizedTerms finds jobs by numbers however they were written, in the job data or in the query
+func TestIndexNormalizedTerms(t *testing.T) {
+	ix, rc := newIndexer(t, "data.user.id", "data.amount", "name", "errorClass")
+	ctx := t.Context()
+
+	rc.HSet(ctx, "bull:payments:1", "name", "charge", "data", `{"user":{"id":42},"amount":"10.50"}`)
+	rc.HSet(ctx, "bull:payments:2", "name", "charge", "data", `{"user":{"id":42.0},"amount":10.5}`, "failedReason", "TypeError: x is undefined")
+	rc.HSet(ctx, "bull:payments:3", "name", "refund", "data", `{"user":{"id":"42x"}}`, "stacktrace", `["RangeError: too far"]`)
+
+	if err := ix.IndexJobs(ctx, "bull:payments", []string{"1", "2", "3"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Indexes are only used once the queue is marked ready
+	if _, ok, err := ix.Lookup(ctx, "bull:payments", []Term{{Field: "name", Value: "charge"}}); ok || err != nil {
+		t.Fatalf("got ok %v, %v before the queue is ready", ok, err)
+	}
+
+	rc.Set(ctx, readyKey("bull:payments"), ix.signature, 0)
+
+	cases := []struct {
+		terms []Term
+		want  []string
+	}{
+		{[]Term{{Field: "data.user.id", Value: "42"}}, []string{"2", "1"}},
+		{[]Term{{Field: "data.user.id", Value: "42.000"}}, []string{"2", "1"}},
+		{[]Term{{Field: "data.user.id", Value: "42x"}}, []string{"3"}},
+		{[]Term{{Field: "data.amount", Value: "10.5"}}, []string{"2", "1"}},
+		{[]Term{{Field: "name", Value: "charge"}, {Field: "errorClass", Value: "TypeError"}}, []string{"2"}},
+		{[]Term{{Field: "errorClass", Value: "RangeError"}}, []string{"3"}},
+		{[]Term{{Field: "name", Value: "missing"}}, []string{}},
+	}
+
+	for _, c := range cases {
+		ids, ok, err := ix.Lookup(ctx, "bull:payments", c.terms)
+
+		if err != nil || !ok {
+			t.Errorf("%v: got ok %v, %v", c.terms, ok, err)
+			continue
+		}
+
+		if !slices.Equal(ids, c.want) {
+			t.Errorf("%v: got %v, want %v", c.terms, ids, c.want)
+		}
+	}
+
+	// Fields that aren't indexed are searched by scanning
+	if _, ok, _ := ix.Lookup(ctx, "bull:payments", []Term{{Field: "data.user.email", Value: "a@b.c"}}); ok {
+		t.Error("got ok for a field that isn't indexed")
+	}
+
+	// Jobs changing or removed leave the indexes they no longer belong to
+	rc.HSet(ctx, "bull:payments:1", "data", `{"user":{"id":7}}`)
+	rc.Del(ctx, "bull:payments:2")
+
+	if err := ix.IndexJobs(ctx, "bull:payments", []string{"1", "2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ids, _, _ := ix.Lookup(ctx, "bull:payments", []Term{{Field: "data.user.id", Value: "42"}}); len(ids) != 0 {
+		t.Errorf("got %v, want no job left with the id 42", ids)
+	}
+
+	if n, _ := rc.Exists(ctx, jobKey("bull:payments", "2")).Result(); n != 0 {
+		t.Error("the removed job still lists its index keys")
+	}
+}
+
+// TestReindexTrimmedEvents indexes the queue again when the events following the cursor were trimmed before
+// being read, the jobs they concerned would be missing from the indexes otherwise
+func TestReindexTrimmedEvents(t *testing.T) {
+	ix, rc := newIndexer(t, "name")
+	ctx := t.Context()
+
+	rc.HSet(ctx, "bull:payments:1", "name", "charge")
+	rc.HSet(ctx, "bull:payments:2", "name", "charge")
+	rc.LPush(ctx, "bull:payments:wait", "1", "2")
+	rc.ZAdd(ctx, "bull:payments:completed", redis.Z{Score: 1, Member: "3"})
+	rc.HSet(ctx, "bull:payments:3", "name", "refund")
+
+	// Job 1 was indexed up to event 5-0, the events of jobs 2 and 3 that followed were trimmed
+	rc.SAdd(ctx, indexKey("bull:payments", "name", "charge"), "1")
+	rc.SAdd(ctx, jobKey("bull:payments", "1"), indexKey("bull:payments", "name", "charge"))
+	rc.Set(ctx, readyKey("bull:payments"), ix.signature, 0)
+	rc.Set(ctx, cursorKey("bull:payments"), "5-0", 0)
+
+	for _, id := range []string{"20-0", "21-0"} {
+		rc.XAdd(ctx, &redis.XAddArgs{Stream: "bull:payments:events", ID: id, Values: []any{"event", "progress", "jobId", "1"}})
+	}
+
+	ix.cursors["bull:payments"] = "5-0"
+
+	if err := ix.tail(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Tailing starts again from the latest event while the existing jobs are indexed
+	if cursor, _ := rc.Get(ctx, cursorKey("bull:payments")).Result(); cursor != "21-0" {
+		t.Errorf("got cursor %q, want the latest event", cursor)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		ids, ok, err := ix.Lookup(ctx, "bull:payments", []Term{{Field: "name", Value: "charge"}})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ok {
+			if !slices.Equal(ids, []string{"2", "1"}) {
+				t.Errorf("got %v, want the jobs whose events were trimmed too", ids)
+			}
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("the queue wasn't marked ready again")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if ids, _, _ := ix.Lookup(ctx, "bull:payments", []Term{{Field: "name", Value: "refund"}}); !slices.Equal(ids, []string{"3"}) {
+		t.Errorf("got %v, want the completed job", ids)
+	}
+
+	// Events following a cursor still in the stream are processed without indexing the queue again
+	rc.HSet(ctx, "bull:payments:4", "name", "charge")
+	rc.XAdd(ctx, &redis.XAddArgs{Stream: "bull:payments:events", ID: "22-0", Values: []any{"event", "added", "jobId", "4"}})
+
+	if err := ix.tail(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if ids, ok, _ := ix.Lookup(ctx, "bull:payments", []Term{{Field: "name", Value: "charge"}}); !ok || !slices.Equal(ids, []string{"4", "2", "1"}) {
+		t.Errorf("got %v, ok %v after the added event", ids, ok)
+	}
+}
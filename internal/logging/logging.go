@@ -0,0 +1,95 @@
+// Package logging builds the log/slog handler of taskboard and carries the attributes of requests in their
+// context, so every line logged while serving a request tells which one it belongs to.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// NewHandler creates a handler writing to w in the text or json format, the lines logged with the context
+// of a request carry its attributes
+func NewHandler(w io.Writer, format string, level slog.Leveler) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{Level: level}
+
+	switch format {
+	case "", FormatText:
+		return contextHandler{slog.NewTextHandler(w, opts)}, nil
+	case FormatJSON:
+		return contextHandler{slog.NewJSONHandler(w, opts)}, nil
+	}
+
+	return nil, fmt.Errorf("invalid log format %q: must be text or json", format)
+}
+
+// contextHandler adds the attributes of the request and the trace of the context to each record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		record.AddAttrs(slog.String("trace_id", span.TraceID().String()), slog.String("span_id", span.SpanID().String()))
+	}
+
+	if r := RequestOf(ctx); r != nil {
+		record.AddAttrs(r.attrs...)
+
+		if calls, total := r.Redis(); calls > 0 {
+			record.AddAttrs(slog.Int64("redis_calls", calls), slog.Duration("redis_time", total))
+		}
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+type requestKey struct{}
+
+// Request holds the attributes logged with each line of a request and the time it spent waiting on Redis
+type Request struct {
+	attrs      []slog.Attr
+	redisCalls atomic.Int64
+	redisTime  atomic.Int64
+}
+
+// WithRequest returns a context carrying a new request with attrs, such as its id and route
+func WithRequest(ctx context.Context, attrs ...slog.Attr) (context.Context, *Request) {
+	r := &Request{attrs: attrs}
+	return context.WithValue(ctx, requestKey{}, r), r
+}
+
+// RequestOf is the request carried by ctx, nil outside of requests
+func RequestOf(ctx context.Context) *Request {
+	r, _ := ctx.Value(requestKey{}).(*Request)
+	return r
+}
+
+// AddRedis counts a call to Redis that took d
+func (r *Request) AddRedis(d time.Duration) {
+	r.redisCalls.Add(1)
+	r.redisTime.Add(int64(d))
+}
+
+// Redis is the number of calls to Redis and the time spent waiting on them so far
+func (r *Request) Redis() (int64, time.Duration) {
+	return r.redisCalls.Load(), time.Duration(r.redisTime.Load())
+}
@@ -0,0 +1,492 @@
+// Package query parses the job search language, e.g.
+//
+//	name:sendEmail AND data.user.id=42 AND failedReason~"timeout" AND finishedOn>-1h
+//
+// Terms compare a field with a value and can be combined with AND, OR, NOT and parentheses.
+// Terms next to each other without an operator are combined with AND.
+// The parsed expression is evaluated server-side by the searchJobs script.
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	OpAnd = "and"
+	OpOr  = "or"
+	OpNot = "not"
+	OpCmp = "cmp"
+)
+
+// Comparison operators, ':' is an alias of '='
+const (
+	CmpEq          = "="
+	CmpNe          = "!="
+	CmpContains    = "~"
+	CmpNotContains = "!~"
+	CmpGt          = ">"
+	CmpGte         = ">="
+	CmpLt          = "<"
+	CmpLte         = "<="
+)
+
+// Expr is a node of a parsed query. Its JSON encoding is what the searchJobs script evaluates.
+type Expr struct {
+	Op   string  `json:"op"`
+	Args []*Expr `json:"args,omitempty"`
+
+	// Field is the name used in the query, Keys are the job hash fields it is read from (first present wins)
+	Field string   `json:"field,omitempty"`
+	Keys  []string `json:"keys,omitempty"`
+	// Path is set for fields holding JSON, e.g. data.user.id reads ["user", "id"] from the data field
+	Path  []string `json:"path,omitempty"`
+	Cmp   string   `json:"cmp,omitempty"`
+	Value string   `json:"value,omitempty"`
+	// Num is set when the value is numeric, numeric comparisons require it
+	Num *float64 `json:"num,omitempty"`
+}
+
+type fieldSpec struct {
+	keys []string
+	// json fields accept a path after the field name
+	json bool
+	// time fields accept relative durations and dates as values
+	time bool
+}
+
+// fields maps the names usable in queries to the job hash fields they read.
+// id and state are not stored in the hash and are provided by the script.
+var fields = map[string]fieldSpec{
+	"id":           {keys: []string{"id"}},
+	"state":        {keys: []string{"state"}},
+	"name":         {keys: []string{"name"}},
+	"data":         {keys: []string{"data"}, json: true},
+	"opts":         {keys: []string{"opts"}, json: true},
+	"returnvalue":  {keys: []string{"returnvalue"}, json: true},
+	"failedReason": {keys: []string{"failedReason"}},
+	"stacktrace":   {keys: []string{"stacktrace"}},
+	"timestamp":    {keys: []string{"timestamp"}, time: true},
+	"processedOn":  {keys: []string{"processedOn"}, time: true},
+	"finishedOn":   {keys: []string{"finishedOn"}, time: true},
+	// BullMQ 5 stores attemptsMade as atm
+	"attemptsMade": {keys: []string{"atm", "attemptsMade"}},
+	"priority":     {keys: []string{"priority"}},
+	"delay":        {keys: []string{"delay"}},
+	"parentKey":    {keys: []string{"parentKey"}},
+	// errorClass is derived by the script from the latest stacktrace, e.g. TypeError
+	"errorClass": {keys: []string{"failedReason", "stacktrace"}},
+}
+
+// Fields returns the field names that can be used in queries
+func Fields() []string {
+	names := make([]string, 0, len(fields))
+
+	for name := range fields {
+		names = append(names, name)
+	}
+
+	return names
+}
+
+type parser struct {
+	input string
+	pos   int
+	now   time.Time
+}
+
+// Parse parses a query, relative times such as finishedOn>-1h are resolved against now
+func Parse(input string, now time.Time) (*Expr, error) {
+	p := &parser{input: input, now: now}
+
+	p.skipSpaces()
+	if p.done() {
+		return nil, fmt.Errorf("empty query")
+	}
+
+	expr, err := p.parseOr()
+
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpaces()
+	if !p.done() {
+		return nil, p.errorf("unexpected %q", p.input[p.pos:])
+	}
+
+	return expr, nil
+}
+
+// JSON encodes the expression for the searchJobs script
+func (e *Expr) JSON() (string, error) {
+	b, err := json.Marshal(e)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+// String renders the expression back into the query language
+func (e *Expr) String() string {
+	switch e.Op {
+	case OpAnd, OpOr:
+		parts := make([]string, len(e.Args))
+
+		for i, arg := range e.Args {
+			parts[i] = arg.String()
+		}
+
+		return "(" + strings.Join(parts, " "+strings.ToUpper(e.Op)+" ") + ")"
+	case OpNot:
+		return "NOT " + e.Args[0].String()
+	default:
+		field := e.Field
+		if len(e.Path) > 0 {
+			field += "." + strings.Join(e.Path, ".")
+		}
+
+		return field + e.Cmp + strconv.Quote(e.Value)
+	}
+}
+
+func (p *parser) parseOr() (*Expr, error) {
+	left, err := p.parseAnd()
+
+	if err != nil {
+		return nil, err
+	}
+
+	args := []*Expr{left}
+
+	for p.acceptKeyword("OR") {
+		right, err := p.parseAnd()
+
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, right)
+	}
+
+	if len(args) == 1 {
+		return left, nil
+	}
+
+	return &Expr{Op: OpOr, Args: args}, nil
+}
+
+func (p *parser) parseAnd() (*Expr, error) {
+	left, err := p.parseUnary()
+
+	if err != nil {
+		return nil, err
+	}
+
+	args := []*Expr{left}
+
+	for {
+		if p.acceptKeyword("AND") {
+			right, err := p.parseUnary()
+
+			if err != nil {
+				return nil, err
+			}
+
+			args = append(args, right)
+			continue
+		}
+
+		// Terms following each other are implicitly combined with AND
+		p.skipSpaces()
+		if p.done() || p.peek() == ')' || p.peekKeyword("OR") {
+			break
+		}
+
+		right, err := p.parseUnary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, right)
+	}
+
+	if len(args) == 1 {
+		return left, nil
+	}
+
+	return &Expr{Op: OpAnd, Args: args}, nil
+}
+
+func (p *parser) parseUnary() (*Expr, error) {
+	p.skipSpaces()
+
+	if p.acceptKeyword("NOT") {
+		arg, err := p.parseUnary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &Expr{Op: OpNot, Args: []*Expr{arg}}, nil
+	}
+
+	if p.peek() == '(' {
+		p.pos++
+
+		expr, err := p.parseOr()
+
+		if err != nil {
+			return nil, err
+		}
+
+		p.skipSpaces()
+		if p.peek() != ')' {
+			return nil, p.errorf("expected )")
+		}
+		p.pos++
+
+		return expr, nil
+	}
+
+	return p.parseTerm()
+}
+
+func (p *parser) parseTerm() (*Expr, error) {
+	p.skipSpaces()
+	start := p.pos
+
+	for !p.done() && isFieldChar(rune(p.input[p.pos])) {
+		p.pos++
+	}
+
+	if start == p.pos {
+		if p.done() {
+			return nil, p.errorf("expected a term")
+		}
+		return nil, p.errorf("unexpected %q", string(p.input[p.pos]))
+	}
+
+	name := p.input[start:p.pos]
+	cmp := p.parseCmp()
+
+	if cmp == "" {
+		return nil, p.errorf("expected an operator after %q", name)
+	}
+
+	value, err := p.parseValue()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return p.newTerm(name, cmp, value)
+}
+
+func (p *parser) parseCmp() string {
+	for _, cmp := range []string{CmpNe, CmpNotContains, CmpGte, CmpLte, CmpEq, CmpContains, CmpGt, CmpLt, ":"} {
+		if strings.HasPrefix(p.input[p.pos:], cmp) {
+			p.pos += len(cmp)
+
+			if cmp == ":" {
+				return CmpEq
+			}
+
+			return cmp
+		}
+	}
+
+	return ""
+}
+
+func (p *parser) parseValue() (string, error) {
+	if p.peek() == '"' {
+		// Find the closing quote, skipping escaped ones
+		end := p.pos + 1
+
+		for end < len(p.input) && p.input[end] != '"' {
+			if p.input[end] == '\\' {
+				end++
+			}
+			end++
+		}
+
+		if end >= len(p.input) {
+			return "", p.errorf("unterminated string")
+		}
+
+		value, err := strconv.Unquote(p.input[p.pos : end+1])
+
+		if err != nil {
+			return "", p.errorf("invalid string: %v", err)
+		}
+
+		p.pos = end + 1
+
+		return value, nil
+	}
+
+	start := p.pos
+	for !p.done() && !unicode.IsSpace(rune(p.input[p.pos])) && p.input[p.pos] != ')' && p.input[p.pos] != '(' {
+		p.pos++
+	}
+
+	if start == p.pos {
+		return "", p.errorf("expected a value")
+	}
+
+	return p.input[start:p.pos], nil
+}
+
+func (p *parser) newTerm(name string, cmp string, value string) (*Expr, error) {
+	field, path, _ := strings.Cut(name, ".")
+	spec, ok := fields[field]
+
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q", field)
+	}
+
+	expr := &Expr{Op: OpCmp, Field: field, Keys: spec.keys, Cmp: cmp, Value: value}
+
+	if path != "" {
+		if !spec.json {
+			return nil, fmt.Errorf("field %q does not hold JSON and can't be used with a path", field)
+		}
+
+		expr.Path = strings.Split(path, ".")
+
+		for _, segment := range expr.Path {
+			if segment == "" {
+				return nil, fmt.Errorf("invalid path %q", name)
+			}
+		}
+	}
+
+	if spec.time {
+		if millis, ok := p.parseTime(value); ok {
+			expr.Value = strconv.FormatInt(millis, 10)
+		}
+	}
+
+	if num, err := strconv.ParseFloat(expr.Value, 64); err == nil {
+		expr.Num = &num
+	}
+
+	switch cmp {
+	case CmpGt, CmpGte, CmpLt, CmpLte:
+		if expr.Num == nil {
+			return nil, fmt.Errorf("%s%s requires a numeric value, got %q", name, cmp, value)
+		}
+	}
+
+	return expr, nil
+}
+
+func (p *parser) parseTime(value string) (int64, bool) {
+	return ParseTime(value, p.now)
+}
+
+// ParseTime resolves values of time fields into unix milliseconds. Accepted are relative durations
+// such as -1h, -30m or -2d, "now", RFC 3339 timestamps and dates (2006-01-02).
+func ParseTime(value string, now time.Time) (int64, bool) {
+	if value == "now" {
+		return now.UnixMilli(), true
+	}
+
+	if strings.HasPrefix(value, "-") || strings.HasPrefix(value, "+") {
+		if d, ok := parseDuration(value[1:]); ok {
+			if value[0] == '-' {
+				d = -d
+			}
+			return now.Add(d).UnixMilli(), true
+		}
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UnixMilli(), true
+		}
+	}
+
+	return 0, false
+}
+
+// parseDuration extends time.ParseDuration with days (d) and weeks (w)
+func parseDuration(value string) (time.Duration, bool) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(value, suffix); ok {
+			count, err := strconv.ParseFloat(n, 64)
+
+			if err != nil {
+				return 0, false
+			}
+
+			return time.Duration(count * float64(unit)), true
+		}
+	}
+
+	d, err := time.ParseDuration(value)
+
+	return d, err == nil
+}
+
+func (p *parser) acceptKeyword(keyword string) bool {
+	if !p.peekKeyword(keyword) {
+		return false
+	}
+
+	p.skipSpaces()
+	p.pos += len(keyword)
+
+	return true
+}
+
+func (p *parser) peekKeyword(keyword string) bool {
+	p.skipSpaces()
+
+	rest := p.input[p.pos:]
+	if !strings.HasPrefix(rest, keyword) {
+		return false
+	}
+
+	// The keyword must stand on its own, e.g. ORDER is not OR
+	if len(rest) > len(keyword) {
+		next := rune(rest[len(keyword)])
+		return unicode.IsSpace(next) || next == '('
+	}
+
+	return true
+}
+
+func (p *parser) skipSpaces() {
+	for !p.done() && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *parser) peek() byte {
+	if p.done() {
+		return 0
+	}
+
+	return p.input[p.pos]
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("invalid query at position %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func isFieldChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.' || r == '-'
+}
@@ -0,0 +1,148 @@
+package query
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		input string
+		want  string
+	}{
+		// AND binds tighter than OR, terms next to each other are combined with AND
+		{"name:a OR name:b AND name:c", `(name="a" OR (name="b" AND name="c"))`},
+		{"name:a name:b OR name:c", `((name="a" AND name="b") OR name="c")`},
+		{"(name:a OR name:b) name:c", `((name="a" OR name="b") AND name="c")`},
+		{"NOT name:a name:b", `(NOT name="a" AND name="b")`},
+		{"NOT (name:a OR name:b)", `NOT (name="a" OR name="b")`},
+		{"name:a AND NOT NOT name:b", `(name="a" AND NOT NOT name="b")`},
+		// Keywords stand on their own
+		{"name:ORDERS OR name:ANDROID", `(name="ORDERS" OR name="ANDROID")`},
+		{"name:a OR(name:b)", `(name="a" OR name="b")`},
+		// Quoting
+		{`failedReason~"connection refused"`, `failedReason~"connection refused"`},
+		{`failedReason~"say \"hi\""`, `failedReason~"say \"hi\""`},
+		{`name:"a OR b"`, `name="a OR b"`},
+		{`name:""`, `name=""`},
+		// Comparisons
+		{"name!=a", `name!="a"`},
+		{"data.user.email!~example.org", `data.user.email!~"example.org"`},
+		{"attemptsMade>=3 priority<=1", `(attemptsMade>="3" AND priority<="1")`},
+		{"delay>1000 delay<2000.5", `(delay>"1000" AND delay<"2000.5")`},
+		// Times are resolved against now
+		{"finishedOn>-1h", `finishedOn>"1704161045000"`},
+		{"timestamp<2024-01-01", `timestamp<"1704067200000"`},
+		{"processedOn<=now", `processedOn<="1704164645000"`},
+	}
+
+	for _, c := range cases {
+		expr, err := Parse(c.input, now)
+
+		if err != nil {
+			t.Errorf("%s: %v", c.input, err)
+			continue
+		}
+
+		if got := expr.String(); got != c.want {
+			t.Errorf("%s: got %s, want %s", c.input, got, c.want)
+		}
+	}
+}
+
+func TestParseTerm(t *testing.T) {
+	expr, err := Parse("data.user.id=42", now)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expr.Field != "data" || strings.Join(expr.Path, ".") != "user.id" || expr.Num == nil || *expr.Num != 42 {
+		t.Errorf("got %+v, want data with the path user.id and the number 42", expr)
+	}
+
+	// attemptsMade is read from atm first, where BullMQ 5 stores it
+	if expr, err = Parse("attemptsMade>1", now); err != nil || strings.Join(expr.Keys, ",") != "atm,attemptsMade" {
+		t.Errorf("got %+v, %v", expr, err)
+	}
+
+	// Values of fields that aren't times are left as they are
+	if expr, err = Parse("name:-1h", now); err != nil || expr.Value != "-1h" || expr.Num != nil {
+		t.Errorf("got %+v, %v", expr, err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := []struct {
+		input string
+		err   string
+	}{
+		{"", "empty query"},
+		{"   ", "empty query"},
+		{"name", `expected an operator after "name"`},
+		{"name:", "expected a value"},
+		{`name:"abc`, "unterminated string"},
+		{`name:"\q"`, "invalid string"},
+		{"(name:a", "expected )"},
+		{"name:a)", `unexpected ")"`},
+		{"name:a OR", "expected a term"},
+		{"NOT", "expected a term"},
+		{"*:a", `unexpected "*"`},
+		{"color:red", `unknown field "color"`},
+		{"name.first:a", `field "name" does not hold JSON`},
+		{"data..id:1", `invalid path "data..id"`},
+		{"attemptsMade>three", "requires a numeric value"},
+		{"finishedOn>yesterday", "requires a numeric value"},
+	}
+
+	for _, c := range cases {
+		_, err := Parse(c.input, now)
+
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%q: got error %v, want %q", c.input, err, c.err)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	cases := []struct {
+		value string
+		want  time.Time
+		ok    bool
+	}{
+		{"now", now, true},
+		{"-1h", now.Add(-time.Hour), true},
+		{"+30m", now.Add(30 * time.Minute), true},
+		{"-90s", now.Add(-90 * time.Second), true},
+		{"-2d", now.Add(-48 * time.Hour), true},
+		{"-1.5d", now.Add(-36 * time.Hour), true},
+		{"-1w", now.Add(-7 * 24 * time.Hour), true},
+		{"-1h30m", now.Add(-90 * time.Minute), true},
+		{"2024-01-01T10:00:00Z", time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), true},
+		{"2024-01-01T10:00:00+02:00", time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC), true},
+		{"2024-01-01T10:00:00", time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), true},
+		{"2024-01-01", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{"1h", time.Time{}, false},
+		{"-", time.Time{}, false},
+		{"-xd", time.Time{}, false},
+		{"-1y", time.Time{}, false},
+		{"yesterday", time.Time{}, false},
+		{"2024-13-01", time.Time{}, false},
+	}
+
+	for _, c := range cases {
+		got, ok := ParseTime(c.value, now)
+
+		if ok != c.ok {
+			t.Errorf("%s: got ok %v, want %v", c.value, ok, c.ok)
+			continue
+		}
+
+		if ok && got != c.want.UnixMilli() {
+			t.Errorf("%s: got %s, want %s", c.value, time.UnixMilli(got).UTC(), c.want)
+		}
+	}
+}
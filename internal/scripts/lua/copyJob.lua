@@ -0,0 +1,40 @@
+--[[
+  Adds a copy of a job read from another queue, the second step of moving or copying a job
+  to a queue in another hash slot.
+
+  Input:
+    KEYS[1] 'prefix' - Target queue prefix (e.g., 'bull:emails-slow')
+
+    ARGV[1] jobId - Id of the new job, empty to take the next id of the queue
+    ARGV[2] name
+    ARGV[3] data - JSON encoded data
+    ARGV[4] opts - JSON encoded options
+    ARGV[5] priority - Priority of the job (0 for none)
+    ARGV[6] timestamp - Current time in milliseconds
+    ARGV[7...] logs - Log lines of the job
+
+  Output:
+    {1, jobId} if the job was added
+    {-3} if a job with the same id already exists
+
+  Events:
+    'added' and 'waiting' events
+]]
+
+local rcall = redis.call
+local prefix = KEYS[1]
+
+--- @include "addJobCopy"
+
+local logs = {}
+for i = 7, #ARGV do
+  logs[#logs + 1] = ARGV[i]
+end
+
+local jobId = addJobCopy(prefix, ARGV[1], ARGV[2], ARGV[3], ARGV[4], tonumber(ARGV[6]), tonumber(ARGV[5]), logs)
+
+if not jobId then
+  return {-3}
+end
+
+return {1, jobId}
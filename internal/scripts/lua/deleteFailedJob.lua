@@ -0,0 +1,29 @@
+--[[
+  Deletes a failed job, jobs that are no longer failed are left as they are
+
+  Input:
+    KEYS[1] 'prefix' - Queue prefix (e.g., 'bull:myqueue')
+
+    ARGV[1] jobId - The failed job
+
+  Output:
+    1 if the job was deleted
+    0 if the job is not failed
+
+  Events:
+    'removed' event
+]]
+
+local rcall = redis.call
+local prefix = KEYS[1]
+local jobId = ARGV[1]
+local jobKey = prefix .. ":" .. jobId
+
+if rcall("ZREM", prefix .. ":failed", jobId) == 0 then
+  return 0
+end
+
+rcall("DEL", jobKey, jobKey .. ":logs")
+rcall("XADD", prefix .. ":events", "*", "event", "removed", "jobId", jobId, "prev", "failed")
+
+return 1
@@ -20,27 +20,16 @@ local jobId = ARGV[1]
 
 local jobKey = prefix .. ":" .. jobId
 
+--- @include "removeJobFromState"
+
 -- Check if the job exists
 local exists = rcall("EXISTS", jobKey)
 if exists == 0 then
   return 0
 end
 
--- All possible states where the job could be
-local states = {"wait", "active", "delayed", "failed", "completed", "paused", "waiting-children"}
-
--- Remove from all possible states
-for _, state in ipairs(states) do
-  local stateKey = prefix .. ":" .. state
-
-  if state == "wait" or state == "active" or state == "paused" or state == "waiting-children" then
-    -- These are stored as lists
-    rcall("LREM", stateKey, 0, jobId)
-  else
-    -- delayed, failed, completed are stored as sorted sets
-    rcall("ZREM", stateKey, jobId)
-  end
-end
+-- States are lists or sorted sets, each is read as the type of its key
+removeJobFromState(prefix, jobId)
 
 -- Delete the job hash itself
 rcall("DEL", jobKey)
@@ -0,0 +1,58 @@
+--[[
+  First step of moving a job to a queue in another hash slot: the job is taken out of its state
+  so no worker picks it up while it is copied. Its state is kept in the job hash, reattachJob
+  puts it back when the copy fails. Detached jobs are tracked in '<prefix>:taskboard:detached'
+  by detach time so those left behind by interrupted moves can be put back. Jobs being copied
+  are only read.
+
+  Input:
+    KEYS[1] 'prefix' - Queue prefix (e.g., 'bull:emails')
+
+    ARGV[1] jobId - The job to detach
+    ARGV[2] copy - '1' to only read the job, leaving it in its state
+    ARGV[3] timestamp - Current time in milliseconds
+
+  Output:
+    {1, name, data, opts, priority, logs} if the job was detached or read, logs being a list of lines
+    {0} if the job was not found
+    {-1} if the job is active
+    {-2} if the job belongs to a flow
+    {-4} if the job is already being moved
+]]
+
+local rcall = redis.call
+local prefix = KEYS[1]
+local jobId = ARGV[1]
+local copy = ARGV[2] == "1"
+local timestamp = ARGV[3]
+
+--- @include "removeJobFromState"
+
+local jobKey = prefix .. ":" .. jobId
+
+if rcall("EXISTS", jobKey) == 0 then
+  return {0}
+end
+
+if rcall("LPOS", prefix .. ":active", jobId) then
+  return {-1}
+end
+
+if rcall("HEXISTS", jobKey, "parentKey") == 1 or rcall("EXISTS", jobKey .. ":dependencies") == 1 then
+  return {-2}
+end
+
+if rcall("HEXISTS", jobKey, "taskboardDetached") == 1 then
+  return {-4}
+end
+
+if not copy then
+  local state, score = removeJobFromState(prefix, jobId)
+
+  rcall("HSET", jobKey, "taskboardDetached", cjson.encode({state = state or cjson.null, score = score or cjson.null}))
+  rcall("ZADD", prefix .. ":taskboard:detached", timestamp, jobId)
+end
+
+local fields = rcall("HMGET", jobKey, "name", "data", "opts", "priority")
+
+return {1, fields[1] or "", fields[2] or "{}", fields[3] or "{}", tonumber(fields[4]) or 0, rcall("LRANGE", jobKey .. ":logs", 0, -1)}
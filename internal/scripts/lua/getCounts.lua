@@ -14,21 +14,16 @@ local results = {}
 for i = 1, #ARGV do
 	local stateKey = prefix .. ":" .. ARGV[i]
 
-	if ARGV == "wait" or ARGV[i] == "paused" then
+	if ARGV[i] == "wait" or ARGV[i] == "paused" then
+		local count = rcall("LLEN", stateKey)
 		local marker = rcall("LINDEX", stateKey, -1)
 
+		-- Older BullMQ versions mark delayed jobs with a 0: entry in the list, it is left there as it isn't a job
 		if marker and string.sub(marker, 1, 2) == "0:" then
-			local count = rcall("LLEN", stateKey)
-			
-			if count > 1 then
-				rcall("RPOP", stateKey)
-				results[#results+1] = count-1
-			else
-				results[#results+1] = 0
-			end
-		else
-			results[#results+1] = rcall("LLEN", stateKey)
+			count = count - 1
 		end
+
+		results[#results+1] = count
 	elseif ARGV[i] == "active" then
 		results[#results+1] = rcall("LLEN", stateKey)
 	else
@@ -0,0 +1,55 @@
+--[[
+  Reads everything needed to render a job as a node of a flow (parent/child) tree
+
+  Input:
+    KEYS[1] 'prefix' - Queue prefix (e.g., 'bull:myqueue')
+
+    ARGV[1] jobId - The job ID to read
+
+  Output:
+    false if the job does not exist
+    { name, state, parentKey, pending, processed, failed, unsuccessful } otherwise
+    where pending, processed, failed and unsuccessful are lists of child job keys
+]]
+
+local rcall = redis.call
+local prefix = KEYS[1]
+local jobId = ARGV[1]
+
+local jobKey = prefix .. ":" .. jobId
+
+if rcall("EXISTS", jobKey) == 0 then
+  return false
+end
+
+-- Depending on the BullMQ version some states are stored as lists or sorted sets
+local function isInState(stateKey)
+  local keyType = rcall("TYPE", stateKey)["ok"]
+
+  if keyType == "zset" then
+    return rcall("ZSCORE", stateKey, jobId) ~= false
+  elseif keyType == "list" then
+    return rcall("LPOS", stateKey, jobId) ~= false
+  end
+
+  return false
+end
+
+local state = "unknown"
+local states = {"completed", "failed", "delayed", "prioritized", "active", "wait", "paused", "waiting-children"}
+
+for _, candidate in ipairs(states) do
+  if isInState(prefix .. ":" .. candidate) then
+    state = candidate
+    break
+  end
+end
+
+local fields = rcall("HMGET", jobKey, "name", "parentKey")
+
+local processed = rcall("HKEYS", jobKey .. ":processed")
+local failed = rcall("HKEYS", jobKey .. ":failed")
+local unsuccessful = rcall("ZRANGE", jobKey .. ":unsuccessful", 0, -1)
+local pending = rcall("SMEMBERS", jobKey .. ":dependencies")
+
+return {fields[1] or "", state, fields[2] or "", pending, processed, failed, unsuccessful}
@@ -0,0 +1,79 @@
+--[[
+  Reads a page of a job's logs, optionally filtered by a search term
+
+  Input:
+    KEYS[1] 'prefix' - Queue prefix (e.g., 'bull:myqueue')
+
+    ARGV[1] jobId - The job ID whose logs should be read
+    ARGV[2] after - Only lines with an index greater than this are considered (-1 for all)
+    ARGV[3] offset - Number of considered lines (or matches) to skip
+    ARGV[4] limit - Maximum number of lines to return
+    ARGV[5] search - Case-insensitive substring lines must contain (empty for all)
+
+  Output:
+    false if the job does not exist
+    { total, matched, index1, line1, index2, line2, ... } otherwise
+]]
+
+local rcall = redis.call
+local prefix = KEYS[1]
+local jobId = ARGV[1]
+local after = tonumber(ARGV[2])
+local offset = tonumber(ARGV[3])
+local limit = tonumber(ARGV[4])
+local search = ARGV[5] or ""
+
+local jobKey = prefix .. ":" .. jobId
+
+if rcall("EXISTS", jobKey) == 0 then
+  return false
+end
+
+local logsKey = jobKey .. ":logs"
+local total = rcall("LLEN", logsKey)
+local first = after + 1
+local results = {total, 0}
+
+if search == "" then
+  local matched = total - first
+  if matched < 0 then
+    matched = 0
+  end
+  results[2] = matched
+
+  local from = first + offset
+  if limit > 0 and from < total then
+    local lines = rcall("LRANGE", logsKey, from, from + limit - 1)
+    for i, line in ipairs(lines) do
+      results[#results + 1] = from + i - 1
+      results[#results + 1] = line
+    end
+  end
+
+  return results
+end
+
+-- Scan in batches so a large log list doesn't have to be loaded at once
+local needle = string.lower(search)
+local batch = 1000
+local matched = 0
+local returned = 0
+
+for from = first, total - 1, batch do
+  local lines = rcall("LRANGE", logsKey, from, from + batch - 1)
+
+  for i, line in ipairs(lines) do
+    if string.find(string.lower(line), needle, 1, true) then
+      if matched >= offset and returned < limit then
+        results[#results + 1] = from + i - 1
+        results[#results + 1] = line
+        returned = returned + 1
+      end
+      matched = matched + 1
+    end
+  end
+end
+
+results[2] = matched
+
+return results
@@ -0,0 +1,85 @@
+--[[
+  Lists the job schedulers (repeatable jobs) of a queue together with recently produced repeat jobs
+
+  Input:
+    KEYS[1] 'prefix' - Queue prefix (e.g., 'bull:myqueue')
+
+    ARGV[1] schedulerId - Only return this scheduler (empty for all)
+    ARGV[2] window - How many of the most recent jobs per state are inspected to find produced jobs
+
+  Schedulers are paused when taskboard paused them and they are not back in the repeat set, the
+  application upserting a scheduler adds it back and resumes it.
+
+  Output:
+    {
+      { { schedulerId, nextMillis, { field1, value1, ... }, paused }, ... },
+      { jobId1, state1, jobId2, state2, ... }
+    }
+]]
+
+local rcall = redis.call
+local prefix = KEYS[1]
+local schedulerId = ARGV[1]
+local window = tonumber(ARGV[2])
+
+local repeatKey = prefix .. ":repeat"
+local pausedKey = prefix .. ":taskboard:paused-schedulers"
+local schedulers = {}
+
+local function addScheduler(id, score)
+  local fields = rcall("HGETALL", repeatKey .. ":" .. id)
+  local paused = 0
+
+  if score == "" and rcall("SISMEMBER", pausedKey, id) == 1 then
+    paused = 1
+  end
+
+  schedulers[#schedulers + 1] = {id, score, fields, paused}
+end
+
+if schedulerId ~= "" then
+  local score = rcall("ZSCORE", repeatKey, schedulerId)
+
+  -- Paused schedulers are removed from the set but keep their hash
+  if score or rcall("EXISTS", repeatKey .. ":" .. schedulerId) == 1 then
+    addScheduler(schedulerId, score or "")
+  end
+else
+  local members = rcall("ZRANGE", repeatKey, 0, -1, "WITHSCORES")
+  local listed = {}
+
+  for i = 1, #members, 2 do
+    listed[members[i]] = true
+    addScheduler(members[i], members[i + 1])
+  end
+
+  -- Paused schedulers are removed from the repeat set, taskboard keeps track of them separately
+  for _, id in ipairs(rcall("SMEMBERS", pausedKey)) do
+    if not listed[id] and rcall("EXISTS", repeatKey .. ":" .. id) == 1 then
+      addScheduler(id, "")
+    end
+  end
+end
+
+local recent = {}
+
+local function collect(state, ids)
+  for _, id in ipairs(ids) do
+    if string.sub(id, 1, 7) == "repeat:" then
+      recent[#recent + 1] = id
+      recent[#recent + 1] = state
+    end
+  end
+end
+
+for _, state in ipairs({"active", "wait", "paused"}) do
+  collect(state, rcall("LRANGE", prefix .. ":" .. state, 0, window - 1))
+end
+
+collect("prioritized", rcall("ZRANGE", prefix .. ":prioritized", 0, window - 1))
+
+for _, state in ipairs({"completed", "failed"}) do
+  collect(state, rcall("ZREVRANGE", prefix .. ":" .. state, 0, window - 1))
+end
+
+return {schedulers, recent}
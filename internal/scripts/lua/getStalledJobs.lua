@@ -0,0 +1,27 @@
+--[[
+  Finds active jobs whose lock has expired. The worker that was processing them is gone,
+  BullMQ considers them stalled.
+
+  Input:
+    KEYS[1] 'prefix' - Queue prefix (e.g., 'bull:myqueue')
+
+  Output:
+    { jobId1, stalledCounter1, jobId2, stalledCounter2, ... }
+]]
+
+local rcall = redis.call
+local prefix = KEYS[1]
+
+local results = {}
+local active = rcall("LRANGE", prefix .. ":active", 0, -1)
+
+for _, jobId in ipairs(active) do
+  local jobKey = prefix .. ":" .. jobId
+
+  if rcall("EXISTS", jobKey .. ":lock") == 0 then
+    results[#results + 1] = jobId
+    results[#results + 1] = tonumber(rcall("HGET", jobKey, "stc") or 0)
+  end
+end
+
+return results
@@ -0,0 +1,36 @@
+--[[
+  Adds a fresh job to a queue from the name, data and options of another job, along with its logs.
+  Ids are taken from the queue counter like BullMQ does when jobId is empty.
+  Returns the id of the job, or nil when a job with the given id already exists.
+]]
+
+--- @include "addJobToWait"
+
+local function addJobCopy(prefix, jobId, name, data, opts, timestamp, priority, logs)
+  if jobId == "" then
+    repeat
+      jobId = tostring(rcall("INCR", prefix .. ":id"))
+    until rcall("EXISTS", prefix .. ":" .. jobId) == 0
+  elseif rcall("EXISTS", prefix .. ":" .. jobId) == 1 then
+    return nil
+  end
+
+  local jobKey = prefix .. ":" .. jobId
+
+  rcall("HSET", jobKey,
+    "name", name,
+    "data", data,
+    "opts", opts,
+    "timestamp", timestamp,
+    "delay", 0,
+    "priority", priority)
+
+  for i = 1, #logs, 1000 do
+    rcall("RPUSH", jobKey .. ":logs", unpack(logs, i, math.min(i + 999, #logs)))
+  end
+
+  rcall("XADD", prefix .. ":events", "*", "event", "added", "jobId", jobId, "name", name)
+  addJobToWait(prefix, jobId, priority)
+
+  return jobId
+end
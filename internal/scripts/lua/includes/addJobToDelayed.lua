@@ -0,0 +1,20 @@
+--[[
+  Adds a job id to the delayed set so it is promoted at the given timestamp.
+  Scores follow BullMQ: timestamp * 0x1000 plus a counter for jobs sharing a timestamp.
+]]
+
+local function addJobToDelayed(prefix, jobId, timestamp)
+  local delayedKey = prefix .. ":delayed"
+  local minScore = timestamp * 0x1000
+  local maxScore = (timestamp + 1) * 0x1000 - 1
+  local score = minScore
+
+  local last = rcall("ZREVRANGEBYSCORE", delayedKey, maxScore, minScore, "WITHSCORES", "LIMIT", 0, 1)
+  if #last > 0 then
+    score = tonumber(last[2]) + 1
+  end
+
+  rcall("ZADD", delayedKey, score, jobId)
+  rcall("ZADD", prefix .. ":marker", timestamp, "1")
+  rcall("XADD", prefix .. ":events", "*", "event", "delayed", "jobId", jobId, "delay", timestamp)
+end
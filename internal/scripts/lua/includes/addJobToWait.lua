@@ -0,0 +1,26 @@
+--[[
+  Adds a job id to the structure workers pick jobs from, the same way BullMQ does:
+    - the paused list when the queue is paused
+    - the prioritized set when the job has a priority
+    - the wait list otherwise
+  Workers blocked on the marker key are woken up.
+]]
+
+local function addJobToWait(prefix, jobId, priority)
+  local isPaused = rcall("HEXISTS", prefix .. ":meta", "paused") == 1
+
+  if priority > 0 then
+    local counter = rcall("INCR", prefix .. ":pc")
+    rcall("ZADD", prefix .. ":prioritized", priority * 0x100000000 + counter % 0x100000000, jobId)
+  elseif isPaused then
+    rcall("LPUSH", prefix .. ":paused", jobId)
+  else
+    rcall("LPUSH", prefix .. ":wait", jobId)
+  end
+
+  if not isPaused then
+    rcall("ZADD", prefix .. ":marker", 0, "0")
+  end
+
+  rcall("XADD", prefix .. ":events", "*", "event", "waiting", "jobId", jobId)
+end
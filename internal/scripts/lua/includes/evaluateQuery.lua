@@ -0,0 +1,179 @@
+--[[
+  Evaluates expressions built by the query package against a job hash.
+  Jobs are tables holding id, state and the hash fields listed by collectQueryFields.
+]]
+
+-- Collect the hash fields an expression needs so only those are read
+local function collectQueryFields(expr, names, seen)
+  if expr.op == "cmp" then
+    for _, key in ipairs(expr.keys) do
+      if key ~= "id" and key ~= "state" and not seen[key] then
+        seen[key] = true
+        names[#names + 1] = key
+      end
+    end
+  else
+    for _, arg in ipairs(expr.args) do
+      collectQueryFields(arg, names, seen)
+    end
+  end
+
+  return names
+end
+
+local function loadQueryJob(jobKey, jobId, state, fieldNames)
+  local job = {id = jobId, state = state, decoded = {}}
+
+  if #fieldNames > 0 then
+    local values = rcall("HMGET", jobKey, unpack(fieldNames))
+
+    for i, name in ipairs(fieldNames) do
+      if values[i] then
+        job[name] = values[i]
+      end
+    end
+  end
+
+  return job
+end
+
+-- The error class is the name of the error in the latest stacktrace, e.g. TypeError,
+-- falling back to the failed reason. Must stay in sync with ErrorClass in the index package.
+local function getErrorClass(job)
+  local line = job.failedReason
+
+  if job.stacktrace then
+    local ok, stack = pcall(cjson.decode, job.stacktrace)
+
+    if ok and type(stack) == "table" and type(stack[#stack]) == "string" then
+      line = stack[#stack]
+    end
+  end
+
+  if line == nil or line == "" then
+    return nil
+  end
+
+  return string.match(line, "^([%a_$][%w_$.]*):") or "Error"
+end
+
+local function resolveQueryField(expr, job)
+  if expr.field == "errorClass" then
+    return getErrorClass(job)
+  end
+
+  for _, key in ipairs(expr.keys) do
+    local raw = job[key]
+
+    if raw ~= nil then
+      if not expr.path then
+        return raw
+      end
+
+      local decoded = job.decoded[key]
+      if decoded == nil then
+        local ok, value = pcall(cjson.decode, raw)
+        decoded = ok and value or false
+        job.decoded[key] = decoded
+      end
+
+      local value = decoded
+      for _, segment in ipairs(expr.path) do
+        if type(value) ~= "table" then
+          return nil
+        end
+
+        local nextValue = value[segment]
+        -- Array elements are addressed with 0-based indexes like in JavaScript
+        if nextValue == nil and tonumber(segment) then
+          nextValue = value[tonumber(segment) + 1]
+        end
+        value = nextValue
+      end
+
+      if value == nil or value == cjson.null then
+        return nil
+      end
+
+      if type(value) == "table" then
+        return cjson.encode(value)
+      end
+
+      return value
+    end
+  end
+
+  return nil
+end
+
+local function compareQueryTerm(expr, job)
+  local value = resolveQueryField(expr, job)
+  local cmp = expr.cmp
+
+  if value == nil then
+    return cmp == "!=" or cmp == "!~"
+  end
+
+  local num = tonumber(value)
+
+  if cmp == "=" or cmp == "!=" then
+    local equal
+    if expr.num and num then
+      equal = num == expr.num
+    else
+      equal = tostring(value) == expr.value
+    end
+
+    if cmp == "=" then
+      return equal
+    end
+    return not equal
+  end
+
+  if cmp == "~" or cmp == "!~" then
+    local found = string.find(string.lower(tostring(value)), string.lower(expr.value), 1, true) ~= nil
+
+    if cmp == "~" then
+      return found
+    end
+    return not found
+  end
+
+  if not num or not expr.num then
+    return false
+  end
+
+  if cmp == ">" then
+    return num > expr.num
+  elseif cmp == ">=" then
+    return num >= expr.num
+  elseif cmp == "<" then
+    return num < expr.num
+  elseif cmp == "<=" then
+    return num <= expr.num
+  end
+
+  return false
+end
+
+local function evaluateQuery(expr, job)
+  if expr.op == "and" then
+    for _, arg in ipairs(expr.args) do
+      if not evaluateQuery(arg, job) then
+        return false
+      end
+    end
+    return true
+  elseif expr.op == "or" then
+    for _, arg in ipairs(expr.args) do
+      if evaluateQuery(arg, job) then
+        return true
+      end
+    end
+    return false
+  elseif expr.op == "not" then
+    return not evaluateQuery(expr.args[1], job)
+  end
+
+  return compareQueryTerm(expr, job)
+end
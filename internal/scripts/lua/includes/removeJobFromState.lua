@@ -0,0 +1,29 @@
+--[[
+  Removes a job id from the structure of the state it is in, sorted sets and lists alike.
+  Returns the state and the score the job had in it, nil when the state is a list,
+  or nil when the job isn't in any state.
+]]
+
+local function removeJobFromState(prefix, jobId)
+  local states = {"active", "wait", "paused", "prioritized", "delayed", "waiting-children", "failed", "completed"}
+
+  for _, state in ipairs(states) do
+    local stateKey = prefix .. ":" .. state
+    local keyType = rcall("TYPE", stateKey)["ok"]
+
+    if keyType == "zset" then
+      local score = rcall("ZSCORE", stateKey, jobId)
+
+      if score then
+        rcall("ZREM", stateKey, jobId)
+        return state, score
+      end
+    elseif keyType == "list" then
+      if rcall("LREM", stateKey, 1, jobId) > 0 then
+        return state, nil
+      end
+    end
+  end
+
+  return nil, nil
+end
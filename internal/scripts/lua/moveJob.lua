@@ -0,0 +1,74 @@
+--[[
+  Moves or copies a job into another queue in a single step, both queues must share a hash slot.
+  The job is added to the target queue as a fresh job with the same name, data, options and logs,
+  then removed from the source queue unless it is copied.
+
+  Input:
+    KEYS[1] 'source' - Source queue prefix (e.g., 'bull:emails')
+    KEYS[2] 'target' - Target queue prefix (e.g., 'bull:emails-slow')
+
+    ARGV[1] jobId - The job to move
+    ARGV[2] newJobId - Id of the job in the target queue, empty to take the next id of the target queue
+    ARGV[3] copy - '1' to leave the job in the source queue
+    ARGV[4] timestamp - Current time in milliseconds
+
+  Output:
+    {1, newJobId} if the job was moved or copied
+    {0} if the job was not found
+    {-1} if the job is active
+    {-2} if the job belongs to a flow
+    {-3} if the target queue already has a job with newJobId
+    {-4} if the job is being moved to a queue in another hash slot
+
+  Events:
+    'added' and 'waiting' events in the target queue
+    'removed' event in the source queue when moving
+]]
+
+local rcall = redis.call
+local source = KEYS[1]
+local target = KEYS[2]
+local jobId = ARGV[1]
+local newJobId = ARGV[2]
+local copy = ARGV[3] == "1"
+local timestamp = tonumber(ARGV[4])
+
+--- @include "addJobCopy"
+--- @include "removeJobFromState"
+
+local jobKey = source .. ":" .. jobId
+
+if rcall("EXISTS", jobKey) == 0 then
+  return {0}
+end
+
+if rcall("LPOS", source .. ":active", jobId) then
+  return {-1}
+end
+
+-- Moving either end of a flow would leave the other waiting forever
+if rcall("HEXISTS", jobKey, "parentKey") == 1 or rcall("EXISTS", jobKey .. ":dependencies") == 1 then
+  return {-2}
+end
+
+if rcall("HEXISTS", jobKey, "taskboardDetached") == 1 then
+  return {-4}
+end
+
+local fields = rcall("HMGET", jobKey, "name", "data", "opts", "priority")
+local logs = rcall("LRANGE", jobKey .. ":logs", 0, -1)
+
+newJobId = addJobCopy(target, newJobId, fields[1] or "", fields[2] or "{}", fields[3] or "{}", timestamp, tonumber(fields[4]) or 0, logs)
+
+if not newJobId then
+  return {-3}
+end
+
+if not copy then
+  removeJobFromState(source, jobId)
+
+  rcall("DEL", jobKey, jobKey .. ":logs")
+  rcall("XADD", source .. ":events", "*", "event", "removed", "jobId", jobId)
+end
+
+return {1, newJobId}
@@ -0,0 +1,127 @@
+--[[
+  Recovers stalled jobs the same way BullMQ's moveStalledJobsToWait does. Each job still active
+  without a lock gets its stalled counter (stc) incremented, it is then moved back to wait, or to
+  failed once it has stalled more than maxStalledCount times. Jobs that are no longer active or that
+  hold a lock are skipped so running the script twice is harmless.
+
+  Parent jobs of flows are not notified when a stalled child is failed.
+
+  Input:
+    KEYS[1] 'prefix' - Queue prefix (e.g., 'bull:myqueue')
+
+    ARGV[1] maxStalledCount - Number of times a job can stall before it is failed
+    ARGV[2] timestamp - Current time in milliseconds
+    ARGV[3...] jobIds - The jobs to recover
+
+  Output:
+    { { jobIds moved to wait }, { jobIds moved to failed } }
+
+  Events:
+    'stalled' and 'waiting' events for jobs moved to wait
+    'failed' event for jobs moved to failed
+]]
+
+local rcall = redis.call
+local prefix = KEYS[1]
+local maxStalledCount = tonumber(ARGV[1])
+local timestamp = tonumber(ARGV[2])
+
+local activeKey = prefix .. ":active"
+local failedKey = prefix .. ":failed"
+local eventsKey = prefix .. ":events"
+local failedReason = "job stalled more than allowable limit"
+
+-- Applies removeOnFail which can be a boolean, a count or { count, age }
+local function removeFailedJobs(jobId, opts)
+  local removeOnFail = opts["removeOnFail"]
+
+  if removeOnFail == true then
+    rcall("ZREM", failedKey, jobId)
+    rcall("DEL", prefix .. ":" .. jobId, prefix .. ":" .. jobId .. ":logs")
+    return
+  end
+
+  local maxCount = nil
+  local maxAge = nil
+
+  if type(removeOnFail) == "number" then
+    maxCount = removeOnFail
+  elseif type(removeOnFail) == "table" then
+    maxCount = removeOnFail["count"]
+    maxAge = removeOnFail["age"]
+  end
+
+  if maxAge then
+    local removed = rcall("ZRANGEBYSCORE", failedKey, 0, timestamp - maxAge * 1000, "LIMIT", 0, 1000)
+    for _, id in ipairs(removed) do
+      rcall("DEL", prefix .. ":" .. id, prefix .. ":" .. id .. ":logs")
+      rcall("ZREM", failedKey, id)
+    end
+  end
+
+  if maxCount and maxCount >= 0 then
+    local removed = rcall("ZREVRANGE", failedKey, maxCount, -1)
+    for _, id in ipairs(removed) do
+      rcall("DEL", prefix .. ":" .. id, prefix .. ":" .. id .. ":logs")
+    end
+    rcall("ZREMRANGEBYRANK", failedKey, 0, -(maxCount + 1))
+  end
+end
+
+local movedToWait = {}
+local movedToFailed = {}
+local isPaused = rcall("HEXISTS", prefix .. ":meta", "paused") == 1
+
+for i = 3, #ARGV do
+  local jobId = ARGV[i]
+  local jobKey = prefix .. ":" .. jobId
+
+  if rcall("LPOS", activeKey, jobId) ~= false and rcall("EXISTS", jobKey .. ":lock") == 0 then
+    rcall("LREM", activeKey, 1, jobId)
+    rcall("SREM", prefix .. ":stalled", jobId)
+
+    -- The job hash may be gone if it was removed while active
+    if rcall("EXISTS", jobKey) == 1 then
+      local stalledCount = rcall("HINCRBY", jobKey, "stc", 1)
+
+      if stalledCount > maxStalledCount then
+        rcall("ZADD", failedKey, timestamp, jobId)
+        rcall("HSET", jobKey, "failedReason", failedReason, "finishedOn", timestamp)
+        rcall("XADD", eventsKey, "*", "event", "failed", "jobId", jobId, "failedReason", failedReason, "prev", "active")
+
+        local rawOpts = rcall("HGET", jobKey, "opts")
+        if rawOpts then
+          local ok, opts = pcall(cjson.decode, rawOpts)
+          if ok and type(opts) == "table" then
+            removeFailedJobs(jobId, opts)
+          end
+        end
+
+        movedToFailed[#movedToFailed + 1] = jobId
+      else
+        local priority = tonumber(rcall("HGET", jobKey, "priority") or 0)
+
+        -- Stalled jobs go to the front of the queue so they are picked up next
+        if priority > 0 then
+          local counter = rcall("INCR", prefix .. ":pc")
+          rcall("ZADD", prefix .. ":prioritized", priority * 0x100000000 + counter % 0x100000000, jobId)
+        elseif isPaused then
+          rcall("RPUSH", prefix .. ":paused", jobId)
+        else
+          rcall("RPUSH", prefix .. ":wait", jobId)
+        end
+
+        if not isPaused then
+          rcall("ZADD", prefix .. ":marker", 0, "0")
+        end
+
+        rcall("XADD", eventsKey, "*", "event", "waiting", "jobId", jobId, "prev", "active")
+        rcall("XADD", eventsKey, "*", "event", "stalled", "jobId", jobId)
+
+        movedToWait[#movedToWait + 1] = jobId
+      end
+    end
+  end
+end
+
+return {movedToWait, movedToFailed}
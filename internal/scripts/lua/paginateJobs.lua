@@ -1,16 +1,158 @@
-local prefix = ARGV[1]
-local queue = ARGV[2]
-local state = ARGV[3]
-local start = ARGV[4]
-local stop = ARGV[5]
+--[[
+  Returns a page of the job ids of a state. Pages of sorted sets are ordered by score then member,
+  pages of lists by position from the head, where jobs are pushed.
+  The cursor is the position and member of the last job of the previous page, the page holds the jobs
+  following it, so jobs changing state between calls don't shift the page.
+
+  Input:
+    KEYS[1] 'stateKey' - State key (e.g., 'bull:myqueue:completed')
+
+    ARGV[1] order - 'asc' or 'desc'
+    ARGV[2] min - Lowest score to return (sorted sets only, e.g., '-inf')
+    ARGV[3] max - Highest score to return (sorted sets only, e.g., '+inf')
+    ARGV[4] direction - 'next' to return the jobs after the cursor, 'prev' for those before it
+    ARGV[5] position - Score or list index of the cursor job, empty to start from the first job
+    ARGV[6] member - Id of the cursor job
+    ARGV[7] limit - Maximum number of jobs to return
+
+  Output:
+    { total, hasPrev, hasNext, jobId1, position1, jobId2, position2, ... }
+    where total is the number of jobs of the state within min and max
+]]
 
-local results = {}
 local rcall = redis.call
-local key = prefix ":" .. queue .. ":" .. state
-local total_count = rcall('ZCARD', key)
-local revrange_result = rcall('ZREVRANGE', key, start, stop)
+local key = KEYS[1]
+local order = ARGV[1]
+local min = ARGV[2]
+local max = ARGV[3]
+local forward = ARGV[4] ~= "prev"
+local cursorPosition = ARGV[5]
+local cursorMember = ARGV[6]
+local limit = tonumber(ARGV[7])
+
+local keyType = rcall("TYPE", key)["ok"]
+
+-- Returns up to count { jobId, position, ... } strictly after position/member in the given order,
+-- from the first job when position is empty
+local function zsetAfter(position, member, ascending, count)
+  if position == "" then
+    if ascending then
+      return rcall("ZRANGEBYSCORE", key, min, max, "WITHSCORES", "LIMIT", 0, count)
+    end
+    return rcall("ZREVRANGEBYSCORE", key, max, min, "WITHSCORES", "LIMIT", 0, count)
+  end
+
+  -- Jobs sharing the cursor score are ordered by member, those up to the cursor member are skipped
+  local skip = 0
+  for _, tie in ipairs(rcall("ZRANGEBYSCORE", key, position, position)) do
+    if (ascending and tie <= member) or (not ascending and tie >= member) then
+      skip = skip + 1
+    end
+  end
+
+  if ascending then
+    return rcall("ZRANGEBYSCORE", key, position, max, "WITHSCORES", "LIMIT", skip, count)
+  end
+  return rcall("ZREVRANGEBYSCORE", key, position, min, "WITHSCORES", "LIMIT", skip, count)
+end
+
+-- Descending lists start at the head where the newest jobs are, positions are indexes from the head
+local function listAfter(position, member, ascending, count)
+  local length = rcall("LLEN", key)
+  local index
+
+  if position == "" then
+    index = ascending and length or -1
+  else
+    -- Follow the cursor job when it moved, e.g. when jobs were pushed in front of it
+    index = rcall("LPOS", key, member)
+
+    -- Once it was removed, the jobs behind it moved up one place towards the head
+    if not index then
+      index = tonumber(position)
+      if not ascending then
+        index = index - 1
+      end
+    end
+  end
+
+  local first, last
+  if ascending then
+    first, last = math.max(index - count, 0), index - 1
+  else
+    first, last = index + 1, index + count
+  end
+
+  local items = {}
+
+  if last < first then
+    return items
+  end
+
+  local ids = rcall("LRANGE", key, first, last)
+
+  if ascending then
+    for i = #ids, 1, -1 do
+      items[#items + 1] = ids[i]
+      items[#items + 1] = tostring(first + i - 1)
+    end
+  else
+    for i = 1, #ids do
+      items[#items + 1] = ids[i]
+      items[#items + 1] = tostring(first + i - 1)
+    end
+  end
+
+  return items
+end
+
+local after
+local total = 0
+
+if keyType == "zset" then
+  after = zsetAfter
+  total = rcall("ZCOUNT", key, min, max)
+elseif keyType == "list" then
+  after = listAfter
+  total = rcall("LLEN", key)
+else
+  return {0, 0, 0}
+end
+
+-- Pages before the cursor are read in the opposite order then reversed
+local ascending = (order == "asc") == forward
+local items = after(cursorPosition, cursorMember, ascending, limit + 1)
+local hasMore = #items > limit * 2
+
+local page = {}
+for i = 1, math.min(#items, limit * 2), 2 do
+  page[#page + 1] = {items[i], items[i + 1]}
+end
+
+if not forward then
+  for i = 1, math.floor(#page / 2) do
+    page[i], page[#page - i + 1] = page[#page - i + 1], page[i]
+  end
+end
+
+local hasPrev, hasNext
+
+if #page == 0 then
+  hasPrev = forward and cursorPosition ~= ""
+  hasNext = not forward and cursorPosition ~= ""
+elseif forward then
+  hasNext = hasMore
+  hasPrev = #after(page[1][2], page[1][1], order ~= "asc", 1) > 0
+else
+  hasPrev = hasMore
+  hasNext = #after(page[#page][2], page[#page][1], order == "asc", 1) > 0
+end
+
+local output = {total, hasPrev and 1 or 0, hasNext and 1 or 0}
 
-results['count'] = total_count
-results['jobs'] = revrange_result
+for _, item in ipairs(page) do
+  output[#output + 1] = item[1]
+  output[#output + 1] = item[2]
+end
 
-return results
+return output
@@ -0,0 +1,54 @@
+--[[
+  Pauses a job scheduler. BullMQ has no notion of a paused scheduler so taskboard removes it from the
+  repeat set, keeps its hash untouched, and removes the upcoming delayed job. Paused schedulers are
+  tracked in '<prefix>:taskboard:paused-schedulers' so they can still be listed. Upserting the scheduler
+  from the application adds it back to the repeat set, which resumes it.
+
+  Input:
+    KEYS[1] 'prefix' - Queue prefix (e.g., 'bull:myqueue')
+
+    ARGV[1] schedulerId - The scheduler to pause
+    ARGV[2] jobIdKey - The key used in the ids of the jobs it produces (repeat:<jobIdKey>:<millis>)
+
+  Output:
+    1 if paused
+    2 if it was already paused
+    0 if the scheduler was not found
+
+  Events:
+    'removed' event for the upcoming job
+]]
+
+local rcall = redis.call
+local prefix = KEYS[1]
+local schedulerId = ARGV[1]
+local jobIdKey = ARGV[2]
+
+local repeatKey = prefix .. ":repeat"
+local schedulerKey = repeatKey .. ":" .. schedulerId
+
+if rcall("EXISTS", schedulerKey) == 0 then
+  return 0
+end
+
+local nextMillis = rcall("ZSCORE", repeatKey, schedulerId)
+
+if not nextMillis then
+  if rcall("SISMEMBER", prefix .. ":taskboard:paused-schedulers", schedulerId) == 1 then
+    return 2
+  end
+  return 0
+end
+
+local nextJobId = "repeat:" .. jobIdKey .. ":" .. nextMillis
+local nextJobKey = prefix .. ":" .. nextJobId
+
+if rcall("ZREM", prefix .. ":delayed", nextJobId) == 1 then
+  rcall("DEL", nextJobKey, nextJobKey .. ":logs")
+  rcall("XADD", prefix .. ":events", "*", "event", "removed", "jobId", nextJobId, "prev", "delayed")
+end
+
+rcall("ZREM", repeatKey, schedulerId)
+rcall("SADD", prefix .. ":taskboard:paused-schedulers", schedulerId)
+
+return 1
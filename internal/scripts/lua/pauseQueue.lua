@@ -0,0 +1,51 @@
+--[[
+  Pauses or resumes a queue the same way BullMQ does, workers stop picking jobs from a paused queue
+
+  Input:
+    KEYS[1] 'prefix' - Queue prefix (e.g., 'bull:myqueue')
+
+    ARGV[1] action - 'paused' or 'resumed'
+
+  Output:
+    1 if the queue was paused or resumed
+    2 if it already was
+
+  Events:
+    'paused' or 'resumed' event
+]]
+
+local rcall = redis.call
+local prefix = KEYS[1]
+local action = ARGV[1]
+
+local metaKey = prefix .. ":meta"
+local markerKey = prefix .. ":marker"
+local isPaused = rcall("HEXISTS", metaKey, "paused") == 1
+
+if (action == "paused") == isPaused then
+  return 2
+end
+
+local src, dst = prefix .. ":wait", prefix .. ":paused"
+
+if action == "paused" then
+  rcall("HSET", metaKey, "paused", 1)
+  rcall("DEL", markerKey)
+else
+  src, dst = prefix .. ":paused", prefix .. ":wait"
+  rcall("HDEL", metaKey, "paused")
+end
+
+-- Waiting jobs are kept in the paused list while the queue is paused
+if rcall("EXISTS", src) == 1 then
+  rcall("RENAME", src, dst)
+end
+
+-- Wake up workers when jobs are waiting again
+if action == "resumed" and (rcall("LLEN", dst) > 0 or rcall("ZCARD", prefix .. ":prioritized") > 0) then
+  rcall("ZADD", markerKey, 0, "0")
+end
+
+rcall("XADD", prefix .. ":events", "*", "event", action)
+
+return 1
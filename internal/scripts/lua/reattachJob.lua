@@ -0,0 +1,46 @@
+--[[
+  Puts a job taken out of its state by detachJob back, when copying it to another queue failed.
+  Jobs of list states are put back at the end workers take jobs from.
+
+  Input:
+    KEYS[1] 'prefix' - Queue prefix (e.g., 'bull:emails')
+
+    ARGV[1] jobId - The detached job
+
+  Output:
+    1 if the job was put back
+    0 if the job was not detached
+]]
+
+local rcall = redis.call
+local prefix = KEYS[1]
+local jobId = ARGV[1]
+local jobKey = prefix .. ":" .. jobId
+
+rcall("ZREM", prefix .. ":taskboard:detached", jobId)
+
+local detached = rcall("HGET", jobKey, "taskboardDetached")
+
+if not detached then
+  return 0
+end
+
+detached = cjson.decode(detached)
+
+if detached.state ~= cjson.null then
+  local stateKey = prefix .. ":" .. detached.state
+
+  if detached.score ~= cjson.null then
+    rcall("ZADD", stateKey, detached.score, jobId)
+  else
+    rcall("RPUSH", stateKey, jobId)
+  end
+
+  if detached.state == "wait" or detached.state == "prioritized" then
+    rcall("ZADD", prefix .. ":marker", 0, "0")
+  end
+end
+
+rcall("HDEL", jobKey, "taskboardDetached")
+
+return 1
@@ -0,0 +1,37 @@
+--[[
+  Removes a job taken out of its state by detachJob once it was copied to another queue, the last
+  step of moving a job to a queue in another hash slot. The job is also taken out of any state
+  it was added to meanwhile, e.g. by retrying it, each state being read as the type of its key.
+
+  Input:
+    KEYS[1] 'prefix' - Queue prefix (e.g., 'bull:emails')
+
+    ARGV[1] jobId - The detached job
+
+  Output:
+    1 if the job was removed
+    0 if the job was not detached, e.g. it was put back by reattachJob
+
+  Events:
+    'removed' event
+]]
+
+local rcall = redis.call
+local prefix = KEYS[1]
+local jobId = ARGV[1]
+local jobKey = prefix .. ":" .. jobId
+
+--- @include "removeJobFromState"
+
+rcall("ZREM", prefix .. ":taskboard:detached", jobId)
+
+if rcall("HEXISTS", jobKey, "taskboardDetached") == 0 then
+  return 0
+end
+
+removeJobFromState(prefix, jobId)
+
+rcall("DEL", jobKey, jobKey .. ":logs", jobKey .. ":lock")
+rcall("XADD", prefix .. ":events", "*", "event", "removed", "jobId", jobId)
+
+return 1
@@ -0,0 +1,46 @@
+--[[
+  Removes a job scheduler and the upcoming job it has scheduled
+
+  Input:
+    KEYS[1] 'prefix' - Queue prefix (e.g., 'bull:myqueue')
+
+    ARGV[1] schedulerId - The scheduler to remove
+    ARGV[2] jobIdKey - The key used in the ids of the jobs it produces (repeat:<jobIdKey>:<millis>)
+
+  Output:
+    1 if removed
+    0 if the scheduler was not found
+
+  Events:
+    'removed' event for the upcoming job
+]]
+
+local rcall = redis.call
+local prefix = KEYS[1]
+local schedulerId = ARGV[1]
+local jobIdKey = ARGV[2]
+
+local repeatKey = prefix .. ":repeat"
+local schedulerKey = repeatKey .. ":" .. schedulerId
+
+local nextMillis = rcall("ZSCORE", repeatKey, schedulerId)
+
+if not nextMillis and rcall("EXISTS", schedulerKey) == 0 then
+  return 0
+end
+
+if nextMillis then
+  local nextJobId = "repeat:" .. jobIdKey .. ":" .. nextMillis
+  local nextJobKey = prefix .. ":" .. nextJobId
+
+  if rcall("ZREM", prefix .. ":delayed", nextJobId) == 1 then
+    rcall("DEL", nextJobKey, nextJobKey .. ":logs")
+    rcall("XADD", prefix .. ":events", "*", "event", "removed", "jobId", nextJobId, "prev", "delayed")
+  end
+end
+
+rcall("ZREM", repeatKey, schedulerId)
+rcall("DEL", schedulerKey)
+rcall("SREM", prefix .. ":taskboard:paused-schedulers", schedulerId)
+
+return 1
@@ -0,0 +1,68 @@
+--[[
+  Resumes a job scheduler paused by taskboard by adding it back to the repeat set and scheduling its next job
+
+  Input:
+    KEYS[1] 'prefix' - Queue prefix (e.g., 'bull:myqueue')
+
+    ARGV[1] schedulerId - The scheduler to resume
+    ARGV[2] jobIdKey - The key used in the ids of the jobs it produces (repeat:<jobIdKey>:<millis>)
+    ARGV[3] nextMillis - When the next job should run
+    ARGV[4] opts - JSON encoded options of the next job
+    ARGV[5] timestamp - Current time in milliseconds
+
+  Output:
+    1 if resumed
+    2 if it was not paused
+    0 if the scheduler was not found
+
+  Events:
+    'delayed' event for the next job
+]]
+
+local rcall = redis.call
+local prefix = KEYS[1]
+local schedulerId = ARGV[1]
+local jobIdKey = ARGV[2]
+local nextMillis = tonumber(ARGV[3])
+local opts = ARGV[4]
+local timestamp = tonumber(ARGV[5])
+
+--- @include "addJobToDelayed"
+
+local repeatKey = prefix .. ":repeat"
+local schedulerKey = repeatKey .. ":" .. schedulerId
+
+if rcall("EXISTS", schedulerKey) == 0 then
+  return 0
+end
+
+local pausedKey = prefix .. ":taskboard:paused-schedulers"
+
+-- A scheduler upserted by the application since it was paused is back in the repeat set, it is running
+if rcall("ZSCORE", repeatKey, schedulerId) then
+  rcall("SREM", pausedKey, schedulerId)
+  return 2
+end
+
+if rcall("SISMEMBER", pausedKey, schedulerId) == 0 then
+  return 2
+end
+
+local fields = rcall("HMGET", schedulerKey, "name", "data")
+local jobId = "repeat:" .. jobIdKey .. ":" .. ARGV[3]
+
+rcall("HSET", prefix .. ":" .. jobId,
+  "name", fields[1] or "",
+  "data", fields[2] or "{}",
+  "opts", opts,
+  "timestamp", timestamp,
+  "delay", math.max(nextMillis - timestamp, 0),
+  "priority", 0,
+  "rjk", schedulerId)
+
+addJobToDelayed(prefix, jobId, nextMillis)
+
+rcall("ZADD", repeatKey, nextMillis, schedulerId)
+rcall("SREM", pausedKey, schedulerId)
+
+return 1
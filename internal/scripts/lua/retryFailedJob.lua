@@ -0,0 +1,35 @@
+--[[
+  Retries a failed job the way BullMQ does: its failure is cleared, its attempts start over and it is
+  added back to wait, or to paused when the queue is paused. Jobs that are no longer failed are left
+  as they are.
+
+  Input:
+    KEYS[1] 'prefix' - Queue prefix (e.g., 'bull:myqueue')
+
+    ARGV[1] jobId - The failed job
+
+  Output:
+    1 if the job was retried
+    0 if the job is not failed
+
+  Events:
+    'waiting' event
+]]
+
+local rcall = redis.call
+local prefix = KEYS[1]
+local jobId = ARGV[1]
+local jobKey = prefix .. ":" .. jobId
+
+--- @include "addJobToWait"
+
+if rcall("EXISTS", jobKey) == 0 or rcall("ZREM", prefix .. ":failed", jobId) == 0 then
+  return 0
+end
+
+-- BullMQ 5 stores attemptsMade as atm
+rcall("HDEL", jobKey, "failedReason", "finishedOn", "processedOn", "atm", "attemptsMade")
+
+addJobToWait(prefix, jobId, tonumber(rcall("HGET", jobKey, "priority")) or 0)
+
+return 1
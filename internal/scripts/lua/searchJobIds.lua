@@ -0,0 +1,89 @@
+--[[
+  Evaluates a query against candidate job ids, e.g. those found in the secondary index.
+  Candidates are only returned when they are in one of the given states.
+
+  Input:
+    KEYS[1] 'prefix' - Queue prefix (e.g., 'bull:myqueue')
+
+    ARGV[1] query - JSON encoded expression built by the query package
+    ARGV[2] states - Comma separated states the jobs must be in
+    ARGV[3] limit - Maximum number of matches to return, 0 only counts matches
+    ARGV[4...] jobIds - Candidate job ids, in the order they should be returned
+
+  Output:
+    { consumed, matched, missingCount, missingId1, ..., jobId1, state1, jobId2, state2, ... }
+    where consumed is the number of candidates inspected and missing ids have no job hash anymore
+]]
+
+local rcall = redis.call
+local prefix = KEYS[1]
+local query = cjson.decode(ARGV[1])
+local limit = tonumber(ARGV[3])
+local countOnly = limit == 0
+
+local states = {}
+for state in string.gmatch(ARGV[2], "[^,]+") do
+  states[#states + 1] = {name = state, key = prefix .. ":" .. state, type = rcall("TYPE", prefix .. ":" .. state)["ok"]}
+end
+
+--- @include "evaluateQuery"
+
+local fieldNames = collectQueryFields(query, {}, {})
+
+local function findState(jobId)
+  for _, state in ipairs(states) do
+    if state.type == "zset" then
+      if rcall("ZSCORE", state.key, jobId) then
+        return state.name
+      end
+    elseif state.type == "list" then
+      if rcall("LPOS", state.key, jobId) then
+        return state.name
+      end
+    end
+  end
+
+  return nil
+end
+
+local consumed = 0
+local matched = 0
+local missing = {}
+local results = {}
+
+for i = 4, #ARGV do
+  if not countOnly and matched >= limit then
+    break
+  end
+
+  local jobId = ARGV[i]
+  local jobKey = prefix .. ":" .. jobId
+  consumed = consumed + 1
+
+  if rcall("EXISTS", jobKey) == 0 then
+    missing[#missing + 1] = jobId
+  else
+    local state = findState(jobId)
+
+    if state and evaluateQuery(query, loadQueryJob(jobKey, jobId, state, fieldNames)) then
+      matched = matched + 1
+
+      if not countOnly then
+        results[#results + 1] = jobId
+        results[#results + 1] = state
+      end
+    end
+  end
+end
+
+local output = {consumed, matched, #missing}
+
+for _, jobId in ipairs(missing) do
+  output[#output + 1] = jobId
+end
+
+for _, value in ipairs(results) do
+  output[#output + 1] = value
+end
+
+return output
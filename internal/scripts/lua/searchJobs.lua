@@ -0,0 +1,92 @@
+--[[
+  Scans the jobs of one or more states and returns those matching a query.
+  The scan stops after maxScan jobs so a single call never blocks Redis for long,
+  the returned position is used to continue where it stopped.
+
+  Input:
+    KEYS[1] 'prefix' - Queue prefix (e.g., 'bull:myqueue')
+
+    ARGV[1] query - JSON encoded expression built by the query package
+    ARGV[2] states - Comma separated states to scan, in order
+    ARGV[3] stateIndex - 1-based index of the state to resume from
+    ARGV[4] offset - Position within that state to resume from
+    ARGV[5] limit - Maximum number of matches to return, 0 only counts matches
+    ARGV[6] maxScan - Maximum number of jobs to inspect
+
+  Output:
+    { stateIndex, offset, scanned, matched, jobId1, state1, jobId2, state2, ... }
+    where stateIndex is 0 once every state has been scanned
+]]
+
+local rcall = redis.call
+local prefix = KEYS[1]
+local query = cjson.decode(ARGV[1])
+local stateIndex = tonumber(ARGV[3])
+local offset = tonumber(ARGV[4])
+local limit = tonumber(ARGV[5])
+local maxScan = tonumber(ARGV[6])
+local countOnly = limit == 0
+
+local states = {}
+for state in string.gmatch(ARGV[2], "[^,]+") do
+  states[#states + 1] = state
+end
+
+--- @include "evaluateQuery"
+
+local fieldNames = collectQueryFields(query, {}, {})
+
+local batchSize = 100
+local scanned = 0
+local matched = 0
+local results = {}
+
+while stateIndex <= #states and scanned < maxScan and (countOnly or matched < limit) do
+  local state = states[stateIndex]
+  local stateKey = prefix .. ":" .. state
+  local keyType = rcall("TYPE", stateKey)["ok"]
+  local count = math.min(batchSize, maxScan - scanned)
+  local ids = {}
+
+  -- Newest jobs first: sorted sets by descending score, lists from the head where jobs are pushed
+  if keyType == "zset" then
+    ids = rcall("ZREVRANGE", stateKey, offset, offset + count - 1)
+  elseif keyType == "list" then
+    ids = rcall("LRANGE", stateKey, offset, offset + count - 1)
+  end
+
+  if #ids == 0 then
+    stateIndex = stateIndex + 1
+    offset = 0
+  else
+    for _, jobId in ipairs(ids) do
+      scanned = scanned + 1
+      offset = offset + 1
+
+      if rcall("EXISTS", prefix .. ":" .. jobId) == 1 and evaluateQuery(query, loadQueryJob(prefix .. ":" .. jobId, jobId, state, fieldNames)) then
+        matched = matched + 1
+
+        if not countOnly then
+          results[#results + 1] = jobId
+          results[#results + 1] = state
+
+          if matched >= limit then
+            break
+          end
+        end
+      end
+    end
+  end
+end
+
+if stateIndex > #states then
+  stateIndex = 0
+end
+
+local output = {stateIndex, offset, scanned, matched}
+
+for _, value in ipairs(results) do
+  output[#output + 1] = value
+end
+
+return output
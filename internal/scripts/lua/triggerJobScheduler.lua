@@ -0,0 +1,57 @@
+--[[
+  Adds a one-off job built from a job scheduler's template so it runs immediately.
+  The job is not linked to the scheduler, the regular schedule is left untouched.
+
+  Input:
+    KEYS[1] 'prefix' - Queue prefix (e.g., 'bull:myqueue')
+
+    ARGV[1] schedulerId - The scheduler to trigger
+    ARGV[2] jobId - The id of the job to add
+    ARGV[3] opts - JSON encoded options of the job
+    ARGV[4] timestamp - Current time in milliseconds
+    ARGV[5] priority - Priority of the job (0 for none)
+
+  Output:
+    1 if the job was added
+    0 if the scheduler was not found
+    -1 if a job with the same id already exists
+
+  Events:
+    'waiting' event
+]]
+
+local rcall = redis.call
+local prefix = KEYS[1]
+local schedulerId = ARGV[1]
+local jobId = ARGV[2]
+local opts = ARGV[3]
+local timestamp = tonumber(ARGV[4])
+local priority = tonumber(ARGV[5])
+
+--- @include "addJobToWait"
+
+local schedulerKey = prefix .. ":repeat:" .. schedulerId
+
+if rcall("EXISTS", schedulerKey) == 0 then
+  return 0
+end
+
+local jobKey = prefix .. ":" .. jobId
+
+if rcall("EXISTS", jobKey) == 1 then
+  return -1
+end
+
+local fields = rcall("HMGET", schedulerKey, "name", "data")
+
+rcall("HSET", jobKey,
+  "name", fields[1] or "",
+  "data", fields[2] or "{}",
+  "opts", opts,
+  "timestamp", timestamp,
+  "delay", 0,
+  "priority", priority)
+
+addJobToWait(prefix, jobId, priority)
+
+return 1
@@ -3,11 +3,19 @@ package scripts
 import (
 	"context"
 	"embed"
+	"errors"
 	"fmt"
+	"log/slog"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/redis/go-redis/v9"
+	"github.com/wolzey/taskboard/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Scripts struct {
@@ -15,10 +23,29 @@ type Scripts struct {
 	client  *redis.Client
 }
 
+// Queue is a BullMQ queue, the keys of its structures start with its prefix and name, e.g. bull:emails:wait
+type Queue struct {
+	Prefix string
+	// Name is the key of the queue when Prefix is empty, e.g. for the parents of flow jobs under other prefixes
+	Name string
+}
+
+// Key is the key of the queue, or that of one of its structures when parts are given
+func (q Queue) Key(parts ...string) string {
+	if q.Prefix == "" {
+		return strings.Join(append([]string{q.Name}, parts...), ":")
+	}
+
+	return strings.Join(append([]string{q.Prefix, q.Name}, parts...), ":")
+}
+
 //go:embed lua/*.lua
 //go:embed lua/includes/*.lua
 var scriptFiles embed.FS
 
+// includePattern matches lines such as `--- @include "addJobToWait"` which are replaced by lua/includes/addJobToWait.lua
+var includePattern = regexp.MustCompile(`(?m)^--- @include "([\w-]+)"\s*$`)
+
 func LoadScripts(client *redis.Client) (*Scripts, error) {
 	sc := &Scripts{
 		scripts: make(map[string]*redis.Script),
@@ -35,8 +62,14 @@ func LoadScripts(client *redis.Client) (*Scripts, error) {
 				return nil, fmt.Errorf("failed to read %s: %v", entry.Name(), err)
 			}
 
+			source, err := resolveIncludes(string(content))
+
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve includes for %s: %v", entry.Name(), err)
+			}
+
 			name := strings.TrimSuffix(entry.Name(), ".lua")
-			script := redis.NewScript(string(content))
+			script := redis.NewScript(source)
 			sc.scripts[name] = script
 		}
 	}
@@ -44,10 +77,45 @@ func LoadScripts(client *redis.Client) (*Scripts, error) {
 	return sc, nil
 }
 
+// resolveIncludes inlines the helpers a script includes, each helper is only inlined once.
+// Helpers may include other helpers, those are inlined before them.
+func resolveIncludes(source string) (string, error) {
+	return resolveIncludesOnce(source, make(map[string]bool))
+}
+
+func resolveIncludesOnce(source string, included map[string]bool) (string, error) {
+	var resolveErr error
+	resolved := includePattern.ReplaceAllStringFunc(source, func(line string) string {
+		name := includePattern.FindStringSubmatch(line)[1]
+
+		if included[name] || resolveErr != nil {
+			return ""
+		}
+		included[name] = true
+
+		content, err := scriptFiles.ReadFile(filepath.Join("lua", "includes", name+".lua"))
+
+		if err != nil {
+			resolveErr = err
+			return ""
+		}
+
+		helper, err := resolveIncludesOnce(string(content), included)
+
+		if err != nil {
+			resolveErr = err
+			return ""
+		}
+
+		return helper
+	})
+
+	return resolved, resolveErr
+}
+
 func (s *Scripts) GetQueues(ctx context.Context, prefix string) ([]string, error) {
-	script := s.scripts["getQueues"]
 	args := []any{fmt.Sprintf("%s*", prefix), "0", "100"}
-	cmd := script.Run(ctx, s.client, []string{}, args...)
+	cmd := s.run(ctx, "getQueues", "", []string{}, args...)
 
 	if cmd.Err() != nil {
 		return nil, cmd.Err()
@@ -66,16 +134,14 @@ func (s *Scripts) GetQueues(ctx context.Context, prefix string) ([]string, error
 	return res, nil
 }
 
-func (s *Scripts) GetJobCounts(ctx context.Context, queue string, states []string) ([]int64, error) {
-	script := s.scripts["getCounts"]
-
+func (s *Scripts) GetJobCounts(ctx context.Context, queue Queue, states []string) ([]int64, error) {
 	args := make([]any, len(states))
 
 	for i, state := range states {
 		args[i] = state
 	}
 
-	cmd := script.Run(ctx, s.client, []string{queue}, args...)
+	cmd := s.run(ctx, "getCounts", queue.Name, []string{queue.Key()}, args...)
 
 	if cmd.Err() != nil {
 		return nil, cmd.Err()
@@ -84,22 +150,77 @@ func (s *Scripts) GetJobCounts(ctx context.Context, queue string, states []strin
 	ret, err := cmd.Int64Slice()
 
 	if err != nil {
-		fmt.Printf("Unexpected return type: %v", err)
+		slog.ErrorContext(ctx, "scripts: unexpected return type of getCounts", "error", err)
 		return nil, err
 	}
 
 	return ret, nil
 }
 
-type PaginatedJobOptions struct {
-	Start int64
-	Stop  int64
-	State string
+type PageOptions struct {
+	// Order is asc or desc
+	Order string
+	// Min and Max bound the scores of sorted sets, e.g. -inf and +inf
+	Min string
+	Max string
+	// Prev returns the jobs before the cursor instead of those after it
+	Prev bool
+	// Position and Member are the cursor, an empty Position starts from the first job
+	Position string
+	Member   string
+	Limit    int64
+}
+
+type PagedJob struct {
+	ID string
+	// Position is the score of the job in sorted sets, its index in lists
+	Position string
 }
 
-type PaginatedJobResponse struct {
-	Count   int64 `redis:"count"`
-	Results []any `redis:"results"`
+type JobPage struct {
+	Total   int64
+	HasPrev bool
+	HasNext bool
+	Jobs    []PagedJob
+}
+
+// PaginateJobs returns a page of the job ids of a state, read from the sorted set or list holding them
+func (s *Scripts) PaginateJobs(ctx context.Context, queue Queue, state string, opts PageOptions) (*JobPage, error) {
+	direction := "next"
+	if opts.Prev {
+		direction = "prev"
+	}
+
+	cmd := s.run(ctx, "paginateJobs", queue.Name, []string{queue.Key(state)}, opts.Order, opts.Min, opts.Max, direction, opts.Position, opts.Member, opts.Limit)
+
+	if cmd.Err() != nil {
+		return nil, cmd.Err()
+	}
+
+	res, err := cmd.Slice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get script result: %w", err)
+	}
+
+	if len(res) < 3 {
+		return nil, fmt.Errorf("unexpected script result length %d", len(res))
+	}
+
+	page := &JobPage{
+		Total:   res[0].(int64),
+		HasPrev: res[1].(int64) == 1,
+		HasNext: res[2].(int64) == 1,
+		Jobs:    []PagedJob{},
+	}
+
+	for i := 3; i+1 < len(res); i += 2 {
+		page.Jobs = append(page.Jobs, PagedJob{
+			ID:       res[i].(string),
+			Position: res[i+1].(string),
+		})
+	}
+
+	return page, nil
 }
 
 // PromoteJob promotes a job from a given state to the wait queue
@@ -107,10 +228,8 @@ type PaginatedJobResponse struct {
 //   1 if successful
 //   0 if job not found in the specified state
 //   -1 if invalid state
-func (s *Scripts) PromoteJob(ctx context.Context, queue string, jobId string, fromState string) (int64, error) {
-	script := s.scripts["promoteJob"]
-
-	cmd := script.Run(ctx, s.client, []string{queue}, jobId, fromState)
+func (s *Scripts) PromoteJob(ctx context.Context, queue Queue, jobId string, fromState string) (int64, error) {
+	cmd := s.run(ctx, "promoteJob", queue.Name, []string{queue.Key()}, jobId, fromState)
 
 	if cmd.Err() != nil {
 		return 0, cmd.Err()
@@ -124,14 +243,287 @@ func (s *Scripts) PromoteJob(ctx context.Context, queue string, jobId string, fr
 	return result, nil
 }
 
+// RetryFailedJob moves a failed job back to wait, clearing its failure and attempts
+// Returns:
+//   1 if the job was retried
+//   0 if the job is not failed
+func (s *Scripts) RetryFailedJob(ctx context.Context, queue Queue, jobId string) (int64, error) {
+	return s.runInt64(ctx, "retryFailedJob", queue.Name, []string{queue.Key()}, jobId)
+}
+
+// DeleteFailedJob deletes a job only if it is failed
+// Returns:
+//   1 if the job was deleted
+//   0 if the job is not failed
+func (s *Scripts) DeleteFailedJob(ctx context.Context, queue Queue, jobId string) (int64, error) {
+	return s.runInt64(ctx, "deleteFailedJob", queue.Name, []string{queue.Key()}, jobId)
+}
+
 // DeleteJob deletes a job from the queue
 // Returns:
 //   1 if successful (job deleted)
 //   0 if job not found
-func (s *Scripts) DeleteJob(ctx context.Context, queue string, jobId string) (int64, error) {
-	script := s.scripts["deleteJob"]
+func (s *Scripts) DeleteJob(ctx context.Context, queue Queue, jobId string) (int64, error) {
+	cmd := s.run(ctx, "deleteJob", queue.Name, []string{queue.Key()}, jobId)
+
+	if cmd.Err() != nil {
+		return 0, cmd.Err()
+	}
+
+	result, err := cmd.Int64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get script result: %w", err)
+	}
+
+	return result, nil
+}
 
-	cmd := script.Run(ctx, s.client, []string{queue}, jobId)
+type JobLogLine struct {
+	Index int64
+	Line  string
+}
+
+type JobLogs struct {
+	Total   int64
+	Matched int64
+	Lines   []JobLogLine
+}
+
+// ErrJobNotFound is returned by scripts that operate on a single job when its hash does not exist
+var ErrJobNotFound = errors.New("job not found")
+
+// GetJobLogs reads a page of the logs stored for a job
+// Only lines with an index greater than after are considered, which allows tailing with the last seen index.
+// When search is not empty only lines containing it (case-insensitive) are matched.
+// Returns ErrJobNotFound if the job does not exist
+func (s *Scripts) GetJobLogs(ctx context.Context, queue Queue, jobId string, after int64, offset int64, limit int64, search string) (*JobLogs, error) {
+	cmd := s.run(ctx, "getJobLogs", queue.Name, []string{queue.Key()}, jobId, after, offset, limit, search)
+
+	if cmd.Err() != nil {
+		if errors.Is(cmd.Err(), redis.Nil) {
+			return nil, ErrJobNotFound
+		}
+		return nil, cmd.Err()
+	}
+
+	res, err := cmd.Slice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get script result: %w", err)
+	}
+
+	if len(res) < 2 {
+		return nil, fmt.Errorf("unexpected script result length %d", len(res))
+	}
+
+	logs := &JobLogs{
+		Total:   res[0].(int64),
+		Matched: res[1].(int64),
+		Lines:   make([]JobLogLine, 0, (len(res)-2)/2),
+	}
+
+	for i := 2; i+1 < len(res); i += 2 {
+		logs.Lines = append(logs.Lines, JobLogLine{
+			Index: res[i].(int64),
+			Line:  res[i+1].(string),
+		})
+	}
+
+	return logs, nil
+}
+
+type FlowNode struct {
+	Name      string
+	State     string
+	ParentKey string
+	// Child job keys grouped by how far along they are
+	Pending      []string
+	Processed    []string
+	Failed       []string
+	Unsuccessful []string
+}
+
+// GetFlowNode reads a job's state, parent and children as stored by BullMQ flows
+// Returns ErrJobNotFound if the job does not exist
+func (s *Scripts) GetFlowNode(ctx context.Context, queue Queue, jobId string) (*FlowNode, error) {
+	cmd := s.run(ctx, "getFlowNode", queue.Name, []string{queue.Key()}, jobId)
+
+	if cmd.Err() != nil {
+		if errors.Is(cmd.Err(), redis.Nil) {
+			return nil, ErrJobNotFound
+		}
+		return nil, cmd.Err()
+	}
+
+	res, err := cmd.Slice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get script result: %w", err)
+	}
+
+	if len(res) != 7 {
+		return nil, fmt.Errorf("unexpected script result length %d", len(res))
+	}
+
+	return &FlowNode{
+		Name:         res[0].(string),
+		State:        res[1].(string),
+		ParentKey:    res[2].(string),
+		Pending:      toStringSlice(res[3]),
+		Processed:    toStringSlice(res[4]),
+		Failed:       toStringSlice(res[5]),
+		Unsuccessful: toStringSlice(res[6]),
+	}, nil
+}
+
+func toStringSlice(v any) []string {
+	items, _ := v.([]any)
+	res := make([]string, 0, len(items))
+
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			res = append(res, s)
+		}
+	}
+
+	return res
+}
+
+type JobScheduler struct {
+	ID string
+	// NextMillis is empty when the scheduler is not in the repeat set, e.g. when it is paused
+	NextMillis string
+	Fields     map[string]string
+	// Paused is set for schedulers paused by taskboard that were not upserted since
+	Paused bool
+}
+
+type JobSchedulers struct {
+	Schedulers []JobScheduler
+	// RecentJobs maps the ids of recently produced repeat jobs to their state
+	RecentJobs map[string]string
+}
+
+// GetJobSchedulers lists the job schedulers of a queue, or only schedulerId when it is not empty.
+// The window most recent jobs of each state are inspected to find the jobs they produced.
+func (s *Scripts) GetJobSchedulers(ctx context.Context, queue Queue, schedulerId string, window int64) (*JobSchedulers, error) {
+	cmd := s.run(ctx, "getJobSchedulers", queue.Name, []string{queue.Key()}, schedulerId, window)
+
+	if cmd.Err() != nil {
+		return nil, cmd.Err()
+	}
+
+	res, err := cmd.Slice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get script result: %w", err)
+	}
+
+	if len(res) != 2 {
+		return nil, fmt.Errorf("unexpected script result length %d", len(res))
+	}
+
+	result := &JobSchedulers{RecentJobs: make(map[string]string)}
+
+	entries, _ := res[0].([]any)
+	for _, entry := range entries {
+		values, _ := entry.([]any)
+		if len(values) != 4 {
+			continue
+		}
+
+		fields := toStringSlice(values[2])
+		scheduler := JobScheduler{
+			ID:         values[0].(string),
+			NextMillis: values[1].(string),
+			Fields:     make(map[string]string, len(fields)/2),
+			Paused:     values[3] == int64(1),
+		}
+
+		for i := 0; i+1 < len(fields); i += 2 {
+			scheduler.Fields[fields[i]] = fields[i+1]
+		}
+
+		result.Schedulers = append(result.Schedulers, scheduler)
+	}
+
+	recent := toStringSlice(res[1])
+	for i := 0; i+1 < len(recent); i += 2 {
+		result.RecentJobs[recent[i]] = recent[i+1]
+	}
+
+	return result, nil
+}
+
+// PauseJobScheduler stops a scheduler from producing jobs until it is resumed
+// Returns:
+//   1 if paused
+//   2 if it was already paused
+//   0 if the scheduler was not found
+func (s *Scripts) PauseJobScheduler(ctx context.Context, queue Queue, schedulerId string, jobIdKey string) (int64, error) {
+	return s.runInt64(ctx, "pauseJobScheduler", queue.Name, []string{queue.Key()}, schedulerId, jobIdKey)
+}
+
+// ResumeJobScheduler resumes a paused scheduler, scheduling its next job at nextMillis
+// Returns:
+//   1 if resumed
+//   2 if it was not paused
+//   0 if the scheduler was not found
+func (s *Scripts) ResumeJobScheduler(ctx context.Context, queue Queue, schedulerId string, jobIdKey string, nextMillis int64, opts string, timestamp int64) (int64, error) {
+	return s.runInt64(ctx, "resumeJobScheduler", queue.Name, []string{queue.Key()}, schedulerId, jobIdKey, nextMillis, opts, timestamp)
+}
+
+// TriggerJobScheduler adds a one-off job using the scheduler's template
+// Returns:
+//   1 if the job was added
+//   0 if the scheduler was not found
+//   -1 if a job with the same id already exists
+func (s *Scripts) TriggerJobScheduler(ctx context.Context, queue Queue, schedulerId string, jobId string, opts string, timestamp int64, priority int64) (int64, error) {
+	return s.runInt64(ctx, "triggerJobScheduler", queue.Name, []string{queue.Key()}, schedulerId, jobId, opts, timestamp, priority)
+}
+
+// RemoveJobScheduler removes a scheduler and its upcoming job
+// Returns:
+//   1 if removed
+//   0 if the scheduler was not found
+func (s *Scripts) RemoveJobScheduler(ctx context.Context, queue Queue, schedulerId string, jobIdKey string) (int64, error) {
+	return s.runInt64(ctx, "removeJobScheduler", queue.Name, []string{queue.Key()}, schedulerId, jobIdKey)
+}
+
+// PauseQueue pauses a queue, or resumes it when pause is false
+// Returns:
+//   1 if paused or resumed
+//   2 if the queue already was
+func (s *Scripts) PauseQueue(ctx context.Context, queue Queue, pause bool) (int64, error) {
+	action := "resumed"
+	if pause {
+		action = "paused"
+	}
+
+	return s.runInt64(ctx, "pauseQueue", queue.Name, []string{queue.Key()}, action)
+}
+
+// run runs a script in a span named after it when traced, queue is the name of the queue it works on, empty
+// when there is none
+func (s *Scripts) run(ctx context.Context, name string, queue string, keys []string, args ...any) *redis.Cmd {
+	attrs := []attribute.KeyValue{semconv.DBSystemNameRedis, attribute.String("taskboard.script", name)}
+
+	if queue != "" {
+		attrs = append(attrs, attribute.String("taskboard.queue", queue))
+	}
+
+	ctx, span := tracing.StartChild(ctx, "script "+name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	defer span.End()
+
+	cmd := s.scripts[name].Run(ctx, s.client, keys, args...)
+
+	if err := cmd.Err(); err != nil && err != redis.Nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return cmd
+}
+
+func (s *Scripts) runInt64(ctx context.Context, name string, queue string, keys []string, args ...any) (int64, error) {
+	cmd := s.run(ctx, name, queue, keys, args...)
 
 	if cmd.Err() != nil {
 		return 0, cmd.Err()
@@ -144,3 +536,292 @@ func (s *Scripts) DeleteJob(ctx context.Context, queue string, jobId string) (in
 
 	return result, nil
 }
+
+type StalledJob struct {
+	ID             string
+	StalledCounter int64
+}
+
+// GetStalledJobs returns the active jobs of a queue whose lock has expired
+func (s *Scripts) GetStalledJobs(ctx context.Context, queue Queue) ([]StalledJob, error) {
+	cmd := s.run(ctx, "getStalledJobs", queue.Name, []string{queue.Key()})
+
+	if cmd.Err() != nil {
+		return nil, cmd.Err()
+	}
+
+	res, err := cmd.Slice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get script result: %w", err)
+	}
+
+	jobs := make([]StalledJob, 0, len(res)/2)
+
+	for i := 0; i+1 < len(res); i += 2 {
+		jobs = append(jobs, StalledJob{
+			ID:             res[i].(string),
+			StalledCounter: res[i+1].(int64),
+		})
+	}
+
+	return jobs, nil
+}
+
+// MoveStalledJobs moves stalled jobs back to wait, or to failed once they stalled more than maxStalledCount times
+// Returns the ids moved to wait and the ids moved to failed, jobs that are not stalled are skipped
+func (s *Scripts) MoveStalledJobs(ctx context.Context, queue Queue, maxStalledCount int64, timestamp int64, jobIds []string) ([]string, []string, error) {
+	args := make([]any, 0, len(jobIds)+2)
+	args = append(args, maxStalledCount, timestamp)
+
+	for _, id := range jobIds {
+		args = append(args, id)
+	}
+
+	cmd := s.run(ctx, "moveStalledJobs", queue.Name, []string{queue.Key()}, args...)
+
+	if cmd.Err() != nil {
+		return nil, nil, cmd.Err()
+	}
+
+	res, err := cmd.Slice()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get script result: %w", err)
+	}
+
+	if len(res) != 2 {
+		return nil, nil, fmt.Errorf("unexpected script result length %d", len(res))
+	}
+
+	return toStringSlice(res[0]), toStringSlice(res[1]), nil
+}
+
+// SearchPosition is where a search stopped scanning, StateIndex is 1-based and 0 once every state was scanned
+type SearchPosition struct {
+	StateIndex int64
+	Offset     int64
+}
+
+type SearchMatch struct {
+	ID    string
+	State string
+}
+
+type SearchResult struct {
+	Next    SearchPosition
+	Scanned int64
+	Matched int64
+	Jobs    []SearchMatch
+}
+
+// SearchJobs scans the jobs of states starting at pos and returns up to limit jobs matching the JSON encoded query.
+// At most maxScan jobs are inspected per call, a limit of 0 only counts matches.
+func (s *Scripts) SearchJobs(ctx context.Context, queue Queue, query string, states []string, pos SearchPosition, limit int64, maxScan int64) (*SearchResult, error) {
+	cmd := s.run(ctx, "searchJobs", queue.Name, []string{queue.Key()}, query, strings.Join(states, ","), pos.StateIndex, pos.Offset, limit, maxScan)
+
+	if cmd.Err() != nil {
+		return nil, cmd.Err()
+	}
+
+	res, err := cmd.Slice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get script result: %w", err)
+	}
+
+	if len(res) < 4 {
+		return nil, fmt.Errorf("unexpected script result length %d", len(res))
+	}
+
+	result := &SearchResult{
+		Next: SearchPosition{
+			StateIndex: res[0].(int64),
+			Offset:     res[1].(int64),
+		},
+		Scanned: res[2].(int64),
+		Matched: res[3].(int64),
+	}
+
+	for i := 4; i+1 < len(res); i += 2 {
+		result.Jobs = append(result.Jobs, SearchMatch{
+			ID:    res[i].(string),
+			State: res[i+1].(string),
+		})
+	}
+
+	return result, nil
+}
+
+type CandidateSearchResult struct {
+	// Consumed is the number of candidates inspected, the next call continues after them
+	Consumed int64
+	Matched  int64
+	// Missing are candidates whose job no longer exists
+	Missing []string
+	Jobs    []SearchMatch
+}
+
+// SearchJobIds evaluates the JSON encoded query against candidate job ids and returns up to limit matches
+// in the order of the candidates. Only jobs in one of the states match, a limit of 0 only counts matches.
+func (s *Scripts) SearchJobIds(ctx context.Context, queue Queue, query string, states []string, jobIds []string, limit int64) (*CandidateSearchResult, error) {
+	args := []any{query, strings.Join(states, ","), limit}
+	for _, jobId := range jobIds {
+		args = append(args, jobId)
+	}
+
+	cmd := s.run(ctx, "searchJobIds", queue.Name, []string{queue.Key()}, args...)
+
+	if cmd.Err() != nil {
+		return nil, cmd.Err()
+	}
+
+	res, err := cmd.Slice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get script result: %w", err)
+	}
+
+	if len(res) < 3 {
+		return nil, fmt.Errorf("unexpected script result length %d", len(res))
+	}
+
+	result := &CandidateSearchResult{
+		Consumed: res[0].(int64),
+		Matched:  res[1].(int64),
+	}
+
+	missing := int(res[2].(int64))
+
+	if len(res) < 3+missing {
+		return nil, fmt.Errorf("unexpected script result length %d", len(res))
+	}
+
+	result.Missing = toStringSlice(res[3 : 3+missing])
+
+	for i := 3 + missing; i+1 < len(res); i += 2 {
+		result.Jobs = append(result.Jobs, SearchMatch{
+			ID:    res[i].(string),
+			State: res[i+1].(string),
+		})
+	}
+
+	return result, nil
+}
+
+// MoveJob adds a job of the source queue to the target queue as a fresh waiting job, along with its logs,
+// and removes it from the source queue unless copy is set. Both queues must share a hash slot.
+// An empty newJobId takes the next id of the target queue.
+// Returns the id of the new job and:
+//   1 if moved or copied
+//   0 if the job was not found
+//   -1 if the job is active
+//   -2 if the job belongs to a flow
+//   -3 if the target queue already has a job with newJobId
+//   -4 if the job is being moved to a queue in another hash slot
+func (s *Scripts) MoveJob(ctx context.Context, source Queue, target Queue, jobId string, newJobId string, copy bool, timestamp int64) (int64, string, error) {
+	copyArg := "0"
+	if copy {
+		copyArg = "1"
+	}
+
+	cmd := s.run(ctx, "moveJob", source.Name, []string{source.Key(), target.Key()}, jobId, newJobId, copyArg, timestamp)
+
+	if cmd.Err() != nil {
+		return 0, "", cmd.Err()
+	}
+
+	res, err := cmd.Slice()
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to get script result: %w", err)
+	}
+
+	if len(res) == 2 {
+		return res[0].(int64), res[1].(string), nil
+	}
+
+	return res[0].(int64), "", nil
+}
+
+// JobCopy holds what is copied from a job into another queue
+type JobCopy struct {
+	Name     string
+	Data     string
+	Opts     string
+	Priority int64
+	Logs     []string
+}
+
+// DetachJob takes a job out of its state while it is copied to a queue in another hash slot,
+// ReattachJob puts it back and RemoveDetachedJob removes it once copied. With copy set, the job
+// is only read and stays in its state.
+// Returns the job along with the same codes as MoveJob.
+func (s *Scripts) DetachJob(ctx context.Context, queue Queue, jobId string, copy bool, timestamp int64) (int64, *JobCopy, error) {
+	copyArg := "0"
+	if copy {
+		copyArg = "1"
+	}
+
+	cmd := s.run(ctx, "detachJob", queue.Name, []string{queue.Key()}, jobId, copyArg, timestamp)
+
+	if cmd.Err() != nil {
+		return 0, nil, cmd.Err()
+	}
+
+	res, err := cmd.Slice()
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get script result: %w", err)
+	}
+
+	if len(res) < 6 {
+		return res[0].(int64), nil, nil
+	}
+
+	return res[0].(int64), &JobCopy{
+		Name:     res[1].(string),
+		Data:     res[2].(string),
+		Opts:     res[3].(string),
+		Priority: res[4].(int64),
+		Logs:     toStringSlice(res[5]),
+	}, nil
+}
+
+// ReattachJob puts a job taken out of its state by DetachJob back
+// Returns:
+//   1 if the job was put back
+//   0 if the job was not detached
+func (s *Scripts) ReattachJob(ctx context.Context, queue Queue, jobId string) (int64, error) {
+	return s.runInt64(ctx, "reattachJob", queue.Name, []string{queue.Key()}, jobId)
+}
+
+// RemoveDetachedJob removes a job taken out of its state by DetachJob once it was copied
+// Returns:
+//   1 if the job was removed
+//   0 if the job was not detached
+func (s *Scripts) RemoveDetachedJob(ctx context.Context, queue Queue, jobId string) (int64, error) {
+	return s.runInt64(ctx, "removeDetachedJob", queue.Name, []string{queue.Key()}, jobId)
+}
+
+// CopyJob adds a job copied from another queue as a fresh waiting job, an empty jobId takes the next id of the queue
+// Returns the id of the new job and:
+//   1 if the job was added
+//   -3 if a job with the same id already exists
+func (s *Scripts) CopyJob(ctx context.Context, queue Queue, jobId string, job *JobCopy, timestamp int64) (int64, string, error) {
+	args := []any{jobId, job.Name, job.Data, job.Opts, job.Priority, timestamp}
+	for _, line := range job.Logs {
+		args = append(args, line)
+	}
+
+	cmd := s.run(ctx, "copyJob", queue.Name, []string{queue.Key()}, args...)
+
+	if cmd.Err() != nil {
+		return 0, "", cmd.Err()
+	}
+
+	res, err := cmd.Slice()
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to get script result: %w", err)
+	}
+
+	if len(res) == 2 {
+		return res[0].(int64), res[1].(string), nil
+	}
+
+	return res[0].(int64), "", nil
+}
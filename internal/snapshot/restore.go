@@ -0,0 +1,427 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrCollision is returned when jobs of the snapshot already exist in the target queue and aren't remapped
+var ErrCollision = errors.New("job ids already exist")
+
+type RestoreOptions struct {
+	// Prefix and Queue are where the snapshot is restored, those of the snapshot by default
+	Prefix string
+	Queue  string
+	// Remap gives jobs whose id is taken in the target queue a new id, restoring fails otherwise
+	Remap bool
+	// DryRun only reports what restoring would change
+	DryRun bool
+}
+
+type JobChange struct {
+	ID    string
+	State string
+	// Exists is set when the target queue already has a job with this id
+	Exists bool
+	// NewID is the id the job was remapped to, it is empty on dry runs
+	NewID string
+}
+
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+type SchedulerChange struct {
+	ID     string
+	Exists bool
+	Paused bool
+}
+
+// Report lists what a restore changes in the target queue
+type Report struct {
+	Header Header
+	// Target is the key of the queue restored into
+	Target     string
+	Jobs       []JobChange
+	Meta       []FieldChange
+	Schedulers []SchedulerChange
+}
+
+// Collisions is the number of jobs whose id is already taken in the target queue
+func (r *Report) Collisions() int {
+	count := 0
+
+	for _, job := range r.Jobs {
+		if job.Exists {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Restore writes a snapshot into a queue. The snapshot is read twice: once to find what it would
+// change, then to write it, so nothing is written when jobs collide and remapping is off.
+func Restore(ctx context.Context, client *redis.Client, src io.ReadSeeker, opts RestoreOptions) (*Report, error) {
+	reader, err := NewReader(src)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Prefix == "" {
+		opts.Prefix = reader.Header.Prefix
+	}
+
+	if opts.Queue == "" {
+		opts.Queue = reader.Header.Queue
+	}
+
+	target := queueKeys(opts.Prefix + ":" + opts.Queue)
+	report, err := plan(ctx, client, reader, target)
+	reader.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.DryRun {
+		return report, nil
+	}
+
+	if collisions := report.Collisions(); collisions > 0 && !opts.Remap {
+		return report, fmt.Errorf("%w: %d jobs of the snapshot are already in %s, restore with remapping to give them new ids", ErrCollision, collisions, target)
+	}
+
+	remap := map[string]string{}
+	// New ids must not be taken by the target queue nor by other jobs of the snapshot
+	taken := make(map[string]bool, len(report.Jobs))
+
+	for _, job := range report.Jobs {
+		taken[job.ID] = true
+	}
+
+	for i, job := range report.Jobs {
+		if !job.Exists {
+			continue
+		}
+
+		if report.Jobs[i].NewID, err = newJobID(ctx, client, target, taken); err != nil {
+			return nil, fmt.Errorf("failed to remap job %s: %w", job.ID, err)
+		}
+
+		remap[job.ID] = report.Jobs[i].NewID
+	}
+
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	if reader, err = NewReader(src); err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	if err := apply(ctx, client, reader, target, remap); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// plan reads the snapshot and compares it with the target queue
+func plan(ctx context.Context, client *redis.Client, reader *Reader, target queueKeys) (*Report, error) {
+	report := &Report{Header: reader.Header, Target: string(target)}
+	var batch []JobChange
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		pipe := client.Pipeline()
+		exists := make([]*redis.IntCmd, len(batch))
+
+		for i, job := range batch {
+			exists[i] = pipe.Exists(ctx, target.key(job.ID))
+		}
+
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+
+		for i := range batch {
+			batch[i].Exists = exists[i].Val() == 1
+		}
+
+		report.Jobs = append(report.Jobs, batch...)
+		batch = nil
+
+		return nil
+	}
+
+	for {
+		record, err := reader.Next()
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid snapshot: %w", err)
+		}
+
+		switch record.Type {
+		case RecordMeta:
+			current, err := client.HGetAll(ctx, target.key("meta")).Result()
+
+			if err != nil {
+				return nil, err
+			}
+
+			for field, value := range record.Fields {
+				if current[field] != value {
+					report.Meta = append(report.Meta, FieldChange{Field: field, Old: current[field], New: value})
+				}
+			}
+		case RecordJob:
+			batch = append(batch, JobChange{ID: record.ID, State: record.State})
+
+			if len(batch) >= batchSize {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+			}
+		case RecordScheduler:
+			exists, err := client.Exists(ctx, target.key("repeat", record.ID)).Result()
+
+			if err != nil {
+				return nil, err
+			}
+
+			if exists == 0 {
+				_, err = client.ZScore(ctx, target.key("repeat"), record.ID).Result()
+
+				if err != nil && !errors.Is(err, redis.Nil) {
+					return nil, err
+				}
+
+				if err == nil {
+					exists = 1
+				}
+			}
+
+			report.Schedulers = append(report.Schedulers, SchedulerChange{ID: record.ID, Exists: exists == 1, Paused: record.Paused})
+		}
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// newJobID takes the next id of the queue counter, the way BullMQ numbers jobs, skipping ids in use
+func newJobID(ctx context.Context, client *redis.Client, target queueKeys, taken map[string]bool) (string, error) {
+	for {
+		next, err := client.Incr(ctx, target.key("id")).Result()
+
+		if err != nil {
+			return "", err
+		}
+
+		id := strconv.FormatInt(next, 10)
+
+		if taken[id] {
+			continue
+		}
+
+		exists, err := client.Exists(ctx, target.key(id)).Result()
+
+		if err != nil {
+			return "", err
+		}
+
+		if exists == 0 {
+			return id, nil
+		}
+	}
+}
+
+// apply writes the records of the snapshot into the target queue
+func apply(ctx context.Context, client *redis.Client, reader *Reader, target queueKeys, remap map[string]string) error {
+	source := reader.Header.Prefix + ":" + reader.Header.Queue
+	pipe := client.Pipeline()
+	pending := 0
+
+	var paused bool
+	var maxID int64
+	var waiting bool
+	nextDelayed := math.Inf(1)
+
+	for {
+		record, err := reader.Next()
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("invalid snapshot: %w", err)
+		}
+
+		switch record.Type {
+		case RecordMeta:
+			_, paused = record.Fields["paused"]
+			pipe.HSet(ctx, target.key("meta"), fieldArgs(record.Fields)...)
+		case RecordJob:
+			id := record.ID
+			if newID, ok := remap[id]; ok {
+				id = newID
+			}
+
+			if num, err := strconv.ParseInt(id, 10, 64); err == nil {
+				maxID = max(maxID, num)
+			}
+
+			fields := rewriteParent(record.Fields, source, target, remap)
+
+			pipe.Del(ctx, target.key(id), target.key(id, "logs"))
+			pipe.HSet(ctx, target.key(id), fieldArgs(fields)...)
+
+			if len(record.Logs) > 0 {
+				logs := make([]any, len(record.Logs))
+				for i, line := range record.Logs {
+					logs[i] = line
+				}
+				pipe.RPush(ctx, target.key(id, "logs"), logs...)
+			}
+
+			// Lists are written in order from the head, appending keeps it
+			if record.Score != nil {
+				pipe.ZAdd(ctx, target.key(record.State), redis.Z{Score: *record.Score, Member: id})
+			} else {
+				pipe.RPush(ctx, target.key(record.State), id)
+			}
+
+			switch record.State {
+			case "wait", "prioritized":
+				waiting = true
+			case "delayed":
+				nextDelayed = math.Min(nextDelayed, *record.Score)
+			}
+		case RecordScheduler:
+			if len(record.Fields) > 0 {
+				pipe.HSet(ctx, target.key("repeat", record.ID), fieldArgs(record.Fields)...)
+			}
+
+			if record.Paused {
+				pipe.SAdd(ctx, target.pausedSchedulers(), record.ID)
+			} else {
+				pipe.ZAdd(ctx, target.key("repeat"), redis.Z{Score: *record.Score, Member: record.ID})
+			}
+		}
+
+		if pending++; pending >= batchSize {
+			if _, err := pipe.Exec(ctx); err != nil {
+				return err
+			}
+			pending = 0
+		}
+	}
+
+	// Wake up workers, delayed jobs are scored by timestamp * 0x1000 plus a counter
+	if !paused && waiting {
+		pipe.ZAdd(ctx, target.key("marker"), redis.Z{Score: 0, Member: "0"})
+	}
+
+	if !paused && !math.IsInf(nextDelayed, 1) {
+		pipe.ZAdd(ctx, target.key("marker"), redis.Z{Score: math.Floor(nextDelayed / 0x1000), Member: "1"})
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	return bumpJobCounter(ctx, client, target, maxID)
+}
+
+// bumpJobCounter makes sure jobs added later don't get the id of a restored job
+func bumpJobCounter(ctx context.Context, client *redis.Client, target queueKeys, maxID int64) error {
+	current, err := client.Get(ctx, target.key("id")).Int64()
+
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+
+	if current >= maxID {
+		return nil
+	}
+
+	return client.Set(ctx, target.key("id"), maxID, 0).Err()
+}
+
+// rewriteParent points jobs whose parent is in the snapshot queue to the restored parent
+func rewriteParent(fields map[string]string, source string, target queueKeys, remap map[string]string) map[string]string {
+	parentKey, hasKey := fields["parentKey"]
+	parentJSON, hasJSON := fields["parent"]
+
+	if !hasKey && !hasJSON {
+		return fields
+	}
+
+	rewritten := make(map[string]string, len(fields))
+	for field, value := range fields {
+		rewritten[field] = value
+	}
+
+	mapID := func(id string) string {
+		if newID, ok := remap[id]; ok {
+			return newID
+		}
+		return id
+	}
+
+	if parentId, ok := strings.CutPrefix(parentKey, source+":"); hasKey && ok {
+		rewritten["parentKey"] = target.key(mapID(parentId))
+	}
+
+	if hasJSON {
+		var parent map[string]any
+
+		if json.Unmarshal([]byte(parentJSON), &parent) == nil && parent["queueKey"] == source {
+			parent["queueKey"] = string(target)
+
+			if id, ok := parent["id"].(string); ok {
+				parent["id"] = mapID(id)
+			}
+
+			if encoded, err := json.Marshal(parent); err == nil {
+				rewritten["parent"] = string(encoded)
+			}
+		}
+	}
+
+	return rewritten
+}
+
+func fieldArgs(fields map[string]string) []any {
+	args := make([]any, 0, 2*len(fields))
+
+	for field, value := range fields {
+		args = append(args, field, value)
+	}
+
+	return args
+}
@@ -0,0 +1,327 @@
+// Package snapshot copies the state of a queue into a file that can be restored into another Redis,
+// e.g. to reproduce a production issue locally.
+//
+// Snapshots are gzip compressed NDJSON: a Header line followed by Record lines holding the queue
+// meta, the job hashes along with their logs and state membership, and the job schedulers.
+// Snapshots aren't atomic, jobs moving while one is taken may be missed or captured twice.
+package snapshot
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	Format = "taskboard-snapshot"
+	// Version is increased whenever the format changes, restore rejects newer snapshots
+	Version = 1
+
+	batchSize = 500
+)
+
+// States can be captured, sorted sets keep their scores, lists their order
+var States = []string{"active", "wait", "prioritized", "paused", "waiting-children", "delayed", "failed", "completed"}
+
+const (
+	RecordMeta      = "meta"
+	RecordJob       = "job"
+	RecordScheduler = "scheduler"
+)
+
+type Header struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	Prefix    string    `json:"prefix"`
+	Queue     string    `json:"queue"`
+	States    []string  `json:"states"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Record is a line following the header, Type tells which fields are set
+type Record struct {
+	Type   string            `json:"type"`
+	ID     string            `json:"id,omitempty"`
+	Fields map[string]string `json:"fields,omitempty"`
+
+	// State is the state a job was in, Score its score when the state is a sorted set.
+	// Jobs of list states are written in list order, from the head.
+	State string   `json:"state,omitempty"`
+	Score *float64 `json:"score,omitempty"`
+	Logs  []string `json:"logs,omitempty"`
+
+	// Paused is set on schedulers paused from taskboard, which are only kept in the paused schedulers set
+	Paused bool `json:"paused,omitempty"`
+}
+
+// Summary counts what a snapshot captured
+type Summary struct {
+	Jobs       map[string]int
+	Schedulers int
+}
+
+// queueKeys builds the keys of a queue
+type queueKeys string
+
+func (q queueKeys) key(parts ...string) string {
+	key := string(q)
+
+	for _, part := range parts {
+		key += ":" + part
+	}
+
+	return key
+}
+
+func (q queueKeys) pausedSchedulers() string {
+	return q.key("taskboard", "paused-schedulers")
+}
+
+// Take writes a snapshot of the given states of a queue to w
+func Take(ctx context.Context, client *redis.Client, prefix string, queue string, states []string, w io.Writer) (*Summary, error) {
+	gz := gzip.NewWriter(w)
+	buf := bufio.NewWriter(gz)
+	enc := json.NewEncoder(buf)
+	keys := queueKeys(prefix + ":" + queue)
+
+	header := Header{Format: Format, Version: Version, Prefix: prefix, Queue: queue, States: states, CreatedAt: time.Now().UTC()}
+
+	if err := enc.Encode(header); err != nil {
+		return nil, err
+	}
+
+	meta, err := client.HGetAll(ctx, keys.key("meta")).Result()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read queue meta: %w", err)
+	}
+
+	if len(meta) == 0 {
+		return nil, fmt.Errorf("queue %s not found", keys)
+	}
+
+	if err := enc.Encode(Record{Type: RecordMeta, Fields: meta}); err != nil {
+		return nil, err
+	}
+
+	summary := &Summary{Jobs: map[string]int{}}
+
+	for _, state := range states {
+		count, err := writeState(ctx, client, keys, state, enc)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to capture %s jobs: %w", state, err)
+		}
+
+		summary.Jobs[state] = count
+	}
+
+	if summary.Schedulers, err = writeSchedulers(ctx, client, keys, enc); err != nil {
+		return nil, fmt.Errorf("failed to capture job schedulers: %w", err)
+	}
+
+	if err := buf.Flush(); err != nil {
+		return nil, err
+	}
+
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+func writeState(ctx context.Context, client *redis.Client, keys queueKeys, state string, enc *json.Encoder) (int, error) {
+	stateKey := keys.key(state)
+
+	keyType, err := client.Type(ctx, stateKey).Result()
+
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+
+	for start := int64(0); ; start += batchSize {
+		var ids []string
+		var scores []*float64
+
+		switch keyType {
+		case "zset":
+			members, err := client.ZRangeWithScores(ctx, stateKey, start, start+batchSize-1).Result()
+
+			if err != nil {
+				return count, err
+			}
+
+			for _, member := range members {
+				score := member.Score
+				ids = append(ids, member.Member.(string))
+				scores = append(scores, &score)
+			}
+		case "list":
+			if ids, err = client.LRange(ctx, stateKey, start, start+batchSize-1).Result(); err != nil {
+				return count, err
+			}
+
+			scores = make([]*float64, len(ids))
+		}
+
+		written, err := writeJobs(ctx, client, keys, state, ids, scores, enc)
+		count += written
+
+		if err != nil {
+			return count, err
+		}
+
+		if len(ids) < batchSize {
+			return count, nil
+		}
+	}
+}
+
+// writeJobs reads the hashes and logs of jobs in a single round trip, jobs removed meanwhile are skipped
+func writeJobs(ctx context.Context, client *redis.Client, keys queueKeys, state string, ids []string, scores []*float64, enc *json.Encoder) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	pipe := client.Pipeline()
+	hashes := make([]*redis.MapStringStringCmd, len(ids))
+	logs := make([]*redis.StringSliceCmd, len(ids))
+
+	for i, id := range ids {
+		hashes[i] = pipe.HGetAll(ctx, keys.key(id))
+		logs[i] = pipe.LRange(ctx, keys.key(id, "logs"), 0, -1)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	count := 0
+
+	for i, id := range ids {
+		if len(hashes[i].Val()) == 0 {
+			continue
+		}
+
+		record := Record{Type: RecordJob, ID: id, Fields: hashes[i].Val(), State: state, Score: scores[i], Logs: logs[i].Val()}
+
+		if err := enc.Encode(record); err != nil {
+			return count, err
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+// writeSchedulers captures the scheduler definitions, scored by their next run, and those paused from taskboard
+func writeSchedulers(ctx context.Context, client *redis.Client, keys queueKeys, enc *json.Encoder) (int, error) {
+	schedulers, err := client.ZRangeWithScores(ctx, keys.key("repeat"), 0, -1).Result()
+
+	if err != nil {
+		return 0, err
+	}
+
+	paused, err := client.SMembers(ctx, keys.pausedSchedulers()).Result()
+
+	if err != nil {
+		return 0, err
+	}
+
+	records := make([]Record, 0, len(schedulers)+len(paused))
+
+	for _, scheduler := range schedulers {
+		score := scheduler.Score
+		records = append(records, Record{Type: RecordScheduler, ID: scheduler.Member.(string), Score: &score})
+	}
+
+	for _, id := range paused {
+		// Schedulers upserted by the application since they were paused are running again
+		if slices.ContainsFunc(schedulers, func(z redis.Z) bool { return z.Member == id }) {
+			continue
+		}
+
+		records = append(records, Record{Type: RecordScheduler, ID: id, Paused: true})
+	}
+
+	count := 0
+
+	for _, record := range records {
+		// Legacy repeatable jobs have no hash, their definition is encoded in the id
+		fields, err := client.HGetAll(ctx, keys.key("repeat", record.ID)).Result()
+
+		if err != nil {
+			return count, err
+		}
+
+		if len(fields) > 0 {
+			record.Fields = fields
+		}
+
+		if err := enc.Encode(record); err != nil {
+			return count, err
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+// Reader reads the records of a snapshot
+type Reader struct {
+	gz     *gzip.Reader
+	dec    *json.Decoder
+	Header Header
+}
+
+// NewReader reads the header of a snapshot and checks it can be restored
+func NewReader(r io.Reader) (*Reader, error) {
+	gz, err := gzip.NewReader(r)
+
+	if err != nil {
+		return nil, fmt.Errorf("not a snapshot: %w", err)
+	}
+
+	reader := &Reader{gz: gz, dec: json.NewDecoder(gz)}
+
+	if err := reader.dec.Decode(&reader.Header); err != nil {
+		return nil, fmt.Errorf("not a snapshot: %w", err)
+	}
+
+	if reader.Header.Format != Format {
+		return nil, fmt.Errorf("not a snapshot: unknown format %q", reader.Header.Format)
+	}
+
+	if reader.Header.Version > Version {
+		return nil, fmt.Errorf("snapshot version %d is newer than the supported version %d", reader.Header.Version, Version)
+	}
+
+	return reader, nil
+}
+
+// Next returns the next record, io.EOF once every record was read
+func (r *Reader) Next() (*Record, error) {
+	var record Record
+
+	if err := r.dec.Decode(&record); err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+func (r *Reader) Close() error {
+	return r.gz.Close()
+}
@@ -0,0 +1,222 @@
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newClient(t *testing.T) *redis.Client {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+// Delayed jobs are scored by timestamp * 0x1000 plus a counter
+const delayedScore = 1700000000000 * 0x1000
+
+// takeFixture snapshots a queue holding a flow, a parent waiting for its child, along with a delayed job,
+// a completed job and two schedulers, one of them paused from taskboard
+func takeFixture(t *testing.T) []byte {
+	t.Helper()
+
+	client := newClient(t)
+	ctx := t.Context()
+
+	client.HSet(ctx, "bull:payments:meta", "opts.maxLenEvents", "10000", "version", "bullmq:5.0.0")
+	client.HSet(ctx, "bull:payments:1", "name", "checkout", "data", "{}", "opts", "{}")
+	client.ZAdd(ctx, "bull:payments:waiting-children", redis.Z{Score: 1700000000000, Member: "1"})
+	client.HSet(ctx, "bull:payments:2", "name", "charge", "data", `{"user":42}`, "opts", "{}", "parentKey", "bull:payments:1", "parent", `{"id":"1","queueKey":"bull:payments"}`)
+	client.RPush(ctx, "bull:payments:2:logs", "charging", "retrying")
+	client.RPush(ctx, "bull:payments:wait", "2")
+	client.HSet(ctx, "bull:payments:3", "name", "charge", "data", "{}", "opts", "{}", "parentKey", "bull:orders:9", "parent", `{"id":"9","queueKey":"bull:orders"}`)
+	client.ZAdd(ctx, "bull:payments:delayed", redis.Z{Score: delayedScore, Member: "3"})
+	client.HSet(ctx, "bull:payments:4", "name", "refund", "data", "{}", "opts", "{}", "returnvalue", "true")
+	client.ZAdd(ctx, "bull:payments:completed", redis.Z{Score: 1700000001000, Member: "4"})
+	client.HSet(ctx, "bull:payments:repeat:daily", "name", "report", "pattern", "0 0 * * *")
+	client.ZAdd(ctx, "bull:payments:repeat", redis.Z{Score: 1700006400000, Member: "daily"})
+	client.HSet(ctx, "bull:payments:repeat:weekly", "name", "digest", "every", "604800000")
+	client.SAdd(ctx, "bull:payments:taskboard:paused-schedulers", "weekly")
+
+	var buf bytes.Buffer
+	summary, err := Take(ctx, client, "bull", "payments", States, &buf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int{"waiting-children": 1, "wait": 1, "delayed": 1, "completed": 1}
+
+	for state, count := range summary.Jobs {
+		if count != want[state] {
+			t.Errorf("got %d %s jobs in the snapshot, want %d", count, state, want[state])
+		}
+	}
+
+	if summary.Schedulers != 2 {
+		t.Errorf("got %d schedulers in the snapshot, want 2", summary.Schedulers)
+	}
+
+	return buf.Bytes()
+}
+
+func TestRestore(t *testing.T) {
+	snapshot := takeFixture(t)
+	client := newClient(t)
+	ctx := t.Context()
+
+	// Job 1, the parent of the flow, collides with a job of the target queue
+	client.HSet(ctx, "bull:copy:meta", "opts.maxLenEvents", "5000")
+	client.HSet(ctx, "bull:copy:1", "name", "existing", "data", "{}", "opts", "{}")
+	client.ZAdd(ctx, "bull:copy:completed", redis.Z{Score: 1, Member: "1"})
+
+	opts := RestoreOptions{Queue: "copy", DryRun: true}
+	report, err := Restore(ctx, client, bytes.NewReader(snapshot), opts)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Target != "bull:copy" || report.Collisions() != 1 || len(report.Jobs) != 4 {
+		t.Errorf("got target %s, %d jobs and %d collisions planned", report.Target, len(report.Jobs), report.Collisions())
+	}
+
+	if !slices.Contains(report.Meta, FieldChange{Field: "opts.maxLenEvents", Old: "5000", New: "10000"}) {
+		t.Errorf("got meta changes %v", report.Meta)
+	}
+
+	if !slices.Contains(report.Schedulers, SchedulerChange{ID: "weekly", Paused: true}) || !slices.Contains(report.Schedulers, SchedulerChange{ID: "daily"}) {
+		t.Errorf("got scheduler changes %v", report.Schedulers)
+	}
+
+	// Neither a dry run nor a restore refused for its collisions write anything
+	opts.DryRun = false
+
+	if report, err = Restore(ctx, client, bytes.NewReader(snapshot), opts); !errors.Is(err, ErrCollision) || report.Collisions() != 1 {
+		t.Fatalf("got %v, want ErrCollision", err)
+	}
+
+	if n, _ := client.Exists(ctx, "bull:copy:2", "bull:copy:wait", "bull:copy:repeat").Result(); n != 0 {
+		t.Fatal("a restore refused for its collisions wrote jobs")
+	}
+
+	opts.Remap = true
+
+	if report, err = Restore(ctx, client, bytes.NewReader(snapshot), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// The ids of the snapshot are taken too, the parent gets the first free id
+	parent := slices.IndexFunc(report.Jobs, func(job JobChange) bool { return job.ID == "1" })
+
+	if parent < 0 || report.Jobs[parent].NewID != "5" {
+		t.Fatalf("got %v, want job 1 remapped to 5", report.Jobs)
+	}
+
+	if name, _ := client.HGet(ctx, "bull:copy:1", "name").Result(); name != "existing" {
+		t.Error("the colliding job of the target queue was overwritten")
+	}
+
+	if name, _ := client.HGet(ctx, "bull:copy:5", "name").Result(); name != "checkout" {
+		t.Error("the remapped job wasn't restored")
+	}
+
+	if score, _ := client.ZScore(ctx, "bull:copy:waiting-children", "5").Result(); score != 1700000000000 {
+		t.Errorf("got score %v for the remapped parent waiting for its children", score)
+	}
+
+	// The child points at its remapped parent, the job whose parent is in another queue is left as it was
+	child, _ := client.HGetAll(ctx, "bull:copy:2").Result()
+
+	if child["parentKey"] != "bull:copy:5" || child["parent"] != `{"id":"5","queueKey":"bull:copy"}` {
+		t.Errorf("got parent %s and %s for the child", child["parentKey"], child["parent"])
+	}
+
+	if other, _ := client.HGetAll(ctx, "bull:copy:3").Result(); other["parentKey"] != "bull:orders:9" || other["parent"] != `{"id":"9","queueKey":"bull:orders"}` {
+		t.Errorf("got parent %s and %s for a job of another flow", other["parentKey"], other["parent"])
+	}
+
+	if logs, _ := client.LRange(ctx, "bull:copy:2:logs", 0, -1).Result(); !slices.Equal(logs, []string{"charging", "retrying"}) {
+		t.Errorf("got logs %v", logs)
+	}
+
+	if wait, _ := client.LRange(ctx, "bull:copy:wait", 0, -1).Result(); !slices.Equal(wait, []string{"2"}) {
+		t.Errorf("got %v waiting", wait)
+	}
+
+	if score, _ := client.ZScore(ctx, "bull:copy:delayed", "3").Result(); score != delayedScore {
+		t.Errorf("got score %v for the delayed job", score)
+	}
+
+	if returned, _ := client.HGet(ctx, "bull:copy:4", "returnvalue").Result(); returned != "true" {
+		t.Error("the completed job wasn't restored with its fields")
+	}
+
+	// Workers are woken up for the waiting job and the delayed job
+	markers, _ := client.ZRangeWithScores(ctx, "bull:copy:marker", 0, -1).Result()
+
+	if !slices.Equal(markers, []redis.Z{{Score: 0, Member: "0"}, {Score: 1700000000000, Member: "1"}}) {
+		t.Errorf("got markers %v", markers)
+	}
+
+	if meta, _ := client.HGetAll(ctx, "bull:copy:meta").Result(); !maps.Equal(meta, map[string]string{"opts.maxLenEvents": "10000", "version": "bullmq:5.0.0"}) {
+		t.Errorf("got meta %v", meta)
+	}
+
+	if score, _ := client.ZScore(ctx, "bull:copy:repeat", "daily").Result(); score != 1700006400000 {
+		t.Errorf("got score %v for the scheduler", score)
+	}
+
+	if paused, _ := client.SIsMember(ctx, "bull:copy:taskboard:paused-schedulers", "weekly").Result(); !paused {
+		t.Error("the paused scheduler isn't paused")
+	}
+
+	if every, _ := client.HGet(ctx, "bull:copy:repeat:weekly", "every").Result(); every != "604800000" {
+		t.Error("the paused scheduler wasn't restored with its definition")
+	}
+
+	// Jobs added later don't get the ids of restored jobs
+	if id, _ := client.Get(ctx, "bull:copy:id").Int64(); id < 5 {
+		t.Errorf("got job counter %d, want at least 5", id)
+	}
+}
+
+func TestRewriteParent(t *testing.T) {
+	remap := map[string]string{"1": "10"}
+
+	cases := []struct {
+		fields map[string]string
+		want   map[string]string
+	}{
+		{
+			map[string]string{"parentKey": "bull:payments:1", "parent": `{"id":"1","queueKey":"bull:payments"}`},
+			map[string]string{"parentKey": "bull:copy:10", "parent": `{"id":"10","queueKey":"bull:copy"}`},
+		},
+		{
+			map[string]string{"parentKey": "bull:payments:2", "parent": `{"id":"2","queueKey":"bull:payments"}`},
+			map[string]string{"parentKey": "bull:copy:2", "parent": `{"id":"2","queueKey":"bull:copy"}`},
+		},
+		// Parents in other queues, even ones the queue name is a prefix of, are left alone
+		{
+			map[string]string{"parentKey": "bull:payments-eu:1", "parent": `{"id":"1","queueKey":"bull:payments-eu"}`},
+			map[string]string{"parentKey": "bull:payments-eu:1", "parent": `{"id":"1","queueKey":"bull:payments-eu"}`},
+		},
+		{map[string]string{"parent": "not json"}, map[string]string{"parent": "not json"}},
+		{map[string]string{"name": "charge"}, map[string]string{"name": "charge"}},
+	}
+
+	for _, c := range cases {
+		if got := rewriteParent(c.fields, "bull:payments", queueKeys("bull:copy"), remap); !maps.Equal(got, c.want) {
+			t.Errorf("%v: got %v, want %v", c.fields, got, c.want)
+		}
+	}
+}
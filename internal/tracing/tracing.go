@@ -0,0 +1,156 @@
+// Package tracing exports the OpenTelemetry traces of the requests served, the scripts they run and the Redis
+// pipelines they send. Spans are dropped unless Setup installed an exporter.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+
+	ProtocolHTTP = "http"
+	ProtocolGRPC = "grpc"
+)
+
+// name is the name of the instrumentation of taskboard
+const name = "github.com/wolzey/taskboard"
+
+type Options struct {
+	// Exporter is otlp, or stdout to print the spans for local testing
+	Exporter string
+	// Endpoint is the host:port or URL of the OTLP collector, the OTEL_EXPORTER_OTLP_* variables apply when empty
+	Endpoint string
+	// Protocol is http or grpc
+	Protocol string
+	// Insecure sends the spans without TLS when Endpoint is not a URL
+	Insecure bool
+	// Headers are sent with the spans, e.g. the API key of a vendor
+	Headers     map[string]string
+	ServiceName string
+	// SampleRatio is the share of the traces started by taskboard that are kept, traces started by callers
+	// are kept when the caller sampled them
+	SampleRatio float64
+}
+
+// Tracer creates the spans of taskboard
+func Tracer() trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// StartChild starts a span under the span of ctx, the background work started outside of requests is not traced
+func StartChild(ctx context.Context, spanName string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+
+	return Tracer().Start(ctx, spanName, opts...)
+}
+
+// Validate checks the exporter and protocol of the options
+func Validate(opts Options) error {
+	if opts.Exporter != ExporterOTLP && opts.Exporter != ExporterStdout {
+		return fmt.Errorf("invalid exporter %q: must be otlp or stdout", opts.Exporter)
+	}
+
+	if opts.Protocol != ProtocolHTTP && opts.Protocol != ProtocolGRPC {
+		return fmt.Errorf("invalid protocol %q: must be http or grpc", opts.Protocol)
+	}
+
+	if opts.SampleRatio < 0 || opts.SampleRatio > 1 {
+		return fmt.Errorf("invalid sample ratio %v: must be between 0 and 1", opts.SampleRatio)
+	}
+
+	return nil
+}
+
+// Setup exports the spans with the options and propagates W3C trace contexts, shutdown exports the spans
+// not sent yet
+func Setup(ctx context.Context, opts Options) (shutdown func(context.Context) error, err error) {
+	if err := Validate(opts); err != nil {
+		return nil, err
+	}
+
+	exporter, err := newExporter(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the %s exporter: %w", opts.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(opts.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+func newExporter(ctx context.Context, opts Options) (sdktrace.SpanExporter, error) {
+	if opts.Exporter == ExporterStdout {
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+	}
+
+	isURL := strings.Contains(opts.Endpoint, "://")
+
+	if opts.Protocol == ProtocolGRPC {
+		var options []otlptracegrpc.Option
+
+		switch {
+		case isURL:
+			options = append(options, otlptracegrpc.WithEndpointURL(opts.Endpoint))
+		case opts.Endpoint != "":
+			options = append(options, otlptracegrpc.WithEndpoint(opts.Endpoint))
+		}
+
+		if opts.Insecure {
+			options = append(options, otlptracegrpc.WithInsecure())
+		}
+
+		if len(opts.Headers) > 0 {
+			options = append(options, otlptracegrpc.WithHeaders(opts.Headers))
+		}
+
+		return otlptracegrpc.New(ctx, options...)
+	}
+
+	var options []otlptracehttp.Option
+
+	switch {
+	case isURL:
+		options = append(options, otlptracehttp.WithEndpointURL(opts.Endpoint))
+	case opts.Endpoint != "":
+		options = append(options, otlptracehttp.WithEndpoint(opts.Endpoint))
+	}
+
+	if opts.Insecure {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+
+	if len(opts.Headers) > 0 {
+		options = append(options, otlptracehttp.WithHeaders(opts.Headers))
+	}
+
+	return otlptracehttp.New(ctx, options...)
+}
@@ -0,0 +1,107 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// eventsBlock is how long reads of the events streams block, the watched queues are updated in between
+	eventsBlock = 5 * time.Second
+	// eventsRetry is how long to wait before reading the streams again after a failure
+	eventsRetry = 5 * time.Second
+)
+
+// watchEvents refreshes the screen when the events streams show activity on the queues shown:
+// every queue on the queues page, the queue browsed otherwise
+func (u *UI) watchEvents(ctx context.Context) {
+	// lastIDs are the ids of the last events read from each stream
+	lastIDs := map[string]string{}
+
+	for ctx.Err() == nil {
+		u.mu.Lock()
+		names := u.queueNames
+		u.mu.Unlock()
+
+		if len(names) == 0 {
+			if !sleep(ctx, time.Second) {
+				return
+			}
+			continue
+		}
+
+		keys := make([]string, 0, len(names))
+		ids := make([]string, 0, len(names))
+
+		for _, name := range names {
+			key := u.app.QueuePrefix + ":" + name + ":events"
+
+			if _, ok := lastIDs[key]; !ok {
+				lastIDs[key] = u.lastEventID(ctx, key)
+			}
+
+			keys = append(keys, key)
+			ids = append(ids, lastIDs[key])
+		}
+
+		streams, err := u.app.Redis.XRead(ctx, &redis.XReadArgs{
+			Streams: append(keys, ids...),
+			Count:   100,
+			Block:   eventsBlock,
+		}).Result()
+
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+
+		if err != nil {
+			if !sleep(ctx, eventsRetry) {
+				return
+			}
+			continue
+		}
+
+		v := u.currentView()
+		shown := false
+
+		for _, stream := range streams {
+			if len(stream.Messages) == 0 {
+				continue
+			}
+
+			lastIDs[stream.Stream] = stream.Messages[len(stream.Messages)-1].ID
+
+			if v.page == pageQueues || stream.Stream == u.app.QueuePrefix+":"+v.queue+":events" {
+				shown = true
+			}
+		}
+
+		if shown {
+			u.refresh()
+		}
+	}
+}
+
+// lastEventID is the id of the newest event of a stream, events after it are read
+func (u *UI) lastEventID(ctx context.Context, key string) string {
+	messages, err := u.app.Redis.XRevRangeN(ctx, key, "+", "-", 1).Result()
+
+	if err != nil || len(messages) == 0 {
+		return "0-0"
+	}
+
+	return messages[0].ID
+}
+
+// sleep waits for d, it returns false when ctx is done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
@@ -0,0 +1,260 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// hints are the key bindings shown in the status bar of each page
+var hints = map[string]string{
+	pageQueues: "[yellow]enter[-] jobs  [yellow]P[-] pause/resume  [yellow]q[-] quit",
+	pageJobs:   "[yellow]enter[-] job  [yellow]←→[-] state  [yellow]n/b[-] page  [yellow]p[-] promote  [yellow]r[-] retry  [yellow]d[-] delete  [yellow]P[-] pause  [yellow]esc[-] back",
+	pageJob:    "[yellow]↑↓[-] scroll  [yellow]p[-] promote  [yellow]r[-] retry  [yellow]d[-] delete  [yellow]P[-] pause/resume  [yellow]esc[-] back",
+}
+
+func (u *UI) showHints(page string) {
+	u.hints.SetText(hints[page])
+}
+
+// setMessage shows the outcome of an action in the status bar
+func (u *UI) setMessage(failed bool, message string) {
+	color := "green"
+	if failed {
+		color = "red"
+	}
+
+	u.message.SetText(fmt.Sprintf("[%s]%s[-]", color, tview.Escape(message)))
+}
+
+func (u *UI) handleKey(event *tcell.EventKey) *tcell.EventKey {
+	// The confirmation dialog handles its own keys
+	if name, _ := u.pages.GetFrontPage(); name == pageConfirm {
+		return event
+	}
+
+	v := u.currentView()
+
+	switch event.Key() {
+	case tcell.KeyEscape:
+		switch v.page {
+		case pageJobs:
+			u.navigate(view{page: pageQueues})
+		case pageJob:
+			v.page, v.jobID = pageJobs, ""
+			u.navigate(v)
+		}
+		return nil
+	case tcell.KeyLeft, tcell.KeyRight, tcell.KeyTab, tcell.KeyBacktab:
+		if v.page != pageJobs {
+			return event
+		}
+
+		step := 1
+		if event.Key() == tcell.KeyLeft || event.Key() == tcell.KeyBacktab {
+			step = len(states) - 1
+		}
+
+		i := slices.Index(states, v.state)
+		v.state, v.cursor = states[(i+step)%len(states)], ""
+		u.navigate(v)
+		return nil
+	case tcell.KeyRune:
+	default:
+		return event
+	}
+
+	switch event.Rune() {
+	case 'q':
+		u.tv.Stop()
+	case 'P':
+		u.togglePause(v)
+	case 'n', 'b':
+		if v.page != pageJobs || u.lastJobs == nil {
+			return event
+		}
+
+		cursor := u.lastJobs.Next
+		if event.Rune() == 'b' {
+			cursor = u.lastJobs.Prev
+		}
+
+		if cursor == "" {
+			u.setMessage(false, "No more pages")
+			return nil
+		}
+
+		v.cursor = cursor
+		u.navigate(v)
+	case 'p':
+		u.promoteJob(v, []string{"delayed", "waiting-children"}, "Only delayed and waiting-children jobs can be promoted")
+	case 'r':
+		u.promoteJob(v, []string{"failed", "completed"}, "Only failed and completed jobs can be retried")
+	case 'd':
+		u.deleteJob(v)
+	default:
+		return event
+	}
+
+	return nil
+}
+
+// selectedJob is the job shown, or the one selected in the jobs list
+func (u *UI) selectedJob(v view) string {
+	switch v.page {
+	case pageJob:
+		return v.jobID
+	case pageJobs:
+		row, _ := u.jobs.GetSelection()
+		id, _ := u.jobs.GetCell(row, 0).GetReference().(string)
+		return id
+	}
+
+	return ""
+}
+
+// promoteJob moves the selected job to wait when it is in one of fromStates, which promotes or retries it
+func (u *UI) promoteJob(v view, fromStates []string, invalid string) {
+	id := u.selectedJob(v)
+
+	if id == "" {
+		return
+	}
+
+	if !slices.Contains(fromStates, v.state) {
+		u.setMessage(true, invalid)
+		return
+	}
+
+	u.run(func(ctx context.Context) (string, error) {
+		res, err := u.app.PromoteJob(ctx, v.queue, id, v.state)
+
+		if err != nil {
+			return "", err
+		}
+
+		if !res.Success {
+			return "", fmt.Errorf("%s", res.Message)
+		}
+
+		return res.Message, nil
+	}, u.backToJobs(v))
+}
+
+// backToJobs returns to the jobs list once the job shown left its state
+func (u *UI) backToJobs(v view) func() {
+	return func() {
+		if current := u.currentView(); current == v && v.page == pageJob {
+			v.page, v.jobID = pageJobs, ""
+			u.navigate(v)
+		}
+	}
+}
+
+func (u *UI) deleteJob(v view) {
+	id := u.selectedJob(v)
+
+	if id == "" {
+		return
+	}
+
+	u.confirm(fmt.Sprintf("Delete job %s of %s?", id, v.queue), "Delete", func() {
+		u.run(func(ctx context.Context) (string, error) {
+			res, err := u.app.DeleteJob(ctx, v.queue, id)
+
+			if err != nil {
+				return "", err
+			}
+
+			if !res.Success {
+				return "", fmt.Errorf("%s", res.Message)
+			}
+
+			return res.Message, nil
+		}, u.backToJobs(v))
+	})
+}
+
+// togglePause pauses the queue shown or selected, or resumes it when it is paused
+func (u *UI) togglePause(v view) {
+	queue := v.queue
+
+	if v.page == pageQueues {
+		row, _ := u.queues.GetSelection()
+		queue, _ = u.queues.GetCell(row, 0).GetReference().(string)
+	}
+
+	if queue == "" {
+		return
+	}
+
+	u.run(func(ctx context.Context) (string, error) {
+		paused, err := u.app.IsQueuePaused(ctx, queue)
+
+		if err != nil {
+			return "", err
+		}
+
+		toggle := u.app.PauseQueue
+		if paused {
+			toggle = u.app.ResumeQueue
+		}
+
+		res, err := toggle(ctx, queue)
+
+		if err != nil {
+			return "", err
+		}
+
+		return res.Message, nil
+	}, nil)
+}
+
+// run runs an action outside of the UI goroutine, then shows its outcome and refreshes the screen.
+// done is called on the UI goroutine when the action succeeded.
+func (u *UI) run(action func(ctx context.Context) (string, error), done func()) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), actionTimeout)
+		defer cancel()
+
+		message, err := action(ctx)
+
+		u.tv.QueueUpdateDraw(func() {
+			if err != nil {
+				u.setMessage(true, err.Error())
+				return
+			}
+
+			u.setMessage(false, message)
+
+			if done != nil {
+				done()
+			}
+		})
+
+		u.refresh()
+	}()
+}
+
+// confirm asks to confirm an action in a dialog, focus goes back to the page when it is closed
+func (u *UI) confirm(question string, button string, confirmed func()) {
+	focused := u.tv.GetFocus()
+
+	modal := tview.NewModal().
+		SetText(question).
+		AddButtons([]string{button, "Cancel"}).
+		SetDoneFunc(func(index int, label string) {
+			u.pages.RemovePage(pageConfirm)
+			u.tv.SetFocus(focused)
+
+			if label == button {
+				confirmed()
+			}
+		})
+
+	u.pages.AddPage(pageConfirm, modal, false, true)
+	u.tv.SetFocus(modal)
+}
@@ -0,0 +1,485 @@
+// Package tui is a full screen terminal dashboard to browse queues and act on their jobs.
+//
+// The dashboard has three pages: the queues with their counts, the jobs of a state of a queue, and the
+// details of a job. Data is read by a refresh loop, outside of the UI goroutine, whenever the events
+// streams of the queues show activity, when the view changes, and at a regular interval otherwise.
+package tui
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/wolzey/taskboard/internal/app"
+	"github.com/wolzey/taskboard/internal/scripts"
+)
+
+const (
+	pageQueues  = "queues"
+	pageJobs    = "jobs"
+	pageJob     = "job"
+	pageConfirm = "confirm"
+
+	jobsPageSize = 100
+	// minRefresh bounds how often the screen is refreshed, busy queues emit events continuously
+	minRefresh = 500 * time.Millisecond
+	// pollInterval refreshes the screen when no event comes, e.g. to show new queues
+	pollInterval = 5 * time.Second
+	// actionTimeout bounds the reads of a refresh and the actions run on jobs
+	actionTimeout = 10 * time.Second
+)
+
+// states are the columns of the queues page and the tabs of the jobs page
+var states = []string{"wait", "paused", "prioritized", "delayed", "active", "waiting-children", "completed", "failed"}
+
+// stateLabels shorten the longest states so every column fits in 80 characters
+var stateLabels = map[string]string{
+	"prioritized":      "prio",
+	"waiting-children": "children",
+}
+
+func stateLabel(state string) string {
+	if label, ok := stateLabels[state]; ok {
+		return label
+	}
+
+	return state
+}
+
+// view is what the screen shows, it is read by the refresh loop
+type view struct {
+	page   string
+	queue  string
+	state  string
+	cursor string
+	jobID  string
+}
+
+type queueRow struct {
+	name   string
+	paused bool
+	counts map[string]int64
+}
+
+// snapshot is the data read for a view
+type snapshot struct {
+	view   view
+	queues []queueRow
+	jobs   *app.ListJobsResponse
+	job    *app.ParsedJobResponse
+	err    error
+}
+
+type UI struct {
+	app *app.App
+	tv  *tview.Application
+
+	pages     *tview.Pages
+	queues    *tview.Table
+	stateTabs *tview.TextView
+	jobs      *tview.Table
+	job       *tview.TextView
+	hints     *tview.TextView
+	message   *tview.TextView
+
+	mu   sync.Mutex
+	view view
+	// queueNames are the queues whose events are watched
+	queueNames []string
+
+	refreshes chan struct{}
+	// rows and lastJobs are the queues and jobs shown, they are only used on the UI goroutine
+	rows     []queueRow
+	lastJobs *app.ListJobsResponse
+}
+
+func New(a *app.App) *UI {
+	u := &UI{
+		app:       a,
+		tv:        tview.NewApplication(),
+		pages:     tview.NewPages(),
+		queues:    tview.NewTable(),
+		stateTabs: tview.NewTextView(),
+		jobs:      tview.NewTable(),
+		job:       tview.NewTextView(),
+		hints:     tview.NewTextView(),
+		message:   tview.NewTextView(),
+		view:      view{page: pageQueues},
+		refreshes: make(chan struct{}, 1),
+	}
+
+	u.queues.SetSelectable(true, false).SetFixed(1, 0).SetBorder(true).SetTitle(" Queues ")
+	u.queues.SetSelectedFunc(func(row int, column int) {
+		if name, ok := u.queues.GetCell(row, 0).GetReference().(string); ok {
+			u.navigate(view{page: pageJobs, queue: name, state: "wait"})
+		}
+	})
+
+	u.stateTabs.SetDynamicColors(true)
+	u.jobs.SetSelectable(true, false).SetFixed(1, 0).SetBorder(true)
+	u.jobs.SetSelectedFunc(func(row int, column int) {
+		if id, ok := u.jobs.GetCell(row, 0).GetReference().(string); ok {
+			v := u.currentView()
+			v.page, v.jobID = pageJob, id
+			u.navigate(v)
+		}
+	})
+
+	u.job.SetDynamicColors(true).SetScrollable(true).SetWrap(true).SetBorder(true)
+
+	u.hints.SetDynamicColors(true)
+	u.message.SetDynamicColors(true).SetTextAlign(tview.AlignRight)
+
+	jobsPage := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(u.stateTabs, 1, 0, false).
+		AddItem(u.jobs, 0, 1, true)
+
+	u.pages.AddPage(pageQueues, u.queues, true, true)
+	u.pages.AddPage(pageJobs, jobsPage, true, false)
+	u.pages.AddPage(pageJob, u.job, true, false)
+
+	title := tview.NewTextView().SetDynamicColors(true).
+		SetText(fmt.Sprintf("[::b]taskboard[::-]  prefix %s  %s", tview.Escape(a.QueuePrefix), tview.Escape(a.Redis.Options().Addr)))
+
+	// Messages share the top line with the title, key bindings take the whole bottom line
+	top := tview.NewFlex().
+		AddItem(title, 0, 1, false).
+		AddItem(u.message, 0, 1, false)
+
+	root := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(top, 1, 0, false).
+		AddItem(u.pages, 0, 1, true).
+		AddItem(u.hints, 1, 0, false)
+
+	u.tv.SetRoot(root, true).SetInputCapture(u.handleKey)
+	u.showHints(pageQueues)
+
+	return u
+}
+
+// Run shows the dashboard until it is quit
+func (u *UI) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go u.refreshLoop(ctx)
+	go u.watchEvents(ctx)
+
+	go func() {
+		<-ctx.Done()
+		u.tv.Stop()
+	}()
+
+	u.refresh()
+
+	return u.tv.Run()
+}
+
+func (u *UI) currentView() view {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.view
+}
+
+// refresh asks the refresh loop to read the data of the current view
+func (u *UI) refresh() {
+	select {
+	case u.refreshes <- struct{}{}:
+	default:
+	}
+}
+
+func (u *UI) refreshLoop(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-u.refreshes:
+		case <-ticker.C:
+		}
+
+		snap := u.load(ctx, u.currentView())
+		u.tv.QueueUpdateDraw(func() { u.apply(snap) })
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(minRefresh):
+		}
+	}
+}
+
+// load reads the counts of every queue and the data of the page shown
+func (u *UI) load(ctx context.Context, v view) snapshot {
+	ctx, cancel := context.WithTimeout(ctx, actionTimeout)
+	defer cancel()
+
+	snap := snapshot{view: v}
+
+	names, err := u.app.ListQueues(ctx)
+
+	if err != nil {
+		snap.err = fmt.Errorf("failed to list queues: %w", err)
+		return snap
+	}
+
+	u.mu.Lock()
+	u.queueNames = names
+	u.mu.Unlock()
+
+	for _, name := range names {
+		row := queueRow{name: name, counts: map[string]int64{}}
+
+		counts, err := u.app.Redis.Scripts.GetJobCounts(ctx, scripts.Queue{Prefix: u.app.QueuePrefix, Name: name}, states)
+
+		if err != nil {
+			snap.err = fmt.Errorf("failed to count the jobs of %s: %w", name, err)
+			return snap
+		}
+
+		for i, state := range states {
+			row.counts[state] = counts[i]
+		}
+
+		if row.paused, err = u.app.IsQueuePaused(ctx, name); err != nil {
+			snap.err = err
+			return snap
+		}
+
+		snap.queues = append(snap.queues, row)
+	}
+
+	switch v.page {
+	case pageJobs:
+		snap.jobs, snap.err = u.app.ListJobs(ctx, v.queue, v.state, app.ListJobsOptions{Limit: jobsPageSize, Cursor: v.cursor})
+	case pageJob:
+		snap.job, snap.err = u.app.GetJobDetails(ctx, v.queue, v.jobID)
+	}
+
+	return snap
+}
+
+// apply shows a snapshot, the pages of another view than the current one are left as they are
+func (u *UI) apply(snap snapshot) {
+	if snap.err != nil {
+		u.setMessage(true, snap.err.Error())
+	}
+
+	current := u.currentView()
+
+	if snap.queues != nil {
+		u.rows = snap.queues
+		u.showQueues()
+	}
+
+	if snap.view != current {
+		return
+	}
+
+	switch current.page {
+	case pageJobs:
+		u.showStateTabs(current)
+
+		if snap.jobs != nil {
+			u.lastJobs = snap.jobs
+			u.showJobs(current, snap.jobs)
+		}
+	case pageJob:
+		if snap.job != nil {
+			u.showJob(current, snap.job)
+		}
+	}
+}
+
+// navigate switches to the page of a view, its data is shown once the refresh loop read it
+func (u *UI) navigate(v view) {
+	u.mu.Lock()
+	previous := u.view
+	u.view = v
+	u.mu.Unlock()
+
+	switch v.page {
+	case pageQueues:
+		u.pages.SwitchToPage(pageQueues)
+		u.tv.SetFocus(u.queues)
+	case pageJobs:
+		if previous.page != pageJob || previous.queue != v.queue || previous.state != v.state || previous.cursor != v.cursor {
+			u.jobs.Clear()
+			u.jobs.SetTitle(fmt.Sprintf(" %s: %s ", tview.Escape(v.queue), v.state))
+		}
+
+		u.showStateTabs(v)
+		u.pages.SwitchToPage(pageJobs)
+		u.tv.SetFocus(u.jobs)
+	case pageJob:
+		u.job.Clear()
+		u.job.SetTitle(fmt.Sprintf(" %s: job %s ", tview.Escape(v.queue), tview.Escape(v.jobID)))
+		u.pages.SwitchToPage(pageJob)
+		u.tv.SetFocus(u.job)
+	}
+
+	u.showHints(v.page)
+	u.refresh()
+}
+
+func (u *UI) showQueues() {
+	selected := ""
+	if row, _ := u.queues.GetSelection(); row > 0 {
+		selected, _ = u.queues.GetCell(row, 0).GetReference().(string)
+	}
+
+	u.queues.Clear()
+	u.queues.SetCell(0, 0, headerCell("QUEUE"))
+	u.queues.SetCell(0, 1, headerCell("STATUS"))
+
+	for i, state := range states {
+		u.queues.SetCell(0, i+2, headerCell(strings.ToUpper(stateLabel(state))).SetAlign(tview.AlignRight))
+	}
+
+	for r, row := range u.rows {
+		status := "[green]running"
+		if row.paused {
+			status = "[yellow]paused"
+		}
+
+		u.queues.SetCell(r+1, 0, tview.NewTableCell(tview.Escape(row.name)).SetReference(row.name).SetExpansion(1))
+		u.queues.SetCell(r+1, 1, tview.NewTableCell(status))
+
+		for i, state := range states {
+			cell := tview.NewTableCell(strconv.FormatInt(row.counts[state], 10)).SetAlign(tview.AlignRight)
+
+			if state == "failed" && row.counts[state] > 0 {
+				cell.SetTextColor(tcell.ColorRed)
+			}
+
+			u.queues.SetCell(r+1, i+2, cell)
+		}
+
+		if row.name == selected {
+			u.queues.Select(r+1, 0)
+		}
+	}
+
+	if len(u.rows) == 0 {
+		u.queues.SetCell(1, 0, tview.NewTableCell("No queues found").SetSelectable(false))
+	}
+}
+
+func (u *UI) showStateTabs(v view) {
+	var counts map[string]int64
+
+	if i := slices.IndexFunc(u.rows, func(row queueRow) bool { return row.name == v.queue }); i >= 0 {
+		counts = u.rows[i].counts
+	}
+
+	tabs := make([]string, len(states))
+
+	for i, state := range states {
+		tabs[i] = fmt.Sprintf("%s:%d", stateLabel(state), counts[state])
+
+		if state == v.state {
+			tabs[i] = "[black:white]" + tabs[i] + "[-:-]"
+		}
+	}
+
+	u.stateTabs.SetText(strings.Join(tabs, " "))
+}
+
+func (u *UI) showJobs(v view, res *app.ListJobsResponse) {
+	selected := ""
+	if row, _ := u.jobs.GetSelection(); row > 0 {
+		selected, _ = u.jobs.GetCell(row, 0).GetReference().(string)
+	}
+
+	u.jobs.Clear()
+	u.jobs.SetTitle(fmt.Sprintf(" %s: %s, %d jobs ", tview.Escape(v.queue), v.state, res.Count))
+
+	for i, header := range []string{"ID", "NAME", "ATTEMPTS", "CREATED", "PROCESSED", "FAILED REASON"} {
+		u.jobs.SetCell(0, i, headerCell(header))
+	}
+
+	for r, job := range res.Results {
+		u.jobs.SetCell(r+1, 0, tview.NewTableCell(tview.Escape(job.ID)).SetReference(job.ID))
+		u.jobs.SetCell(r+1, 1, tview.NewTableCell(tview.Escape(job.Name)))
+		u.jobs.SetCell(r+1, 2, tview.NewTableCell(strconv.Itoa(job.AttemptsMade)).SetAlign(tview.AlignRight))
+		u.jobs.SetCell(r+1, 3, tview.NewTableCell(formatTimestamp(job.Timestamp)))
+		u.jobs.SetCell(r+1, 4, tview.NewTableCell(formatTimestamp(strconv.FormatInt(job.ProcessedOn, 10))))
+		u.jobs.SetCell(r+1, 5, tview.NewTableCell(tview.Escape(job.FailedReason)).SetMaxWidth(80).SetExpansion(1))
+
+		if job.ID == selected {
+			u.jobs.Select(r+1, 0)
+		}
+	}
+
+	if len(res.Results) == 0 {
+		u.jobs.SetCell(1, 0, tview.NewTableCell("No jobs").SetSelectable(false))
+	}
+}
+
+func (u *UI) showJob(v view, job *app.ParsedJobResponse) {
+	var text strings.Builder
+
+	field := func(name string, value string) {
+		fmt.Fprintf(&text, "[::b]%-14s[::-]%s\n", name, tview.Escape(value))
+	}
+
+	field("Name", job.Name)
+	field("State", v.state)
+	field("Created", formatTimestamp(job.Timestamp))
+	field("Processed", formatTimestamp(strconv.FormatInt(job.ProcessedOn, 10)))
+	field("Attempts", strconv.Itoa(job.AttemptsMade))
+	field("Priority", strconv.Itoa(job.Priority))
+	field("Delay", strconv.Itoa(job.Delay))
+
+	if job.FailedReason != "" {
+		fmt.Fprintf(&text, "[::b]%-14s[::-][red]%s[-]\n", "Failed reason", tview.Escape(job.FailedReason))
+	}
+
+	section := func(title string, value any) {
+		pretty, err := json.MarshalIndent(value, "", "  ")
+
+		if err != nil {
+			pretty = []byte(err.Error())
+		}
+
+		fmt.Fprintf(&text, "\n[::b]%s[::-]\n%s\n", title, tview.Escape(string(pretty)))
+	}
+
+	section("Data", job.Data)
+	section("Options", job.Options)
+
+	// The stack of the last attempt is shown first
+	for i := len(job.StackTrace) - 1; i >= 0; i-- {
+		fmt.Fprintf(&text, "\n[::b]Stack trace, attempt %d[::-]\n[red]%s[-]\n", i+1, tview.Escape(job.StackTrace[i]))
+	}
+
+	row, _ := u.job.GetScrollOffset()
+	u.job.SetText(text.String())
+	u.job.ScrollTo(row, 0)
+}
+
+func headerCell(text string) *tview.TableCell {
+	return tview.NewTableCell(text).SetSelectable(false).SetAttributes(tcell.AttrBold).SetTextColor(tcell.ColorYellow)
+}
+
+// formatTimestamp formats the unix milliseconds BullMQ stores, which may be written as floats
+func formatTimestamp(value string) string {
+	millis, err := strconv.ParseFloat(value, 64)
+
+	if err != nil || millis <= 0 {
+		return "-"
+	}
+
+	return time.UnixMilli(int64(millis)).Format("2006-01-02 15:04:05")
+}
@@ -0,0 +1,332 @@
+// taskboard UI: an overview of the queues, the jobs of each state and the details of a job.
+// Pages are routed with the URL fragment and the API is called with paths relative to the page,
+// which keeps the UI working under the sub-path of a reverse proxy.
+(function () {
+  "use strict";
+
+  // states are the tabs of a queue, counts are only known for the ones of the overview
+  var states = ["wait", "active", "delayed", "prioritized", "waiting-children", "paused", "completed", "failed"];
+  var countedStates = ["wait", "active", "delayed", "completed", "failed"];
+  // promoteStates and retryStates are the states jobs can be moved to wait from
+  var promoteStates = ["delayed", "waiting-children"];
+  var retryStates = ["failed", "completed"];
+
+  var pageSize = 25;
+  var refreshInterval = 5000;
+
+  var main = document.getElementById("main");
+  var crumbs = document.getElementById("crumbs");
+  var status = document.getElementById("status");
+  var timer = null;
+  // flash is the outcome of an action, shown once the page it navigated to is rendered
+  var flash = null;
+
+  // el creates an element, strings and numbers among children become text nodes
+  function el(tag, attrs) {
+    var node = document.createElement(tag);
+
+    Object.keys(attrs || {}).forEach(function (name) {
+      var value = attrs[name];
+
+      if (value === null || value === undefined || value === false) {
+        return;
+      }
+
+      if (name.indexOf("on") === 0) {
+        node.addEventListener(name.slice(2), value);
+      } else {
+        node.setAttribute(name, value === true ? "" : value);
+      }
+    });
+
+    for (var i = 2; i < arguments.length; i++) {
+      append(node, arguments[i]);
+    }
+
+    return node;
+  }
+
+  function append(node, child) {
+    if (child === null || child === undefined || child === false) {
+      return;
+    }
+
+    if (Array.isArray(child)) {
+      child.forEach(function (c) { append(node, c); });
+      return;
+    }
+
+    node.appendChild(typeof child === "object" ? child : document.createTextNode(String(child)));
+  }
+
+  function api(method, path, body) {
+    var init = { method: method, headers: { Accept: "application/json" } };
+
+    if (body !== undefined) {
+      init.headers["Content-Type"] = "application/json";
+      init.body = JSON.stringify(body);
+    }
+
+    return fetch("api/" + path, init).then(function (res) {
+      return res.json().catch(function () { return {}; }).then(function (json) {
+        if (!res.ok && !("success" in json)) {
+          throw new Error(json.message || res.status + " " + res.statusText);
+        }
+
+        return json;
+      });
+    });
+  }
+
+  function segment(value) {
+    return encodeURIComponent(value);
+  }
+
+  function href(parts, params) {
+    var path = "#/" + parts.map(segment).join("/");
+    var query = new URLSearchParams(params || {}).toString();
+
+    return query ? path + "?" + query : path;
+  }
+
+  // show replaces the content of the page
+  function show() {
+    main.replaceChildren();
+
+    for (var i = 0; i < arguments.length; i++) {
+      append(main, arguments[i]);
+    }
+  }
+
+  function setStatus(message, failed) {
+    status.textContent = message || "";
+    status.className = message ? (failed ? "error" : "ok") : "";
+  }
+
+  function setCrumbs(links) {
+    crumbs.replaceChildren();
+
+    links.forEach(function (link, i) {
+      if (i > 0) {
+        append(crumbs, el("span", null, "/"));
+      }
+
+      append(crumbs, el("a", { href: link[1] }, link[0]));
+    });
+  }
+
+  function formatTime(millis) {
+    var value = Number(millis);
+
+    if (!value || value <= 0) {
+      return "-";
+    }
+
+    return new Date(value).toLocaleString();
+  }
+
+  function pretty(value) {
+    return JSON.stringify(value === undefined ? null : value, null, 2);
+  }
+
+  // route parses the fragment into its decoded path segments and query parameters
+  function route() {
+    var hash = location.hash.replace(/^#\/?/, "");
+    var i = hash.indexOf("?");
+    var path = i < 0 ? hash : hash.slice(0, i);
+
+    return {
+      parts: path ? path.split("/").map(decodeURIComponent) : [],
+      params: new URLSearchParams(i < 0 ? "" : hash.slice(i + 1)),
+    };
+  }
+
+  function render() {
+    var r = route();
+    var p = r.parts;
+
+    clearTimeout(timer);
+
+    var page;
+
+    if (p[0] === "queues" && p.length === 4 && p[2] === "job") {
+      page = showJob(p[1], p[3], r.params.get("state") || "");
+    } else if (p[0] === "queues" && (p.length === 2 || p.length === 3)) {
+      page = showQueue(p[1], p[2] || "wait", r.params);
+    } else {
+      page = showOverview();
+    }
+
+    page.catch(function (err) {
+      show(el("p", { class: "empty" }, err.message));
+      setStatus(err.message, true);
+      poll();
+    });
+  }
+
+  // poll renders the page again unless the route changed in between
+  function poll() {
+    var hash = location.hash;
+
+    clearTimeout(timer);
+    timer = setTimeout(function () {
+      if (location.hash === hash) {
+        render();
+      }
+    }, refreshInterval);
+  }
+
+  function showOverview() {
+    setCrumbs([]);
+
+    return api("GET", "overview").then(function (counts) {
+      var names = Object.keys(counts).sort();
+
+      show(
+        el("h1", null, "Queues"),
+        names.length === 0 ? el("p", { class: "empty" }, "No queues found.") : el("div", { class: "grid" }, names.map(function (name) {
+          return el("div", { class: "card" },
+            el("h3", null, el("a", { href: href(["queues", name]) }, name)),
+            el("div", { class: "counts" }, countedStates.map(function (state) {
+              return el("a", { href: href(["queues", name, state]), class: state },
+                el("b", null, counts[name][state] || 0),
+                el("small", null, state));
+            })));
+        })));
+
+      poll();
+    });
+  }
+
+  function showQueue(queue, state, params) {
+    setCrumbs([[queue, href(["queues", queue])]]);
+
+    var query = new URLSearchParams({ limit: pageSize });
+
+    if (params.get("cursor")) {
+      query.set("cursor", params.get("cursor"));
+    }
+
+    var path = "queues/" + segment(queue);
+
+    return Promise.all([
+      api("GET", path),
+      api("GET", path + "/jobs/" + segment(state) + "?" + query.toString()),
+    ]).then(function (results) {
+      var counts = results[0].counts || {};
+      var jobs = results[1];
+      var rows = jobs.results || [];
+
+      var prev = jobs.prev ? { cursor: jobs.prev } : null;
+      var next = jobs.next ? { cursor: jobs.next } : null;
+
+      function page(params) {
+        return function () { location.hash = href(["queues", queue, state], params); };
+      }
+
+      show(
+        el("h1", null, queue),
+        el("div", { class: "tabs" }, states.map(function (s) {
+          return el("a", { href: href(["queues", queue, s]), class: s === state ? "selected" : null },
+            s, s in counts ? el("small", null, counts[s]) : null);
+        })),
+        rows.length === 0 ? el("p", { class: "empty" }, "No " + state + " jobs.") : el("table", null,
+          el("thead", null, el("tr", null, ["ID", "Name", "Attempts", "Created", "Processed", "Failed reason"].map(function (h) {
+            return el("th", null, h);
+          }))),
+          el("tbody", null, rows.map(function (job) {
+            return el("tr", null,
+              el("td", null, el("a", { href: href(["queues", queue, "job", job.id], { state: state }) }, job.id)),
+              el("td", null, job.name),
+              el("td", null, job.attempts_made),
+              el("td", null, formatTime(job.timestamp)),
+              el("td", null, formatTime(job.processed_on)),
+              el("td", { class: "reason", title: job.failed_reason || null }, job.failed_reason || ""));
+          }))),
+        el("div", { class: "pager" },
+          el("button", { disabled: !prev, onclick: page(prev) }, "Previous"),
+          el("button", { disabled: !next, onclick: page(next) }, "Next"),
+          el("span", null, rows.length + " of " + jobs.count + " jobs")));
+
+      poll();
+    });
+  }
+
+  function showJob(queue, id, state) {
+    setCrumbs([[queue, href(["queues", queue])], [state || "job", href(["queues", queue, state || "wait"])]]);
+
+    return api("GET", "queues/" + segment(queue) + "/" + segment(id)).then(function (job) {
+      var back = href(["queues", queue, state || "wait"]);
+      var actions = [];
+
+      if (promoteStates.indexOf(state) >= 0) {
+        actions.push(el("button", { class: "primary", onclick: function () { promote(queue, id, state, back); } }, "Promote"));
+      }
+
+      if (retryStates.indexOf(state) >= 0) {
+        actions.push(el("button", { class: "primary", onclick: function () { promote(queue, id, state, back); } }, "Retry"));
+      }
+
+      actions.push(el("button", { class: "danger", onclick: function () { remove(queue, id, back); } }, "Delete"));
+
+      var stack = (job.stacktrace || []).slice().reverse();
+
+      show(
+        el("h1", null, (job.name || "job") + " #" + id),
+        el("div", { class: "actions" }, actions),
+        el("div", { class: "card" }, el("dl", null,
+          el("dt", null, "State"), el("dd", null, state || "-"),
+          el("dt", null, "Attempts"), el("dd", null, job.attempts_made),
+          el("dt", null, "Priority"), el("dd", null, job.priority),
+          el("dt", null, "Delay"), el("dd", null, job.delay ? job.delay + " ms" : "-"),
+          el("dt", null, "Created"), el("dd", null, formatTime(job.timestamp)),
+          el("dt", null, "Processed"), el("dd", null, formatTime(job.processed_on)),
+          el("dt", null, "Finished"), el("dd", null, formatTime(job.finished_on)),
+          job.failed_reason ? [el("dt", null, "Failed reason"), el("dd", null, job.failed_reason)] : null)),
+        el("h2", null, "Data"),
+        el("pre", null, pretty(job.data)),
+        el("h2", null, "Options"),
+        el("pre", null, pretty(job.options)),
+        stack.length ? [el("h2", null, "Stack traces"), stack.map(function (trace) { return el("pre", null, trace); })] : null);
+    });
+  }
+
+  // promote moves the job to wait, then shows the state it left
+  function promote(queue, id, state, back) {
+    api("POST", "queues/" + segment(queue) + "/" + segment(id) + "/promote", { fromState: state }).then(function (res) {
+      done(res, back);
+    }).catch(function (err) {
+      setStatus(err.message, true);
+    });
+  }
+
+  function remove(queue, id, back) {
+    if (!confirm("Delete job " + id + " of " + queue + "?")) {
+      return;
+    }
+
+    api("DELETE", "queues/" + segment(queue) + "/" + segment(id)).then(function (res) {
+      done(res, back);
+    }).catch(function (err) {
+      setStatus(err.message, true);
+    });
+  }
+
+  function done(res, back) {
+    if (!res.success) {
+      setStatus(res.message, true);
+      return;
+    }
+
+    flash = res.message;
+    location.hash = back;
+  }
+
+  window.addEventListener("hashchange", function () {
+    setStatus(flash, false);
+    flash = null;
+    render();
+  });
+
+  render();
+})();
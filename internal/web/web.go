@@ -0,0 +1,27 @@
+// Package web embeds the single page UI served by the API.
+//
+// The UI is plain HTML, CSS and JavaScript without a build step or external resources, so it works
+// offline. It routes with the URL fragment and calls the API with paths relative to the page, so the
+// same files work at the root and under the sub-path of a reverse proxy.
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed static
+var static embed.FS
+
+// Files are the files of the UI, index.html at the root
+var Files fs.FS
+
+func init() {
+	sub, err := fs.Sub(static, "static")
+
+	if err != nil {
+		panic(err)
+	}
+
+	Files = sub
+}